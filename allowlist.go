@@ -0,0 +1,84 @@
+/*! \file allowlist.go
+    \brief Keeping firewall rules and cloud flare ip access rules in line with the allowlists in the config, with -allowsync from cron
+*/
+
+package main
+
+import (
+    "fmt"
+    "sort"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief An allowlist from the config, where its addresses come from and what's kept in line with them
+ */
+type allowlist_t struct {
+    Source      string  `json:"source"`    //file, url, 'github:actions' or 'cloudflare'
+    Firewall    string  `json:"firewall,omitempty"`  //digital ocean firewall the inbound rule is on
+    Protocol    string  `json:"protocol,omitempty"`  //for the firewall rule, tcp when it's not set
+    Ports       string  `json:"ports,omitempty"`     //for the firewall rule, ie '22' or '443'
+    CloudFlare  bool    `json:"cloudflare,omitempty"`    //ip access rules on the zone from -d, or the config's default zone
+}
+
+type allowlist_change_t struct {
+    List        string  `json:"list"`
+    Target      string  `json:"target"`
+    Change      string  `json:"change"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Syncs the named allowlist, or every one in the config for 'all'.  A list that can't be fetched stops it before anything changes
+ */
+func syncAllowlists (name string, lists map[string]allowlist_t, dryRun bool, do libraries.DO_c, cf libraries.CF_c) ([]allowlist_change_t, error) {
+    names := make([]string, 0)
+    if name == "all" {
+        for n := range(lists) { names = append(names, n) }
+        sort.Strings(names)
+    } else if _, ok := lists[name]; ok {
+        names = append(names, name)
+    }
+    if len(names) == 0 { return nil, fmt.Errorf("Allowlist '%s' not found in the allowlists of the config", name) }
+
+    addrs := make(map[string][]string)
+    for _, n := range(names) {
+        list := lists[n]
+        if len(list.Firewall) == 0 && !list.CloudFlare { return nil, fmt.Errorf("Allowlist '%s' needs a firewall or cloudflare to sync to", n) }
+        if len(list.Firewall) > 0 && len(list.Ports) == 0 { return nil, fmt.Errorf("Allowlist '%s' needs the ports its firewall rule is for", n) }
+        if list.CloudFlare && len(cf.Config.APIKey) < 1 { return nil, fmt.Errorf("Cannot use CloudFlare without the api_key set in the harbormaster.json config file") }
+
+        var err error
+        if addrs[n], err = libraries.FetchAllowlist(list.Source); err != nil { return nil, fmt.Errorf("Allowlist '%s' :: %s", n, err.Error()) }
+    }
+
+    changes := make([]allowlist_change_t, 0)
+    for _, n := range(names) {
+        list := lists[n]
+        if len(list.Firewall) > 0 {
+            proto := list.Protocol
+            if len(proto) == 0 { proto = "tcp" }
+            diff, err := do.SyncFirewallAllowlist(list.Firewall, proto, list.Ports, addrs[n], dryRun)
+            for _, d := range(diff) { changes = append(changes, allowlist_change_t{List: n, Target: fmt.Sprintf("%s %s %s", list.Firewall, proto, list.Ports), Change: d}) }
+            if err != nil { return changes, err }
+        }
+        if list.CloudFlare {
+            diff, err := cf.SyncAccessAllowlist(n, addrs[n], dryRun)
+            for _, d := range(diff) { changes = append(changes, allowlist_change_t{List: n, Target: "access rules", Change: d}) }
+            if err != nil { return changes, err }
+        }
+    }
+    return changes, nil
+}
+
+/*! \brief One line per change, ie '+ 192.0.2.0/24 web-fw tcp 22 (office)'
+ */
+func (c allowlist_change_t) String () string {
+    return fmt.Sprintf("%s %s (%s)", c.Change, c.Target, c.List)
+}
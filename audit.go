@@ -0,0 +1,110 @@
+/*! \file audit.go
+    \brief Security audit of the account, nodes without a firewall, sensitive ports open to everyone and records skipping the cloud flare proxy
+*/
+
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+var audit_sensitive_ports = []struct { port int; name string }{{22, "ssh"}, {3306, "mysql"}, {5432, "postgres"}, {6379, "redis"}, {27017, "mongodb"}}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief One problem the audit found
+ */
+type audit_finding_t struct {
+    Check       string  `json:"check"`   //no-firewall, open-port or unproxied
+    Resource    string  `json:"resource"`
+    Message     string  `json:"message"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lets us know if the firewall rule's ports include this one, digital ocean uses 0 or all for every port
+ */
+func portAllowed (ports string, port int) bool {
+    if ports == "0" || ports == "all" || len(ports) == 0 { return true }
+    if from, to, found := strings.Cut(ports, "-"); found {
+        low, errLow := strconv.Atoi(from)
+        high, errHigh := strconv.Atoi(to)
+        return errLow == nil && errHigh == nil && port >= low && port <= high
+    }
+    return ports == strconv.Itoa(port)
+}
+
+/*! \brief Lets us know if the firewall applies to the node, either directly or through one of its tags
+ */
+func firewallCovers (fw libraries.DO_firewall_t, node libraries.DO_node_t) bool {
+    for _, id := range(fw.DropletIDs) {
+        if id == node.ID { return true }
+    }
+    for _, t := range(fw.Tags) {
+        for _, nt := range(node.Tags) {
+            if t == nt { return true }
+        }
+    }
+    return false
+}
+
+/*! \brief Runs all the checks, the cloud flare one only when we have a zone to look at
+ */
+func runAudit (do libraries.DO_c, cf libraries.CF_c, cloudflare bool) ([]audit_finding_t, error) {
+    nodes, err := do.ListNodes("", "")
+    if err != nil { return nil, err }
+    firewalls, err := do.ListFirewalls()
+    if err != nil { return nil, err }
+
+    findings := make([]audit_finding_t, 0)
+    for _, n := range(nodes) {
+        covered := false
+        for _, fw := range(firewalls) {
+            if firewallCovers(fw, n) { covered = true }
+        }
+        if !covered { findings = append(findings, audit_finding_t{Check: "no-firewall", Resource: n.Name, Message: "Node doesn't have a firewall attached"}) }
+    }
+
+    for _, fw := range(firewalls) {
+        for _, rule := range(fw.Inbound) {
+            if rule.Sources == nil || strings.EqualFold(rule.Protocol, "icmp") { continue }
+            for _, addr := range(rule.Sources.Addresses) {
+                if addr != "0.0.0.0/0" && addr != "::/0" { continue }
+                for _, p := range(audit_sensitive_ports) {
+                    if portAllowed(rule.Ports, p.port) {
+                        findings = append(findings, audit_finding_t{Check: "open-port", Resource: fw.Name, Message: fmt.Sprintf("%s port %d (%s) is open to %s", rule.Protocol, p.port, p.name, addr)})
+                    }
+                }
+            }
+        }
+    }
+
+    if cloudflare {
+        origins := make(map[string]string)  //ip to node name
+        for _, n := range(nodes) {
+            if len(n.IP) > 0 { origins[n.IP] = n.Name }
+            if len(n.IPv6) > 0 { origins[n.IPv6] = n.Name }
+        }
+
+        records, err := cf.ListDomainRecords("", "", "")
+        if err != nil { return findings, err }
+        for _, rec := range(records) {
+            if node, ok := origins[rec.Content]; ok && !rec.Proxied {
+                findings = append(findings, audit_finding_t{Check: "unproxied", Resource: rec.Name, Message: fmt.Sprintf("%s record points at node %s without the cloud flare proxy, exposing the origin", rec.Type, node)})
+            }
+        }
+    }
+    return findings, nil
+}
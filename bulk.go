@@ -0,0 +1,467 @@
+/*! \file bulk.go
+    \brief Handles running a batch of node and domain operations read in from a csv or json file
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "strconv"
+    "sync"
+    "encoding/csv"
+    "encoding/json"
+    "io/ioutil"
+    "path/filepath"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief One row from the bulk file, the fields match the command line options
+ */
+type bulk_row_t struct {
+    Action      string  `json:"action"`
+    Name        string  `json:"name"`
+    Region      string  `json:"region"`
+    Size        int     `json:"size"`
+    CPU         int     `json:"cpu"`
+    Slug        string  `json:"slug"`    //exact size, ie for the premium and gpu sizes
+    Image       string  `json:"image"`
+    Latest      bool    `json:"latest"`
+    Tag         string  `json:"tag"`
+    SSHKey      string  `json:"ssh_key"`
+    Domain      string  `json:"domain"`
+    SubDomain   string  `json:"subdomain"`
+    Type        string  `json:"type"`
+    IP          string  `json:"ip"`
+    Node        string  `json:"node"`    //node a dns-set or fip row points at, created first when it's in the same file
+    IPv6        bool    `json:"ipv6"`    //dns-set also creates an AAAA record from the node
+    IP6         string  `json:"ip6"`     //reserved ipv6 a fip row moves along with the floating ip, or auto
+    CloudFlare  bool    `json:"cloudflare"`
+}
+
+type bulk_result_t struct {
+    Row         int     `json:"row"`
+    Action      string  `json:"action"`
+    Name        string  `json:"name"`
+    Success     bool    `json:"success"`
+    Skipped     bool    `json:"skipped,omitempty"`  //never ran, ie after a failure with -fail-fast
+    Error       string  `json:"error,omitempty"`
+    Output      *libraries.FileOutput_t `json:"output,omitempty"`
+}
+
+/*! \brief Error for when some of the bulk rows worked and some didn't, so it gets its own exit code
+ */
+type partial_error struct {
+    Failed, Total   int
+}
+
+func (e partial_error) Error () string {
+    return fmt.Sprintf("%d of %d bulk operations failed", e.Failed, e.Total)
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Sets a single csv column on the row, the column names match the json keys
+ */
+func (row *bulk_row_t) set (key, val string) (err error) {
+    val = strings.TrimSpace(val)
+    if len(val) == 0 { return }  //leave the default in place
+
+    switch strings.ToLower(strings.TrimSpace(key)) {
+    case "action":      row.Action = val
+    case "name":        row.Name = val
+    case "region":      row.Region = val
+    case "image":       row.Image = val
+    case "slug":        row.Slug = val
+    case "tag":         row.Tag = val
+    case "ssh_key":     row.SSHKey = val
+    case "domain":      row.Domain = val
+    case "subdomain":   row.SubDomain = val
+    case "type":        row.Type = val
+    case "ip":          row.IP = val
+    case "ip6":         row.IP6 = val
+    case "node":        row.Node = val
+    case "size":        row.Size, err = strconv.Atoi(val)
+    case "cpu":         row.CPU, err = strconv.Atoi(val)
+    case "cloudflare":  row.CloudFlare, err = strconv.ParseBool(val)
+    case "latest":      row.Latest, err = strconv.ParseBool(val)
+    case "ipv6":        row.IPv6, err = strconv.ParseBool(val)
+    default:
+        err = fmt.Errorf("Unknown column '%s'", key)
+    }
+    return
+}
+
+/*! \brief Label used when reporting on this row
+ */
+func (row bulk_row_t) label () string {
+    if len(row.Name) > 0 { return row.Name }
+    if len(row.Domain) > 0 { return row.SubDomain + "." + row.Domain }
+    if len(row.SubDomain) == 0 { return row.IP }
+    return row.SubDomain
+}
+
+/*! \brief Reads in the bulk file, it's either a csv with a header line, or a json array of rows
+ *  Any column left blank in the file gets the value from the defaults
+ */
+func readBulkFile (loc string, defaults bulk_row_t) (rows []bulk_row_t, err error) {
+    bulkFile, err := os.Open(loc)
+    if err != nil { return nil, fmt.Errorf("Unable to open '%s' file :: %s", loc, err.Error()) }
+    defer bulkFile.Close()
+
+    if strings.EqualFold(filepath.Ext(loc), ".json") {
+        var raw []json.RawMessage
+        err = json.NewDecoder(bulkFile).Decode(&raw)
+        for i := 0; err == nil && i < len(raw); i++ {
+            row := defaults
+            err = json.Unmarshal(raw[i], &row)
+            rows = append(rows, row)
+        }
+    } else {    //treat anything else as a csv
+        reader := csv.NewReader(bulkFile)
+        reader.TrimLeadingSpace = true
+        reader.FieldsPerRecord = -1 //trailing columns can be left off
+        var lines [][]string
+        lines, err = reader.ReadAll()
+        if err == nil && len(lines) < 2 { err = fmt.Errorf("Bulk file requires a header line and at least one row") }
+
+        for i := 1; err == nil && i < len(lines); i++ {
+            row := defaults
+            for col := 0; err == nil && col < len(lines[0]) && col < len(lines[i]); col++ {
+                err = row.set(lines[0][col], lines[i][col])
+            }
+            if err != nil { err = fmt.Errorf("Line %d :: %s", i + 1, err.Error()) }
+            rows = append(rows, row)
+        }
+    }
+
+    if err == nil && len(rows) == 0 { err = fmt.Errorf("No rows found in '%s'", loc) }
+    return
+}
+
+/*! \brief Runs the action for a single row, this matches the logic of the command line flags
+ */
+func runBulkRow (row bulk_row_t, config config_t, do libraries.DO_c, cf libraries.CF_c, fileOutput *libraries.FileOutput_t) (err error) {
+    if row.CloudFlare && len(cf.Config.APIKey) < 1 {
+        return fmt.Errorf("Cannot use CloudFlare without the api_key set in the harbormaster.json config file")
+    }
+    if row.CloudFlare {
+        if err = cf.SelectZone("", row.Domain); err != nil { return }   //our copy of cf, so this doesn't touch the other rows
+    }
+
+    switch strings.ToLower(row.Action) {
+    case "create":
+        if len(row.Name) == 0 { return fmt.Errorf("Node name not set") }
+        targetSize, err := targetSizeSlug(row.Size, row.CPU, row.Slug)
+        if err == nil {
+            if len(targetSize) == 0 { return fmt.Errorf("Size of node not set") }
+            var image string
+            image, err = do.ResolveImage(row.Image, row.Region, row.Latest)
+            if err == nil {
+                event := hook_event_t{Name: row.Name, Region: row.Region, Size: targetSize, Image: image, Tag: row.Tag}
+                err = config.Hooks.around(do, "create", event, func () error {
+                    return do.CreateNode(row.Name, row.Region, row.Tag, targetSize, image, row.SSHKey, "", fileOutput)
+                })
+            }
+        }
+        return err
+
+    case "delete":
+        if len(row.Name) == 0 { return fmt.Errorf("Node name not set") }
+        if err = config.Protected.checkNode(do, row.Name); err != nil { return }
+        return config.Hooks.around(do, "delete", hook_event_t{Name: row.Name}, func () error { return do.DeleteNode(row.Name) })
+
+    case "resize":
+        if len(row.Name) == 0 { return fmt.Errorf("Node name not set") }
+        targetSize, err := targetSizeSlug(row.Size, row.CPU, row.Slug)
+        if err == nil {
+            if len(targetSize) == 0 { return fmt.Errorf("Size to resize to not set") }
+            if err = config.Protected.checkNode(do, row.Name); err != nil { return err }
+            err = config.Hooks.around(do, "resize", hook_event_t{Name: row.Name, Size: targetSize}, func () error { return do.ResizeNode(row.Name, targetSize) })
+        }
+        return err
+
+    case "dns-set":
+        if len(row.IP) == 0 && len(row.Node) > 0 {
+            if _, row.IP, err = do.NodeAddress(row.Node); err != nil { return }
+        }
+        if len(row.IP) == 0 || len(row.Type) == 0 || len(row.SubDomain) == 0 { return fmt.Errorf("dns-set requires ip or node, type and subdomain") }
+        if err = config.Protected.checkDNS(cf, row.CloudFlare, row.Domain, row.SubDomain); err != nil { return }
+        if row.CloudFlare {
+            err = cf.AssignDomainRecord(row.Type, row.SubDomain, row.IP)
+        } else if len(row.Domain) == 0 {
+            return fmt.Errorf("Domain name not set")
+        } else {
+            err = do.AssignDomainRecord(row.Domain, row.Type, row.SubDomain, row.IP)
+        }
+        if err == nil && row.IPv6 { err = assignIPv6Record(do, cf, row.CloudFlare, row.Domain, row.SubDomain, row.Type, row.Node) }
+        if err == nil { err = autoUptimeCheck(do, cf, row.CloudFlare, row.Domain, row.SubDomain, row.Type) }
+        return err
+
+    case "dns-delete":
+        if len(row.SubDomain) == 0 { return fmt.Errorf("Subdomain not set") }
+        if err = config.Protected.checkDNS(cf, row.CloudFlare, row.Domain, row.SubDomain); err != nil { return }
+        if row.CloudFlare { return cf.DeleteDomainRecord(row.SubDomain) }
+        if len(row.Domain) == 0 { return fmt.Errorf("Domain name not set") }
+        return do.DeleteDomainRecord(row.Domain, row.SubDomain)
+
+    case "fip":
+        if len(row.IP) == 0 || len(row.Node) == 0 { return fmt.Errorf("fip requires the floating ip, or auto, and node") }
+        id, _, err := do.NodeAddress(row.Node)
+        if err != nil { return err }
+
+        if strings.EqualFold(row.IP, "auto") {
+            fileOutput.FloatingIP, err = do.ReserveFloatingIP(id)
+            if err == nil { fmt.Printf("Floating ip for %s: %s\n", row.Node, fileOutput.FloatingIP) }
+            if err == nil && strings.EqualFold(row.IP6, "auto") {
+                var ip6 string
+                ip6, err = do.ReserveIPv6(id)
+                if err == nil { fmt.Printf("Reserved ipv6 for %s: %s\n", row.Node, ip6) }
+            }
+            return err
+        }
+
+        existing, err := do.GetFloatingIP(row.IP)
+        if err == nil && existing != id { err = do.AssignFloatingIP(row.IP, id) }
+        if err == nil && len(row.IP6) > 0 && !strings.EqualFold(row.IP6, "auto") {
+            existing, err = do.GetReservedIPv6(row.IP6)
+            if err == nil && existing != id { err = do.AssignReservedIPv6(row.IP6, id) }
+        }
+        return err
+    }
+
+    return fmt.Errorf("Unknown action '%s', expecting create, delete, resize, dns-set, dns-delete or fip", row.Action)
+}
+
+/*! \brief Figures out which rows need to wait for others, dns-set and fip rows wait for their node to be created
+ */
+func bulkDependencies (rows []bulk_row_t) [][]int {
+    deps := make([][]int, len(rows))
+    for i, row := range(rows) {
+        action := strings.ToLower(row.Action)
+        if len(row.Node) == 0 || (action != "dns-set" && action != "fip") { continue }
+
+        for j, other := range(rows) {
+            if strings.EqualFold(other.Action, "create") && strings.EqualFold(other.Name, row.Node) {
+                deps[i] = append(deps[i], j)
+                break
+            }
+        }
+    }
+    return deps
+}
+
+/*! \brief Runs all the rows, at most concurrency at a time, and returns the result of each in the original order
+ *  Rows that depend on others wait for them to finish first, and fail without running if they failed
+ */
+func runBulk (rows []bulk_row_t, concurrency int, failFast bool, config config_t, do libraries.DO_c, cf libraries.CF_c) ([]bulk_result_t) {
+    if concurrency < 1 { concurrency = 1 }
+
+    stop := make(chan struct{})  //closed on the first failure with failFast
+    stopOnce := sync.Once{}
+    stopped := func () bool {
+        select {
+        case <-stop:    return true
+        default:        return false
+        }
+    }
+
+    results := make([]bulk_result_t, len(rows))
+    deps := bulkDependencies(rows)
+    done := make([]chan struct{}, len(rows))
+    for i := range(done) { done[i] = make(chan struct{}) }
+
+    slots := make(chan struct{}, concurrency)
+    wg := sync.WaitGroup{}
+
+    for i, row := range(rows) {
+        wg.Add(1)
+
+        go func (i int, row bulk_row_t) {
+            defer wg.Done()
+            defer close(done[i])
+
+            results[i] = bulk_result_t{Row: i + 1, Action: row.Action, Name: row.label()}
+            for _, d := range(deps[i]) {    //waiting for these doesn't take up a slot
+                <-done[d]
+                if !results[d].Success {
+                    results[i].Error = fmt.Sprintf("Depends on row %d, which failed", d + 1)
+                    return
+                }
+            }
+
+            slots <- struct{}{} //wait for an open slot
+            defer func() { <-slots }()
+
+            if stopped() {
+                results[i].Skipped, results[i].Error = true, "Skipped, an earlier row failed"
+                return
+            }
+
+            fileOutput := libraries.FileOutput_t{}
+            err := runBulkRow(row, config, do, cf, &fileOutput)
+            if fileOutput.Droplet.ID > 0 || len(fileOutput.FloatingIP) > 0 { results[i].Output = &fileOutput }   //only creates and reserved ips fill this in
+
+            if err == nil {
+                results[i].Success = true
+            } else {
+                results[i].Error = err.Error()
+                if failFast { stopOnce.Do(func () { close(stop) }) }
+            }
+        }(i, row)
+    }
+
+    wg.Wait()
+    return results
+}
+
+/*! \brief Prints out how each row went, and returns an error if any of them failed
+ *  When only some failed it's a partial_error, so a retry can be told apart from a total failure
+ */
+func bulkSummary (results []bulk_result_t) error {
+    failed, skipped := 0, 0
+    fmt.Println("\nBulk summary")
+    for _, res := range(results) {
+        if res.Success {
+            fmt.Printf("  row %d: %s %s :: OK\n", res.Row, res.Action, res.Name)
+        } else if res.Skipped {
+            skipped++
+            fmt.Printf("  row %d: %s %s :: SKIPPED\n", res.Row, res.Action, res.Name)
+        } else {
+            failed++
+            fmt.Printf("  row %d: %s %s :: FAILED :: %s\n", res.Row, res.Action, res.Name, res.Error)
+        }
+    }
+    fmt.Printf("%d succeeded, %d failed, %d skipped\n\n", len(results) - failed - skipped, failed, skipped)
+
+    if failed == 0 && skipped == 0 { return nil }
+    if failed + skipped < len(results) { return partial_error{Failed: failed + skipped, Total: len(results)} }
+    return fmt.Errorf("All %d bulk operations failed", len(results))
+}
+
+/*! \brief Saves what the records the dns rows touch look like now, so -rollback can put them back if the batch goes wrong
+ */
+func snapshotBulkDNS (rows []bulk_row_t, do libraries.DO_c, cf libraries.CF_c, loc string) error {
+    snaps := make([]libraries.DNS_snapshot_t, 0)
+    for i, row := range(rows) {
+        action := strings.ToLower(row.Action)
+        if action != "dns-set" && action != "dns-delete" { continue }
+
+        types := []string{row.Type}
+        if action == "dns-delete" {
+            types = []string{""}    //delete removes whatever's there
+        } else if row.IPv6 {
+            types = append(types, "AAAA")
+        }
+
+        rowCF := cf
+        if row.CloudFlare {
+            if err := rowCF.SelectZone("", row.Domain); err != nil { return fmt.Errorf("Row %d :: %s", i + 1, err.Error()) }
+        }
+        for _, t := range(types) {
+            var snap libraries.DNS_snapshot_t
+            var err error
+            if row.CloudFlare {
+                snap, err = rowCF.SnapshotRecord(t, row.SubDomain)
+            } else {
+                snap, err = do.SnapshotRecord(row.Domain, t, row.SubDomain)
+            }
+            if err != nil { return fmt.Errorf("Row %d :: %s", i + 1, err.Error()) }
+            if snap.Existed || action == "dns-set" { snaps = append(snaps, snap) }  //a delete of nothing has nothing to put back
+        }
+    }
+
+    jStr, _ := json.MarshalIndent(snaps, "", "  ")
+    if err := ioutil.WriteFile(loc, jStr, 0644); err != nil { return err }
+    fmt.Printf("Saved %d records to %s\n", len(snaps), loc)
+    return nil
+}
+
+/*! \brief Puts every record in the snapshot file back the way it was, carrying on past failures so as much as possible is restored
+ */
+func rollbackDNS (loc string, do libraries.DO_c, cf libraries.CF_c, dryRun bool) error {
+    data, err := ioutil.ReadFile(loc)
+    if err != nil { return fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+    var snaps []libraries.DNS_snapshot_t
+    if err = json.Unmarshal(data, &snaps); err != nil { return fmt.Errorf("Invalid snapshot file '%s' :: %s", loc, err.Error()) }
+    return restoreSnapshots(snaps, do, cf, dryRun)
+}
+
+/*! \brief Puts the records back in order, carrying on past failures
+ */
+func restoreSnapshots (snaps []libraries.DNS_snapshot_t, do libraries.DO_c, cf libraries.CF_c, dryRun bool) error {
+    do.Journal, cf.Journal = nil, nil   //putting them back isn't something to undo later
+    moved := make(map[string]string)    //records that were deleted come back with a new id, the earlier snapshots of them need it
+    var err error
+    failed := 0
+    for _, snap := range(snaps) {
+        fmt.Println("Restoring " + snap.String())
+        if dryRun { continue }
+
+        key := fmt.Sprintf("%t/%s/%s", snap.CloudFlare, snap.Zone + snap.Domain, snap.ID)
+        if id, ok := moved[key]; ok { snap.ID = id }
+        var id string
+        if snap.CloudFlare && len(cf.Config.APIKey) < 1 {
+            err = fmt.Errorf("Cannot use CloudFlare without the api_key set in the harbormaster.json config file")
+        } else if snap.CloudFlare {
+            id, err = cf.RestoreRecord(snap)
+        } else {
+            id, err = do.RestoreRecord(snap)
+        }
+        if len(snap.ID) > 0 && len(id) > 0 && id != snap.ID { moved[key] = id }
+        if err != nil {
+            failed++
+            fmt.Printf("  FAILED :: %s\n", err.Error())
+        }
+    }
+    if dryRun && len(snaps) > 0 { fmt.Println("Dry run, nothing was changed") }
+    if failed > 0 { return partial_error{Failed: failed, Total: len(snaps)} }
+    return nil
+}
+
+/*! \brief Reads in the rules for -retag, either a json array or a csv with match, add and remove columns
+ *  In the csv the tags to add and remove are separated by spaces
+ */
+func readRetagFile (loc string) (rules []libraries.DO_retag_t, err error) {
+    retagFile, err := os.Open(loc)
+    if err != nil { return nil, fmt.Errorf("Unable to open '%s' file :: %s", loc, err.Error()) }
+    defer retagFile.Close()
+
+    if strings.EqualFold(filepath.Ext(loc), ".json") {
+        err = json.NewDecoder(retagFile).Decode(&rules)
+    } else {
+        reader := csv.NewReader(retagFile)
+        reader.TrimLeadingSpace = true
+        reader.FieldsPerRecord = -1
+        var lines [][]string
+        lines, err = reader.ReadAll()
+        if err == nil && len(lines) < 2 { err = fmt.Errorf("Retag file requires a header line and at least one row") }
+
+        for i := 1; err == nil && i < len(lines); i++ {
+            rule := libraries.DO_retag_t{}
+            for col := 0; err == nil && col < len(lines[0]) && col < len(lines[i]); col++ {
+                switch strings.ToLower(strings.TrimSpace(lines[0][col])) {
+                case "match":   rule.Match = strings.TrimSpace(lines[i][col])
+                case "add":     rule.Add = strings.Fields(lines[i][col])
+                case "remove":  rule.Remove = strings.Fields(lines[i][col])
+                default:        err = fmt.Errorf("Line %d :: Unknown column '%s'", i + 1, lines[0][col])
+                }
+            }
+            rules = append(rules, rule)
+        }
+    }
+
+    for i := 0; err == nil && i < len(rules); i++ {
+        if len(rules[i].Match) == 0 { err = fmt.Errorf("Rule %d doesn't have a match pattern", i + 1) }
+    }
+    if err == nil && len(rules) == 0 { err = fmt.Errorf("No rules found in '%s'", loc) }
+    return
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+    "io/ioutil"
+    "net/http"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+/*! \brief The fake provider as the default transport for the test, the config has its credentials like a -provider fake run
+ */
+func fakeProvider (t *testing.T) (config_t, libraries.DO_c, libraries.CF_c) {
+    fake, err := libraries.NewFake("state=memory,boot=0,action=0,latency=0")
+    if err != nil { t.Fatal(err) }
+    was := http.DefaultTransport
+    http.DefaultTransport = fake
+    t.Cleanup(func () { http.DefaultTransport = was })
+
+    var config config_t
+    libraries.FakeCredentials(&config.DO, &config.CF)
+    return config, libraries.DO_c{Config: config.DO}, libraries.CF_c{Config: config.CF}
+}
+
+func TestReadBulkFile (t *testing.T) {
+    defaults := bulk_row_t{Region: "nyc3", Size: 1}
+    tests := []struct {
+        name        string
+        file        string
+        content     string
+        rows        []bulk_row_t
+        fails       bool
+    }{
+        {"csv", "nodes.csv", "action,name,size,cloudflare\ncreate,web-1,2,\ndns-delete,,,true\n",
+            []bulk_row_t{{Action: "create", Name: "web-1", Region: "nyc3", Size: 2}, {Action: "dns-delete", Region: "nyc3", Size: 1, CloudFlare: true}}, false},
+        {"short lines", "nodes.csv", "action, name, region\ndelete, web-1\n", []bulk_row_t{{Action: "delete", Name: "web-1", Region: "nyc3", Size: 1}}, false},
+        {"anything else is a csv", "nodes.txt", "action,node,ip\nfip,web-1,auto\n", []bulk_row_t{{Action: "fip", Node: "web-1", IP: "auto", Region: "nyc3", Size: 1}}, false},
+        {"json", "nodes.json", `[{"action":"create","name":"web-1","cpu":2},{"action":"dns-set","node":"web-1","subdomain":"www","type":"A","ipv6":true}]`,
+            []bulk_row_t{{Action: "create", Name: "web-1", Region: "nyc3", Size: 1, CPU: 2}, {Action: "dns-set", Node: "web-1", SubDomain: "www", Type: "A", IPv6: true, Region: "nyc3", Size: 1}}, false},
+        {"unknown column", "nodes.csv", "action,colour\ncreate,blue\n", nil, true},
+        {"bad number", "nodes.csv", "action,size\ncreate,big\n", nil, true},
+        {"header only", "nodes.csv", "action,name\n", nil, true},
+        {"empty json", "nodes.json", `[]`, nil, true},
+        {"bad json", "nodes.json", `{"action":"create"}`, nil, true},
+    }
+
+    for _, tt := range(tests) {
+        loc := filepath.Join(t.TempDir(), tt.file)
+        if err := ioutil.WriteFile(loc, []byte(tt.content), 0644); err != nil { t.Fatal(err) }
+        rows, err := readBulkFile(loc, defaults)
+        if tt.fails {
+            if err == nil { t.Errorf("%s: expecting an error", tt.name) }
+            continue
+        }
+        if err != nil { t.Errorf("%s: %s", tt.name, err); continue }
+        if !reflect.DeepEqual(rows, tt.rows) { t.Errorf("%s: got %+v, expecting %+v", tt.name, rows, tt.rows) }
+    }
+
+    if _, err := readBulkFile(filepath.Join(t.TempDir(), "missing.csv"), defaults); err == nil { t.Error("Expecting an error for a missing file") }
+}
+
+func TestBulkDependencies (t *testing.T) {
+    tests := []struct {
+        name        string
+        rows        []bulk_row_t
+        deps        [][]int
+    }{
+        {"none", []bulk_row_t{{Action: "create", Name: "web-1"}, {Action: "delete", Name: "web-2"}}, [][]int{nil, nil}},
+        {"dns after create", []bulk_row_t{{Action: "dns-set", Node: "web-1"}, {Action: "create", Name: "web-1"}}, [][]int{{1}, nil}},
+        {"fip after create", []bulk_row_t{{Action: "create", Name: "WEB-1"}, {Action: "FIP", Node: "web-1"}}, [][]int{nil, {0}}},
+        {"node isn't being created", []bulk_row_t{{Action: "delete", Name: "web-1"}, {Action: "dns-set", Node: "web-1"}}, [][]int{nil, nil}},
+        {"only dns-set and fip wait", []bulk_row_t{{Action: "create", Name: "web-1"}, {Action: "resize", Name: "web-1", Node: "web-1"}}, [][]int{nil, nil}},
+    }
+
+    for _, tt := range(tests) {
+        if deps := bulkDependencies(tt.rows); !reflect.DeepEqual(deps, tt.deps) { t.Errorf("%s: got %v, expecting %v", tt.name, deps, tt.deps) }
+    }
+}
+
+func TestRunBulk (t *testing.T) {
+    config, do, cf := fakeProvider(t)
+    bogus := bulk_row_t{Action: "bogus", Name: "web-1"}
+
+    tests := []struct {
+        name        string
+        rows        []bulk_row_t
+        concurrency int
+        failFast    bool
+        failed      int
+        skipped     int
+        errors      []string    //each row's error starts with this, empty when it worked
+    }{
+        {"all fail", []bulk_row_t{bogus, bogus, bogus}, 2, false, 3, 0, []string{"Unknown action", "Unknown action", "Unknown action"}},
+        {"fail fast", []bulk_row_t{bogus, bogus, bogus}, 1, true, 1, 2, nil},
+        {"waits for its node", []bulk_row_t{{Action: "dns-set", Node: "web-1", SubDomain: "www", Type: "A", Domain: "example.com"}, {Action: "create", Name: "web-1"}}, 2, false, 2, 0,
+            []string{"Depends on row 2", "Size of node not set"}},
+        {"node isn't in the file", []bulk_row_t{{Action: "dns-set", Node: "web-9", SubDomain: "www", Type: "A", Domain: "example.com"}}, 1, false, 1, 0, []string{"Node 'web-9'"}},
+        {"works", []bulk_row_t{{Action: "dns-set", IP: "192.0.2.10", SubDomain: "www", Type: "A", Domain: "example.com"}}, 1, false, 0, 0, []string{""}},
+    }
+
+    for _, tt := range(tests) {
+        results := runBulk(tt.rows, tt.concurrency, tt.failFast, config, do, cf)
+        if len(results) != len(tt.rows) { t.Fatalf("%s: %d results for %d rows", tt.name, len(results), len(tt.rows)) }
+        failed, skipped := 0, 0
+        for i, r := range(results) {
+            if r.Row != i + 1 { t.Errorf("%s: result %d is for row %d", tt.name, i, r.Row) }
+            if r.Skipped {
+                skipped++
+            } else if !r.Success {
+                failed++
+            }
+            if tt.errors != nil && !strings.HasPrefix(r.Error, tt.errors[i]) { t.Errorf("%s: row %d error '%s', expecting '%s'", tt.name, i + 1, r.Error, tt.errors[i]) }
+            if tt.errors != nil && len(tt.errors[i]) == 0 && len(r.Error) > 0 { t.Errorf("%s: row %d failed :: %s", tt.name, i + 1, r.Error) }
+        }
+        if failed != tt.failed || skipped != tt.skipped { t.Errorf("%s: %d failed and %d skipped, expecting %d and %d", tt.name, failed, skipped, tt.failed, tt.skipped) }
+    }
+}
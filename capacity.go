@@ -0,0 +1,48 @@
+/*! \file capacity.go
+    \brief -capacity reports disk, memory and load of the nodes with the tag or in the stack against their sizes, and which ones should be resized
+*/
+
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Collects the report and prints it, the error is only for not being able to make the report at all
+ */
+func capacityReport (tag, stack, format string, limits libraries.DO_capacity_limits_t, concurrency int, do libraries.DO_c) ([]*libraries.DO_capacity_t, error) {
+    if len(tag) == 0 && len(stack) == 0 { return nil, fmt.Errorf("Nodes to report on not set.  use the -tag or -stack option") }
+    nodes, err := do.ListNodes(tag, stack)
+    if err != nil { return nil, err }
+    if len(nodes) == 0 { return nil, fmt.Errorf("No nodes to report on") }
+
+    report, err := do.CapacityReport(nodes, limits, concurrency)
+    if err != nil { return nil, err }
+
+    rows := make([][]string, 0, len(report))
+    candidates, failed := 0, 0
+    for _, r := range(report) {
+        if len(r.Over) > 0 { candidates++ }
+        if len(r.Error) > 0 {
+            failed++
+            rows = append(rows, []string{r.Node, r.Size, "", "", "", "", "", r.Error})
+            continue
+        }
+        rows = append(rows, []string{r.Node, r.Size, fmt.Sprintf("%.0f%%", r.DiskUsed), fmt.Sprintf("%.0f%%", r.MemoryUsed), fmt.Sprintf("%.2f", r.LoadPerCPU),
+            strings.Join(r.Over, ", "), r.Suggest, fmt.Sprintf("$%.2f", r.PriceMonthly)})
+    }
+    if err = printList(format, []string{"node", "size", "disk", "memory", "load/cpu", "over", "suggest", "monthly"}, rows, report); err != nil { return report, err }
+    if strings.EqualFold(format, "table") || strings.EqualFold(format, "github") {
+        fmt.Printf("%d of %d nodes are resize candidates", candidates, len(report))
+        if failed > 0 { fmt.Printf(", %d couldn't be reached", failed) }
+        fmt.Println()
+    }
+    return report, nil
+}
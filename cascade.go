@@ -0,0 +1,79 @@
+/*! \file cascade.go
+    \brief Deleting a node with -cascade, its records, floating ip, firewalls, balancers and volumes go with it
+ *  Leftover records end up pointing at whoever digital ocean hands the ip address to next
+*/
+
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type cascade_result_t struct {
+    *libraries.DO_cascade_t
+    CloudFlare  []libraries.CF_record_t     `json:"cloudflare_records"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Deletes the node and everything tied to it.  The records are looked for in the digital ocean domain, or all of them when it's not set,
+ *  and in the cloud flare zone with cloudflare.  Protected records stop it before anything is changed
+ */
+func cascadeDelete (name, domain string, cloudflare, deleteVolumes, dryRun bool, config config_t, do libraries.DO_c, cf libraries.CF_c) (*cascade_result_t, error) {
+    doDomain := domain
+    if cloudflare { doDomain = "" }     //the domain is the cloud flare zone
+    plan, err := do.NodeCascade(name, doDomain)
+    if err != nil { return nil, err }
+    if plan == nil {
+        fmt.Println("Droplet does not exist, nothing to do...")
+        return nil, nil
+    }
+    result := &cascade_result_t{DO_cascade_t: plan, CloudFlare: make([]libraries.CF_record_t, 0)}
+
+    if cloudflare {
+        for _, ip := range(plan.IPs) {
+            records, err := cf.ListDomainRecords("", "", ip)
+            if err != nil { return nil, err }
+            for _, r := range(records) {
+                if r.Content == ip { result.CloudFlare = append(result.CloudFlare, r) }     //the filter only needs to contain it
+            }
+        }
+    }
+
+    for _, r := range(plan.Records) {
+        fmt.Printf("- record %s %s.%s -> %s\n", r.Type, r.Name, r.Domain, r.Data)
+        if err = config.Protected.checkDNS(cf, false, r.Domain, r.Name); err != nil { return nil, err }
+    }
+    for _, r := range(result.CloudFlare) {
+        fmt.Printf("- record %s %s -> %s\n", r.Type, r.Name, r.Content)
+        if err = config.Protected.checkDNS(cf, true, "", strings.TrimSuffix(strings.TrimSuffix(r.Name, r.ZoneName), ".")); err != nil { return nil, err }
+    }
+    if len(plan.FloatingIP) > 0 { fmt.Println("- floating ip " + plan.FloatingIP) }
+    for _, id := range(plan.Firewalls) { fmt.Println("- firewall " + id) }
+    for _, id := range(plan.Balancers) { fmt.Println("- load balancer " + id) }
+    for _, id := range(plan.Volumes) {
+        if deleteVolumes {
+            fmt.Println("- volume " + id)
+        } else {
+            fmt.Println("- volume attachment " + id)
+        }
+    }
+    fmt.Println("- node " + plan.Node)
+    if dryRun { return result, nil }
+
+    for _, r := range(result.CloudFlare) {     //before the node goes, so nothing is sent at it
+        fmt.Printf("Deleting %s record %s -> %s\n", r.Type, r.Name, r.Content)
+        if err = cf.DeleteDomainRecordID(r.ID); err != nil { return result, err }
+    }
+    err = config.Hooks.around(do, "delete", hook_event_t{Name: plan.Node}, func () error { return do.CascadeDelete(plan, deleteVolumes) })
+    return result, err
+}
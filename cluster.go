@@ -0,0 +1,358 @@
+/*! \file cluster.go
+    \brief Whole clusters from a spec file, the nodes of a stack along with its firewall, load balancer and records
+ *  Creating and scaling are the same thing, the cluster is brought in line with the spec and the count
+ *  A spec with regions is a stack in each of them, and its names go through a cloud flare load balancer that steers by geography
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Cloud flare's geo steering region for each digital ocean data center, by the letters of the slug
+ */
+var cluster_cf_regions = map[string]string{"nyc": "ENAM", "tor": "ENAM", "atl": "ENAM", "sfo": "WNAM", "ams": "WEU", "lon": "WEU", "fra": "WEU", "blr": "SAS", "sgp": "SEAS", "syd": "OC"}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type cluster_balancer_t struct {
+    ForwardingRules []libraries.DO_forwarding_rule_t    `json:"forwarding_rules"`
+    HealthCheck     *libraries.DO_health_check_t        `json:"health_check"`
+}
+
+/*! \brief Records for the cluster, names point at the load balancer and nodes gives each node a record of its own name
+ */
+type cluster_dns_t struct {
+    Domain      string      `json:"domain"`
+    CloudFlare  bool        `json:"cloudflare"`
+    Names       []string    `json:"names"`
+    Nodes       bool        `json:"nodes"`
+}
+
+/*! \brief One region of an active/active cluster, its stack is the cluster's name and the region, ie web-nyc3
+ */
+type cluster_region_t struct {
+    Region      string      `json:"region"`
+    Count       int         `json:"count"`
+    FloatingIP  bool        `json:"floating_ip"`   //the region's origin is a floating ip on one of its nodes, rather than its balancer or all its nodes
+    CFRegions   []string    `json:"cf_regions"`    //cloud flare regions steered here, ie ENAM or WEU.  guessed from the data center when left out
+}
+
+/*! \brief The cluster spec file, the name is the stack and its nodes are name-1, name-2 and so on
+ *  The node fields match the command line options, and anything left out comes from them
+ */
+type cluster_spec_t struct {
+    Name        string  `json:"name"`
+    Count       int     `json:"count"`
+    Region      string  `json:"region"`
+    Size        int     `json:"size"`
+    CPU         int     `json:"cpu"`
+    Slug        string  `json:"slug"`
+    Image       string  `json:"image"`
+    Latest      bool    `json:"latest"`
+    Tag         string  `json:"tag"`
+    SSHKey      string  `json:"ssh_key"`
+    UserData    string  `json:"user_data"`   //file with a cloud-init script
+    Owner       string  `json:"owner"`
+    Note        string  `json:"note"`
+    Firewall    []string    `json:"firewall"`    //rule sets from the config
+    Balancer    *cluster_balancer_t `json:"balancer"`
+    DNS         *cluster_dns_t      `json:"dns"`
+    Regions     []cluster_region_t  `json:"regions"`   //region and count are per region when these are set
+}
+
+type cluster_result_t struct {
+    Name        string  `json:"name"`
+    Region      string  `json:"region,omitempty"`
+    Created     []string    `json:"created"`
+    Deleted     []string    `json:"deleted"`
+    Nodes       []libraries.DO_node_t   `json:"nodes"`
+    Balancer    *libraries.DO_balancer_t    `json:"balancer,omitempty"`
+    FloatingIP  string  `json:"floating_ip,omitempty"`
+    Regions     []*cluster_result_t     `json:"regions,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Reads in the spec file, unknown fields are an error so a typo doesn't quietly do nothing
+ */
+func readClusterSpec (loc string, spec cluster_spec_t) (cluster_spec_t, error) {
+    specFile, err := os.Open(loc)
+    if err != nil { return spec, fmt.Errorf("Unable to open '%s' file :: %s", loc, err.Error()) }
+    defer specFile.Close()
+
+    decoder := json.NewDecoder(specFile)
+    decoder.DisallowUnknownFields()
+    if err = decoder.Decode(&spec); err != nil { return spec, fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+
+    switch {
+    case len(spec.Name) == 0:
+        err = fmt.Errorf("Cluster name not set in the spec")
+    case spec.Count < 0:
+        err = fmt.Errorf("Cluster count can't be negative")
+    case spec.DNS != nil && len(spec.DNS.Domain) == 0:
+        err = fmt.Errorf("Cluster dns needs a domain")
+    case spec.DNS != nil && len(spec.DNS.Names) > 0 && len(spec.Regions) > 0 && !spec.DNS.CloudFlare:
+        err = fmt.Errorf("Cluster dns names for a cluster with regions go through a cloud flare load balancer, so the spec's dns needs cloudflare")
+    case spec.DNS != nil && len(spec.DNS.Names) > 0 && len(spec.Regions) == 0 && spec.Balancer == nil:
+        err = fmt.Errorf("Cluster dns names point at the load balancer, so the spec needs a balancer")
+    }
+
+    seen := make(map[string]bool)
+    for _, r := range(spec.Regions) {
+        switch {
+        case err != nil:
+        case len(r.Region) == 0:
+            err = fmt.Errorf("Cluster region not set for one of the spec's regions")
+        case seen[r.Region]:
+            err = fmt.Errorf("Cluster region %s is in the spec twice", r.Region)
+        case r.Count < 0:
+            err = fmt.Errorf("Cluster count for %s can't be negative", r.Region)
+        case len(r.cfRegions()) == 0 && spec.DNS != nil && len(spec.DNS.Names) > 0:
+            err = fmt.Errorf("No cloud flare region known for %s, set cf_regions for it in the spec", r.Region)
+        }
+        seen[r.Region] = true
+    }
+    return spec, err
+}
+
+/*! \brief The cloud flare regions the geo steering sends to this one
+ */
+func (r cluster_region_t) cfRegions () []string {
+    if len(r.CFRegions) > 0 { return r.CFRegions }
+    if code, ok := cluster_cf_regions[strings.TrimRight(r.Region, "0123456789")]; ok { return []string{code} }
+    return nil
+}
+
+/*! \brief Name of the node with the index
+ */
+func (spec cluster_spec_t) nodeName (index int) string {
+    return fmt.Sprintf("%s-%d", spec.Name, index)
+}
+
+/*! \brief Index of the node in the cluster, 0 when it isn't one of ours, ie it was added to the stack by hand
+ */
+func (spec cluster_spec_t) nodeIndex (name string) int {
+    if !strings.HasPrefix(name, spec.Name + "-") { return 0 }
+    index, err := strconv.Atoi(strings.TrimPrefix(name, spec.Name + "-"))
+    if err != nil { return 0 }
+    return index
+}
+
+/*! \brief Points the record at the ip address, or removes it when ip is empty
+ */
+func clusterRecord (spec cluster_spec_t, config config_t, do libraries.DO_c, cf libraries.CF_c, subDomain, ip string) error {
+    if err := config.Protected.checkDNS(cf, spec.DNS.CloudFlare, spec.DNS.Domain, subDomain); err != nil { return err }
+    switch {
+    case len(ip) == 0 && spec.DNS.CloudFlare:   return cf.DeleteDomainRecord(subDomain)
+    case len(ip) == 0:                          return do.DeleteDomainRecord(spec.DNS.Domain, subDomain)
+    case spec.DNS.CloudFlare:                   return cf.AssignDomainRecord("A", subDomain, ip)
+    }
+    return do.AssignDomainRecord(spec.DNS.Domain, "A", subDomain, ip)
+}
+
+/*! \brief Brings the cluster in line with the spec, creating the missing nodes up to the count and removing the ones past it
+ *  The balancer and firewall go by the stack's tag so they pick up new nodes on their own, the records are kept up to date here
+ */
+func runCluster (spec cluster_spec_t, dryRun bool, config config_t, do libraries.DO_c, cf libraries.CF_c) (*cluster_result_t, error) {
+    result := &cluster_result_t{Name: spec.Name, Created: make([]string, 0), Deleted: make([]string, 0)}
+    do.Stack = spec.Name
+    do.Owner, do.Note = spec.Owner, spec.Note
+    if spec.DNS != nil && spec.DNS.CloudFlare {
+        if len(cf.Config.APIKey) < 1 { return nil, fmt.Errorf("Cannot use CloudFlare without the api_key set in the harbormaster.json config file") }
+        if err := cf.SelectZone("", spec.DNS.Domain); err != nil { return nil, err }
+    }
+
+    nodes, err := do.ListNodes("", spec.Name)
+    if err != nil { return nil, err }
+    existing := make(map[int]bool)
+    for _, n := range(nodes) {
+        index := spec.nodeIndex(n.Name)
+        if index > spec.Count {
+            result.Deleted = append(result.Deleted, n.Name)
+        } else if index > 0 {
+            existing[index] = true
+        }
+    }
+    for i := 1; i <= spec.Count; i++ {
+        if !existing[i] { result.Created = append(result.Created, spec.nodeName(i)) }
+    }
+    sort.Slice(result.Deleted, func (i, j int) bool { return spec.nodeIndex(result.Deleted[i]) > spec.nodeIndex(result.Deleted[j]) })  //newest go first
+
+    for _, name := range(result.Created) { fmt.Println("+ node " + name) }
+    for _, name := range(result.Deleted) { fmt.Println("- node " + name) }
+    if dryRun {
+        if len(spec.Firewall) > 0 {
+            diff, err := do.ApplyFirewall(spec.Name, spec.Firewall, true)
+            if err != nil { return nil, err }
+            for _, d := range(diff) { fmt.Println(d) }
+        }
+        result.Nodes = nodes
+        return result, nil
+    }
+
+    if len(result.Created) > 0 {
+        targetSize, err := targetSizeSlug(spec.Size, spec.CPU, spec.Slug)
+        if err == nil && len(targetSize) == 0 { err = fmt.Errorf("Size of node not set in the spec, or with the -size, -cpu or -slug option") }
+        userData := ""
+        if err == nil && len(spec.UserData) > 0 {
+            var data []byte
+            data, err = ioutil.ReadFile(spec.UserData)
+            userData = string(data)
+        }
+        image := ""
+        if err == nil { image, err = do.ResolveImage(spec.Image, spec.Region, spec.Latest) }
+        if err != nil { return nil, err }
+
+        for _, name := range(result.Created) {
+            fmt.Printf("Creating node: %s with the size %s\n", name, targetSize)
+            event := hook_event_t{Name: name, Region: spec.Region, Size: targetSize, Image: image, Tag: spec.Tag}
+            err = config.Hooks.around(do, "create", event, func () error {
+                return do.CreateNode(name, spec.Region, spec.Tag, targetSize, image, spec.SSHKey, userData, &libraries.FileOutput_t{})
+            })
+            if err != nil { return result, err }
+        }
+    }
+
+    if len(spec.Firewall) > 0 {
+        if _, err = do.ApplyFirewall(spec.Name, spec.Firewall, false); err != nil { return result, err }
+    }
+
+    if spec.Balancer != nil {
+        result.Balancer, err = do.AssignLoadBalancer(spec.Name, spec.Region, spec.Name, spec.Balancer.ForwardingRules, spec.Balancer.HealthCheck)
+        if err != nil { return result, err }
+    }
+
+    if spec.DNS != nil {
+        for _, sub := range(spec.DNS.Names) {
+            if err = clusterRecord(spec, config, do, cf, sub, result.Balancer.IP); err != nil { return result, err }
+        }
+        if spec.DNS.Nodes {
+            if nodes, err = do.ListNodes("", spec.Name); err != nil { return result, err }    //the new ones have their addresses now
+            for _, n := range(nodes) {
+                index := spec.nodeIndex(n.Name)
+                if index == 0 || index > spec.Count || len(n.IP) == 0 { continue }
+                if err = clusterRecord(spec, config, do, cf, n.Name, n.IP); err != nil { return result, err }
+            }
+            for _, name := range(result.Deleted) {  //out of the records before the node goes away
+                if err = clusterRecord(spec, config, do, cf, name, ""); err != nil { return result, err }
+            }
+        }
+    }
+
+    for _, name := range(result.Deleted) {
+        if err = config.Protected.checkNode(do, name); err != nil { return result, err }
+        err = config.Hooks.around(do, "delete", hook_event_t{Name: name}, func () error { return do.DeleteNode(name) })
+        if err != nil { return result, err }
+    }
+
+    result.Nodes, err = do.ListNodes("", spec.Name)
+    return result, err
+}
+
+/*! \brief The floating ip on one of the region's nodes, reserving one for the first node when none of them have one
+ */
+func clusterFloatingIP (spec cluster_spec_t, nodes []libraries.DO_node_t, do libraries.DO_c) (string, error) {
+    if len(nodes) == 0 { return "", nil }
+    floating, err := do.ListFloatingIPs()
+    if err != nil { return "", err }
+    first := nodes[0]
+    for _, n := range(nodes) {
+        for _, f := range(floating) {
+            if f.DropletID == n.ID { return f.IP, nil }
+        }
+        if index := spec.nodeIndex(n.Name); index > 0 && (spec.nodeIndex(first.Name) == 0 || index < spec.nodeIndex(first.Name)) { first = n }
+    }
+    fmt.Println("Reserving a floating ip for " + first.Name)
+    return do.ReserveFloatingIP(first.ID)
+}
+
+/*! \brief The origins for the region's pool, its floating ip, otherwise its balancer, otherwise each of its nodes
+ */
+func clusterOrigins (result *cluster_result_t) []libraries.CF_pool_origin_t {
+    switch {
+    case len(result.FloatingIP) > 0:
+        return []libraries.CF_pool_origin_t{{Name: result.Name, Address: result.FloatingIP, Enabled: true, Weight: 1}}
+    case result.Balancer != nil && len(result.Balancer.IP) > 0:
+        return []libraries.CF_pool_origin_t{{Name: result.Name, Address: result.Balancer.IP, Enabled: true, Weight: 1}}
+    }
+    origins := make([]libraries.CF_pool_origin_t, 0, len(result.Nodes))
+    for _, n := range(result.Nodes) {
+        if len(n.IP) > 0 { origins = append(origins, libraries.CF_pool_origin_t{Name: n.Name, Address: n.IP, Enabled: true, Weight: 1}) }
+    }
+    return origins
+}
+
+/*! \brief Brings each region's stack in line with the spec, then points the names at a cloud flare load balancer with a pool for each region
+ *  Each part of the world goes to the regions for it, the rest of it gets all of them
+ */
+func runClusterRegions (spec cluster_spec_t, dryRun bool, config config_t, do libraries.DO_c, cf libraries.CF_c) (*cluster_result_t, error) {
+    result := &cluster_result_t{Name: spec.Name, Created: make([]string, 0), Deleted: make([]string, 0), Nodes: make([]libraries.DO_node_t, 0)}
+    geo := spec.DNS != nil && len(spec.DNS.Names) > 0
+    regionPools := make(map[string][]string)
+    pools := make([]string, 0, len(spec.Regions))
+
+    for _, r := range(spec.Regions) {
+        sub := spec
+        sub.Name, sub.Region, sub.Count, sub.Regions = spec.Name + "-" + r.Region, r.Region, r.Count, nil
+        if spec.DNS != nil {
+            dns := *spec.DNS
+            dns.Names = nil     //those are the geo balancer's
+            sub.DNS = &dns
+        }
+
+        fmt.Printf("Region %s, %d nodes\n", r.Region, r.Count)
+        regionResult, err := runCluster(sub, dryRun, config, do, cf)
+        if regionResult != nil {
+            regionResult.Region = r.Region
+            result.Created = append(result.Created, regionResult.Created...)
+            result.Deleted = append(result.Deleted, regionResult.Deleted...)
+            result.Nodes = append(result.Nodes, regionResult.Nodes...)
+            result.Regions = append(result.Regions, regionResult)
+        }
+        if err != nil { return result, err }
+
+        if dryRun {
+            if geo { fmt.Printf("~ pool %s for %s\n", sub.Name, strings.Join(r.cfRegions(), ", ")) }
+            continue
+        }
+        if r.FloatingIP {
+            if regionResult.FloatingIP, err = clusterFloatingIP(sub, regionResult.Nodes, do); err != nil { return result, err }
+        }
+        if geo {
+            pool, err := cf.AssignPool(sub.Name, clusterOrigins(regionResult))
+            if err != nil { return result, err }
+            pools = append(pools, pool.ID)
+            for _, code := range(r.cfRegions()) { regionPools[code] = append(regionPools[code], pool.ID) }
+        }
+    }
+
+    if geo {
+        for _, sub := range(spec.DNS.Names) {
+            if err := config.Protected.checkDNS(cf, true, spec.DNS.Domain, sub); err != nil { return result, err }
+            hostname := strings.ToLower(spec.DNS.Domain)
+            if sub != "@" { hostname = strings.ToLower(sub) + "." + hostname }
+            fmt.Println("~ geo load balancer " + hostname)
+            if dryRun { continue }
+            if err := cf.AssignGeoBalancer(hostname, regionPools, pools); err != nil { return result, err }
+        }
+    }
+    return result, nil
+}
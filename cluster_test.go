@@ -0,0 +1,103 @@
+package main
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "reflect"
+    "testing"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+/*! \brief Stands in for the provider api through base_url, answering each "METHOD path" with the json.  Anything else is a 404
+ */
+func stubAPI (t *testing.T, replies map[string]string) string {
+    server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        body, ok := replies[r.Method + " " + r.URL.Path]
+        if !ok {
+            http.NotFound(w, r)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(body))
+    }))
+    t.Cleanup(server.Close)
+    return server.URL
+}
+
+func TestReadClusterSpec (t *testing.T) {
+    tests := []struct {
+        name        string
+        content     string
+        fails       bool
+    }{
+        {"works", `{"name":"web","count":2,"balancer":{"forwarding_rules":[]},"dns":{"domain":"example.com","names":["www"]}}`, false},
+        {"no name", `{"count":2}`, true},
+        {"negative count", `{"name":"web","count":-1}`, true},
+        {"dns without a domain", `{"name":"web","dns":{"nodes":true}}`, true},
+        {"names without a balancer", `{"name":"web","dns":{"domain":"example.com","names":["www"]}}`, true},
+        {"unknown field", `{"name":"web","colour":"blue"}`, true},
+        {"bad json", `{"name":`, true},
+    }
+
+    for _, tt := range(tests) {
+        loc := filepath.Join(t.TempDir(), "cluster.json")
+        if err := ioutil.WriteFile(loc, []byte(tt.content), 0644); err != nil { t.Fatal(err) }
+        _, err := readClusterSpec(loc, cluster_spec_t{Region: "nyc3"})
+        if tt.fails != (err != nil) { t.Errorf("%s: error %v", tt.name, err) }
+    }
+}
+
+func TestClusterNodeIndex (t *testing.T) {
+    spec := cluster_spec_t{Name: "web"}
+    tests := []struct {
+        name        string
+        index       int
+    }{
+        {"web-1", 1},
+        {"web-12", 12},
+        {"web-api-1", 0},
+        {"webby-1", 0},
+        {"web-", 0},
+        {"db-1", 0},
+    }
+
+    for _, tt := range(tests) {
+        if index := spec.nodeIndex(tt.name); index != tt.index { t.Errorf("%s: index %d, expecting %d", tt.name, index, tt.index) }
+    }
+    if name := spec.nodeName(3); name != "web-3" { t.Errorf("Node name %s, expecting web-3", name) }
+}
+
+func TestClusterDryRun (t *testing.T) {
+    api := stubAPI(t, map[string]string{
+        "GET /droplets": `{"droplets":[{"id":1,"name":"web-1","tags":["hm:stack:web"]},{"id":2,"name":"web-2","tags":["hm:stack:web"]},{"id":3,"name":"web-3","tags":["hm:stack:web"]},{"id":4,"name":"web-extra","tags":["hm:stack:web"]},{"id":5,"name":"web-4"}]}`,
+        "GET /firewalls": `{"firewalls":[]}`,
+    })
+    var config config_t
+    do := libraries.DO_c{Config: libraries.DO_config_t{APIKey: "key", BaseURL: api, FirewallRules: map[string]libraries.DO_rule_set_t{
+        "web": {Inbound: []libraries.DO_fw_rule_t{{Protocol: "tcp", Ports: "80", Sources: &libraries.DO_fw_target_t{Addresses: []string{"0.0.0.0/0"}}}}},
+    }}}
+
+    tests := []struct {
+        count       int
+        created     []string
+        deleted     []string
+    }{
+        {3, []string{}, []string{}},
+        {5, []string{"web-4", "web-5"}, []string{}},
+        {1, []string{}, []string{"web-3", "web-2"}},
+        {0, []string{}, []string{"web-3", "web-2", "web-1"}},
+    }
+
+    for _, tt := range(tests) {
+        spec := cluster_spec_t{Name: "web", Count: tt.count, Firewall: []string{"web"}}
+        result, err := runCluster(spec, true, config, do, libraries.CF_c{})
+        if err != nil { t.Fatalf("%d: %s", tt.count, err) }
+        if !reflect.DeepEqual(result.Created, tt.created) || !reflect.DeepEqual(result.Deleted, tt.deleted) {
+            t.Errorf("%d: created %v deleted %v, expecting %v and %v", tt.count, result.Created, result.Deleted, tt.created, tt.deleted)
+        }
+        if len(result.Nodes) != 4 { t.Errorf("%d: %d nodes, expecting the 4 listed", tt.count, len(result.Nodes)) }
+    }
+}
@@ -0,0 +1,259 @@
+/*! \file cutover.go
+    \brief Moving a record's traffic to a new address gradually with -cutover, through cloud flare pool weights or by lowering the ttl first
+ *  Each stage is saved to a checkpoint file as it's reached, so an interrupted cutover picks up where it left off when it's run again
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "time"
+    "context"
+    "strings"
+    "path/filepath"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief What to cut over and how
+ */
+type cutover_t struct {
+    CloudFlare  bool
+    Domain      string
+    SubDomain   string
+    Type        string
+    To          string
+    Origin      string          //name for the new origin when it isn't in the pool yet
+    Pool        string          //cloud flare load balancer pool, the weights are moved instead of the record
+    Steps       []int           //percent of the traffic the new address gets at each step
+    StepWait    time.Duration   //between the pool steps, and after switching a record before its ttl is put back
+    TTL         int             //the record's ttl while it's switched
+}
+
+/*! \brief How far the cutover got, it's the output of the run too
+ */
+type cutover_checkpoint_t struct {
+    Record      string      `json:"record"`
+    Type        string      `json:"type,omitempty"`
+    Pool        string      `json:"pool,omitempty"`
+    From        string      `json:"from,omitempty"`
+    To          string      `json:"to"`
+    TTL         int         `json:"ttl,omitempty"`     //what the record's ttl was, it's put back at the end
+    Stage       string      `json:"stage"`     //lowered, switched or done for records, weight for pools
+    Weight      int         `json:"weight,omitempty"`  //percent the new origin is at
+    At          time.Time   `json:"at"`        //when the stage was reached
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Parses the -steps percents, they have to go up and end at 100
+ */
+func cutoverSteps (list string) ([]int, error) {
+    steps := make([]int, 0)
+    for _, s := range(strings.Split(list, ",")) {
+        var p int
+        if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d", &p); err != nil || p < 1 || p > 100 { return nil, fmt.Errorf("Invalid step '%s', expecting percents from 1 to 100", s) }
+        if len(steps) > 0 && p <= steps[len(steps) - 1] { return nil, fmt.Errorf("The steps have to go up, %d is after %d", p, steps[len(steps) - 1]) }
+        steps = append(steps, p)
+    }
+    if len(steps) == 0 || steps[len(steps) - 1] != 100 { return nil, fmt.Errorf("The last step has to be 100") }
+    return steps, nil
+}
+
+/*! \brief Waits until the time, unless the run's context is done first
+ */
+func waitUntilTime (ctx context.Context, what string, until time.Time) error {
+    d := time.Until(until)
+    if d <= 0 { return nil }
+    if ctx == nil { ctx = context.Background() }
+    fmt.Printf("Waiting %s for %s\n", d.Round(time.Second), what)
+    select {
+    case <-time.After(d):
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (cp *cutover_checkpoint_t) save (loc string) error {
+    cp.At = time.Now().UTC()
+    jStr, _ := json.MarshalIndent(cp, "", "  ")
+    if err := ioutil.WriteFile(loc, jStr, 0644); err != nil { return fmt.Errorf("Unable to write the checkpoint '%s' :: %s", loc, err.Error()) }
+    return nil
+}
+
+/*! \brief Reads the checkpoint of a cutover that didn't finish, a new one when there isn't one
+ */
+func readCutover (loc string, opts cutover_t, record string) (*cutover_checkpoint_t, error) {
+    cp := &cutover_checkpoint_t{Record: record, Type: opts.Type, Pool: opts.Pool, To: opts.To}
+    data, err := ioutil.ReadFile(loc)
+    if os.IsNotExist(err) { return cp, nil }
+    if err != nil { return nil, fmt.Errorf("Unable to read the checkpoint '%s' :: %s", loc, err.Error()) }
+    if err = json.Unmarshal(data, cp); err != nil { return nil, fmt.Errorf("Invalid checkpoint '%s' :: %s", loc, err.Error()) }
+    if cp.To != opts.To || cp.Pool != opts.Pool { return nil, fmt.Errorf("A cutover of %s to %s is already under way.  run it again to finish it, or remove '%s'", record, cp.To, loc) }
+    fmt.Printf("Picking up the cutover of %s at %s, from %s\n", record, cp.Stage, cp.At.Local().Format("2006-01-02 15:04:05"))
+    return cp, nil
+}
+
+/*! \brief Moves the pool's weight to the new origin a step at a time, waiting between them
+ */
+func cutoverPool (opts cutover_t, cp *cutover_checkpoint_t, loc string, dryRun bool, do libraries.DO_c, cf libraries.CF_c) error {
+    pool, err := cf.GetPool(opts.Pool)
+    if err != nil { return err }
+
+    found := false
+    for _, o := range(pool.Origins) { found = found || o.Address == opts.To }
+    if !found {
+        name := opts.Origin
+        if len(name) == 0 { name = opts.To }
+        pool.Origins = append(pool.Origins, libraries.CF_pool_origin_t{Name: name, Address: opts.To, Enabled: true})
+    }
+
+    for _, p := range(opts.Steps) {
+        if p > cp.Weight { fmt.Printf("~ pool %s, %s at %d%%\n", pool.Name, opts.To, p) }
+    }
+    if dryRun { return nil }
+
+    for _, p := range(opts.Steps) {
+        if p <= cp.Weight { continue }
+        if cp.Weight > 0 {
+            if err = waitUntilTime(do.Ctx, fmt.Sprintf("the pool at %d%%", cp.Weight), cp.At.Add(opts.StepWait)); err != nil { return err }
+        }
+
+        for i, o := range(pool.Origins) {
+            if o.Address == opts.To {
+                pool.Origins[i].Weight, pool.Origins[i].Enabled = float64(p) / 100, true
+            } else if o.Enabled {
+                pool.Origins[i].Weight = float64(100 - p) / 100
+            }
+        }
+        err = do.Progress.Step(fmt.Sprintf("weight %d%%", p), func () error { return cf.SetPoolOrigins(*pool) })
+        if err != nil { return err }
+        cp.Stage, cp.Weight = "weight", p
+        if err = cp.save(loc); err != nil { return err }
+    }
+    return nil
+}
+
+/*! \brief Lowers the record's ttl, waits for the old one to run out, switches it and puts the ttl back once the new address has had a while
+ *  Proxied cloud flare records don't have a ttl that matters, so they're just switched
+ */
+func cutoverRecord (opts cutover_t, cp *cutover_checkpoint_t, loc string, dryRun bool, do libraries.DO_c, cf libraries.CF_c) error {
+    update := func (content string, ttl int) error {
+        if opts.CloudFlare { return cf.UpdateDomainRecord(opts.Type, opts.SubDomain, content, ttl) }
+        return do.UpdateDomainRecord(opts.Domain, opts.Type, opts.SubDomain, content, ttl)
+    }
+
+    proxied := false
+    if len(cp.Stage) == 0 {
+        var ttl int
+        if opts.CloudFlare {
+            rec, err := cf.GetDomainRecord(opts.Type, opts.SubDomain)
+            if err != nil { return err }
+            if rec == nil { return fmt.Errorf("Domain record %s doesn't exist to cut over", cp.Record) }
+            cp.From, ttl, proxied = rec.Content, rec.TTL, rec.Proxied
+        } else {
+            rec, err := do.GetDomainRecord(opts.Domain, opts.Type, opts.SubDomain)
+            if err != nil { return err }
+            if rec == nil { return fmt.Errorf("Domain record %s doesn't exist to cut over", cp.Record) }
+            cp.From, ttl = rec.Data, rec.TTL
+        }
+        if cp.From == opts.To {
+            fmt.Printf("%s already points at %s\n", cp.Record, opts.To)
+            cp.Stage = "done"
+            return nil
+        }
+        cp.TTL = ttl
+
+        if proxied {
+            fmt.Printf("~ %s %s -> %s, it's proxied so it's switched right away\n", cp.Record, cp.From, opts.To)
+        } else if ttl > opts.TTL {
+            fmt.Printf("~ %s ttl %d -> %d, then wait %ds for the old ttl to run out\n", cp.Record, ttl, opts.TTL, ttl)
+            fmt.Printf("~ %s %s -> %s, then wait %s\n", cp.Record, cp.From, opts.To, opts.StepWait)
+            fmt.Printf("~ %s ttl %d -> %d\n", cp.Record, opts.TTL, ttl)
+        } else {
+            fmt.Printf("~ %s %s -> %s, its ttl is already %d\n", cp.Record, cp.From, opts.To, ttl)
+        }
+    }
+    if dryRun { return nil }
+
+    if proxied {
+        if err := do.Progress.Step("switch record", func () error { return update(opts.To, 0) }); err != nil { return err }
+        cp.Stage = "done"
+        return nil
+    }
+
+    low := opts.TTL
+    if cp.TTL > 0 && cp.TTL < low { low = cp.TTL }
+    if len(cp.Stage) == 0 {
+        if cp.TTL > low {
+            if err := do.Progress.Step("lower ttl", func () error { return update(cp.From, low) }); err != nil { return err }
+        }
+        cp.Stage = "lowered"
+        if err := cp.save(loc); err != nil { return err }
+    }
+
+    if cp.Stage == "lowered" {
+        if err := waitUntilTime(do.Ctx, "the old ttl to run out", cp.At.Add(time.Duration(cp.TTL) * time.Second)); err != nil { return err }
+        if err := do.Progress.Step("switch record", func () error { return update(opts.To, low) }); err != nil { return err }
+        cp.Stage = "switched"
+        if err := cp.save(loc); err != nil { return err }
+    }
+
+    if cp.Stage == "switched" {
+        if cp.TTL > low {
+            if err := waitUntilTime(do.Ctx, "the new address before the ttl goes back", cp.At.Add(opts.StepWait)); err != nil { return err }
+            if err := do.Progress.Step("restore ttl", func () error { return update(opts.To, cp.TTL) }); err != nil { return err }
+        }
+        cp.Stage = "done"
+    }
+    return nil
+}
+
+/*! \brief Cuts the record, or the pool, over to the new address.  The checkpoint is removed once it's done
+ */
+func runCutover (opts cutover_t, dryRun bool, stateDir string, config config_t, do libraries.DO_c, cf libraries.CF_c) (*cutover_checkpoint_t, error) {
+    if len(opts.To) == 0 { return nil, fmt.Errorf("Address to cut over to not set.  use the -ip or -n option") }
+    if len(opts.Pool) > 0 && !opts.CloudFlare { return nil, fmt.Errorf("Load balancer pools are only on Cloud Flare, use the -cloudflare option") }
+    if opts.CloudFlare && len(cf.Config.APIKey) < 1 { return nil, fmt.Errorf("Cannot use CloudFlare without the api_key set in the harbormaster.json config file") }
+
+    record := opts.Pool
+    if len(opts.Pool) == 0 {
+        if len(opts.SubDomain) == 0 { return nil, fmt.Errorf("Subdomain not set.  use the -sd option, or -pool for a load balancer pool") }
+        if !opts.CloudFlare && len(opts.Domain) == 0 { return nil, fmt.Errorf("Domain name not set.  use the -d option") }
+        if err := config.Protected.checkDNS(cf, opts.CloudFlare, opts.Domain, opts.SubDomain); err != nil { return nil, err }
+        record = strings.ToLower(opts.SubDomain)
+        if len(opts.Domain) > 0 { record += "." + strings.ToLower(opts.Domain) }
+    }
+
+    loc := filepath.Join(stateDir, "cutover_" + strings.NewReplacer("*", "_", "/", "_").Replace(record) + ".json")
+    cp, err := readCutover(loc, opts, record)
+    if err != nil { return nil, err }
+
+    if len(opts.Pool) > 0 {
+        err = cutoverPool(opts, cp, loc, dryRun, do, cf)
+        if err == nil && !dryRun { cp.Stage = "done" }
+    } else {
+        err = cutoverRecord(opts, cp, loc, dryRun, do, cf)
+    }
+    if err != nil {
+        if len(cp.Stage) > 0 { fmt.Printf("Run it again to carry on from %s\n", cp.Stage) }
+        return cp, err
+    }
+
+    if dryRun {
+        fmt.Println("Dry run, nothing was changed")
+    } else {
+        os.Remove(loc)
+    }
+    return cp, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+/*! \brief Digital ocean's domain records for the test, they're listed and updated like the api does through base_url
+ */
+type stub_records_t struct {
+    Records     []libraries.DO_record_t
+    lock        sync.Mutex
+}
+
+func (s *stub_records_t) ServeHTTP (w http.ResponseWriter, r *http.Request) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")     //domains/example.com/records/id
+    if len(parts) < 3 || parts[0] != "domains" || parts[2] != "records" {
+        http.NotFound(w, r)
+        return
+    }
+    if len(parts) == 3 && r.Method == "GET" {
+        json.NewEncoder(w).Encode(map[string]interface{}{"domain_records": s.Records})
+        return
+    }
+
+    id := -1
+    if len(parts) == 4 { id, _ = strconv.Atoi(parts[3]) }
+    for i := range(s.Records) {
+        if s.Records[i].ID != id { continue }
+        if r.Method == "PUT" {
+            body, _ := ioutil.ReadAll(r.Body)
+            json.Unmarshal(body, &s.Records[i])
+            s.Records[i].ID = id
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"domain_record": s.Records[i]})
+        return
+    }
+    http.NotFound(w, r)
+}
+
+/*! \brief The record with the name, it has to be there
+ */
+func (s *stub_records_t) get (t *testing.T, name string) libraries.DO_record_t {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    for _, r := range(s.Records) {
+        if r.Name == name { return r }
+    }
+    t.Fatalf("Record %s is gone", name)
+    return libraries.DO_record_t{}
+}
+
+/*! \brief Digital ocean pointed at the records
+ */
+func stubRecords (t *testing.T, records ...libraries.DO_record_t) (libraries.DO_c, *stub_records_t) {
+    stub := &stub_records_t{Records: records}
+    server := httptest.NewServer(stub)
+    t.Cleanup(server.Close)
+    return libraries.DO_c{Config: libraries.DO_config_t{APIKey: "key", BaseURL: server.URL}, Progress: &libraries.Progress_t{}}, stub
+}
+
+func TestCutoverSteps (t *testing.T) {
+    tests := []struct {
+        list        string
+        steps       []int
+    }{
+        {"10,50,100", []int{10, 50, 100}},
+        {" 25 , 100 ", []int{25, 100}},
+        {"100", []int{100}},
+        {"10,50", nil},
+        {"50,10,100", nil},
+        {"50,50,100", nil},
+        {"0,100", nil},
+        {"10,abc,100", nil},
+        {"", nil},
+    }
+
+    for _, tt := range(tests) {
+        steps, err := cutoverSteps(tt.list)
+        if tt.steps == nil {
+            if err == nil { t.Errorf("'%s': expecting an error, got %v", tt.list, steps) }
+            continue
+        }
+        if err != nil || !reflect.DeepEqual(steps, tt.steps) { t.Errorf("'%s': got %v %v, expecting %v", tt.list, steps, err, tt.steps) }
+    }
+}
+
+func TestCutoverRecord (t *testing.T) {
+    do, records := stubRecords(t, libraries.DO_record_t{ID: 1, Type: "A", Name: "api", Data: "192.0.2.10", TTL: 1}, libraries.DO_record_t{ID: 2, Type: "A", Name: "www", Data: "192.0.2.20", TTL: 1})
+    var config config_t
+
+    tests := []struct {
+        name        string
+        opts        cutover_t
+        stage       string      //empty when it fails
+        data        string      //where the record ends up
+    }{
+        {"switched", cutover_t{Domain: "example.com", SubDomain: "api", Type: "A", To: "192.0.2.30", TTL: 60}, "done", "192.0.2.30"},
+        {"already there", cutover_t{Domain: "example.com", SubDomain: "www", Type: "A", To: "192.0.2.20", TTL: 60}, "done", "192.0.2.20"},
+        {"missing", cutover_t{Domain: "example.com", SubDomain: "gone", Type: "A", To: "192.0.2.30", TTL: 60}, "", ""},
+        {"no address", cutover_t{Domain: "example.com", SubDomain: "api", Type: "A", TTL: 60}, "", ""},
+        {"pool without cloud flare", cutover_t{Pool: "web", To: "192.0.2.30"}, "", ""},
+    }
+
+    for _, tt := range(tests) {
+        cp, err := runCutover(tt.opts, false, t.TempDir(), config, do, libraries.CF_c{})
+        if len(tt.stage) == 0 {
+            if err == nil { t.Errorf("%s: expecting an error", tt.name) }
+            continue
+        }
+        if err != nil { t.Fatalf("%s: %s", tt.name, err) }
+        if cp.Stage != tt.stage { t.Errorf("%s: stage %s, expecting %s", tt.name, cp.Stage, tt.stage) }
+        if rec := records.get(t, tt.opts.SubDomain); rec.Data != tt.data { t.Errorf("%s: points at %s, expecting %s", tt.name, rec.Data, tt.data) }
+    }
+}
+
+func TestCutoverPool (t *testing.T) {
+    pool := libraries.CF_pool_t{ID: "pool-1", Name: "web", Origins: []libraries.CF_pool_origin_t{{Name: "old", Address: "192.0.2.10", Enabled: true, Weight: 1}}}
+    weights := make([]float64, 0)   //the new origin's weight at each patch
+    server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+        switch r.Method + " " + r.URL.Path {
+        case "GET /accounts/acct/load_balancers/pools":
+            json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": []libraries.CF_pool_t{pool}})
+        case "PATCH /accounts/acct/load_balancers/pools/pool-1":
+            json.NewDecoder(r.Body).Decode(&pool)
+            weights = append(weights, pool.Origins[len(pool.Origins) - 1].Weight)
+            json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": pool})
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+
+    var config config_t
+    cf := libraries.CF_c{Config: libraries.CF_config_t{APIKey: "key", Email: "me@example.com", Account: "acct", BaseURL: server.URL}}
+    opts := cutover_t{CloudFlare: true, Pool: "web", To: "192.0.2.20", Origin: "new", Steps: []int{25, 50, 100}}
+    cp, err := runCutover(opts, false, t.TempDir(), config, libraries.DO_c{Progress: &libraries.Progress_t{}}, cf)
+    if err != nil { t.Fatal(err) }
+    if cp.Stage != "done" || cp.Weight != 100 { t.Errorf("Stage %s at %d%%, expecting done at 100%%", cp.Stage, cp.Weight) }
+    if !reflect.DeepEqual(weights, []float64{0.25, 0.5, 1}) { t.Errorf("New origin went %v, expecting 0.25, 0.5 then 1", weights) }
+    if len(pool.Origins) != 2 || pool.Origins[0].Weight != 0 || pool.Origins[1].Name != "new" { t.Errorf("Pool ended up %+v", pool.Origins) }
+}
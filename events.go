@@ -0,0 +1,186 @@
+/*! \file events.go
+    \brief Server-sent events with -events, so chatops bots and the cmdb can follow what a watcher changes instead of polling for it
+ *  Nodes showing up or going away under -watch, the records -failover switches and the stack's health flipping under -status-page are all sent
+*/
+
+package main
+
+import (
+    "fmt"
+    "context"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "encoding/json"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const events_path       = "/events"
+const events_recent     = 200   //kept for subscribers that reconnect with a Last-Event-ID
+const events_buffer     = 64    //a subscriber further behind than this is dropped, it picks up the rest when it reconnects
+const events_heartbeat  = 30 * time.Second
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Something that changed, ie node.created, node.deleted, dns.updated, failover.triggered or health.changed
+ */
+type event_t struct {
+    ID          int64       `json:"id"`
+    Time        time.Time   `json:"time"`
+    Type        string      `json:"type"`
+    Target      string      `json:"target"`
+    Detail      string      `json:"detail,omitempty"`
+}
+
+/*! \brief Hands the events out to whoever is subscribed.  A nil hub is fine to publish to, it's how -events being off looks
+ */
+type event_hub_t struct {
+    lock        sync.Mutex
+    next        int64
+    recent      []event_t
+    subs        map[chan event_t]bool
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func (h *event_hub_t) publish (kind, target, detail string) {
+    if h == nil { return }
+    h.lock.Lock()
+    defer h.lock.Unlock()
+
+    h.next++
+    e := event_t{ID: h.next, Time: time.Now().UTC(), Type: kind, Target: target, Detail: detail}
+    h.recent = append(h.recent, e)
+    if len(h.recent) > events_recent { h.recent = h.recent[len(h.recent) - events_recent:] }
+
+    for sub := range(h.subs) {
+        select {
+        case sub <- e:
+        default:
+            delete(h.subs, sub)     //too far behind
+            close(sub)
+        }
+    }
+}
+
+/*! \brief Subscribes, with the recent events after the id to catch up on first
+ */
+func (h *event_hub_t) subscribe (after int64) (chan event_t, []event_t) {
+    h.lock.Lock()
+    defer h.lock.Unlock()
+
+    missed := make([]event_t, 0)
+    for _, e := range(h.recent) {
+        if e.ID > after { missed = append(missed, e) }
+    }
+    sub := make(chan event_t, events_buffer)
+    h.subs[sub] = true
+    return sub, missed
+}
+
+func (h *event_hub_t) unsubscribe (sub chan event_t) {
+    h.lock.Lock()
+    defer h.lock.Unlock()
+    if h.subs[sub] {
+        delete(h.subs, sub)
+        close(sub)
+    }
+}
+
+/*! \brief Whether the event is one the subscriber asked for with ?types=, a type ending in a dot matches all of them, ie node.
+ */
+func eventWanted (types []string, e event_t) bool {
+    if len(types) == 0 { return true }
+    for _, t := range(types) {
+        if e.Type == t || (strings.HasSuffix(t, ".") && strings.HasPrefix(e.Type, t)) { return true }
+    }
+    return false
+}
+
+/*! \brief The event stream, picking up after the Last-Event-ID header, or ?after=, when the subscriber is reconnecting
+ */
+func (h *event_hub_t) ServeHTTP (w http.ResponseWriter, r *http.Request) {
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+        return
+    }
+
+    last := r.Header.Get("Last-Event-ID")
+    if len(last) == 0 { last = r.URL.Query().Get("after") }
+    after, _ := strconv.ParseInt(last, 10, 64)
+    types := make([]string, 0)
+    for _, t := range(strings.Split(r.URL.Query().Get("types"), ",")) {
+        if t = strings.TrimSpace(t); len(t) > 0 { types = append(types, t) }
+    }
+
+    sub, missed := h.subscribe(after)
+    defer h.unsubscribe(sub)
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+
+    send := func (e event_t) {
+        if !eventWanted(types, e) { return }
+        jStr, _ := json.Marshal(e)
+        fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, jStr)
+    }
+    for _, e := range(missed) { send(e) }
+    flusher.Flush()
+
+    heartbeat := time.NewTicker(events_heartbeat)
+    defer heartbeat.Stop()
+    for {
+        select {
+        case e, open := <-sub:
+            if !open { return }
+            send(e)
+        case <-heartbeat.C:
+            fmt.Fprint(w, ": keepalive\n\n")   //proxies close streams that go quiet
+        case <-r.Context().Done():
+            return
+        }
+        flusher.Flush()
+    }
+}
+
+/*! \brief Starts serving the events on the address, ie :8090, the returned func stops it
+ */
+func serveEvents (addr string) (*event_hub_t, func (), error) {
+    hub := &event_hub_t{subs: make(map[chan event_t]bool)}
+    mux := http.NewServeMux()
+    mux.Handle(events_path, hub)
+    server := &http.Server{Addr: addr, Handler: mux}
+
+    errs := make(chan error, 1)
+    go func () { errs <- server.ListenAndServe() }()
+    select {
+    case err := <-errs:     //the address being taken shows up right away
+        return nil, nil, fmt.Errorf("Unable to serve events on '%s' :: %s", addr, err.Error())
+    case <-time.After(100 * time.Millisecond):
+    }
+    fmt.Printf("Serving events on %s%s\n", addr, events_path)
+
+    return hub, func () {
+        ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+        defer cancel()
+        hub.lock.Lock()
+        for sub := range(hub.subs) {    //streams never finish on their own, so they're ended before the shutdown waits on them
+            delete(hub.subs, sub)
+            close(sub)
+        }
+        hub.lock.Unlock()
+        server.Shutdown(ctx)
+    }, nil
+}
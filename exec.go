@@ -0,0 +1,105 @@
+/*! \file exec.go
+    \brief -exec runs a command on every node with the tag or in the stack, a few at a time, with each line of output prefixed by the node it came from
+*/
+
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "bytes"
+    "strings"
+    "sync"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Writes whole lines with the prefix in front, the lock is shared so lines from different nodes don't interleave
+ */
+type prefix_writer_t struct {
+    prefix      string
+    out         io.Writer
+    lock        *sync.Mutex
+    buf         []byte
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func (w *prefix_writer_t) Write (p []byte) (int, error) {
+    w.buf = append(w.buf, p...)
+    for {
+        i := bytes.IndexByte(w.buf, '\n')
+        if i < 0 { return len(p), nil }
+        w.line(w.buf[:i])
+        w.buf = w.buf[i + 1:]
+    }
+}
+
+/*! \brief Writes out a last line that didn't end in a newline
+ */
+func (w *prefix_writer_t) Flush () {
+    if len(w.buf) > 0 { w.line(w.buf) }
+    w.buf = nil
+}
+
+func (w *prefix_writer_t) line (l []byte) {
+    w.lock.Lock()
+    defer w.lock.Unlock()
+    fmt.Fprintf(w.out, "%s%s\n", w.prefix, bytes.TrimRight(l, "\r"))
+}
+
+/*! \brief Runs the command on the nodes, at most concurrency at a time, and returns how it went on each in the listing's order
+ *  Any failures are summed up in the error, the results are still all there
+ */
+func execNodes (tag, stack, command string, concurrency int, dryRun bool, do libraries.DO_c) ([]*libraries.DO_exec_t, error) {
+    if len(command) == 0 { return nil, fmt.Errorf("Command to run not set.  put it after --, ie -exec -tag workers -- 'systemctl restart app'") }
+    if len(tag) == 0 && len(stack) == 0 { return nil, fmt.Errorf("Nodes to run the command on not set.  use the -tag or -stack option") }
+    nodes, err := do.ListNodes(tag, stack)
+    if err != nil { return nil, err }
+    if len(nodes) == 0 { return nil, fmt.Errorf("No nodes to run the command on") }
+
+    width := 0
+    for _, n := range(nodes) {
+        if len(n.Name) > width { width = len(n.Name) }
+    }
+    results := make([]*libraries.DO_exec_t, len(nodes))
+    if dryRun {
+        for i, n := range(nodes) {
+            fmt.Printf("~ %s: %s\n", n.Name, command)
+            results[i] = &libraries.DO_exec_t{Node: n.Name, IP: n.IP, Result: "dry run"}
+        }
+        return results, nil
+    }
+
+    if concurrency < 1 { concurrency = 1 }
+    slots := make(chan struct{}, concurrency)
+    lock := &sync.Mutex{}
+    wg := sync.WaitGroup{}
+    for i, n := range(nodes) {
+        wg.Add(1)
+        go func (i int, n libraries.DO_node_t) {
+            defer wg.Done()
+            slots <- struct{}{}
+            defer func() { <-slots }()
+
+            w := &prefix_writer_t{prefix: fmt.Sprintf("%-*s | ", width, n.Name), out: os.Stdout, lock: lock}
+            results[i] = do.ExecNode(n, command, w)
+            w.Flush()
+        }(i, n)
+    }
+    wg.Wait()
+
+    failed := make([]string, 0)
+    for _, r := range(results) {
+        if r.Result != "ok" { failed = append(failed, r.Node) }
+    }
+    if len(failed) > 0 { return results, fmt.Errorf("Command failed on %d of %d nodes :: %s", len(failed), len(nodes), strings.Join(failed, ", ")) }
+    return results, nil
+}
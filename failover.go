@@ -0,0 +1,153 @@
+/*! \file failover.go
+    \brief Watching a primary origin with -failover and pointing its record at a standby when it goes down, for where there aren't floating ips
+ *  A switch needs several probes in a row to agree and a while since the last one, so a flaky origin doesn't have the record flapping
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "context"
+    "os/signal"
+    "strings"
+    "time"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief What to watch and when to switch
+ */
+type failover_t struct {
+    CloudFlare  bool
+    Domain      string
+    SubDomain   string
+    Type        string
+    Primary     string
+    Standby     string
+    HealthURL   string          //{ip} is swapped for the address being probed
+    Interval    time.Duration   //between probes
+    FailAfter   int             //failed probes in a row before switching to the standby
+    RecoverAfter    int         //good probes of the primary in a row before switching back
+    Hold        time.Duration   //least time between switches
+    TTL         int             //the record's ttl is kept at or under this, so a switch takes effect quickly
+    Events      *event_hub_t    //switches are sent here with -events
+}
+
+/*! \brief A switch the watcher made, they're the output of the run
+ */
+type failover_event_t struct {
+    Time        time.Time   `json:"time"`
+    Record      string      `json:"record"`
+    From        string      `json:"from"`
+    To          string      `json:"to"`
+    Reason      string      `json:"reason"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Where the record points now and its ttl, and whether cloud flare is proxying it
+ */
+func (opts failover_t) record (do libraries.DO_c, cf libraries.CF_c) (content string, ttl int, proxied bool, err error) {
+    if opts.CloudFlare {
+        var rec *libraries.CF_record_t
+        if rec, err = cf.GetDomainRecord(opts.Type, opts.SubDomain); err == nil && rec != nil { return rec.Content, rec.TTL, rec.Proxied, nil }
+    } else {
+        var rec *libraries.DO_record_t
+        if rec, err = do.GetDomainRecord(opts.Domain, opts.Type, opts.SubDomain); err == nil && rec != nil { return rec.Data, rec.TTL, false, nil }
+    }
+    if err == nil { err = fmt.Errorf("Domain record %s doesn't exist to fail over", opts.SubDomain) }
+    return
+}
+
+func (opts failover_t) update (do libraries.DO_c, cf libraries.CF_c, content string, ttl int) error {
+    if opts.CloudFlare { return cf.UpdateDomainRecord(opts.Type, opts.SubDomain, content, ttl) }
+    return do.UpdateDomainRecord(opts.Domain, opts.Type, opts.SubDomain, content, ttl)
+}
+
+/*! \brief Probes the primary every interval until the run is stopped or times out, moving the record to the standby and back
+ *  The record's ttl is lowered first when it's over the limit, proxied cloud flare records switch right away so theirs is left alone
+ */
+func runFailover (opts failover_t, dryRun bool, config config_t, do libraries.DO_c, cf libraries.CF_c) ([]failover_event_t, error) {
+    if len(opts.Primary) == 0 || len(opts.Standby) == 0 { return nil, fmt.Errorf("Primary and standby addresses not set.  use the -ip, or -n, and -standby options") }
+    if len(opts.SubDomain) == 0 { return nil, fmt.Errorf("Subdomain not set.  use the -sd option") }
+    if !opts.CloudFlare && len(opts.Domain) == 0 { return nil, fmt.Errorf("Domain name not set.  use the -d option") }
+    if opts.CloudFlare && len(cf.Config.APIKey) < 1 { return nil, fmt.Errorf("Cannot use CloudFlare without the api_key set in the harbormaster.json config file") }
+    if opts.FailAfter < 1 || opts.RecoverAfter < 1 { return nil, fmt.Errorf("-fail-after and -recover-after have to be at least 1") }
+    if err := config.Protected.checkDNS(cf, opts.CloudFlare, opts.Domain, opts.SubDomain); err != nil { return nil, err }
+
+    name := strings.ToLower(opts.SubDomain)
+    if len(opts.Domain) > 0 { name += "." + strings.ToLower(opts.Domain) }
+    events := make([]failover_event_t, 0)
+
+    current, ttl, proxied, err := opts.record(do, cf)
+    if err != nil { return nil, err }
+    if current != opts.Primary && current != opts.Standby { return nil, fmt.Errorf("%s points at %s, which is neither the primary or the standby", name, current) }
+    if !proxied && ttl > opts.TTL {
+        fmt.Printf("~ %s ttl %d -> %d\n", name, ttl, opts.TTL)
+        if !dryRun {
+            if err = opts.update(do, cf, current, opts.TTL); err != nil { return nil, err }
+        }
+        ttl = opts.TTL
+    }
+    if proxied { ttl = 0 }  //keeps what cloud flare has
+
+    parent := do.Ctx
+    if parent == nil { parent = context.Background() }
+    ctx, stop := signal.NotifyContext(parent, os.Interrupt)     //ctrl-c, or the -timeout, is how a watcher is meant to stop
+    defer stop()
+    do.Ctx, cf.Ctx = ctx, ctx
+
+    fmt.Printf("Watching %s for %s, %s is the standby\n", opts.Primary, name, opts.Standby)
+    failed, good := 0, 0
+    var lastSwitch time.Time
+    for {
+        probeErr := probeHTTP(strings.ReplaceAll(opts.HealthURL, "{ip}", opts.Primary))
+        if probeErr == nil {
+            failed, good = 0, good + 1
+        } else {
+            failed, good = failed + 1, 0
+            if do.Verbose { fmt.Printf("%s failed a probe, %d in a row :: %s\n", opts.Primary, failed, probeErr.Error()) }
+        }
+
+        to, reason := "", ""
+        switch {
+        case current == opts.Primary && failed >= opts.FailAfter:
+            to, reason = opts.Standby, fmt.Sprintf("%d failed probes :: %s", failed, probeErr.Error())
+        case current == opts.Standby && good >= opts.RecoverAfter:
+            to, reason = opts.Primary, fmt.Sprintf("%d good probes", good)
+        }
+
+        if len(to) > 0 && time.Since(lastSwitch) >= opts.Hold {
+            fmt.Printf("%s %s -> %s, %s\n", time.Now().Format("2006-01-02 15:04:05"), name, to, reason)
+            if !dryRun {
+                err = do.Progress.Step("switch to " + to, func () error { return opts.update(do, cf, to, ttl) })
+            }
+            if err != nil {
+                fmt.Printf("  FAILED :: %s\n", err.Error())     //the next probe tries again, a watcher shouldn't give up over one api error
+                err = nil
+            } else {
+                events = append(events, failover_event_t{Time: time.Now().UTC(), Record: name, From: current, To: to, Reason: reason})
+                if !dryRun {
+                    opts.Events.publish("failover.triggered", name, fmt.Sprintf("%s -> %s, %s", current, to, reason))
+                    opts.Events.publish("dns.updated", name, fmt.Sprintf("%s %s -> %s", opts.Type, current, to))
+                }
+                current, lastSwitch = to, time.Now()
+            }
+        }
+
+        select {
+        case <-time.After(opts.Interval):
+        case <-ctx.Done():
+            fmt.Printf("Stopped watching, %s points at %s\n", name, current)
+            if dryRun { fmt.Println("Dry run, nothing was changed") }
+            return events, nil
+        }
+    }
+}
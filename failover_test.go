@@ -0,0 +1,34 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+func TestFailover (t *testing.T) {
+    down := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) }))
+    defer down.Close()
+
+    primary := "127.0.0.1"
+    do, records := stubRecords(t, libraries.DO_record_t{ID: 1, Type: "A", Name: "api", Data: primary, TTL: 3600})
+    var config config_t
+
+    opts := failover_t{Domain: "example.com", SubDomain: "api", Type: "A", Primary: primary, Standby: "192.0.2.20",
+        HealthURL: strings.Replace(down.URL, primary, "{ip}", 1), Interval: 10 * time.Millisecond, FailAfter: 2, RecoverAfter: 2, TTL: 60}
+    ctx, cancel := context.WithTimeout(context.Background(), 500 * time.Millisecond)
+    defer cancel()
+    do.Ctx = ctx
+
+    events, err := runFailover(opts, false, config, do, libraries.CF_c{})
+    if err != nil { t.Fatal(err) }
+    if len(events) != 1 || events[0].From != primary || events[0].To != opts.Standby { t.Fatalf("Expecting one switch to the standby :: %+v", events) }
+
+    rec := records.get(t, "api")
+    if rec.Data != opts.Standby || rec.TTL != opts.TTL { t.Errorf("Record is %s with a ttl of %d, expecting %s and %d", rec.Data, rec.TTL, opts.Standby, opts.TTL) }
+}
@@ -0,0 +1,165 @@
+/*! \file grants.go
+    \brief Temporary firewall openings with -fw-allow, ie ssh from wherever you are for a couple hours
+ *  Each grant is kept in a journal with when it expires and -reap closes the expired ones, opening and closing are both logged
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "net"
+    "strings"
+    "time"
+    "path/filepath"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const grants_file   = "fw_grants.json"
+const grants_log    = "fw_grants.log"
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type fw_grant_t struct {
+    Node        string      `json:"node"`
+    Firewall    string      `json:"firewall"`
+    FirewallID  string      `json:"firewall_id"`
+    Rule        libraries.DO_fw_rule_t  `json:"rule"`
+    By          string      `json:"by"`
+    Created     time.Time   `json:"created"`
+    Expires     time.Time   `json:"expires"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func (g fw_grant_t) id () string {
+    return fmt.Sprintf("%s/%s/%s/%s", g.FirewallID, g.Rule.Protocol, g.Rule.Ports, strings.Join(g.Rule.Sources.Addresses, ","))
+}
+
+func (g fw_grant_t) String () string {
+    return fmt.Sprintf("%s %s from %s on %s", g.Rule.Protocol, g.Rule.Ports, strings.Join(g.Rule.Sources.Addresses, ","), g.Firewall)
+}
+
+/*! \brief Where the grants are kept, the state repo when there is one so whoever runs -reap sees them, otherwise next to the undo file
+ */
+func grantsDir (stateRepo string) (string, error) {
+    if len(stateRepo) > 0 { return stateRepo, nil }
+    dir, err := os.UserCacheDir()
+    if err != nil { return "", fmt.Errorf("Unable to find a place for the firewall grants :: %s", err.Error()) }
+    return filepath.Join(dir, "harbormaster"), nil
+}
+
+func readGrants (dir string) ([]fw_grant_t, error) {
+    grants := make([]fw_grant_t, 0)
+    loc := filepath.Join(dir, grants_file)
+    data, err := ioutil.ReadFile(loc)
+    if os.IsNotExist(err) { return grants, nil }
+    if err != nil { return nil, fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+    if err = json.Unmarshal(data, &grants); err != nil { return nil, fmt.Errorf("Invalid firewall grants '%s' :: %s", loc, err.Error()) }
+    return grants, nil
+}
+
+func writeGrants (dir string, grants []fw_grant_t) error {
+    loc := filepath.Join(dir, grants_file)
+    jStr, _ := json.MarshalIndent(grants, "", "  ")
+    os.MkdirAll(dir, 0755)
+    if err := ioutil.WriteFile(loc, jStr, 0644); err != nil { return fmt.Errorf("Unable to write '%s' :: %s", loc, err.Error()) }
+    return nil
+}
+
+/*! \brief Prints the event and adds it to the log next to the grants
+ */
+func logGrant (dir, event string, g fw_grant_t) {
+    line := fmt.Sprintf("%s %s %s for %s by %s, expires %s", time.Now().UTC().Format(time.RFC3339), event, g.String(), g.Node, historyBy(), g.Expires.Format(time.RFC3339))
+    fmt.Println(line)
+    f, err := os.OpenFile(filepath.Join(dir, grants_log), os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
+    if err != nil {
+        fmt.Printf("Unable to log the firewall grant :: %s\n", err.Error())
+        return
+    }
+    defer f.Close()
+    fmt.Fprintln(f, line)
+}
+
+/*! \brief Opens the port on the node's firewall to the address until the ttl is up
+ */
+func allowTemp (node, proto, port, from string, ttl time.Duration, stateRepo string, dryRun bool, do libraries.DO_c) (*fw_grant_t, error) {
+    if len(node) == 0 { return nil, fmt.Errorf("Node name not set.  use the -n option") }
+    if len(port) == 0 || len(from) == 0 { return nil, fmt.Errorf("Port and address to open it to not set.  use the -port and -from options") }
+    if net.ParseIP(from) == nil {
+        if _, _, err := net.ParseCIDR(from); err != nil { return nil, fmt.Errorf("'%s' isn't an ip address or range", from) }
+    }
+    if ttl <= 0 { return nil, fmt.Errorf("A temporary opening needs a -ttl") }
+
+    firewalls, err := do.NodeFirewalls(node)
+    if err != nil { return nil, err }
+    if len(firewalls) == 0 { return nil, fmt.Errorf("Node '%s' doesn't have a firewall to open, give its stack one with -fw", node) }
+
+    now := time.Now().UTC()
+    g := &fw_grant_t{Node: node, Firewall: firewalls[0].Name, FirewallID: firewalls[0].ID, By: historyBy(), Created: now, Expires: now.Add(ttl),
+        Rule: libraries.DO_fw_rule_t{Protocol: strings.ToLower(proto), Ports: port, Sources: &libraries.DO_fw_target_t{Addresses: []string{from}}}}
+    fmt.Printf("+ %s until %s\n", g.String(), g.Expires.Local().Format("2006-01-02 15:04"))
+    if dryRun { return g, nil }
+
+    dir, err := grantsDir(stateRepo)
+    if err != nil { return nil, err }
+    grants, err := readGrants(dir)
+    if err != nil { return nil, err }
+
+    if err = do.AddFirewallRule(g.FirewallID, g.Rule); err != nil { return nil, err }
+    kept := []fw_grant_t{*g}
+    for _, old := range(grants) {
+        if old.id() != g.id() { kept = append(kept, old) }     //opening it again pushes the expiry out
+    }
+    logGrant(dir, "opened", *g)
+    return g, writeGrants(dir, kept)
+}
+
+/*! \brief The grants that are past their expiry, for -reap
+ */
+func expiredGrants (stateRepo string) ([]fw_grant_t, error) {
+    dir, err := grantsDir(stateRepo)
+    if err != nil { return nil, err }
+    grants, err := readGrants(dir)
+    if err != nil { return nil, err }
+
+    expired := make([]fw_grant_t, 0)
+    for _, g := range(grants) {
+        if g.Expires.Before(time.Now()) { expired = append(expired, g) }
+    }
+    return expired, nil
+}
+
+/*! \brief Closes the grant and takes it out of the journal, one that's already gone from the firewall is just taken out
+ */
+func revokeGrant (g fw_grant_t, stateRepo string, do libraries.DO_c) error {
+    dir, err := grantsDir(stateRepo)
+    if err != nil { return err }
+
+    removed, err := do.RemoveFirewallRule(g.FirewallID, g.Rule)
+    if err != nil { return err }
+    if removed {
+        logGrant(dir, "closed", g)
+    } else {
+        logGrant(dir, "already closed", g)
+    }
+
+    grants, err := readGrants(dir)
+    if err != nil { return err }
+    kept := make([]fw_grant_t, 0, len(grants))
+    for _, old := range(grants) {
+        if old.id() != g.id() { kept = append(kept, old) }
+    }
+    return writeGrants(dir, kept)
+}
@@ -9,59 +9,223 @@ import (
 	"fmt"
 	"flag"
     "os"
+    "errors"
+    "context"
+    "strings"
+    "time"
     "io/ioutil"
+    "path/filepath"
     "encoding/json"
+    "net/http"
     
     "github.com/NathanRThomas/harbormaster/libraries"
 )
 
 const VER		= "0.4"
 
+var config_uptime_types = map[string]bool{"A": true, "AAAA": true, "CNAME": true}  //records that get an automatic uptime check
+
+/*! \brief Error for when something took longer than we were willing to wait
+ */
+type timeout_error struct {
+    What    string
+    After   time.Duration
+}
+
+func (e timeout_error) Error () string {
+    return fmt.Sprintf("Timed out after %s %s", e.After, e.What)
+}
+
 type config_t struct {
     DO      libraries.DO_config_t  `json:"digital_ocean"`
     CF      libraries.CF_config_t   `json:"cloud_flare"`
+    Hooks   hooks_t     `json:"hooks"`  //local commands run before and after node changes
+    Protected   protected_t `json:"protected"`  //nodes and records we won't delete or overwrite
+    ReadOnly    bool        `json:"read_only"`  //same as -read-only, for configs with production credentials
+    DNSHistory  libraries.DNS_history_t `json:"dns_history"`  //copies of the zones we change
+    StateRepo   string      `json:"state_repo"`  //git repo the output and dns history are kept and committed in
+    Update      update_config_t `json:"update"`
+    Allowlists  map[string]allowlist_t  `json:"allowlists"`   //by name, for -allowsync
+    Slack       slack_config_t  `json:"slack"`  //slash commands for -slack
 }
 
 //-------------------------------------------------------------------------------------------------------------------------//
 //----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
 //-------------------------------------------------------------------------------------------------------------------------//
 
-/*! \brief Reads in our config file
+/*! \brief The credentials in the config, so they can be kept out of anything we save
  */
-func readConfig (loc string) (config config_t, err error) {
+func (config config_t) secrets () []string {
+    list := []string{config.DO.APIKey, config.DO.SpacesKey, config.DO.SpacesSecret, config.CF.APIKey, config.CF.R2AccessKey}
+    for _, account := range(config.CF.Accounts) { list = append(list, account.APIKey, account.R2AccessKey) }
+    list = append(list, config.Slack.SigningSecret, config.Slack.BotToken)
+    for _, val := range(config.DO.Headers) {    //gateways tend to want their own credentials, the ones from $VARS are who's running it
+        if libraries.ExpandHeader(val) == val { list = append(list, val) }
+    }
+    for _, val := range(config.CF.Headers) {
+        if libraries.ExpandHeader(val) == val { list = append(list, val) }
+    }
+    return list
+}
+
+/*! \brief The base_urls standing in for the provider apis, their requests count as api requests too
+ */
+func (config config_t) apiHosts () []string {
+    list := []string{config.DO.BaseURL, config.CF.BaseURL}
+    for _, account := range(config.CF.Accounts) { list = append(list, account.BaseURL) }
+    return list
+}
+
+/*! \brief Reads in our config file, the api keys in the environment win over its own and without one they're all it takes
+ *  With the fake provider the config is optional, and its credentials are swapped for ones only the fake takes
+ */
+func readConfig (loc string, fake bool) (config config_t, err error) {
     //Read in the eggs
     configFile, err := os.Open(loc) //try the file
+    if fake {
+        defer libraries.FakeCredentials(&config.DO, &config.CF)
+        if os.IsNotExist(err) { return config, nil }
+    }
     
 	if err == nil {
         defer configFile.Close()
 		jsonParser := json.NewDecoder(configFile)
 		err = jsonParser.Decode(&config)
+    } else if !fake && os.IsNotExist(err) && envCredentials(&config) {
+        err = nil   //the keys from the environment are enough, ie a -service-install env file
+	} else {
+        return config, fmt.Errorf("Unable to open '%s' file :: " + err.Error(), loc)
+    }
         
-        if err == nil {
-            if len(config.DO.APIKey) < 1 && len(config.CF.APIKey) < 1 {
-                err = fmt.Errorf("No valid api keys found")
-            } else if len(config.DO.APIKey) > 0 && len(config.DO.APIKey) < 64 {
-                err = fmt.Errorf("Digital Ocean api key appears invalid")
-            } else if len(config.CF.APIKey) > 0 && len(config.CF.Email) < 1 {
-                err = fmt.Errorf("Cloud Flare requires an email associated with the api key")
-            } else if len(config.CF.APIKey) > 0 && len(config.CF.Zone) < 1 {
-                err = fmt.Errorf("Cloud Flare requires a zone id associated with it")
-            }
+    if err == nil {
+        envCredentials(&config)     //they win over the file's
+        if fake {
+            err = config.Hooks.validate()
+            if err == nil { err = config.Protected.validate() }
+        } else if len(config.DO.APIKey) < 1 && len(config.CF.APIKey) < 1 {
+            err = fmt.Errorf("No valid api keys found")
+        } else if len(config.DO.APIKey) > 0 && len(config.DO.APIKey) < 64 {
+            err = fmt.Errorf("Digital Ocean api key appears invalid")
+        } else if len(config.CF.APIKey) > 0 && len(config.CF.Email) < 1 {
+            err = fmt.Errorf("Cloud Flare requires an email associated with the api key")
+        } else {
+            err = config.Hooks.validate()
+            if err == nil { err = config.Protected.validate() }
         }
-	} else {
-        err = fmt.Errorf("Unable to open '%s' file :: " + err.Error(), loc)
     }
     return
 }
 
-/*! \brief Writes the json out for the file
+/*! \brief Figures out the size slug from the ram or cpu size, or the slug itself for the premium and gpu sizes.  Empty if none were set
+ */
+func targetSizeSlug (size, cpu int, slug string) (string, error) {
+    if (size > 0 && cpu > 0) || (len(slug) > 0 && (size > 0 || cpu > 0)) {
+        return "", fmt.Errorf("Please use only one of the -size, -cpu or -slug flags.\n-size is for a normal droplet based on ram size\n-cpu is for the higher cpu droplets and is based on cpu count\n-slug is the exact size, ie 's-2vcpu-4gb-amd' or 'gpu-h100x1-80gb'")
+    } else if len(slug) > 0 {
+        return strings.ToLower(slug), nil
+    } else if size > 0 {
+        return fmt.Sprintf("%dgb", size), nil
+    } else if cpu > 0 {
+        return fmt.Sprintf("c-%d", cpu), nil
+    }
+    return "", nil
+}
+
+/*! \brief Creates the tunnel, writing out its credentials file when it's new, and routes the sub domain through it
+ */
+func provisionTunnel (cf libraries.CF_c, name, subDomain, service, dir string) (*libraries.CF_tunnel_t, error) {
+    tunnel, err := cf.CreateTunnel(name)
+    if err != nil { return nil, err }
+    
+    if len(tunnel.Secret) > 0 {  //only new tunnels have their secret, so this is our one chance to save it
+        creds, err := cf.TunnelCredentials(tunnel)
+        if err == nil { err = ioutil.WriteFile(filepath.Join(dir, tunnel.ID + ".json"), creds, 0600) }
+        if err != nil { return nil, err }
+        fmt.Printf("Tunnel credentials written to %s.json\n", tunnel.ID)
+    }
+    
+    if len(subDomain) > 0 {
+        zone, err := cf.ZoneName()
+        if err == nil { err = cf.RouteTunnel(tunnel, subDomain + "." + zone, service) }
+        if err == nil { err = cf.AssignTunnelRecord(subDomain, tunnel) }
+        if err != nil { return nil, err }
+    }
+    return tunnel, nil
+}
+
+/*! \brief Adds an uptime check for a sub domain we just pointed at something, if the config asks for it
+ */
+func autoUptimeCheck (do libraries.DO_c, cf libraries.CF_c, cloudflare bool, domain, subDomain, recordType string) (err error) {
+    if !config_uptime_types[strings.ToUpper(recordType)] || !do.Config.Uptime.Auto { return }
+    
+    if cloudflare && len(domain) == 0 { domain, err = cf.ZoneName() }    //cloud flare doesn't need the domain passed in
+    if err == nil { err = do.AutoUptimeCheck(strings.ToLower(subDomain + "." + domain)) }
+    return
+}
+
+/*! \brief Points an AAAA record for the sub domain at the node's ipv6 address, alongside the A record we just set
+ *  Nodes without ipv6 enabled are left with just the A record
+ */
+func assignIPv6Record (do libraries.DO_c, cf libraries.CF_c, cloudflare bool, domain, subDomain, recordType, node string) error {
+    if len(node) == 0 { return fmt.Errorf("AAAA records come from the node's networks, use the -n option") }
+    if !strings.EqualFold(recordType, "A") { return nil }
+    
+    ip, err := do.NodeIPv6(node)
+    if err != nil { return err }
+    if len(ip) == 0 {
+        if do.Verbose { fmt.Printf("Node '%s' doesn't have ipv6 enabled, skipping the AAAA record\n", node) }
+        return nil
+    }
+    
+    if cloudflare { return cf.AssignDomainRecord("AAAA", subDomain, ip) }
+    return do.AssignDomainRecord(domain, "AAAA", subDomain, ip)
+}
+
+/*! \brief Limits the operation to its own timeout when it's set, on top of the one for the whole run
+ *  A deadline from it comes back as a timeout error saying what was going on
+ */
+func withTimeout (do libraries.DO_c, timeout time.Duration, what string, fn func (do libraries.DO_c) error) error {
+    if timeout <= 0 { return fn(do) }
+    
+    ctx, cancel := context.WithTimeout(do.Ctx, timeout)
+    defer cancel()
+    
+    do.Ctx = ctx
+    err := fn(do)
+    if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil { err = timeout_error{What: what, After: timeout} }
+    return err
+}
+
+/*! \brief Serves the maintenance page while fn runs, when on is set
+ *  It's taken down whether or not fn worked, with its own context so a timeout doesn't leave it up
  */
-func writeOutput (loc string, fileOutput libraries.FileOutput_t) (error) {
-    data, _ := json.Marshal(fileOutput)
-    err := ioutil.WriteFile(loc, data, 0644)
+func withMaintenance (cf libraries.CF_c, on bool, fn func () error) error {
+    if !on { return fn() }
+    
+    fmt.Println("Turning on maintenance mode")
+    previous, err := cf.MaintenanceOn()
+    if err != nil { return err }
+    
+    err = fn()
+    
+    fmt.Println("Turning off maintenance mode")
+    cf.Ctx = context.Background()
+    if offErr := cf.MaintenanceOff(previous); offErr != nil {
+        if err == nil { return offErr }
+        fmt.Println("Unable to turn off maintenance mode :: " + offErr.Error())
+    }
     return err
 }
 
+/*! \brief Lets us know if a flag was passed on the command line, vs just using its default
+ */
+func flagSet (name string) (found bool) {
+    flag.Visit(func (f *flag.Flag) {
+        if f.Name == name { found = true }
+    })
+    return
+}
+
 //-------------------------------------------------------------------------------------------------------------------------//
 //----- MAIN --------------------------------------------------------------------------------------------------------------//
 //-------------------------------------------------------------------------------------------------------------------------//
@@ -81,24 +245,245 @@ func main() {
     fDelete     := flag.Bool("Dn", false, "Delete a node")
     fResize     := flag.Bool("z", false, "Re-size an existing node")
     fDeleteSub  := flag.Bool("Ds", false, "Delete a sub domain")
-    fCreateSub  := flag.Bool("cs", false, "Create a sub domain")
-    fFloatingIP := flag.Bool("fip", false, "Sets a floating ip to a node")
+    fCreateSub  := flag.Bool("cs", false, "Create a sub domain, pointing at -ip or the node named -n")
+    fFloatingIP := flag.Bool("fip", false, "Sets a floating ip to a node, -ip=auto reserves one in the node's region if it doesn't have one")
+    fListSub    := flag.Bool("ls", false, "List domain records, filtered by the -t, -sd and -content options")
+    fCreateHost := flag.Bool("ch", false, "Create a Cloud Flare custom hostname")
+    fDeleteHost := flag.Bool("Dch", false, "Delete a Cloud Flare custom hostname")
+    fListHost   := flag.Bool("lch", false, "List the Cloud Flare custom hostnames")
+    fCreateSpec := flag.Bool("cspec", false, "Create or update a Cloud Flare spectrum app for -host, proxying -proto on -port to -ip or the node named -n")
+    fDeleteSpec := flag.Bool("Dspec", false, "Delete the Cloud Flare spectrum app for -host")
+    fListSpec   := flag.Bool("lspec", false, "List the Cloud Flare spectrum apps")
+    fEmailRoute := flag.Bool("er", false, "Enable Cloud Flare email routing on the zone")
+    fEmailFwd   := flag.Bool("ef", false, "Forward an email address on the zone to another address, enables routing if needed")
+    fDeleteFwd  := flag.Bool("Def", false, "Delete an email forward")
+    fListFwd    := flag.Bool("lef", false, "List the email forwards for the zone")
+    fCreateBkt  := flag.Bool("cb", false, "Create a spaces bucket, or an r2 bucket with -cloudflare applying its cors and lifecycle rules from the config")
+    fDeleteBkt  := flag.Bool("Db", false, "Delete a spaces or r2 bucket")
+    fListBkt    := flag.Bool("lb", false, "List the spaces or r2 buckets")
+    fBucketCred := flag.Bool("r2creds", false, "Generate temporary access credentials for an r2 bucket")
+    fCreateCDN  := flag.Bool("cdn", false, "Put a cdn endpoint in front of a spaces bucket, -sd and -d set a custom domain for it")
+    fDeleteCDN  := flag.Bool("Dcdn", false, "Delete the cdn endpoint in front of a spaces bucket")
+    fListCDN    := flag.Bool("lcdn", false, "List the cdn endpoints")
+    fPurgeCDN   := flag.Bool("purge", false, "Purge the cdn cache for a spaces bucket")
+    fTunnel     := flag.Bool("tunnel", false, "Create a Cloud Flare tunnel named -n, routing -sd through it.  With -c the connector is installed on the new node")
+    fAnalytics  := flag.Bool("analytics", false, "Cloud Flare requests, bandwidth, threats and dns queries per day for the zone")
+    fCreateCert := flag.Bool("ccert", false, "Create a certificate named -cert, uploaded from -certfile or let's encrypt for -dns")
+    fDeleteCert := flag.Bool("Dcert", false, "Delete a certificate")
+    fListCert   := flag.Bool("lcert", false, "List the certificates and their expiry")
+    fApp        := flag.String("app", "", "JSON app spec file to create or update an app platform app from")
+    fDeploy     := flag.Bool("deploy", false, "Start a new deployment of the app platform app named -n")
+    fCreateNS   := flag.Bool("cns", false, "Create a functions namespace labeled -namespace")
+    fDeleteNS   := flag.Bool("Dns", false, "Delete a functions namespace")
+    fListNS     := flag.Bool("lns", false, "List the functions namespaces")
+    fCreateTrig := flag.Bool("ctrig", false, "Create or update a scheduled trigger in -namespace running -function on -cron")
+    fDeleteTrig := flag.Bool("Dtrig", false, "Delete a scheduled trigger")
+    fListTrig   := flag.Bool("ltrig", false, "List the triggers in -namespace")
+    fCreateUp   := flag.Bool("cup", false, "Create or update an uptime check named -check on -target, with the alerts from the config")
+    fDeleteUp   := flag.Bool("Dup", false, "Delete an uptime check")
+    fListUp     := flag.Bool("lup", false, "List the uptime checks")
+    fCreatePool := flag.Bool("cpool", false, "Create or update the kubernetes node pool named -pool in -cluster from the config")
+    fDeletePool := flag.Bool("Dpool", false, "Delete a kubernetes node pool")
+    fListPool   := flag.Bool("lpool", false, "List the node pools in -cluster")
+    fUpgrade    := flag.Bool("upgrade", false, "Upgrade -cluster to -k8s, or the newest kubernetes version available")
+    fKubeconfig := flag.Bool("kubeconfig", false, "Print the kubeconfig for -cluster, with credentials lasting -expiry seconds")
+    fCreateDBP  := flag.Bool("cdbpool", false, "Create or update a connection pool named -pool on the -db cluster")
+    fDeleteDBP  := flag.Bool("Ddbpool", false, "Delete a database connection pool")
+    fListDBP    := flag.Bool("ldbpool", false, "List the connection pools on the -db cluster")
+    fCreateRep  := flag.Bool("crep", false, "Create a read only replica named -replica of the -db cluster")
+    fDeleteRep  := flag.Bool("Drep", false, "Delete a read only replica")
+    fListRep    := flag.Bool("lrep", false, "List the read only replicas of the -db cluster")
+    fMaintain   := flag.Bool("maint", false, "Set the maintenance window of the -db cluster to -day and -hour")
+    fFork       := flag.Bool("fork", false, "Create a new database cluster named -n from the backups of -db, as it was at -at")
+    fAudit      := flag.Bool("audit", false, "Security audit for nodes without a firewall and sensitive ports open to everyone, with -cloudflare also records exposing a node's ip")
+    fHealth     := flag.Bool("health", false, "Probe the health url of every node in -stack or with -tag, their floating ips and load balancers, and with -d the records pointing at them")
+    fHealthURL  := flag.String("health-url", "http://{ip}/", "Url probed for -health, {ip} is swapped for each address.  ie 'http://{ip}:8080/health'")
+    fFirewall   := flag.Bool("fw", false, "Create or update the firewall for the nodes in -stack from the -rules sets in the config")
+    fAllowTemp  := flag.Bool("fw-allow", false, "Open -port on the firewall of the node named -n to -from for -ttl, ie '-port 22 -from 203.0.113.7 -ttl 2h'.  -reap closes it once it's expired")
+    fAllowSync  := flag.String("allowsync", "", "Make the firewall rule or Cloud Flare ip access rules for this allowlist from the config match its source, or 'all' for every one.  ie from cron")
+    fRules      := flag.String("rules", "", "Comma separated firewall rule sets from the config. ie 'web,ssh-from-office'")
+    fTagAudit   := flag.Bool("tagaudit", false, "List the nodes missing any of the required_tags from the config, only the ones with -tag when it's set")
+    fRetag      := flag.String("retag", "", "CSV or JSON file of node name patterns with the tags to add and remove from them")
+    fConsole    := flag.Bool("console", false, "Print the console and recovery links for the node named -n, with -console-action run first")
+    fConsoleAct := flag.String("console-action", "", "Run this on the node before printing its console links. ie 'power_cycle' or 'password_reset' to have a root password emailed for the console login")
+    fCheckPTR   := flag.Bool("ptr", false, "Check the reverse dns of the node named -n matches its name, which mail servers need")
+    fRename     := flag.String("rename", "", "Rename the node named -n to this, use the fully qualified domain name it sends mail as so its PTR record matches")
+    fDNSSync    := flag.Bool("dnssync", false, "Make the A records in -d match the names of the nodes with -tag, removing the ones it made for nodes that are gone")
+    fListNodes  := flag.Bool("ln", false, "List the nodes, only the ones with -tag or in -stack when they're set")
+    fStackDiff  := flag.String("diff", "", "Compare -stack with this stack, ie before promoting staging to prod.  The records in -d are compared when it's set")
+    fAnnotate   := flag.Bool("annotate", false, "Set the -owner and -note on the node named -n, replacing the ones it has")
+    fSelf       := flag.Bool("self", false, "Run on a droplet, shows its metadata.  With -sd it points the record at itself, {hostname} is swapped for its name, and with -tag it adds the tag to itself")
+    fOneClicks  := flag.Bool("oneclicks", false, "List the 1-Click marketplace apps nodes can be created from with -image app:<slug>")
+    fListSizes  := flag.Bool("sizes", false, "List the sizes nodes can be, only the ones in -region when it's set and -class when it's set")
+    fClass      := flag.String("class", "", "Size class -sizes lists.  ie basic, premium-intel, premium-amd, cpu-optimized, memory-optimized, storage-optimized, general-purpose or gpu")
+    fListAction := flag.Bool("lact", false, "List the most recent actions on the account, or on the node named -n")
+    fWaitAction := flag.Int("wact", 0, "Wait for the action with this id to finish, ie one from an interrupted run")
+    fReap       := flag.Bool("reap", false, "Delete the nodes and volumes past their -ttl, unassigned floating ips and unattached volumes, and close expired -fw-allow openings.  Use -dry-run first to see what goes")
+    fVolSnap    := flag.String("vsnap", "", "Snapshot the volume with this name in -region, ie from cron.  With -prune its snapshots older than -days are deleted, keeping the newest -keep")
+    fVolRestore := flag.String("attach-snapshot", "", "Make a volume from the newest volume snapshot named like this and attach it to the node named -n, or just make it in -region. ie 'pgdata-*'")
+    fBuildImage := flag.Bool("build-image", false, "Build a snapshot with the packer template from the config and wait for it to be available.  With -rollout the nodes are rebuilt from it")
+    fRollout    := flag.Bool("rollout", false, "Rebuild the nodes picked by -tag or -stack from -image one at a time, each has to be ready before the next")
+    fExec       := flag.Bool("exec", false, "Run a command over ssh on the nodes with -tag or in -stack, -concurrency at a time.  The command goes after --, ie -exec -tag workers -- 'systemctl restart app'")
+    fPush       := flag.Bool("push", false, "Copy files over sftp to the nodes with -tag or in -stack, -concurrency at a time.  The files go after the options as local:remote, ie -push -tag web ./nginx.conf:/etc/nginx/nginx.conf")
+    fReload     := flag.String("reload", "", "Command run on each node after -push copies its files, ie 'nginx -s reload'")
+    fInventory  := flag.String("inventory", "", "Write the nodes with -tag or in -stack, or all of them, as 'prometheus' file_sd targets grouped by tag or as an 'ssh' config.  Prometheus targets are on -port, 9100 when it's not set")
+    fInvOut     := flag.String("inventory-out", "", "File -inventory writes to, it's only rewritten when the inventory changed.  Stdout when it's not set")
+    fWatch      := flag.Bool("watch", false, "Keep -inventory or -status-page up to date, rewriting it every -interval until ctrl-c or the -timeout")
+    fSlack      := flag.String("slack", "", "Answer slack slash commands on this address, ie :8091, at /slack/commands until ctrl-c or the -timeout.  The signing secret, what each channel can run and the records to swap are in the slack section of the config")
+    fEvents     := flag.String("events", "", "Serve what -watch, -failover and -slack change as server-sent events on this address, ie :8090, at /events.  ?types=node.,dns.updated picks the events and Last-Event-ID catches up after a reconnect")
+    fStatusPage := flag.String("status-page", "", "Publish the -health checks of -stack or -tag as a static status page, index.html and status.json, to spaces:<bucket>/<prefix> in -region or r2:<bucket>/<prefix>")
+    fCapacity   := flag.Bool("capacity", false, "Report disk, memory and load over ssh for the nodes with -tag or in -stack next to their sizes, flagging the ones past -max-disk, -max-memory or -max-load as resize candidates")
+    fMaxDisk    := flag.Float64("max-disk", 80, "Percent of the root disk used that makes a node a -capacity resize candidate")
+    fMaxMemory  := flag.Float64("max-memory", 85, "Percent of memory used that makes a node a -capacity resize candidate")
+    fMaxLoad    := flag.Float64("max-load", 1, "5 minute load average per cpu that makes a node a -capacity resize candidate")
+    fRightsize  := flag.Bool("rightsize", false, "Recommend a size for each of the nodes, only the ones with -tag or in -stack when they're set, from their last week of cpu and memory monitoring")
+    fRightOut   := flag.String("rightsize-out", "", "JSON file -rightsize writes its size changes to, as resize rows for -bulk")
+    fPatch      := flag.Bool("patch", false, "Update the OS packages of the nodes with -tag or in -stack one at a time, draining each first and rebooting it when the updates need it.  With -health-url each has to be healthy before the next goes")
+    fPrune      := flag.Bool("prune", false, "Delete the snapshots and custom images named like -match older than -days, keeping the newest -keep")
+    fCache      := flag.Bool("cache", false, "Apply the Cloud Flare cache settings from the config to the zone")
+    fMigrate    := flag.String("migrate", "", "Copy the records, page rules and key settings of the -d zone to the same zone in this account from the cloud_flare accounts in the config")
     
-    fTag        := flag.String("tag", "", "Tag to associate with either a node or a balancer")
+    fTag        := new(string)
+    flag.Var(multi_flag_t{fTag}, "tag", "Tag to associate with either a node or a balancer, repeat it or use commas for more than one.  When picking nodes it can be an expression, ie 'tag=web AND region=nyc3' or 'tag=web,staging', with keys tag, name, region, size, stack, status and owner")
     fIP         := flag.String("ip", "", "IP address we're targeting")
+    fIP6        := flag.String("ip6", "", "Reserved ipv6 address -fip moves to the node along with the floating ip, auto reserves one in the node's region if it doesn't have one")
     fDomainType := flag.String("t", "A", "Type of domain we're targeting. ie 'A' or 'AAAA' etc")
     fSubDomain  := flag.String("sd", "", "Subdomain name we're targeting. ie 'www'")
     fDomain     := flag.String("d", "", "Domain name we're targeting. ie 'google.com'")
+    fZone       := flag.String("zone", "", "Cloud Flare zone id, overrides the zone picked from the config or -d")
+    fContent    := flag.String("content", "", "Content of the domain record we're looking for")
+    fHostname   := flag.String("host", "", "Custom hostname we're targeting. ie 'shop.customer.com'")
+    fProtocol   := flag.String("proto", "tcp", "Protocol for a spectrum app or -fw-allow. ie 'tcp' or 'udp'")
+    fPorts      := flag.String("port", "", "Port or range of ports for a spectrum app or -fw-allow. ie '25565' or '27015-27030'")
+    fSSLMethod  := flag.String("ssl", "http", "How the certificate for a custom hostname is validated. ie 'http', 'txt' or 'email'")
+    fFrom       := flag.String("from", "", "Email address on the zone to forward, or '*' for the catch-all.  For -fw-allow the address or range the port is opened to")
+    fTo         := flag.String("to", "", "Email address to forward to")
+    fBucket     := flag.String("bucket", "", "Name of the bucket we're targeting")
+    fCertID     := flag.String("cert", "", "Name or id of the certificate we're targeting, ie for a cdn custom domain")
+    fCertFile   := flag.String("certfile", "", "PEM file of the certificate to upload, without it a let's encrypt certificate is created")
+    fKeyFile    := flag.String("keyfile", "", "PEM file of the private key for the certificate to upload")
+    fChainFile  := flag.String("chainfile", "", "PEM file of the certificate chain for the certificate to upload")
+    fDNSNames   := flag.String("dns", "", "Comma separated domain names for a let's encrypt certificate")
+    fWithin     := flag.Int("within", 0, "Only list certificates expiring within this many days, and fail if there are any")
+    fFiles      := flag.String("files", "*", "Comma separated files to purge from the cdn cache, wildcards allowed")
+    fPermission := flag.String("perm", "object-read-write", "Permission for temporary bucket credentials. ie 'object-read-only'")
+    fTTL        := flag.Duration("ttl", time.Hour, "How long things last, ie temporary credentials, the cdn cache or new nodes -reap can remove after it. ie '72h'")
+    fDNSHistory := flag.Bool("dnshistory", false, "Save the -d zone, or the -cloudflare one, to the dns_history from the config and list its snapshots.  With -since it lists what changed up to -until instead")
+    fSince      := flag.String("since", "", "Start date for reports, YYYY-MM-DD.  Defaults to 30 days ago")
+    fUntil      := flag.String("until", "", "End date for reports, YYYY-MM-DD.  Defaults to today")
+    fNamespace  := flag.String("namespace", "", "Label of the functions namespace we're targeting")
+    fTrigger    := flag.String("trigger", "", "Name of the trigger we're targeting")
+    fFunction   := flag.String("function", "", "Function a trigger runs. ie 'package/function'")
+    fCron       := flag.String("cron", "", "Cron schedule for a trigger. ie '*/5 * * * *'")
+    fBody       := flag.String("body", "", "JSON body a trigger passes to its function")
+    fCheck      := flag.String("check", "", "Name of the uptime check we're targeting")
+    fCheckType  := flag.String("checktype", "https", "Type of uptime check. ie 'ping', 'http' or 'https'")
+    fTarget     := flag.String("target", "", "Url or host an uptime check watches")
+    fCluster    := flag.String("cluster", "", "Name of the kubernetes cluster we're targeting")
+    fPool       := flag.String("pool", "", "Name of the kubernetes node pool, database connection pool or Cloud Flare load balancer pool we're targeting")
+    fK8sVersion := flag.String("k8s", "", "Kubernetes version to upgrade to. ie '1.29' or '1.29.1-do.0'")
+    fSurge      := flag.Bool("surge", true, "Surge upgrade, creating new nodes before draining the old ones")
+    fExpiry     := flag.Int("expiry", 0, "Seconds until kubeconfig credentials expire, 0 lasts as long as the api key")
+    fDatabase   := flag.String("db", "", "Name of the managed database cluster we're targeting")
+    fDBName     := flag.String("dbname", "", "Database a connection pool connects to")
+    fDBUser     := flag.String("dbuser", "", "User a connection pool connects as, empty uses the client's user")
+    fPoolMode   := flag.String("mode", "transaction", "Connection pool mode. ie 'session', 'transaction' or 'statement'")
+    fPoolSize   := flag.Int("poolsize", 10, "Number of connections in a connection pool")
+    fReplica    := flag.String("replica", "", "Name of the read only replica we're targeting")
+    fDBSize     := flag.String("dbsize", "", "Size slug for a replica, defaults to the size of the cluster. ie 'db-s-2vcpu-4gb'")
+    fDay        := flag.String("day", "sunday", "Day of the week for a maintenance window")
+    fHour       := flag.String("hour", "04:00", "UTC hour for a maintenance window")
+    fAt         := flag.String("at", "", "Point in time to fork a database from, RFC3339.  Defaults to the latest backup")
+    fLimit      := flag.Int("limit", 20, "Max number of things to list")
+    fMatch      := flag.String("match", "", "Name pattern for images, with shell style wildcards. ie 'webserver-*'")
+    fDays       := flag.Int("days", 30, "Only prune images older than this many days")
+    fKeep       := flag.Int("keep", 3, "Number of the newest matching images to always keep when pruning")
+    fForceBuild := flag.Bool("force-build", false, "Rebuild the app from source when deploying")
+    fTimeout    := flag.Duration("timeout", 0, "Longest the whole run can take, ie '15m'.  0 waits as long as it takes")
+    fCreateTO   := flag.Duration("create-timeout", 0, "Longest creating a node can take, including waiting for its ip address")
+    fResizeTO   := flag.Duration("resize-timeout", 0, "Longest resizing a node can take, including powering it back on")
+    fSecrets    := flag.String("secrets", "", "JSON file of app secrets to deliver to the node -c creates, by reference to vault, ssm, env or file.  They're put in its user data, or sent over ssh once it's up")
+    fKnownHosts := flag.String("known-hosts", "", "Managed known_hosts file.  New nodes get a host key made for them and added to it, deleted nodes are taken out of it, and ssh to the nodes only trusts the keys in it")
+    fWaitSSH    := flag.Bool("wait-ssh", false, "After creating a node wait for ssh to accept connections, not just for it to be active")
+    fWaitInit   := flag.Bool("wait-cloudinit", false, "After creating a node ssh in and wait for cloud-init to finish, implies -wait-ssh")
+    fCascade    := flag.Bool("cascade", false, "Deleting a node also removes the records pointing at it, in -d or every domain, its floating ip, firewalls, load balancers and volume attachments")
+    fDeleteVols := flag.Bool("delete-volumes", false, "With -cascade the node's volumes are deleted too, not just detached")
+    fNoWait     := flag.Bool("no-wait", false, "Fail right away when a node is locked, ie by a backup, instead of waiting up to -lock-timeout for it before deleting, resizing, rebuilding or rebooting it")
+    fLockWait   := flag.Duration("lock-timeout", 30 * time.Minute, "Longest to wait for a locked node, ie one being backed up, before giving up on the change")
+    fWaitDelete := flag.Bool("wait-delete", false, "After deleting a node wait for it to be out of the listings and its floating ip released, before any records are cleaned up")
+    fSSHUser    := flag.String("ssh-user", "root", "User to ssh in as for -wait-cloudinit, the drain command, -exec, -push and -patch.  Also the User in the -inventory ssh config")
+    fSSHIdent   := flag.String("ssh-identity", "", "Private key file to ssh in with for -wait-cloudinit, the drain command, -exec, -push and -patch.  Also the IdentityFile in the -inventory ssh config")
+    fMaintWork  := flag.String("maintenance-worker", "", "HTML file for the maintenance page, uploads our maintenance worker as the script in the cloud_flare maintenance config with the page bound to it")
+    fRetryAfter := flag.Int("retry-after", 300, "Seconds the -maintenance-worker page tells clients to retry after")
+    fErrPages   := flag.Bool("error-pages", false, "List the custom error pages for the zone")
+    fErrPage    := flag.String("error-page", "", "Set a custom error page for the zone, ie '500_errors=https://example.com/500.html'.  'default' instead of the url puts back cloud flare's")
+    fMaintMode  := flag.Bool("maintenance", false, "Serve the maintenance page from the cloud_flare config while -z, -fip or -migrate runs")
+    fSkipDrain  := flag.Bool("skip-drain", false, "Don't run the drain command from the config before resizing or deleting a node")
+    fOwner      := flag.String("owner", "", "Who owns the new nodes, kept in a tag and shown by -ln.  ie 'alice' or 'team-search'")
+    fNote       := flag.String("note", "", "Why the new nodes exist, kept in a tag and shown by -ln")
+    fWait       := flag.Bool("wait", false, "Wait for the operation to finish, ie custom hostname validation or an app deployment")
 	fNodeID     := flag.Int("node", 0, "Node we're targeting")
     fNodeName   := flag.String("n", "", "Name of the target node")
     fRegion     := flag.String("region", "nyc3", "Slug of the region for the node")
     fSize       := flag.Int("size", 0, "Size of the node in gb")
     fCPUSize    := flag.Int("cpu", 0, "Size of node in cpu's, for high cpu droplets")
-    fImage      := flag.String("image", "ubuntu-16-04-x64", "OS image to use for the node")
+    fSlug       := flag.String("slug", "", "Exact size of the node, for the premium and gpu sizes.  ie 's-2vcpu-4gb-intel' or 'gpu-h100x1-80gb'")
+    fImage      := flag.String("image", "ubuntu-16-04-x64", "OS image to use for the node, 'snapshot:pattern' for one of our snapshots or 'app:slug' for a 1-Click app. ie 'snapshot:webserver-*' or 'app:docker-20-04'")
+    fLatest     := flag.Bool("latest", false, "Use the newest snapshot when more than one matches the -image pattern")
+    fOverride   := flag.Bool("override-protection", false, "Allow deleting or overwriting the nodes and domain records protected in the config")
+    fPrivate    := flag.Bool("private", false, "Point -dnssync and -self records at the nodes' private ip addresses")
+    fIPv6       := flag.Bool("ipv6", false, "With -cs and -n, also create an AAAA record for the node's ipv6 address when it has one")
+    fStack      := flag.String("stack", "", "Stack new nodes are tagged as part of, and the one -ln lists")
+    fManaged    := flag.Bool("managed-only", false, "Refuse to delete nodes harbormaster didn't create, ie ones without the hm:managed tag")
     fSSHKey     := flag.String("sshKey", "", "SSH Key to use when creating a node")
+    fUserData   := flag.String("userdata", "", "File with a cloud-init script to run when creating a node")
+    fService    := flag.String("service", "http://localhost:80", "Service on the node that tunnel traffic is sent to")
+    fBulk       := flag.String("bulk", "", "CSV or JSON file of create, delete, resize, dns-set, dns-delete or fip operations to run, rows with a node wait for it to be created")
+    fConcurrent := flag.Int("concurrency", 5, "Max number of bulk operations to run at the same time")
+    fFailFast   := flag.Bool("fail-fast", false, "Stop starting bulk operations after the first one fails")
+    fSnapshot   := flag.String("snapshot", "", "Save the records the bulk dns rows touch to this file before running them, for -rollback")
+    fSpec       := flag.String("cluster-spec", "", "JSON cluster spec of nodes with their firewall, load balancer and records, the cluster is created or brought in line with it")
+    fCount      := flag.Int("count", 0, "Number of nodes -cluster-spec scales to, instead of the count in the spec.  With regions in the spec it is the count for each of them")
+    fRollback   := flag.String("rollback", "", "Put the records in a -snapshot file back the way they were")
+    fCutover    := flag.Bool("cutover", false, "Move -sd over to -ip, or the node named -n, gradually.  The record's ttl is lowered to -cutover-ttl and it's switched once the old ttl has run out, with -cloudflare and -pool the address's weight in the load balancer pool goes up through -steps instead.  Running it again carries on an interrupted one")
+    fSteps      := flag.String("steps", "10,25,50,100", "Percent of the traffic the new address gets at each step of a -cutover through a -pool")
+    fStepWait   := flag.Duration("step-wait", 5 * time.Minute, "Time between the steps of a -cutover, and before a switched record gets its ttl back")
+    fCutoverTTL := flag.Int("cutover-ttl", 60, "Seconds the record's ttl is lowered to during a -cutover")
+    fFailover   := flag.Bool("failover", false, "Watch -ip, or the node named -n, with -health-url and point -sd at -standby when it's down, then back once it's up again.  Runs until ctrl-c or the -timeout")
+    fStandby    := flag.String("standby", "", "Address -failover points the record at while the primary is down")
+    fInterval   := flag.Duration("interval", 30 * time.Second, "Time between the -failover probes, or the -inventory rewrites and -status-page updates with -watch")
+    fFailAfter  := flag.Int("fail-after", 3, "Failed probes in a row before -failover switches to the standby")
+    fRecoverAft := flag.Int("recover-after", 5, "Good probes in a row before -failover switches back to the primary")
+    fHold       := flag.Duration("hold", 5 * time.Minute, "Least time between -failover switches, so a flapping origin doesn't flap the record")
+    fFailTTL    := flag.Int("failover-ttl", 60, "Seconds -failover keeps the record's ttl at or under, so a switch takes effect quickly")
+    fPurgeIP    := flag.String("purge-ip", "", "Delete the records pointing at this ip address in every digital ocean domain and configured cloud flare zone, or just -d.  What's going to change is shown and confirmed first")
+    fRetarget   := flag.String("retarget", "", "With -purge-ip, point the records at this address instead of deleting them")
+    fYes        := flag.Bool("yes", false, "Go ahead without asking, ie -purge-ip from a script")
+    fUndo       := flag.Bool("undo", false, "Put the records the last run that changed dns back the way they were before it.  Run it again to go back another run")
     
     //Other
-    fWriteFile  := flag.Bool("o", false, "Writes output to a local json file")
+    fWriteFile  := &output_dest_t{}
+    flag.Var(fWriteFile, "o", "Writes output to a local json file, or with -o=dest to a file path, 'stdout', s3://bucket/key in -region's spaces, or an https:// url it's posted to")
+    fCacheTTL   := flag.Duration("cache-ttl", 0, "Keep node lists, domain records, regions and sizes locally this long, ie '5m', so repeated reads don't hit the api")
+    fRefresh    := flag.Bool("refresh", false, "Skip the local cache from -cache-ttl, getting everything fresh")
+    fRecord     := flag.String("record", "", "Save every api request and response to this cassette file, with the credentials taken out")
+    fReplay     := flag.String("replay", "", "Answer the api requests from a cassette file made with -record instead of the live apis")
+    fReadOnly   := flag.Bool("read-only", false, "Refuse anything that would change the accounts, so lists and reports can be run safely with production credentials")
+    fMaxReqs    := flag.Int("max-requests", 0, "Stop the run before it makes more than this many api requests, so frequent drift checks stay clear of the rate limits.  The count is in the summary either way")
+    fProvider   := flag.String("provider", "", "'fake' answers the api requests from a pretend digital ocean and cloud flare account, for demos and tests without one.  Its state is kept between runs, settings go after a colon, ie 'fake:boot=2s,action=1s,latency=0,state=./demo.json' or 'fake:reset' to start over")
+    fCompat     := flag.Bool("compat", false, "Probe the digital ocean and cloud flare endpoints we depend on and warn when their responses have drifted from what we expect.  The versions come from api_version in the config")
+    fChaos      := flag.String("chaos", "", "Make api requests fail on purpose, to test scripts around us.  ie 'fail=0.1,429=0.05,error=0.02,delay=2s,seed=7'")
+    fReport     := flag.String("report", "", "Write a report of the run to this file, its inputs, what it changed and a digest of the api responses")
+    fReportKey  := flag.String("report-key", "", "ssh private key the -report is signed with, to <report>.sig.  age keys can't sign, so it has to be an ssh one")
+    fVerifyRep  := flag.String("verify-report", "", "Check the signature on a -report file and that its input files haven't changed")
+    fSigners    := flag.String("allowed-signers", "", "ssh allowed signers file -verify-report and -self-update check who signed against")
+    fSelfUpdate := flag.Bool("self-update", false, "Replace this binary with the latest release, once its signature and checksum check out")
+    fInstall    := flag.String("service-install", "", "Install the rest of the command line as a service with this name, a systemd unit or a launchd agent on a mac, and start it.  ie '-service-install home -service-every 5m -self -sd home -d example.com'.  The api keys can go in its env file as HARBORMASTER_DO_API_KEY, HARBORMASTER_CF_API_KEY and HARBORMASTER_CF_EMAIL")
+    fEvery      := flag.Duration("service-every", 0, "How often -service-install runs the command on a timer, ie '5m'.  Needed for everything but -watch, -failover and -slack, which are kept running")
+    fTraceFile  := flag.String("trace-file", "", "Append a json line for every api request and response to this file, with the credentials taken out")
+    fMerge      := flag.Bool("merge", false, "Merge the output into what -o already wrote, keeping every resource and run")
+    fDryRun     := flag.Bool("dry-run", false, "Show what would change without changing anything")
+    fFormat     := flag.String("format", "table", "Format for listing things. ie 'table', 'json' or 'csv'.  'github' also adds annotations, step outputs and a job summary for github actions")
     fVerbose    := flag.Bool("V", false, "Verbose output")
     fSuperV     := flag.Bool("V+", false, "Super verbose output")
     fVersion    := flag.Bool("v", false, "Version")
@@ -122,41 +507,237 @@ func main() {
     
 //----- Initialization --------------------------------------------------------------------------------------------------------------//
     cwd, _ := os.Getwd()
-    config, err := readConfig(cwd + "/harbormaster.json")
+    configLoc := configPath(cwd)
+    fake := strings.HasPrefix(*fProvider, "fake")
+    runID := runIdentifier()    //before the config, its headers can use it
+    if *fSuperV { fmt.Println("Run id: " + runID) }
+    if len(*fInstall) > 0 {    //before the config, its keys can be in the unit's env file
+        daemon := *fWatch || *fFailover || len(*fSlack) > 0     //runs until it's stopped, so it's kept running instead of on a timer
+        if daemon && *fEvery > 0 {
+            fmt.Println("-service-every is for commands that finish on their own, -watch, -failover and -slack are kept running")
+            os.Exit(3)
+        } else if !daemon && *fEvery <= 0 {
+            fmt.Println("-service-install needs -service-every, the command finishes on its own so it's run on a timer.  -watch, -failover and -slack are kept running instead")
+            os.Exit(3)
+        }
+        if err := installService(*fInstall, configLoc, os.Args[1:], *fEvery, *fDryRun); err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
+    config, err := readConfig(configLoc, fake)
     
     if err != nil { //this is bad
         fmt.Println(err)
         os.Exit(1)
     }
     
+    config.Protected.Override = *fOverride
+    config.ReadOnly = config.ReadOnly || *fReadOnly
+    stateDir := cwd     //where -o writes on its own
+    if len(config.StateRepo) > 0 {
+        stateDir = config.StateRepo
+        if len(config.DNSHistory.Dir) == 0 { config.DNSHistory.Dir = filepath.Join(stateDir, "dns_history") }   //committed with the rest at the end
+    }
+    
     if *fTP_CloudFlare && len(config.CF.APIKey) < 1 {
         fmt.Println("Cannot user ClourFlare without the api_key set in the harbormaster.json config file")
         os.Exit(3)
     }
     
-    do := libraries.DO_c {SuperVerbose: *fSuperV, Verbose: *fVerbose, Config: config.DO}   //digital ocean library
-    cf := libraries.CF_c {SuperVerbose: *fSuperV, Verbose: *fVerbose, Config: config.CF}   //clourd flare library
+    runCtx, cancel := context.Background(), context.CancelFunc(func() {})
+    if *fTimeout > 0 { runCtx, cancel = context.WithTimeout(runCtx, *fTimeout) }
+    defer cancel()
+    
+    readCache, err := libraries.NewReadCache(*fCacheTTL, *fRefresh)
+    if err != nil {
+        fmt.Println(err)
+        os.Exit(1)
+    }
+    
+    libraries.ProviderHosts(config.apiHosts()...)  //the transports below only touch the api requests
+    
+    if fake {  //innermost, the recorder and chaos see it like the real apis
+        spec := strings.TrimPrefix(strings.TrimPrefix(*fProvider, "fake"), ":")
+        provider, err := libraries.NewFake(spec)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Printf("Fake provider, nothing here is real.  %s is the domain to use\n", libraries.Fake_domain)
+        http.DefaultTransport = provider
+    } else if len(*fProvider) > 0 {
+        fmt.Printf("Unknown provider '%s', expecting fake\n", *fProvider)
+        os.Exit(1)
+    }
+    
+    if len(*fRecord) > 0 || len(*fReplay) > 0 {  //the api and spaces requests go through the recorder, health probes and output posts go around it
+        if len(*fRecord) > 0 && len(*fReplay) > 0 {
+            fmt.Println("-record and -replay can't be used together")
+            os.Exit(1)
+        }
+        var recorder *libraries.Recorder_t
+        if len(*fReplay) > 0 {
+            recorder, err = libraries.NewRecorder(*fReplay, true, config.secrets())
+            readCache = nil     //the cassette is the only place answers come from
+        } else {
+            recorder, err = libraries.NewRecorder(*fRecord, false, config.secrets())
+        }
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        http.DefaultTransport = recorder
+    }
+    
+    if len(*fChaos) > 0 {  //in front of the recorder, so only what really went out is recorded
+        chaos, err := libraries.NewChaos(*fChaos)
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        fmt.Println("Chaos mode, api requests will fail on purpose")
+        http.DefaultTransport = chaos
+    }
+    
+    if len(*fTraceFile) > 0 {   //wraps the recorder too, so replays can be traced
+        tracer, err := libraries.NewTracer(*fTraceFile, config.secrets())
+        if err != nil {
+            fmt.Println(err)
+            os.Exit(1)
+        }
+        defer tracer.Close()
+        http.DefaultTransport = tracer
+    }
+    
+    var digest *libraries.Digest_t
+    if len(*fReport) > 0 {  //sees the responses as the run does
+        digest = libraries.NewDigest()
+        http.DefaultTransport = digest
+    }
+    
+    var zoneWatch *libraries.ZoneWatch_t
+    if len(config.DNSHistory.Dir) > 0 {    //notes the zones we change so they're saved at the end
+        zoneWatch = libraries.NewZoneWatch()
+        http.DefaultTransport = zoneWatch
+    }
+    
+    budget := libraries.NewBudget(*fMaxReqs)  //outside everything else, it's what the run asked for that counts
+    http.DefaultTransport = budget
+    
+    progress := &libraries.Progress_t{} //steps of the longer operations, for the summary at the end
+    do := libraries.DO_c {SuperVerbose: *fSuperV, Verbose: *fVerbose, Config: config.DO, Progress: progress, Ctx: runCtx, Cache: readCache, Stack: *fStack, ManagedOnly: *fManaged,
+        Ready: libraries.DO_ready_t{SSH: *fWaitSSH, CloudInit: *fWaitInit, Delete: *fWaitDelete, User: *fSSHUser, Identity: *fSSHIdent, KnownHosts: *fKnownHosts}, SkipDrain: *fSkipDrain, Owner: *fOwner, Note: *fNote, ReadOnly: config.ReadOnly, NoLockWait: *fNoWait, LockWait: *fLockWait}   //digital ocean library
+    cf := libraries.CF_c {SuperVerbose: *fSuperV, Verbose: *fVerbose, Config: config.CF, Ctx: runCtx, Cache: readCache, ReadOnly: config.ReadOnly}   //clourd flare library
+    journal := &libraries.DNS_journal_t{}   //records are noted before they're changed, for -undo
+    do.Journal, cf.Journal = journal, journal
+    if flagSet("ttl") { do.Expires = time.Now().Add(*fTTL) }   //only tagged when it's asked for, the default is for credentials
     fileOutput := libraries.FileOutput_t{}
     
+    if *fTunnel && !*fTP_CloudFlare {
+        fmt.Println("Tunnels require the -cloudflare option")
+        os.Exit(3)
+    }
+    
+    if *fMaintMode && (len(config.CF.APIKey) < 1 || (!*fResize && !*fFloatingIP && len(*fMigrate) == 0)) {
+        fmt.Println("Maintenance mode needs the cloud flare api_key set, and only works with -z, -fip or -migrate")
+        os.Exit(3)
+    }
+    
+    //pick the cloud flare zone, bulk rows pick their own from their domain
+    if (*fTP_CloudFlare && len(*fBulk) == 0) || len(*fZone) > 0 {
+        if err = cf.SelectZone(*fZone, *fDomain); err != nil {
+            fmt.Println(err)
+            os.Exit(3)
+        }
+    }
+    
     //figure out our size, if set
-    targetSize := ""
-    if *fSize > 0 && *fCPUSize > 0 {
-        fmt.Println("Please use either the -size or -cpu flags.\n-size is for a normal droplet based on ram size\n-cpu is for the higher cpu droplets and is based on cpu count")
+    targetSize, err := targetSizeSlug(*fSize, *fCPUSize, *fSlug)
+    if err != nil {
+        fmt.Println(err)
         os.Exit(4)
-    } else if *fSize > 0 {
-        targetSize = fmt.Sprintf("%dgb", *fSize)
-    } else if *fCPUSize > 0 {
-        targetSize = fmt.Sprintf("c-%d", *fCPUSize)
     }
+    var updates <-chan string   //the newer release notice, looked for while the run goes
+    if strings.EqualFold(*fFormat, "table") && !*fSelfUpdate { updates = startUpdateCheck(config.Update, VER + "." + minversion) }
+    var events *event_hub_t    //nil unless -events is set, publishing to it does nothing then
+    if len(*fEvents) > 0 {
+        if !*fWatch && !*fFailover && len(*fSlack) == 0 {
+            fmt.Println("-events only has something to send with -watch, -failover or -slack")
+            os.Exit(3)
+        }
+        var stopEvents func ()
+        if events, stopEvents, err = serveEvents(*fEvents); err != nil {
+            fmt.Println(err)
+            os.Exit(3)
+        }
+        defer stopEvents()
+    }
+    var output interface{} = &fileOutput  //what we write out with -o
+    listing := false    //lists don't get the success message, so the output can be piped
     
 //----- Figure out what we're done --------------------------------------------------------------------------------------------------------------//
     if *fCreate {   //we're creating a new node
         if len(*fNodeName) > 0 {
             if len(targetSize) > 0 {
-                fmt.Printf("Creating node: %s with the size %s\n", *fNodeName, targetSize)
-                err = do.CreateNode(*fNodeName, *fRegion, *fTag, targetSize, *fImage, *fSSHKey, &fileOutput)
+                userData := ""
+                if len(*fUserData) > 0 {
+                    data, readErr := ioutil.ReadFile(*fUserData)
+                    userData, err = string(data), readErr
+                }
+                
+                if err == nil && *fTunnel {  //the node gets the tunnel connector installed on first boot
+                    if len(userData) > 0 {
+                        err = fmt.Errorf("The tunnel connector is installed through the user data, so -userdata can't be used with -tunnel")
+                    } else {
+                        fmt.Println("Creating tunnel: " + *fNodeName)
+                        var tunnel *libraries.CF_tunnel_t
+                        token := ""
+                        err = progress.Step("provision tunnel " + *fNodeName, func() (err error) {
+                            tunnel, err = provisionTunnel(cf, *fNodeName, *fSubDomain, *fService, cwd)
+                            if err == nil { token, err = cf.TunnelToken(tunnel) }
+                            return
+                        })
+                        userData = libraries.TunnelUserData(token)
+                    }
+                }
+                
+                var secrets libraries.DO_secret_file_t
+                var spec secrets_spec_t
+                if err == nil && len(*fSecrets) > 0 {  //looked up before anything is created, so a bad reference doesn't leave a node without them
+                    spec, err = readSecretsSpec(*fSecrets)
+                    if err == nil { secrets, err = renderSecrets(spec) }
+                    if err == nil && spec.Deliver == "userdata" { userData, err = libraries.SecretUserData(secrets, userData) }
+                    if spec.Deliver == "ssh" { do.Ready.SSH = true }
+                }
+                
+                image := ""
+                if err == nil { image, err = do.ResolveImage(*fImage, *fRegion, *fLatest) }
+                
+                if err == nil {
+                    fmt.Printf("Creating node: %s with the size %s\n", *fNodeName, targetSize)
+                    event := hook_event_t{Name: *fNodeName, Region: *fRegion, Size: targetSize, Image: image, Tag: *fTag}
+                    err = config.Hooks.around(do, "create", event, func () error {
+                        return withTimeout(do, *fCreateTO, "creating node " + *fNodeName, func (do libraries.DO_c) error {
+                            return do.CreateNode(*fNodeName, *fRegion, *fTag, targetSize, image, *fSSHKey, userData, &fileOutput)
+                        })
+                    })
+                }
+                if err == nil && spec.Deliver == "ssh" {
+                    err = progress.Step("secrets " + *fNodeName, func () error {
+                        _, ip, err := do.NodeAddress(*fNodeName)
+                        if err == nil { err = do.SendSecretFile(ip, secrets) }
+                        return err
+                    })
+                    if err == nil { fmt.Printf("Sent %d secrets to %s:%s\n", len(spec.Values), *fNodeName, spec.Path) }
+                }
+                if err == nil && strings.HasPrefix(*fImage, "app:") {   //the app's notes on getting started go with the node
+                    fileOutput.OneClick, err = do.OneClickImage(image, *fRegion)
+                    if err == nil && len(fileOutput.OneClick.Description) > 0 { fmt.Printf("%s notes:\n%s\n", image, fileOutput.OneClick.Description) }
+                }
             } else {
-                err = fmt.Errorf("Size of node not set.  use the -size or -cpu option")
+                err = fmt.Errorf("Size of node not set.  use the -size, -cpu or -slug option")
             }
         } else {
             err = fmt.Errorf("Node name not set.  use the -n option")
@@ -164,7 +745,15 @@ func main() {
     
     } else if *fDelete {    //we want to delete a node
         if len(*fNodeName) > 0 {
-            err = do.DeleteNode(*fNodeName)
+            err = config.Protected.checkNode(do, *fNodeName)
+            if err == nil && *fCascade {
+                var result *cascade_result_t
+                result, err = cascadeDelete(*fNodeName, *fDomain, *fTP_CloudFlare, *fDeleteVols, *fDryRun, config, do, cf)
+                if result != nil { output = result }
+                if *fDryRun { fmt.Println("Dry run, nothing was changed") }
+            } else if err == nil {
+                err = config.Hooks.around(do, "delete", hook_event_t{Name: *fNodeName}, func () error { return do.DeleteNode(*fNodeName) })
+            }
         } else {
             err = fmt.Errorf("Node name not set.  use the -n option")
         }
@@ -172,9 +761,18 @@ func main() {
     } else if *fResize {    //we want to resize a node
         if len(*fNodeName) > 0 {
             if len(targetSize) > 0 {
-                err = do.ResizeNode(*fNodeName, targetSize)
+                err = config.Protected.checkNode(do, *fNodeName)
+                if err == nil {
+                    err = withMaintenance(cf, *fMaintMode, func () error {
+                        return config.Hooks.around(do, "resize", hook_event_t{Name: *fNodeName, Size: targetSize}, func () error {
+                            return withTimeout(do, *fResizeTO, "resizing node " + *fNodeName, func (do libraries.DO_c) error {
+                                return do.ResizeNode(*fNodeName, targetSize)
+                            })
+                        })
+                    })
+                }
             } else {
-                err = fmt.Errorf("Size to resize to not set.  use the -size or -cpu option")
+                err = fmt.Errorf("Size to resize to not set.  use the -size, -cpu or -slug option")
             }
         } else {
             err = fmt.Errorf("Node name not set.  use the -n option")
@@ -182,9 +780,10 @@ func main() {
     
     } else if *fDeleteSub { //we want to delete a sub domain
         if len(*fSubDomain) > 0 {
-            if *fTP_CloudFlare {
+            err = config.Protected.checkDNS(cf, *fTP_CloudFlare, *fDomain, *fSubDomain)
+            if err == nil && *fTP_CloudFlare {
                 err = cf.DeleteDomainRecord (*fSubDomain)
-            } else {
+            } else if err == nil {
                 if len(*fDomain) > 0 {
                     err = do.DeleteDomainRecord(*fDomain, *fSubDomain)
                 } else {
@@ -197,52 +796,1256 @@ func main() {
     
     } else if *fFloatingIP {    //we want to set a floating ip to a node
         if len(*fIP) > 0 {
-            if *fNodeID > 0 {
+            if *fNodeID == 0 && len(*fNodeName) > 0 {   //look up the id from the name, ie for a node we just created
+                node := libraries.FileOutput_t{}
+                var found bool
+                found, err = do.GetNode(*fNodeName, &node)
+                if err == nil && !found { err = fmt.Errorf("Node '%s' does not exist", *fNodeName) }
+                *fNodeID = node.Droplet.ID
+            }
+            
+            if err == nil && *fNodeID > 0 && strings.EqualFold(*fIP, "auto") {
+                fmt.Println("Reserving a floating ip for the node")
+                var ip string
+                ip, err = do.ReserveFloatingIP(*fNodeID)
+                if err == nil {
+                    fmt.Println("Floating ip: " + ip)
+                    output = &floating_ip_t{IP: ip, NodeID: *fNodeID}
+                }
+                if err == nil && strings.EqualFold(*fIP6, "auto") {
+                    ip, err = do.ReserveIPv6(*fNodeID)
+                    if err == nil {
+                        fmt.Println("Reserved ipv6: " + ip)
+                        output.(*floating_ip_t).IPv6 = ip
+                    }
+                } else if err == nil && len(*fIP6) > 0 {
+                    err = fmt.Errorf("-ip=auto goes with -ip6=auto")
+                }
+            } else if err == nil && *fNodeID > 0 {
                 fmt.Println("Setting floating ip to a node")
                 
-                existing := 0
+                existing, existing6 := 0, *fNodeID
                 existing, err = do.GetFloatingIP(*fIP)
+                if err == nil && strings.EqualFold(*fIP6, "auto") {
+                    err = fmt.Errorf("-ip6=auto goes with -ip=auto, when swapping give it the reserved ipv6 address")
+                } else if err == nil && len(*fIP6) > 0 {
+                    existing6, err = do.GetReservedIPv6(*fIP6)
+                }
                 if err == nil {
-                    if existing != *fNodeID {    //they don't match. So let's update them
+                    if existing != *fNodeID || existing6 != *fNodeID {    //they don't match. So let's update them, both families together
                         if *fVerbose { fmt.Println("Node not already assigned.  Updating...") }
-                        err = do.AssignFloatingIP(*fIP, *fNodeID)
+                        err = withMaintenance(cf, *fMaintMode, func () error {
+                            if existing != *fNodeID {
+                                if err := do.AssignFloatingIP(*fIP, *fNodeID); err != nil { return err }
+                            }
+                            if existing6 != *fNodeID { return do.AssignReservedIPv6(*fIP6, *fNodeID) }
+                            return nil
+                        })
                     } else {
                         if *fVerbose { fmt.Println("Node already assigned.  No work to do") }
                     }
+                    if err == nil { output = &floating_ip_t{IP: *fIP, IPv6: *fIP6, NodeID: *fNodeID} }
                 }
-            } else { err = fmt.Errorf("Node id not set.  use the -node option") }
+            } else if err == nil { err = fmt.Errorf("Node id not set.  use the -node or -n option") }
         } else { err = fmt.Errorf("Floating ip address not set.  use the -ip option") }
     
     } else if *fCreateSub { //create a sub domain
         fmt.Println("Setting domain record")
-        if len(*fIP) > 0 && len(*fDomainType) > 0 && len(*fSubDomain) > 0 {
-            if *fTP_CloudFlare {
+        if len(*fIP) == 0 && len(*fNodeName) > 0 { _, *fIP, err = do.NodeAddress(*fNodeName) }    //point it at the node
+        
+        if err == nil && len(*fIP) > 0 && len(*fDomainType) > 0 && len(*fSubDomain) > 0 {
+            err = config.Protected.checkDNS(cf, *fTP_CloudFlare, *fDomain, *fSubDomain)
+            if err == nil && *fTP_CloudFlare {
                 err = cf.AssignDomainRecord (*fDomainType, *fSubDomain, *fIP)
-            } else {
+            } else if err == nil {
                 if len(*fDomain) > 0 {
                     err = do.AssignDomainRecord (*fDomain, *fDomainType, *fSubDomain, *fIP)
                 } else {
                     err = fmt.Errorf("Missing command line options for creating a sub-domain\n-d")
                 }
             }
+            if err == nil && *fIPv6 { err = assignIPv6Record(do, cf, *fTP_CloudFlare, *fDomain, *fSubDomain, *fDomainType, *fNodeName) }
+            if err == nil { err = autoUptimeCheck(do, cf, *fTP_CloudFlare, *fDomain, *fSubDomain, *fDomainType) }
+            if err == nil {
+                record := &dns_record_t{Domain: *fDomain, Type: *fDomainType, Name: *fSubDomain, Content: *fIP}
+                if *fTP_CloudFlare {
+                    if len(record.Domain) == 0 { record.Domain, err = cf.ZoneName() }
+                    if err == nil { record.ID, err = cf.DomainRecordID(*fDomainType, *fSubDomain) }
+                } else {
+                    record.ID, err = do.DomainRecordID(*fDomain, *fDomainType, *fSubDomain)
+                }
+                output = record
+                
+                fqdn := *fSubDomain + "." + record.Domain
+                if len(*fNodeName) > 0 && strings.EqualFold(*fDomainType, "A") && !strings.EqualFold(*fNodeName, fqdn) {    //digital ocean sets the PTR from the name
+                    fmt.Printf("Warning: the reverse dns for %s will be '%s', not %s.  use -rename if the node sends mail\n", *fIP, *fNodeName, fqdn)
+                }
+            }
+        } else if err == nil {
+            err = fmt.Errorf("Missing command line options for creating a sub-domain\n-ip or -n, && -sd")
+        }
+    
+    } else if *fListSub {  //list out the domain records
+        if *fTP_CloudFlare {
+            recordType := ""
+            if flagSet("t") { recordType = *fDomainType }  //-t defaults to A, so only filter on it when it was passed in
+            
+            var records []libraries.CF_record_t
+            records, err = cf.ListDomainRecords(recordType, *fSubDomain, *fContent)
+            if err == nil {
+                rows := make([][]string, 0, len(records))
+                for _, rec := range(records) {
+                    rows = append(rows, []string{rec.ID, rec.Type, rec.Name, rec.Content, fmt.Sprintf("%d", rec.TTL), fmt.Sprintf("%t", rec.Proxied)})
+                }
+                err = printList(*fFormat, []string{"id", "type", "name", "content", "ttl", "proxied"}, rows, records)
+                output = records
+                listing = true
+            }
+        } else {
+            err = fmt.Errorf("Listing domain records is only supported with the -cloudflare option")
+        }
+    
+    } else if *fCreateSpec || *fDeleteSpec || *fListSpec {  //spectrum apps
+        if !*fTP_CloudFlare {
+            err = fmt.Errorf("Spectrum apps require the -cloudflare option")
+        } else if *fListSpec {
+            var apps []libraries.CF_spectrum_app_t
+            apps, err = cf.ListSpectrumApps()
+            if err == nil {
+                rows := make([][]string, 0, len(apps))
+                for _, app := range(apps) {
+                    rows = append(rows, []string{app.ID, app.DNS.Name, app.Protocol, strings.Join(app.OriginDirect, " ")})
+                }
+                err = printList(*fFormat, []string{"id", "hostname", "protocol", "origin"}, rows, apps)
+                output = apps
+                listing = true
+            }
+        } else if len(*fHostname) == 0 {
+            err = fmt.Errorf("Spectrum app hostname not set.  use the -host option")
+        } else if *fDeleteSpec {
+            err = cf.DeleteSpectrumApp(*fHostname)
+        } else if len(*fPorts) == 0 {
+            err = fmt.Errorf("Spectrum app port not set.  use the -port option")
+        } else {
+            if len(*fIP) == 0 && len(*fNodeName) > 0 { _, *fIP, err = do.NodeAddress(*fNodeName) }
+            if err == nil && len(*fIP) == 0 { err = fmt.Errorf("Origin not set.  use the -ip or -n option") }
+            if err == nil {
+                fmt.Printf("Setting spectrum app: %s %s/%s\n", *fHostname, *fProtocol, *fPorts)
+                var app *libraries.CF_spectrum_app_t
+                app, err = cf.AssignSpectrumApp(*fHostname, *fProtocol, *fPorts, *fIP)
+                if err == nil { output = app }
+            }
+        }
+    
+    } else if *fCreateHost || *fDeleteHost || *fListHost {    //custom hostnames
+        if !*fTP_CloudFlare {
+            err = fmt.Errorf("Custom hostnames require the -cloudflare option")
+        } else if *fListHost {
+            var hostnames []libraries.CF_hostname_t
+            hostnames, err = cf.ListCustomHostnames()
+            if err == nil {
+                rows := make([][]string, 0, len(hostnames))
+                for _, h := range(hostnames) {
+                    rows = append(rows, []string{h.ID, h.Hostname, h.Status, h.SSL.Status})
+                }
+                err = printList(*fFormat, []string{"id", "hostname", "status", "ssl_status"}, rows, hostnames)
+                output = hostnames
+                listing = true
+            }
+        } else if len(*fHostname) == 0 {
+            err = fmt.Errorf("Custom hostname not set.  use the -host option")
+        } else if *fDeleteHost {
+            err = cf.DeleteCustomHostname(*fHostname)
+        } else {
+            fmt.Println("Creating custom hostname: " + *fHostname)
+            var h *libraries.CF_hostname_t
+            h, err = cf.CreateCustomHostname(*fHostname, *fSSLMethod)
+            if err == nil && *fWait {
+                fmt.Println("Waiting for custom hostname validation")
+                h, err = cf.WaitForCustomHostname(*fHostname, 60)
+            }
+            if err == nil {
+                if h.Status != "active" {
+                    fmt.Printf("Ownership verification: %s %s %s\n", h.OwnershipVerification.Type, h.OwnershipVerification.Name, h.OwnershipVerification.Value)
+                }
+                for _, rec := range(h.SSL.ValidationRecords) {
+                    if len(rec.TxtName) > 0 { fmt.Printf("Certificate validation: TXT %s %s\n", rec.TxtName, rec.TxtValue) }
+                    if len(rec.HttpUrl) > 0 { fmt.Printf("Certificate validation: %s should return %s\n", rec.HttpUrl, rec.HttpBody) }
+                }
+                output = h
+            }
+        }
+    
+    } else if len(*fMaintWork) > 0 {   //something standard for -maintenance to flip to
+        var page []byte
+        page, err = ioutil.ReadFile(*fMaintWork)
+        if err != nil {
+            err = fmt.Errorf("Unable to read '%s' :: %s", *fMaintWork, err.Error())
+        } else if len(config.CF.APIKey) < 1 {
+            err = fmt.Errorf("Cannot use CloudFlare without the api_key set in the harbormaster.json config file")
+        } else {
+            err = cf.UploadMaintenanceWorker(page, *fRetryAfter)
+        }
+
+    } else if *fErrPages || len(*fErrPage) > 0 {   //custom error pages
+        if !*fTP_CloudFlare {
+            err = fmt.Errorf("Custom error pages require the -cloudflare option")
+        } else if *fErrPages {
+            var pages []libraries.CF_custom_page_t
+            pages, err = cf.ListCustomPages()
+            if err == nil {
+                rows := make([][]string, 0, len(pages))
+                for _, p := range(pages) {
+                    rows = append(rows, []string{p.ID, p.State, p.URL, p.Description})
+                }
+                err = printList(*fFormat, []string{"id", "state", "url", "description"}, rows, pages)
+                output = pages
+                listing = true
+            }
+        } else if parts := strings.SplitN(*fErrPage, "=", 2); len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+            err = fmt.Errorf("-error-page is the page and its url, ie '500_errors=https://example.com/500.html'")
+        } else if parts[1] == "default" {
+            err = cf.SetCustomPage(parts[0], "")
+        } else {
+            err = cf.SetCustomPage(parts[0], parts[1])
+        }
+
+    } else if *fEmailRoute || *fEmailFwd || *fDeleteFwd || *fListFwd {  //email routing
+        if !*fTP_CloudFlare {
+            err = fmt.Errorf("Email routing requires the -cloudflare option")
+        } else if *fListFwd {
+            var rules []libraries.CF_email_rule_t
+            rules, err = cf.ListEmailForwards()
+            if err == nil {
+                rows := make([][]string, 0, len(rules))
+                for _, rule := range(rules) {
+                    rows = append(rows, []string{rule.From(), strings.Join(rule.To(), " "), fmt.Sprintf("%t", rule.Enabled)})
+                }
+                err = printList(*fFormat, []string{"from", "to", "enabled"}, rows, rules)
+                output = rules
+                listing = true
+            }
+        } else if *fEmailRoute {
+            err = cf.EnableEmailRouting()
+        } else if len(*fFrom) == 0 {
+            err = fmt.Errorf("Address to forward not set.  use the -from option")
+        } else if *fDeleteFwd {
+            err = cf.DeleteEmailForward(*fFrom)
+        } else if len(*fTo) == 0 {
+            err = fmt.Errorf("Address to forward to not set.  use the -to option")
+        } else {
+            fmt.Printf("Forwarding %s to %s\n", *fFrom, *fTo)
+            err = cf.EnableEmailRouting()
+            if err == nil { err = cf.AssignEmailForward(*fFrom, *fTo) }
+        }
+    
+    } else if (*fCreateBkt || *fDeleteBkt || *fListBkt) && !*fTP_CloudFlare {    //spaces buckets
+        if *fListBkt {
+            var buckets []libraries.DO_bucket_t
+            buckets, err = do.ListBuckets(*fRegion)
+            if err == nil {
+                rows := make([][]string, 0, len(buckets))
+                for _, b := range(buckets) {
+                    rows = append(rows, []string{b.Name, b.Created})
+                }
+                err = printList(*fFormat, []string{"name", "created"}, rows, buckets)
+                output = buckets
+                listing = true
+            }
+        } else if len(*fBucket) == 0 {
+            err = fmt.Errorf("Bucket name not set.  use the -bucket option")
+        } else if *fDeleteBkt {
+            err = do.DeleteBucket(*fBucket, *fRegion)
+        } else {
+            fmt.Println("Creating bucket: " + *fBucket)
+            err = do.CreateBucket(*fBucket, *fRegion)
+        }
+    
+    } else if *fCreateCDN || *fDeleteCDN || *fListCDN || *fPurgeCDN {   //cdn endpoints
+        if *fListCDN {
+            var cdns []libraries.DO_cdn_t
+            cdns, err = do.ListCDNs()
+            if err == nil {
+                rows := make([][]string, 0, len(cdns))
+                for _, c := range(cdns) {
+                    rows = append(rows, []string{c.ID, c.Origin, c.Endpoint, c.CustomDomain, fmt.Sprint(c.TTL)})
+                }
+                err = printList(*fFormat, []string{"id", "origin", "endpoint", "custom_domain", "ttl"}, rows, cdns)
+                output = cdns
+                listing = true
+            }
+        } else if len(*fBucket) == 0 {
+            err = fmt.Errorf("Bucket name not set.  use the -bucket option")
+        } else if *fDeleteCDN {
+            err = do.DeleteCDN(*fBucket, *fRegion)
+        } else if *fPurgeCDN {
+            fmt.Println("Purging cdn cache for bucket: " + *fBucket)
+            err = do.PurgeCDN(*fBucket, *fRegion, strings.Split(*fFiles, ","))
+        } else if len(*fSubDomain) > 0 && len(*fDomain) == 0 {
+            err = fmt.Errorf("Domain name not set for the custom domain.  use the -d option")
         } else {
-            err = fmt.Errorf("Missing command line options for creating a sub-domain\n-ip, && -sd")
+            fmt.Println("Setting cdn endpoint for bucket: " + *fBucket)
+            var cdn *libraries.DO_cdn_t
+            cdn, err = do.AssignCDN(*fBucket, *fRegion, int(fTTL.Seconds()), *fDomain, *fSubDomain, *fCertID)
+            if err == nil {
+                fmt.Println("CDN endpoint: " + cdn.Endpoint)
+                output = cdn
+            }
         }
     
+    } else if len(*fApp) > 0 || *fDeploy {    //app platform
+        var app *libraries.DO_app_t
+        if len(*fApp) > 0 {
+            var spec []byte
+            spec, err = ioutil.ReadFile(*fApp)
+            if err == nil && !json.Valid(spec) { err = fmt.Errorf("App spec '%s' needs to be json", *fApp) }
+            if err == nil {
+                fmt.Println("Setting app from spec: " + *fApp)
+                err = progress.Step("set app", func() (err error) {
+                    app, err = do.AssignApp(spec)
+                    return
+                })
+            }
+        } else if len(*fNodeName) > 0 {
+            fmt.Println("Deploying app: " + *fNodeName)
+            err = progress.Step("deploy app " + *fNodeName, func() (err error) {
+                app, err = do.DeployApp(*fNodeName, *fForceBuild)
+                return
+            })
+        } else {
+            err = fmt.Errorf("App name not set.  use the -n option")
+        }
+        
+        if err == nil && *fWait {
+            fmt.Println("Waiting for deployment to finish")
+            err = progress.Step("wait for deployment", func() error { return do.WaitForDeployment(app, time.Minute * 30) })
+        }
+        if app != nil {
+            if len(app.LiveURL) > 0 { fmt.Println("Live url: " + app.LiveURL) }
+            fileOutput.App = app
+        }
+    
+    } else if *fCreateNS || *fDeleteNS || *fListNS {    //functions namespaces
+        if *fListNS {
+            var namespaces []libraries.DO_namespace_t
+            namespaces, err = do.ListNamespaces()
+            if err == nil {
+                rows := make([][]string, 0, len(namespaces))
+                for _, ns := range(namespaces) {
+                    rows = append(rows, []string{ns.ID, ns.Label, ns.Region, ns.APIHost})
+                }
+                err = printList(*fFormat, []string{"id", "label", "region", "api_host"}, rows, namespaces)
+                output = namespaces
+                listing = true
+            }
+        } else if len(*fNamespace) == 0 {
+            err = fmt.Errorf("Namespace not set.  use the -namespace option")
+        } else if *fDeleteNS {
+            err = do.DeleteNamespace(*fNamespace)
+        } else {
+            fmt.Println("Creating functions namespace: " + *fNamespace)
+            var ns *libraries.DO_namespace_t
+            ns, err = do.CreateNamespace(*fNamespace, *fRegion)
+            if err == nil { output = ns }
+        }
+    
+    } else if *fCreateTrig || *fDeleteTrig || *fListTrig {  //functions triggers
+        if len(*fNamespace) == 0 {
+            err = fmt.Errorf("Namespace not set.  use the -namespace option")
+        } else if *fListTrig {
+            var triggers []libraries.DO_trigger_t
+            triggers, err = do.ListTriggers(*fNamespace)
+            if err == nil {
+                rows := make([][]string, 0, len(triggers))
+                for _, t := range(triggers) {
+                    rows = append(rows, []string{t.Name, t.Function, t.Schedule.Cron, fmt.Sprint(t.Enabled)})
+                }
+                err = printList(*fFormat, []string{"name", "function", "cron", "enabled"}, rows, triggers)
+                output = triggers
+                listing = true
+            }
+        } else if len(*fTrigger) == 0 {
+            err = fmt.Errorf("Trigger name not set.  use the -trigger option")
+        } else if *fDeleteTrig {
+            err = do.DeleteTrigger(*fNamespace, *fTrigger)
+        } else if len(*fFunction) == 0 || len(*fCron) == 0 {
+            err = fmt.Errorf("Missing command line options for creating a trigger\n-function, && -cron")
+        } else {
+            fmt.Println("Setting trigger: " + *fTrigger)
+            err = do.AssignTrigger(*fNamespace, *fTrigger, *fFunction, *fCron, *fBody)
+        }
+    
+    } else if *fCreateUp || *fDeleteUp || *fListUp {    //uptime checks
+        if *fListUp {
+            var checks []libraries.DO_uptime_check_t
+            checks, err = do.ListUptimeChecks()
+            if err == nil {
+                rows := make([][]string, 0, len(checks))
+                for _, c := range(checks) {
+                    rows = append(rows, []string{c.ID, c.Name, c.Type, c.Target, strings.Join(c.Regions, " "), fmt.Sprint(c.Enabled)})
+                }
+                err = printList(*fFormat, []string{"id", "name", "type", "target", "regions", "enabled"}, rows, checks)
+                output = checks
+                listing = true
+            }
+        } else if len(*fCheck) == 0 {
+            err = fmt.Errorf("Uptime check name not set.  use the -check option")
+        } else if *fDeleteUp {
+            err = do.DeleteUptimeCheck(*fCheck)
+        } else if len(*fTarget) == 0 {
+            err = fmt.Errorf("Uptime check target not set.  use the -target option")
+        } else {
+            fmt.Println("Setting uptime check: " + *fCheck)
+            var check *libraries.DO_uptime_check_t
+            check, err = do.AssignUptimeCheck(*fCheck, *fCheckType, *fTarget)
+            if err == nil { output = check }
+        }
+    
+    } else if *fCreatePool || *fDeletePool || *fListPool || *fUpgrade || *fKubeconfig { //kubernetes
+        if len(*fCluster) == 0 {
+            err = fmt.Errorf("Cluster name not set.  use the -cluster option")
+        } else if *fListPool {
+            var pools []libraries.DO_pool_t
+            pools, err = do.ListPools(*fCluster)
+            if err == nil {
+                rows := make([][]string, 0, len(pools))
+                for _, p := range(pools) {
+                    labels, taints := make([]string, 0), make([]string, 0)
+                    for k, v := range(p.Labels) { labels = append(labels, k + "=" + v) }
+                    for _, t := range(p.Taints) { taints = append(taints, t.Key + "=" + t.Value + ":" + t.Effect) }
+                    rows = append(rows, []string{p.ID, p.Name, p.Size, fmt.Sprint(p.Count), fmt.Sprint(p.AutoScale), fmt.Sprint(p.MinNodes), fmt.Sprint(p.MaxNodes), strings.Join(labels, " "), strings.Join(taints, " ")})
+                }
+                err = printList(*fFormat, []string{"id", "name", "size", "count", "auto_scale", "min", "max", "labels", "taints"}, rows, pools)
+                output = pools
+                listing = true
+            }
+        } else if *fUpgrade {
+            fmt.Println("Upgrading cluster: " + *fCluster)
+            var version string
+            version, err = do.UpgradeCluster(*fCluster, *fK8sVersion, *fSurge)
+            if err == nil { fmt.Println("Cluster version: " + version) }
+        } else if *fKubeconfig {
+            var kubeconfig []byte
+            kubeconfig, err = do.Kubeconfig(*fCluster, *fExpiry)
+            if err == nil { fmt.Print(string(kubeconfig)) }
+            listing = true  //so it can be piped straight into a file
+        } else if len(*fPool) == 0 {
+            err = fmt.Errorf("Node pool name not set.  use the -pool option")
+        } else if *fDeletePool {
+            err = do.DeletePool(*fCluster, *fPool)
+        } else if pool, ok := config.DO.NodePools[*fPool]; !ok {
+            err = fmt.Errorf("Node pool '%s' not found in the node_pools of the config", *fPool)
+        } else {
+            fmt.Println("Setting node pool: " + *fPool)
+            if len(pool.Name) == 0 { pool.Name = *fPool }
+            var p *libraries.DO_pool_t
+            p, err = do.AssignPool(*fCluster, pool)
+            if err == nil { output = p }
+        }
+    
+    } else if *fCreateDBP || *fDeleteDBP || *fListDBP || *fCreateRep || *fDeleteRep || *fListRep || *fMaintain || *fFork {   //managed databases
+        if len(*fDatabase) == 0 {
+            err = fmt.Errorf("Database cluster not set.  use the -db option")
+        } else if *fListDBP {
+            var pools []libraries.DO_db_pool_t
+            pools, err = do.ListDatabasePools(*fDatabase)
+            if err == nil {
+                rows := make([][]string, 0, len(pools))
+                for _, p := range(pools) {
+                    rows = append(rows, []string{p.Name, p.Mode, fmt.Sprint(p.Size), p.DB, p.User})
+                }
+                err = printList(*fFormat, []string{"name", "mode", "size", "db", "user"}, rows, pools)
+                output = pools
+                listing = true
+            }
+        } else if *fListRep {
+            var replicas []libraries.DO_replica_t
+            replicas, err = do.ListReplicas(*fDatabase)
+            if err == nil {
+                rows := make([][]string, 0, len(replicas))
+                for _, r := range(replicas) {
+                    rows = append(rows, []string{r.Name, r.Region, r.Size, r.Status, fmt.Sprintf("%s:%d", r.Connection.Host, r.Connection.Port)})
+                }
+                err = printList(*fFormat, []string{"name", "region", "size", "status", "host"}, rows, replicas)
+                output = replicas
+                listing = true
+            }
+        } else if *fMaintain {
+            fmt.Printf("Setting maintenance window to %s %s\n", *fDay, *fHour)
+            err = do.SetMaintenanceWindow(*fDatabase, *fDay, *fHour)
+        } else if *fFork {
+            var at time.Time
+            if len(*fAt) > 0 { at, err = time.Parse(time.RFC3339, *fAt) }
+            if err == nil && len(*fNodeName) == 0 { err = fmt.Errorf("Name for the new database cluster not set.  use the -n option") }
+            if err == nil {
+                fmt.Printf("Forking database %s to %s\n", *fDatabase, *fNodeName)
+                var db *libraries.DO_database_t
+                db, err = do.ForkDatabase(*fDatabase, *fNodeName, at)
+                if err == nil { output = db }
+            }
+        } else if *fCreateRep || *fDeleteRep {
+            if len(*fReplica) == 0 {
+                err = fmt.Errorf("Replica name not set.  use the -replica option")
+            } else if *fDeleteRep {
+                err = do.DeleteReplica(*fDatabase, *fReplica)
+            } else {
+                region := ""
+                if flagSet("region") { region = *fRegion }  //otherwise it lives with the cluster
+                fmt.Println("Creating replica: " + *fReplica)
+                var replica *libraries.DO_replica_t
+                replica, err = do.CreateReplica(*fDatabase, *fReplica, region, *fDBSize)
+                if err == nil { output = replica }
+            }
+        } else if len(*fPool) == 0 {
+            err = fmt.Errorf("Connection pool name not set.  use the -pool option")
+        } else if *fDeleteDBP {
+            err = do.DeleteDatabasePool(*fDatabase, *fPool)
+        } else if len(*fDBName) == 0 {
+            err = fmt.Errorf("Database for the connection pool not set.  use the -dbname option")
+        } else {
+            fmt.Println("Setting connection pool: " + *fPool)
+            err = do.AssignDatabasePool(*fDatabase, libraries.DO_db_pool_t{Name: *fPool, Mode: *fPoolMode, Size: *fPoolSize, DB: *fDBName, User: *fDBUser})
+        }
+    
+    } else if *fAudit {
+        var findings []audit_finding_t
+        findings, err = runAudit(do, cf, *fTP_CloudFlare)
+        if err == nil {
+            rows := make([][]string, 0, len(findings))
+            for _, f := range(findings) {
+                rows = append(rows, []string{f.Check, f.Resource, f.Message})
+            }
+            err = printList(*fFormat, []string{"check", "resource", "message"}, rows, findings)
+            output = findings
+            listing = true
+            if err == nil && len(findings) > 0 { err = fmt.Errorf("Audit found %d problems", len(findings)) }
+        }
+    
+    } else if *fHealth {    //post deploy gate
+        var results []health_result_t
+        results, err = runHealthChecks(do, cf, *fTP_CloudFlare, *fDomain, *fTag, *fStack, *fHealthURL, *fConcurrent)
+        if err == nil {
+            failed := 0
+            rows := make([][]string, 0, len(results))
+            for _, r := range(results) {
+                if !r.OK { failed++ }
+                rows = append(rows, []string{r.Check, r.Target, r.Probe, healthStatus(r.OK), fmt.Sprint(r.Millis), r.Error})
+            }
+            err = printList(*fFormat, []string{"check", "target", "probe", "status", "ms", "error"}, rows, results)
+            output = results
+            listing = true
+            if err == nil && failed > 0 { err = fmt.Errorf("%d of %d health checks failed", failed, len(results)) }
+        }
+    
+    } else if len(*fPurgeIP) > 0 {  //records left pointing at an address we gave up
+        var records []libraries.DNS_ip_record_t
+        records, err = purgeIP(*fPurgeIP, *fRetarget, *fDomain, *fTP_CloudFlare, len(*fZone) > 0 || (*fTP_CloudFlare && len(*fDomain) > 0), *fDryRun, *fYes, config, do, cf)
+        if records != nil { output = records }
+        if err == nil && *fDryRun { fmt.Println("Dry run, nothing was changed") }
+
+    } else if *fCompat {    //api schema drift
+        results := do.CompatCheck()
+        if len(cf.Config.APIKey) > 0 { results = append(results, cf.CompatCheck()...) }
+        rows := make([][]string, 0, len(results))
+        drifted := 0
+        for _, r := range(results) {
+            rows = append(rows, []string{r.Provider, r.Endpoint, r.Result, r.Detail})
+            if r.Result == "drift" || r.Result == "error" { drifted++ }
+        }
+        err = printList(*fFormat, []string{"provider", "endpoint", "result", "detail"}, rows, results)
+        output = results
+        listing = true
+        if err == nil && drifted > 0 { err = fmt.Errorf("%d of %d endpoints have drifted or failed", drifted, len(results)) }
+
+    } else if len(*fSlack) > 0 {   //chatops
+        err = serveSlack(*fSlack, config, events, do, cf)
+        listing = true
+
+    } else if len(*fStatusPage) > 0 {   //status page for stakeholders
+        if *fWatch {
+            err = watchStatus(*fStatusPage, *fRegion, *fTP_CloudFlare, *fDomain, *fTag, *fStack, *fHealthURL, *fConcurrent, *fInterval, *fDryRun, events, do, cf)
+        } else {
+            var status *status_t
+            status, err = publishStatus(*fStatusPage, *fRegion, *fTP_CloudFlare, *fDomain, *fTag, *fStack, *fHealthURL, *fConcurrent, *fDryRun, do, cf)
+            if status != nil { output = status }
+        }
+        listing = true
+        if err == nil && *fDryRun { fmt.Println("Dry run, nothing was changed") }
+
+    } else if *fFirewall {
+        if len(*fStack) == 0 || len(*fRules) == 0 {
+            err = fmt.Errorf("Stack and rule sets not set.  use the -stack and -rules options")
+        } else {
+            var diff []string
+            diff, err = do.ApplyFirewall(*fStack, strings.Split(*fRules, ","), *fDryRun)
+            for _, d := range(diff) { fmt.Println(d) }
+            if err == nil && len(diff) == 0 { fmt.Println("Firewall rules already match, no work to do") }
+            if *fDryRun && len(diff) > 0 { fmt.Println("Dry run, nothing was changed") }
+        }
+    
+    } else if *fAllowTemp {    //ad-hoc openings that close themselves
+        var grant *fw_grant_t
+        grant, err = allowTemp(*fNodeName, *fProtocol, *fPorts, *fFrom, *fTTL, config.StateRepo, *fDryRun, do)
+        if grant != nil { output = grant }
+        if err == nil && *fDryRun { fmt.Println("Dry run, nothing was changed") }
+    
+    } else if len(*fAllowSync) > 0 {   //allowlists from wherever they're published
+        var changes []allowlist_change_t
+        changes, err = syncAllowlists(*fAllowSync, config.Allowlists, *fDryRun, do, cf)
+        for _, c := range(changes) { fmt.Println(c) }
+        if changes != nil { output = changes }
+        if err == nil && len(changes) == 0 { fmt.Println("Allowlists already match, no work to do") }
+        if err == nil && *fDryRun && len(changes) > 0 { fmt.Println("Dry run, nothing was changed") }
+    
+    } else if *fTagAudit {
+        var audit []libraries.DO_tag_audit_t
+        audit, err = do.AuditTags(*fTag)
+        if err == nil {
+            rows := make([][]string, 0, len(audit))
+            for _, a := range(audit) {
+                rows = append(rows, []string{fmt.Sprint(a.ID), a.Name, strings.Join(a.Missing, " ")})
+            }
+            err = printList(*fFormat, []string{"id", "name", "missing"}, rows, audit)
+            output = audit
+            listing = true
+            if err == nil && len(audit) > 0 { err = fmt.Errorf("%d nodes are missing required tags", len(audit)) }
+        }
+    
+    } else if len(*fRetag) > 0 {    //bulk tag changes
+        var rules []libraries.DO_retag_t
+        rules, err = readRetagFile(*fRetag)
+        if err == nil {
+            var changes []libraries.DO_tag_change_t
+            changes, err = do.Retag(rules, *fDryRun)
+            rows := make([][]string, 0, len(changes))
+            for _, c := range(changes) {
+                rows = append(rows, []string{c.Node, c.Action, c.Tag})
+            }
+            if len(changes) == 0 {
+                fmt.Println("Tags already match, no work to do")
+            } else if printErr := printList(*fFormat, []string{"node", "action", "tag"}, rows, changes); err == nil {
+                err = printErr
+            }
+            if *fDryRun && len(changes) > 0 { fmt.Println("Dry run, nothing was changed") }
+            output = changes
+        }
+    
+    } else if *fConsole {   //getting into a broken node
+        if len(*fNodeName) == 0 {
+            err = fmt.Errorf("Node name not set.  use the -n option")
+        } else {
+            var console *libraries.DO_console_t
+            console, err = do.NodeConsole(*fNodeName, *fConsoleAct)
+            if console != nil {
+                output = console
+                fmt.Printf("Node %s (%d) is %s at %s\n", console.Name, console.ID, console.Status, console.IP)
+                fmt.Println("Console:  " + console.ConsoleURL)
+                fmt.Println("Recovery: " + console.RecoveryURL)
+                fmt.Println("  the recovery iso can only be turned on from the dashboard, then power cycle the node with -console-action=power_cycle to boot into it")
+                if len(console.IP) > 0 { fmt.Printf("  once it's back up: ssh root@%s\n", console.IP) }
+            }
+        }
+    
+    } else if *fCheckPTR || len(*fRename) > 0 { //reverse dns
+        if len(*fNodeName) == 0 {
+            err = fmt.Errorf("Node name not set.  use the -n option")
+        } else if len(*fRename) > 0 {
+            err = do.RenameNode(*fNodeName, *fRename)
+        } else {
+            var warnings []string
+            warnings, err = do.CheckReverseDNS(*fNodeName)
+            for _, w := range(warnings) { fmt.Println(w) }
+            if err == nil && len(warnings) > 0 { err = fmt.Errorf("Reverse dns for '%s' doesn't match", *fNodeName) }
+        }
+    
+    } else if *fDNSSync {   //dns records for the fleet
+        if *fTP_CloudFlare {
+            err = fmt.Errorf("-dnssync only supports digital ocean domains")
+        } else if len(*fDomain) == 0 || len(*fTag) == 0 {
+            err = fmt.Errorf("Domain and tag not set.  use the -d and -tag options")
+        } else {
+            var changes []libraries.DO_sync_change_t
+            changes, err = do.SyncNodeRecords(*fDomain, *fTag, *fPrivate, *fDryRun, func (name string) error {
+                return config.Protected.checkDNS(cf, false, *fDomain, name)
+            })
+            rows := make([][]string, 0, len(changes))
+            for _, c := range(changes) {
+                rows = append(rows, []string{c.Action, c.Name, c.IP, c.Message})
+            }
+            if len(changes) == 0 {
+                fmt.Println("Domain records already match the nodes, no work to do")
+            } else if printErr := printList(*fFormat, []string{"action", "name", "ip", "message"}, rows, changes); err == nil {
+                err = printErr
+            }
+            if *fDryRun && len(changes) > 0 { fmt.Println("Dry run, nothing was changed") }
+            output = changes
+        }
+    
+    } else if len(*fStackDiff) > 0 {    //staging against prod
+        if len(*fStack) == 0 {
+            err = fmt.Errorf("Stack to compare with not set.  use the -stack option")
+        } else {
+            var diff []libraries.DO_stack_diff_t
+            diff, err = do.DiffStacks(*fStack, *fStackDiff, *fDomain)
+            if err == nil {
+                rows := make([][]string, 0, len(diff))
+                for _, d := range(diff) {
+                    rows = append(rows, []string{d.Field, d.A, d.B})
+                }
+                if len(diff) == 0 {
+                    fmt.Printf("Stacks %s and %s match\n", *fStack, *fStackDiff)
+                } else {
+                    err = printList(*fFormat, []string{"field", *fStack, *fStackDiff}, rows, diff)
+                    if err == nil { err = fmt.Errorf("Stacks %s and %s have %d differences", *fStack, *fStackDiff, len(diff)) }
+                }
+                output = diff
+                listing = true
+            }
+        }
+
+    } else if *fAnnotate {  //who owns a node and why it's there
+        if len(*fNodeName) == 0 {
+            err = fmt.Errorf("Node name not set.  use the -n option")
+        } else if len(*fOwner) == 0 && len(*fNote) == 0 {
+            err = fmt.Errorf("Nothing to set.  use the -owner or -note options")
+        } else {
+            var changes []libraries.DO_tag_change_t
+            changes, err = do.SetNodeInfo(*fNodeName, *fOwner, *fNote)
+            if len(changes) == 0 && err == nil { fmt.Println("Owner and note already match, no work to do") }
+            for _, c := range(changes) { fmt.Printf("%s %s %s\n", c.Node, c.Action, c.Tag) }
+            output = changes
+        }
+
+    } else if *fSelf {  //running on the node, ie a worker registering itself
+        var meta *libraries.DO_metadata_t
+        meta, err = do.Metadata()
+        if err == nil {
+            output = meta
+            ip := meta.PublicIP()
+            if *fPrivate { ip = meta.PrivateIP() }
+            fmt.Printf("Node %d %s in %s, ip %s, tags %s\n", meta.DropletID, meta.Hostname, meta.Region, ip, strings.Join(meta.Tags, ", "))
+            
+            if len(*fSubDomain) > 0 {
+                subDomain := strings.ReplaceAll(*fSubDomain, "{hostname}", meta.Hostname)
+                err = config.Protected.checkDNS(cf, *fTP_CloudFlare, *fDomain, subDomain)
+                if err == nil && len(ip) == 0 {
+                    err = fmt.Errorf("Node doesn't have an ip address to point %s at", subDomain)
+                } else if err == nil && *fTP_CloudFlare {
+                    err = cf.AssignDomainRecord("A", subDomain, ip)
+                } else if err == nil && len(*fDomain) == 0 {
+                    err = fmt.Errorf("Domain name not set. use the -d option")
+                } else if err == nil {
+                    err = do.AssignDomainRecord(*fDomain, "A", subDomain, ip)
+                }
+            }
+            if err == nil && len(*fTag) > 0 { err = do.TagNode(meta.DropletID, *fTag) }
+        }
+    
+    } else if *fListNodes {
+        var nodes []libraries.DO_node_t
+        nodes, err = do.ListNodes(*fTag, *fStack)
+        if err == nil {
+            rows := make([][]string, 0, len(nodes))
+            for _, n := range(nodes) {
+                rows = append(rows, []string{fmt.Sprint(n.ID), n.Name, n.Status, n.Region, n.Size, n.GPU, n.IP, fmt.Sprint(n.Managed), n.Stack, n.Created, n.Template, n.Owner, n.Note, n.Expires})
+            }
+            err = printList(*fFormat, []string{"id", "name", "status", "region", "size", "gpu", "ip", "managed", "stack", "created", "template", "owner", "note", "expires"}, rows, nodes)
+            output = nodes
+            listing = true
+        }
+    
+    } else if *fOneClicks {
+        var apps []libraries.DO_one_click_t
+        apps, err = do.ListOneClicks("droplet")
+        if err == nil {
+            rows := make([][]string, 0, len(apps))
+            for _, a := range(apps) {
+                rows = append(rows, []string{a.Slug, a.Type})
+            }
+            err = printList(*fFormat, []string{"slug", "type"}, rows, apps)
+            output = apps
+            listing = true
+        }
+
+    } else if *fListSizes {
+        region := ""
+        if flagSet("region") { region = *fRegion }
+        var sizes []libraries.DO_size_t
+        sizes, err = do.ListSizes(region, *fClass)
+        if err == nil {
+            rows := make([][]string, 0, len(sizes))
+            for _, sz := range(sizes) {
+                rows = append(rows, []string{sz.Slug, sz.Class, fmt.Sprint(sz.VCPUs), fmt.Sprintf("%dmb", sz.Memory), fmt.Sprintf("%dgb", sz.Disk), fmt.Sprintf("%.2f", sz.PriceMonthly), sz.GPU, strings.Join(sz.Regions, " ")})
+            }
+            err = printList(*fFormat, []string{"slug", "class", "vcpus", "memory", "disk", "monthly", "gpu", "regions"}, rows, sizes)
+            output = sizes
+            listing = true
+        }
+    
+    } else if *fListAction {    //action history
+        var actions []libraries.DO_action_t
+        actions, err = do.ListActions(*fNodeName, *fLimit)
+        if err == nil {
+            rows := make([][]string, 0, len(actions))
+            for _, a := range(actions) {
+                rows = append(rows, []string{fmt.Sprint(a.ID), a.Type, a.Status, a.ResourceType, fmt.Sprint(a.ResourceID), a.Region, a.StartedAt, a.CompletedAt})
+            }
+            err = printList(*fFormat, []string{"id", "type", "status", "resource_type", "resource_id", "region", "started", "completed"}, rows, actions)
+            output = actions
+            listing = true
+        }
+    
+    } else if *fWaitAction > 0 {    //attach to an action that's still running
+        fmt.Printf("Waiting for action %d to finish\n", *fWaitAction)
+        var action *libraries.DO_action_t
+        action, err = do.WaitForAction(*fWaitAction, time.Minute * 30)
+        if action != nil { output = action }
+    
+    } else if *fReap {  //review environments that outlived their pr
+        var reap []libraries.DO_reap_t
+        reap, err = do.Reapable()
+        grants := make(map[string]fw_grant_t)
+        if err == nil {
+            var expired []fw_grant_t
+            expired, err = expiredGrants(config.StateRepo)
+            for _, g := range(expired) {
+                grants[g.id()] = g
+                reap = append(reap, libraries.DO_reap_t{Type: "fw_grant", ID: g.id(), Name: g.String(), Reason: "expired " + g.Expires.Local().Format("2006-01-02 15:04")})
+            }
+        }
+        if err == nil {
+            rows := make([][]string, 0, len(reap))
+            for _, r := range(reap) {
+                rows = append(rows, []string{r.Type, r.ID, r.Name, r.Region, r.Reason})
+            }
+            var printErr error
+            if len(reap) == 0 {
+                fmt.Println("Nothing to reap, no work to do")
+            } else {
+                printErr = printList(*fFormat, []string{"type", "id", "name", "region", "reason"}, rows, reap)
+            }
+            output = reap
+
+            if *fDryRun {
+                if len(reap) > 0 { fmt.Println("Dry run, nothing was changed") }
+            } else {
+                failed := make([]string, 0)     //one that can't go shouldn't keep the rest around
+                for _, r := range(reap) {
+                    var reapErr error
+                    if r.Type == "fw_grant" {
+                        reapErr = revokeGrant(grants[r.ID], config.StateRepo, do)
+                    } else if r.Type != "node" {
+                        reapErr = do.ReapResource(r)
+                    } else if reapErr = config.Protected.checkNode(do, r.Name); reapErr == nil {
+                        reapErr = config.Hooks.around(do, "delete", hook_event_t{Name: r.Name}, func () error { return do.ReapResource(r) })
+                    }
+                    if reapErr != nil {
+                        failed = append(failed, r.Type + " " + r.Name)
+                        fmt.Printf("  %s %s :: FAILED :: %s\n", r.Type, r.Name, reapErr.Error())
+                    }
+                }
+                if len(failed) > 0 { err = fmt.Errorf("Unable to reap %d of %d :: %s", len(failed), len(reap), strings.Join(failed, ", ")) }
+            }
+            if err == nil { err = printErr }
+        }
+
+    } else if *fBuildImage || *fRollout {   //new images from packer and onto the nodes
+        var result *rollout_result_t
+        result, err = rolloutImage(*fBuildImage, *fRollout, *fImage, *fTag, *fStack, *fLatest, *fDryRun, config, do)
+        if result != nil { output = result }
+        if err == nil && *fDryRun { fmt.Println("Dry run, nothing was changed") }
+
+    } else if *fExec {     //the droplet listing is the host list
+        var results []*libraries.DO_exec_t
+        results, err = execNodes(*fTag, *fStack, strings.Join(flag.Args(), " "), *fConcurrent, *fDryRun, do)
+        if len(results) > 0 {
+            rows := make([][]string, 0, len(results))
+            for _, r := range(results) { rows = append(rows, []string{r.Node, r.IP, fmt.Sprint(r.ExitCode), fmt.Sprint(r.Seconds), r.Result}) }
+            if printErr := printList(*fFormat, []string{"node", "ip", "exit", "seconds", "result"}, rows, results); err == nil { err = printErr }
+            output = results
+        }
+        if err == nil && *fDryRun { fmt.Println("Dry run, nothing was changed") }
+
+    } else if *fPush {     //small config changes between deploys
+        var results []*libraries.DO_push_t
+        results, err = pushNodes(*fTag, *fStack, flag.Args(), *fReload, *fConcurrent, *fDryRun, do)
+        if len(results) > 0 {
+            rows := make([][]string, 0, len(results))
+            for _, r := range(results) { rows = append(rows, []string{r.Node, r.IP, fmt.Sprint(r.Files), fmt.Sprint(r.Reloaded), fmt.Sprint(r.Seconds), r.Result}) }
+            if printErr := printList(*fFormat, []string{"node", "ip", "files", "reloaded", "seconds", "result"}, rows, results); err == nil { err = printErr }
+            output = results
+        }
+        if err == nil && *fDryRun { fmt.Println("Dry run, nothing was changed") }
+
+    } else if len(*fInventory) > 0 {   //monitoring and ssh that match what's running
+        inv := inventory_t{Kind: *fInventory, Out: *fInvOut, Tag: *fTag, Stack: *fStack, Port: *fPorts, User: *fSSHUser, Identity: *fSSHIdent, KnownHosts: *fKnownHosts, Events: events}
+        if *fWatch {
+            err = watchInventory(inv, *fInterval, do)
+        } else {
+            _, _, err = writeInventory(inv, do)
+        }
+        listing = true
+
+    } else if *fCapacity {     //who needs a bigger size
+        limits := libraries.DO_capacity_limits_t{Disk: *fMaxDisk, Memory: *fMaxMemory, Load: *fMaxLoad}
+        var report []*libraries.DO_capacity_t
+        report, err = capacityReport(*fTag, *fStack, *fFormat, limits, *fConcurrent, do)
+        output = report
+        listing = true
+
+    } else if *fRightsize {    //paying for what's used
+        var report []*libraries.DO_rightsize_t
+        report, err = rightsize(*fTag, *fStack, *fRightOut, *fFormat, do)
+        output = report
+        listing = true
+
+    } else if *fPatch {    //monthly patch night
+        var results []*libraries.DO_patch_t
+        results, err = patchNodes(*fTag, *fStack, *fHealthURL, flagSet("health-url"), *fDryRun, do)
+        if len(results) > 0 {
+            rows := make([][]string, 0, len(results))
+            for _, r := range(results) { rows = append(rows, []string{r.Node, r.IP, fmt.Sprint(r.Rebooted), fmt.Sprint(r.Seconds), r.Result}) }
+            if printErr := printList(*fFormat, []string{"node", "ip", "rebooted", "seconds", "result"}, rows, results); err == nil { err = printErr }
+            output = results
+        }
+        if err == nil && *fDryRun { fmt.Println("Dry run, nothing was changed") }
+
+    } else if len(*fVolSnap) > 0 {  //scheduled volume backups
+        var snap *libraries.DO_volume_snapshot_t
+        snap, err = do.SnapshotVolume(*fVolSnap, *fRegion)
+        if err == nil { fmt.Printf("Snapshot %s is %.2f GB\n", snap.Name, snap.SizeGB) }
+        output = snap
+        if err == nil && *fPrune {
+            var pruned []libraries.DO_volume_snapshot_t
+            pruned, err = do.PruneVolumeSnapshots(*fVolSnap + "-*", *fDays, *fKeep, *fDryRun)
+            for _, p := range(pruned) { fmt.Printf("- snapshot %s from %s\n", p.Name, p.Created.Format("2006-01-02")) }
+            if *fDryRun && len(pruned) > 0 { fmt.Println("Dry run, no snapshots were removed") }
+        }
+
+    } else if len(*fVolRestore) > 0 {   //rebuilding a stateful node's data
+        var volume *libraries.DO_volume_t
+        volume, err = do.RestoreVolume(*fVolRestore, *fRegion, *fNodeName)
+        if volume != nil { output = volume }
+
+    } else if *fPrune { //old snapshots and images
+        if len(*fMatch) == 0 {
+            err = fmt.Errorf("Image name pattern not set.  use the -match option")
+        } else {
+            var pruned []libraries.DO_image_t
+            pruned, err = do.PruneImages(*fMatch, *fDays, *fKeep, *fDryRun)
+            
+            total := 0.0
+            rows := make([][]string, 0, len(pruned))
+            for _, img := range(pruned) {
+                total += img.SizeGB
+                rows = append(rows, []string{fmt.Sprint(img.ID), img.Name, img.Type, img.Created.Format("2006-01-02"), fmt.Sprintf("%.2f", img.SizeGB)})
+            }
+            if len(rows) > 0 {
+                if printErr := printList(*fFormat, []string{"id", "name", "type", "created", "size_gb"}, rows, pruned); err == nil { err = printErr }
+            }
+            
+            if *fDryRun {
+                fmt.Printf("Would remove %d images, reclaiming %.2f GB\n", len(pruned), total)
+            } else {
+                fmt.Printf("Removed %d images, reclaiming %.2f GB\n", len(pruned), total)
+            }
+            output = pruned
+        }
+    
+    } else if *fCreateCert || *fDeleteCert || *fListCert {  //certificates
+        if *fListCert {
+            var certs []libraries.DO_cert_t
+            certs, err = do.ListCertificates()
+            if err == nil {
+                expiring := make([]libraries.DO_cert_t, 0)
+                rows := make([][]string, 0, len(certs))
+                for _, c := range(certs) {
+                    if *fWithin > 0 && c.DaysLeft() > *fWithin { continue }
+                    expiring = append(expiring, c)
+                    rows = append(rows, []string{c.ID, c.Name, c.Type, c.State, c.NotAfter.Format("2006-01-02"), fmt.Sprint(c.DaysLeft()), strings.Join(c.DNSNames, " ")})
+                }
+                err = printList(*fFormat, []string{"id", "name", "type", "state", "expires", "days_left", "dns_names"}, rows, expiring)
+                output = expiring
+                listing = true
+                
+                if err == nil && *fWithin > 0 && len(expiring) > 0 {
+                    err = fmt.Errorf("%d certificates expire within %d days", len(expiring), *fWithin)
+                }
+            }
+        } else if len(*fCertID) == 0 {
+            err = fmt.Errorf("Certificate name not set.  use the -cert option")
+        } else if *fDeleteCert {
+            err = do.DeleteCertificate(*fCertID)
+        } else {
+            fmt.Println("Creating certificate: " + *fCertID)
+            var cert *libraries.DO_cert_t
+            if len(*fCertFile) > 0 {
+                var leaf, key, chain []byte
+                leaf, err = ioutil.ReadFile(*fCertFile)
+                if err == nil { key, err = ioutil.ReadFile(*fKeyFile) }
+                if err == nil && len(*fChainFile) > 0 { chain, err = ioutil.ReadFile(*fChainFile) }
+                if err == nil { cert, err = do.UploadCertificate(*fCertID, string(key), string(leaf), string(chain)) }
+            } else if len(*fDNSNames) > 0 {
+                cert, err = do.CreateManagedCertificate(*fCertID, strings.Split(*fDNSNames, ","))
+            } else {
+                err = fmt.Errorf("Use -certfile and -keyfile to upload a certificate, or -dns for a let's encrypt one")
+            }
+            if err == nil { output = cert }
+        }
+    
+    } else if *fCreateBkt || *fDeleteBkt || *fListBkt || *fBucketCred {    //r2 buckets
+        if !*fTP_CloudFlare {
+            err = fmt.Errorf("r2 buckets require the -cloudflare option")
+        } else if *fListBkt {
+            var buckets []libraries.CF_r2_bucket_t
+            buckets, err = cf.ListBuckets()
+            if err == nil {
+                rows := make([][]string, 0, len(buckets))
+                for _, b := range(buckets) {
+                    rows = append(rows, []string{b.Name, b.Location, b.Created})
+                }
+                err = printList(*fFormat, []string{"name", "location", "created"}, rows, buckets)
+                output = buckets
+                listing = true
+            }
+        } else if len(*fBucket) == 0 {
+            err = fmt.Errorf("Bucket name not set.  use the -bucket option")
+        } else if *fDeleteBkt {
+            err = cf.DeleteBucket(*fBucket)
+        } else if *fBucketCred {
+            var creds *libraries.CF_r2_credentials_t
+            creds, err = cf.BucketCredentials(*fBucket, *fPermission, *fTTL)
+            if err == nil {
+                fmt.Printf("Access key id: %s\nSecret access key: %s\nSession token: %s\n", creds.AccessKeyID, creds.SecretKey, creds.SessionToken)
+                output = creds
+            }
+        } else {
+            fmt.Println("Creating bucket: " + *fBucket)
+            err = cf.CreateBucket(*fBucket)
+        }
+    
+    } else if *fTunnel {   //tunnel without a new node
+        if len(*fNodeName) > 0 {
+            fmt.Println("Creating tunnel: " + *fNodeName)
+            var tunnel *libraries.CF_tunnel_t
+            tunnel, err = provisionTunnel(cf, *fNodeName, *fSubDomain, *fService, cwd)
+            if err == nil { output = tunnel }
+        } else {
+            err = fmt.Errorf("Tunnel name not set.  use the -n option")
+        }
+    
+    } else if *fSelfUpdate {
+        err = selfUpdate(config.Update, *fSigners, VER + "." + minversion, *fDryRun)
+    
+    } else if len(*fVerifyRep) > 0 {   //change management checking a run
+        err = verifyReport(*fVerifyRep, *fSigners)
+    
+    } else if *fDNSHistory {   //who changed what in the zone
+        var headers []string
+        var rows [][]string
+        headers, rows, output, err = dnsHistory(config.DNSHistory, *fTP_CloudFlare, *fDomain, *fSince, *fUntil, do, cf)
+        if err == nil { err = printList(*fFormat, headers, rows, output) }
+        listing = true
+    
+    } else if *fAnalytics {    //zone analytics report
+        until, since := time.Now().UTC(), time.Now().UTC().AddDate(0, 0, -30)
+        if len(*fUntil) > 0 { until, err = time.Parse("2006-01-02", *fUntil) }
+        if err == nil && len(*fSince) > 0 { since, err = time.Parse("2006-01-02", *fSince) }
+        
+        if !*fTP_CloudFlare {
+            err = fmt.Errorf("Analytics require the -cloudflare option")
+        } else if err == nil {
+            var days []libraries.CF_analytics_day_t
+            days, err = cf.ZoneAnalytics(since, until)
+            if err == nil {
+                total := libraries.CF_analytics_day_t{Date: "total"}
+                for _, d := range(days) {
+                    total.Requests += d.Requests; total.CachedRequests += d.CachedRequests; total.Bytes += d.Bytes; total.CachedBytes += d.CachedBytes
+                    total.Threats += d.Threats; total.PageViews += d.PageViews; total.Uniques += d.Uniques; total.DNSQueries += d.DNSQueries
+                }
+                
+                rows := make([][]string, 0, len(days) + 1)
+                for _, d := range(append(days, total)) {
+                    rows = append(rows, []string{d.Date, fmt.Sprint(d.Requests), fmt.Sprint(d.CachedRequests), fmt.Sprint(d.Bytes), fmt.Sprint(d.CachedBytes),
+                        fmt.Sprint(d.Threats), fmt.Sprint(d.PageViews), fmt.Sprint(d.Uniques), fmt.Sprint(d.DNSQueries)})
+                }
+                err = printList(*fFormat, []string{"date", "requests", "cached_requests", "bytes", "cached_bytes", "threats", "page_views", "uniques", "dns_queries"}, rows, days)
+                output = days
+                listing = true
+            }
+        }
+    
+    } else if *fCache {    //apply the cache settings to the zone
+        if *fTP_CloudFlare {
+            settings, ok := cf.CacheSettings(*fDomain)
+            if ok {
+                var changes []string
+                changes, err = cf.ApplyCacheSettings(settings, *fDryRun)
+                for _, change := range(changes) { fmt.Println(change) }
+                if len(changes) == 0 { fmt.Println("Cache settings already match, no work to do") }
+                if *fDryRun && len(changes) > 0 { fmt.Println("Dry run, nothing was changed") }
+            } else {
+                err = fmt.Errorf("No cache settings in the config for this domain, or a 'default' entry")
+            }
+        } else {
+            err = fmt.Errorf("Cache settings require the -cloudflare option")
+        }
+    
+    } else if len(*fMigrate) > 0 {    //move the zone to another account
+        account, ok := config.CF.Accounts[*fMigrate]
+        if !*fTP_CloudFlare {
+            err = fmt.Errorf("Migrating a zone requires the -cloudflare option")
+        } else if !ok {
+            err = fmt.Errorf("Account '%s' not found in the cloud_flare accounts of the config", *fMigrate)
+        } else {
+            target := libraries.CF_c {SuperVerbose: *fSuperV, Verbose: *fVerbose, Config: account, Ctx: runCtx, Cache: readCache, ReadOnly: config.ReadOnly}
+            var export *libraries.CF_zone_export_t
+            export, err = cf.ExportZone()
+            if err == nil {
+                output = export
+                fmt.Printf("Exported %d records, %d page rules and %d settings from %s\n", len(export.Records), len(export.PageRules), len(export.Settings), export.Zone)
+                
+                var changes []string
+                err = withMaintenance(cf, *fMaintMode && !*fDryRun, func () (err error) {
+                    changes, err = target.ImportZone(export, *fDryRun)
+                    return
+                })
+                for _, change := range(changes) { fmt.Println(change) }
+                if err == nil && len(changes) == 0 { fmt.Println("Zone already matches in " + *fMigrate + ", no work to do") }
+                if *fDryRun && len(changes) > 0 { fmt.Println("Dry run, nothing was changed") }
+                
+                if err == nil && !*fDryRun && len(changes) > 0 {    //make sure it all made it across
+                    var diff []string
+                    diff, err = target.DiffZone(export)
+                    for _, d := range(diff) { fmt.Println("still different: " + d) }
+                    if err == nil && len(diff) > 0 { err = fmt.Errorf("%d differences remain in %s after the migration", len(diff), *fMigrate) }
+                    if err == nil { fmt.Println("Verified, the zone matches in " + *fMigrate) }
+                }
+            }
+        }
+    
+    } else if len(*fBulk) > 0 {    //run a batch of operations from a file
+        defaults := bulk_row_t{Region: *fRegion, Image: *fImage, Latest: *fLatest, Type: *fDomainType, CloudFlare: *fTP_CloudFlare}
+        var rows []bulk_row_t
+        rows, err = readBulkFile(*fBulk, defaults)
+        if err == nil && len(*fSnapshot) > 0 { err = snapshotBulkDNS(rows, do, cf, *fSnapshot) }
+        if err == nil {
+            fmt.Printf("Running %d bulk operations\n", len(rows))
+            results := runBulk(rows, *fConcurrent, *fFailFast, config, do, cf)
+            output = results
+            err = bulkSummary(results)
+            if err != nil && len(*fSnapshot) > 0 { fmt.Printf("Put the records back with -rollback=%s\n", *fSnapshot) }
+        }
+
+    } else if len(*fRollback) > 0 {    //undo a bulk run's dns changes
+        err = rollbackDNS(*fRollback, do, cf, *fDryRun)
+
+    } else if *fCutover {  //move the traffic over a bit at a time
+        opts := cutover_t{CloudFlare: *fTP_CloudFlare, Domain: *fDomain, SubDomain: *fSubDomain, Type: *fDomainType, To: *fIP, Origin: *fNodeName,
+            Pool: *fPool, StepWait: *fStepWait, TTL: *fCutoverTTL}
+        if len(opts.To) == 0 && len(*fNodeName) > 0 { _, opts.To, err = do.NodeAddress(*fNodeName) }
+        if err == nil && len(opts.Pool) > 0 { opts.Steps, err = cutoverSteps(*fSteps) }
+        if err == nil {
+            var cp *cutover_checkpoint_t
+            cp, err = runCutover(opts, *fDryRun, stateDir, config, do, cf)
+            if cp != nil { output = cp }
+        }
+
+    } else if *fFailover { //dns failover for where there aren't floating ips
+        opts := failover_t{CloudFlare: *fTP_CloudFlare, Domain: *fDomain, SubDomain: *fSubDomain, Type: *fDomainType, Primary: *fIP, Standby: *fStandby,
+            HealthURL: *fHealthURL, Interval: *fInterval, FailAfter: *fFailAfter, RecoverAfter: *fRecoverAft, Hold: *fHold, TTL: *fFailTTL, Events: events}
+        if len(opts.Primary) == 0 && len(*fNodeName) > 0 { _, opts.Primary, err = do.NodeAddress(*fNodeName) }
+        if err == nil {
+            var events []failover_event_t
+            events, err = runFailover(opts, *fDryRun, config, do, cf)
+            if events != nil { output = events }
+        }
+
+    } else if *fUndo {     //undo the last run's dns changes
+        err = undoLast(do, cf, *fDryRun)
+
+    } else if len(*fSpec) > 0 {    //a whole stack from a spec
+        spec := cluster_spec_t{Region: *fRegion, Size: *fSize, CPU: *fCPUSize, Slug: *fSlug, Image: *fImage, Latest: *fLatest, Tag: *fTag, SSHKey: *fSSHKey, UserData: *fUserData, Owner: *fOwner, Note: *fNote}
+        spec, err = readClusterSpec(*fSpec, spec)
+        if err == nil && flagSet("count") {
+            spec.Count = *fCount
+            for i := range(spec.Regions) { spec.Regions[i].Count = *fCount }   //each region gets the count
+            if spec.Count < 0 { err = fmt.Errorf("Cluster count can't be negative") }
+        }
+        if err == nil {
+            var result *cluster_result_t
+            if len(spec.Regions) > 0 {
+                result, err = runClusterRegions(spec, *fDryRun, config, do, cf)
+            } else {
+                result, err = runCluster(spec, *fDryRun, config, do, cf)
+            }
+            if result != nil {
+                output = result
+                count := spec.Count
+                if len(spec.Regions) > 0 { count = len(result.Nodes) }
+                if len(result.Created) == 0 && len(result.Deleted) == 0 { fmt.Printf("Cluster %s already has %d nodes\n", spec.Name, count) }
+            }
+            if *fDryRun { fmt.Println("Dry run, nothing was changed") }
+        }
+
     } else {
         fmt.Println("Invalid flags")
         os.Exit(1)
     }
 
 //----- See if we were successful --------------------------------------------------------------------------------------------------------------//
+    if errors.Is(err, context.DeadlineExceeded) && runCtx.Err() != nil { err = timeout_error{What: "waiting on the run", After: *fTimeout} }
+    do.Ctx = nil    //writing the output still gets to happen after a timeout
+    cf.Ctx = nil
+    if zoneWatch != nil && (len(zoneWatch.DO) > 0 || len(zoneWatch.CF) > 0) { saveDNSHistory(config.DNSHistory, zoneWatch, do, cf) }  //even a run that failed part way changed them
+    if undoErr := saveUndo(journal); undoErr != nil { fmt.Println(undoErr) }
+    if digest != nil {
+        if repErr := writeReport(*fReport, *fReportKey, configLoc, VER + "." + minversion, runID, err, output, progress.Steps, digest); repErr != nil {
+            if err == nil { err = repErr } else { fmt.Println(repErr) }
+        }
+    }
+    
+    if len(progress.Steps) > 0 {    //let them know where the time went
+        fileOutput.Steps = progress.Steps
+        if !listing { printSteps(*fFormat, progress.Steps) }
+    }
+    if !listing && (strings.EqualFold(*fFormat, "table") || strings.EqualFold(*fFormat, "github")) { fmt.Println(budget) }   //lists are piped, it'd end up in the file
+    
+    if strings.EqualFold(*fFormat, "github") {  //running inside github actions
+        if ghErr := githubReport(output, err); ghErr != nil { fmt.Println(ghErr) }
+    }
+    
     if err == nil {
-        fmt.Println("Success")
+        if !listing { fmt.Println("Success") }
+        if !listing { updateNotice(updates) }   //lists get piped into files, ie -kubeconfig and -inventory
         
-        if *fWriteFile {    //we want to output the results to a file
-            writeOutput(cwd + "/harbormaster_output.json", fileOutput)
+        if fWriteFile.set {    //we want to output the results
+            if *fMerge { output, err = mergeOutput(fWriteFile.dest, stateDir, *fRegion, VER + "." + minversion, true, output, progress.Steps, do) }
+            if err == nil { err = writeOutput(fWriteFile.dest, stateDir, *fRegion, output, do) }
+            if err != nil {
+                fmt.Println(err)
+                os.Exit(2)
+            }
+        }
+        if len(config.StateRepo) > 0 {     //nothing is committed when nothing changed, ie for lists
+            if err = commitState(config.StateRepo, nil, output); err != nil {
+                fmt.Println(err)
+                os.Exit(2)
+            }
         }
     } else {
+        if fWriteFile.set && (len(*fBulk) > 0 || *fMerge) {    //the per row results are still useful when some of them failed, and merges keep the failed run
+            var writeErr error
+            if *fMerge { output, writeErr = mergeOutput(fWriteFile.dest, stateDir, *fRegion, VER + "." + minversion, false, output, progress.Steps, do) }
+            if writeErr == nil { writeErr = writeOutput(fWriteFile.dest, stateDir, *fRegion, output, do) }
+            if writeErr != nil { fmt.Println(writeErr) }
+        }
+        if len(config.StateRepo) > 0 {  //whatever it got done before failing is still worth keeping
+            if commitErr := commitState(config.StateRepo, err, output); commitErr != nil { fmt.Println(commitErr) }
+        }
         fmt.Println(err)
+        if _, ok := err.(timeout_error); ok { os.Exit(5) }
+        if _, ok := err.(partial_error); ok { os.Exit(6) }  //some of the bulk rows worked
         os.Exit(2)
     }
 
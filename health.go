@@ -0,0 +1,172 @@
+/*! \file health.go
+    \brief Post deploy health probes for a stack, every node's health endpoint, its floating ips and load balancers, and the records pointing at them
+*/
+
+package main
+
+import (
+    "fmt"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const health_timeout    = 10 * time.Second
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief One probe and how it went
+ */
+type health_result_t struct {
+    Check       string  `json:"check"`   //node, floating-ip, balancer or dns
+    Target      string  `json:"target"`
+    Probe       string  `json:"probe"`   //the url we hit or the name we resolved
+    OK          bool    `json:"ok"`
+    Error       string  `json:"error,omitempty"`
+    Millis      int64   `json:"ms"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Hits the url, anything under a 400 counts as healthy
+ */
+func probeHTTP (url string) error {
+    client := &http.Client{Timeout: health_timeout}
+    resp, err := client.Get(url)
+    if err != nil { return err }
+    resp.Body.Close()
+    if resp.StatusCode >= 400 { return fmt.Errorf("Response code: %s", resp.Status) }
+    return nil
+}
+
+/*! \brief Makes sure the name resolves, and to the ip when the record isn't going through a proxy
+ */
+func probeDNS (name, ip string, proxied bool) error {
+    addrs, err := net.LookupHost(name)
+    if err != nil { return err }
+    if !proxied && !hasString(addrs, ip) { return fmt.Errorf("Resolves to %s, not %s", strings.Join(addrs, ", "), ip) }
+    return nil
+}
+
+func hasString (list []string, str string) bool {
+    for _, s := range(list) {
+        if s == str { return true }
+    }
+    return false
+}
+
+/*! \brief Green or red when we're printing to a terminal, the plain word otherwise so it can be piped
+ */
+func healthStatus (ok bool) string {
+    if !ok { return colorize("FAIL", "31") }
+    return colorize("PASS", "32")
+}
+
+/*! \brief Probes everything in the stack, or with the tag, at most concurrency at a time
+ *  healthURL has {ip} swapped for each address, ie 'http://{ip}:8080/health'.  Records in the domain are only checked when it's set
+ */
+func runHealthChecks (do libraries.DO_c, cf libraries.CF_c, cloudflare bool, domain, tag, stack, healthURL string, concurrency int) ([]health_result_t, error) {
+    nodes, err := do.ListNodes(tag, stack)
+    if err != nil { return nil, err }
+    if len(nodes) == 0 { return nil, fmt.Errorf("No nodes found to check, use -stack or -tag") }
+
+    probes := make([]health_result_t, 0)
+    urlFor := func (ip string) string { return strings.ReplaceAll(healthURL, "{ip}", ip) }
+    ips := make(map[string]bool)    //every address the stack answers on, for matching up the records
+    ids := make(map[int]bool)
+    tags := make(map[string]bool)
+    for _, n := range(nodes) {
+        ids[n.ID] = true
+        for _, t := range(n.Tags) { tags[t] = true }
+        if len(n.IP) == 0 {
+            probes = append(probes, health_result_t{Check: "node", Target: n.Name, Error: "Node doesn't have a public ip address"})
+            continue
+        }
+        ips[n.IP] = true
+        probes = append(probes, health_result_t{Check: "node", Target: n.Name, Probe: urlFor(n.IP)})
+    }
+
+    floating, err := do.ListFloatingIPs()
+    if err != nil { return nil, err }
+    for _, f := range(floating) {
+        if !ids[f.DropletID] { continue }
+        ips[f.IP] = true
+        probes = append(probes, health_result_t{Check: "floating-ip", Target: f.IP, Probe: urlFor(f.IP)})
+    }
+
+    balancers, err := do.ListLoadBalancers()
+    if err != nil { return nil, err }
+    for _, lb := range(balancers) {
+        ours := len(lb.Tag) > 0 && tags[lb.Tag]
+        for _, id := range(lb.DropletIDs) {
+            if ids[id] { ours = true }
+        }
+        if !ours || len(lb.IP) == 0 { continue }
+        ips[lb.IP] = true
+        probes = append(probes, health_result_t{Check: "balancer", Target: lb.Name, Probe: urlFor(lb.IP)})
+    }
+
+    type dns_probe_t struct { ip string; proxied bool }
+    dns := make(map[int]dns_probe_t)    //index into probes
+    if len(domain) > 0 {
+        if cloudflare {
+            records, err := cf.ListDomainRecords("", "", "")
+            if err != nil { return nil, err }
+            for _, rec := range(records) {
+                if (rec.Type == "A" || rec.Type == "AAAA") && ips[rec.Content] {
+                    dns[len(probes)] = dns_probe_t{rec.Content, rec.Proxied}
+                    probes = append(probes, health_result_t{Check: "dns", Target: rec.Name, Probe: rec.Name})
+                }
+            }
+        } else {
+            records, err := do.ListDomainRecords(domain)
+            if err != nil { return nil, err }
+            for _, rec := range(records) {
+                if (rec.Type == "A" || rec.Type == "AAAA") && ips[rec.Data] {
+                    name := strings.ToLower(domain)
+                    if rec.Name != "@" { name = rec.Name + "." + name }
+                    dns[len(probes)] = dns_probe_t{rec.Data, false}
+                    probes = append(probes, health_result_t{Check: "dns", Target: name, Probe: name})
+                }
+            }
+        }
+    }
+
+    if concurrency < 1 { concurrency = 1 }
+    slots := make(chan struct{}, concurrency)
+    wg := sync.WaitGroup{}
+    for i := range(probes) {
+        if len(probes[i].Probe) == 0 { continue }   //already failed
+        wg.Add(1)
+        go func (i int) {
+            defer wg.Done()
+            slots <- struct{}{}
+            defer func() { <-slots }()
+
+            start := time.Now()
+            var err error
+            if d, ok := dns[i]; ok {
+                err = probeDNS(probes[i].Probe, d.ip, d.proxied)
+            } else {
+                err = probeHTTP(probes[i].Probe)
+            }
+            probes[i].Millis = time.Since(start).Milliseconds()
+            probes[i].OK = err == nil
+            if err != nil { probes[i].Error = err.Error() }
+        }(i)
+    }
+    wg.Wait()
+    return probes, nil
+}
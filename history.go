@@ -0,0 +1,127 @@
+/*! \file history.go
+    \brief The dns zone history, saving the zones a run changed and showing what changed in one between two dates
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/user"
+    "time"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A change to the zone, along with the snapshot it first showed up in
+ */
+type dns_history_change_t struct {
+    Time        time.Time   `json:"time"`
+    By          string      `json:"by"`
+    libraries.DNS_zone_change_t
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Who's running this, for the snapshots, ie 'nathan@buildbox'
+ */
+func historyBy () string {
+    name := os.Getenv("USER")
+    if u, err := user.Current(); err == nil { name = u.Username }
+    if host, err := os.Hostname(); err == nil { name += "@" + host }
+    return name
+}
+
+/*! \brief Who made the change for the lists
+ */
+func historyWho (by string) string {
+    if len(by) == 0 { return "(outside harbormaster)" }
+    return by
+}
+
+/*! \brief Saves a snapshot of each zone the run changed records in.  Failing to save one doesn't fail the run, they're just printed
+ */
+func saveDNSHistory (history libraries.DNS_history_t, watch *libraries.ZoneWatch_t, do libraries.DO_c, cf libraries.CF_c) {
+    by := historyBy()
+    save := func (snap *libraries.DNS_zone_snapshot_t, err error) {
+        if err == nil {
+            snap.By = by
+            var saved bool
+            if saved, err = history.Save(snap); saved && do.Verbose { fmt.Printf("Saved the dns history of %s\n", snap.Zone) }
+        }
+        if err != nil { fmt.Printf("Unable to save the dns history :: %s\n", err.Error()) }
+    }
+
+    for domain := range(watch.DO) { save(do.ZoneSnapshot(domain)) }
+    for zone := range(watch.CF) {
+        cf.Config.Zone = zone
+        save(cf.ZoneSnapshot())
+    }
+}
+
+/*! \brief Snapshots the zone as it is now, so changes made somewhere else show up, then lists the changes between the dates
+ *  since and until are YYYY-MM-DD and include the whole day, without since the snapshots are listed instead
+ */
+func dnsHistory (history libraries.DNS_history_t, cloudflare bool, domain, since, until string, do libraries.DO_c, cf libraries.CF_c) ([]string, [][]string, interface{}, error) {
+    if len(history.Dir) == 0 { return nil, nil, nil, fmt.Errorf("No dir in the dns_history section of the config") }
+
+    var snap *libraries.DNS_zone_snapshot_t
+    var err error
+    if cloudflare {
+        snap, err = cf.ZoneSnapshot()
+    } else if len(domain) == 0 {
+        err = fmt.Errorf("Domain name not set. use the -d option")
+    } else {
+        snap, err = do.ZoneSnapshot(domain)
+    }
+    if err != nil { return nil, nil, nil, err }
+    if _, err = history.Save(snap); err != nil { return nil, nil, nil, err }
+
+    times, err := history.Snapshots(snap.Provider, snap.Zone)
+    if err != nil { return nil, nil, nil, err }
+
+    if len(since) == 0 {
+        list := make([]*libraries.DNS_zone_snapshot_t, 0, len(times))
+        rows := make([][]string, 0, len(times))
+        for _, t := range(times) {
+            s, err := history.At(snap.Provider, snap.Zone, t)
+            if err != nil { return nil, nil, nil, err }
+            list = append(list, s)
+            rows = append(rows, []string{s.Time.Format("2006-01-02 15:04:05"), historyWho(s.By), fmt.Sprint(len(s.Records))})
+        }
+        return []string{"time", "by", "records"}, rows, list, nil
+    }
+
+    from, err := time.Parse("2006-01-02", since)
+    to := time.Now().UTC()
+    if err == nil && len(until) > 0 {
+        if to, err = time.Parse("2006-01-02", until); err == nil { to = to.AddDate(0, 0, 1) }
+    }
+    if err != nil { return nil, nil, nil, err }
+
+    prev, err := history.At(snap.Provider, snap.Zone, from)     //what it looked like going in
+    if err != nil { return nil, nil, nil, err }
+
+    changes := make([]dns_history_change_t, 0)
+    rows := make([][]string, 0)
+    for _, t := range(times) {
+        if !t.After(from) || !t.Before(to) { continue }
+        s, err := history.At(snap.Provider, snap.Zone, t)
+        if err != nil { return nil, nil, nil, err }
+
+        if prev != nil {    //the first one we have has nothing to compare to
+            for _, c := range(libraries.DiffZones(prev, s)) {
+                changes = append(changes, dns_history_change_t{Time: s.Time, By: s.By, DNS_zone_change_t: c})
+                rows = append(rows, []string{s.Time.Format("2006-01-02 15:04:05"), historyWho(s.By), c.Change, c.Type, c.Name, c.Before, c.After})
+            }
+        }
+        prev = s
+    }
+    return []string{"time", "by", "change", "type", "name", "before", "after"}, rows, changes, nil
+}
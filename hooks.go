@@ -0,0 +1,110 @@
+/*! \file hooks.go
+    \brief Runs the local commands from the hooks in the config, before and after we change a node
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "bytes"
+    "context"
+    "encoding/json"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+var hook_names = map[string]bool{"pre_create": true, "post_create": true, "pre_delete": true, "post_delete": true, "pre_resize": true, "post_resize": true}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Commands by the hook name, ie "pre_delete": "./cmdb.sh remove"
+ */
+type hooks_t map[string]string
+
+/*! \brief What the hook command gets on stdin, the same things are in HM_ environment variables
+ */
+type hook_event_t struct {
+    Hook        string  `json:"hook"`
+    Name        string  `json:"name"`
+    Region      string  `json:"region,omitempty"`
+    Size        string  `json:"size,omitempty"`
+    Image       string  `json:"image,omitempty"`
+    Tag         string  `json:"tag,omitempty"`
+    Node        *libraries.FileOutput_t `json:"node,omitempty"`  //the node as it is, when it exists
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Makes sure the config only has hooks we know about, so a typo doesn't quietly never run
+ */
+func (hooks hooks_t) validate () error {
+    for name := range(hooks) {
+        if !hook_names[name] { return fmt.Errorf("Unknown hook '%s' in the config, expecting pre_ or post_ create, delete or resize", name) }
+    }
+    return nil
+}
+
+/*! \brief Runs the hook's command through the shell, cmd on windows, if there is one.  A pre_ hook failing stops the operation
+ *  The event is passed as json on stdin and in the environment, the command's output goes to ours
+ */
+func (hooks hooks_t) run (ctx context.Context, event hook_event_t) error {
+    command := hooks[event.Hook]
+    if len(command) == 0 { return nil }
+    if ctx == nil { ctx = context.Background() }
+
+    jStr, err := json.Marshal(event)
+    if err != nil { return err }
+
+    cmd := shellCommand(ctx, command)
+    cmd.Stdin = bytes.NewReader(jStr)
+    cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+    cmd.Env = append(os.Environ(), "HM_HOOK=" + event.Hook, "HM_NAME=" + event.Name, "HM_REGION=" + event.Region,
+        "HM_SIZE=" + event.Size, "HM_IMAGE=" + event.Image, "HM_TAG=" + event.Tag)
+    if event.Node != nil {
+        cmd.Env = append(cmd.Env, fmt.Sprintf("HM_NODE_ID=%d", event.Node.Droplet.ID))
+        for _, n := range(event.Node.Droplet.Networks.V4) {
+            if n.Type == "public" { cmd.Env = append(cmd.Env, "HM_IP=" + n.IP) }
+        }
+    }
+
+    if err = cmd.Run(); err != nil { return fmt.Errorf("The %s hook for '%s' failed :: %s", event.Hook, event.Name, err.Error()) }
+    return nil
+}
+
+/*! \brief Runs the pre_ and post_ hooks around the operation on the node
+ *  The node's current info is looked up for them, so a delete hook knows what it's removing.  Nothing runs for a delete of a node that isn't there
+ */
+func (hooks hooks_t) around (do libraries.DO_c, action string, event hook_event_t, fn func () error) error {
+    if do.ReadOnly || (len(hooks["pre_" + action]) == 0 && len(hooks["post_" + action]) == 0) { return fn() }  //read only refuses fn before it changes anything
+
+    if action != "create" {
+        event.Node = &libraries.FileOutput_t{}
+        found, err := do.GetNode(event.Name, event.Node)
+        if err != nil { return err }
+        if !found {
+            if action == "delete" { return fn() }
+            event.Node = nil
+        }
+    }
+
+    event.Hook = "pre_" + action
+    if err := hooks.run(do.Ctx, event); err != nil { return err }
+
+    if err := fn(); err != nil { return err }
+
+    if action != "delete" {    //get what it looks like now, ie the new node's ip address
+        event.Node = &libraries.FileOutput_t{}
+        if _, err := do.GetNode(event.Name, event.Node); err != nil { return err }
+    }
+    event.Hook = "post_" + action
+    return hooks.run(do.Ctx, event)
+}
@@ -0,0 +1,177 @@
+/*! \file inventory.go
+    \brief Writing the droplets out as prometheus file_sd targets or an ssh config with -inventory, so monitoring and ssh match what's actually running
+ *  With -watch it's regenerated every -interval, the file is only rewritten when something changed so prometheus isn't reloading for nothing
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "bytes"
+    "context"
+    "os/signal"
+    "sort"
+    "strings"
+    "time"
+    "path/filepath"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const inventory_prom_port   = "9100"    //node_exporter's
+const inventory_header      = "# written by harbormaster -inventory, changes here will be overwritten\n"
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief What to write and where
+ */
+type inventory_t struct {
+    Kind        string  //prometheus or ssh
+    Out         string  //file to write, stdout when it's empty
+    Tag         string
+    Stack       string
+    Port        string  //prometheus targets are ip:port
+    User        string  //for the ssh config
+    Identity    string
+    KnownHosts  string  //the managed known_hosts, so ssh by name checks the same keys we do
+    Events      *event_hub_t    //nodes showing up and going away under -watch are sent here with -events
+}
+
+/*! \brief A prometheus file_sd group
+ */
+type prom_group_t struct {
+    Targets     []string            `json:"targets"`
+    Labels      map[string]string   `json:"labels,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A group for each tag with the nodes that have it, nodes without tags are in a group without labels
+ */
+func inventoryProm (nodes []libraries.DO_node_t, port string) ([]byte, error) {
+    if len(port) == 0 { port = inventory_prom_port }
+    byTag := make(map[string][]string)
+    for _, n := range(nodes) {
+        if len(n.IP) == 0 { continue }
+        target := n.IP + ":" + port
+        if len(n.Tags) == 0 { byTag[""] = append(byTag[""], target) }
+        for _, t := range(n.Tags) { byTag[t] = append(byTag[t], target) }
+    }
+
+    tags := make([]string, 0, len(byTag))
+    for t := range(byTag) { tags = append(tags, t) }
+    sort.Strings(tags)
+    groups := make([]prom_group_t, 0, len(tags))
+    for _, t := range(tags) {
+        sort.Strings(byTag[t])
+        g := prom_group_t{Targets: byTag[t]}
+        if len(t) > 0 { g.Labels = map[string]string{"tag": t} }
+        groups = append(groups, g)
+    }
+    data, err := json.MarshalIndent(groups, "", "  ")
+    return append(data, '\n'), err
+}
+
+/*! \brief A Host block for each node, meant to be pulled in with an Include from ~/.ssh/config
+ */
+func inventorySSH (nodes []libraries.DO_node_t, user, identity, knownHosts string) []byte {
+    sorted := append([]libraries.DO_node_t{}, nodes...)
+    sort.Slice(sorted, func (i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+    var b bytes.Buffer
+    b.WriteString(inventory_header)
+    for _, n := range(sorted) {
+        if len(n.IP) == 0 { continue }
+        fmt.Fprintf(&b, "\nHost %s\n    HostName %s\n", n.Name, n.IP)
+        if len(user) > 0 { fmt.Fprintf(&b, "    User %s\n", user) }
+        if len(identity) > 0 { fmt.Fprintf(&b, "    IdentityFile %s\n", identity) }
+        if len(knownHosts) > 0 { fmt.Fprintf(&b, "    UserKnownHostsFile %s\n    StrictHostKeyChecking yes\n", knownHosts) }
+    }
+    return b.Bytes()
+}
+
+/*! \brief Builds the inventory and writes it, returns the nodes in it and whether the file changed.  Stdout always counts as a change
+ */
+func writeInventory (inv inventory_t, do libraries.DO_c) ([]libraries.DO_node_t, bool, error) {
+    nodes, err := do.ListNodes(inv.Tag, inv.Stack)
+    if err != nil { return nil, false, err }
+
+    var data []byte
+    switch strings.ToLower(inv.Kind) {
+    case "prometheus", "prom", "file_sd":
+        if data, err = inventoryProm(nodes, inv.Port); err != nil { return nil, false, err }
+    case "ssh":
+        data = inventorySSH(nodes, inv.User, inv.Identity, inv.KnownHosts)
+    default:
+        return nil, false, fmt.Errorf("Unknown inventory '%s', expecting prometheus or ssh", inv.Kind)
+    }
+
+    if len(inv.Out) == 0 {
+        fmt.Print(string(data))
+        return nodes, true, nil
+    }
+    if old, err := ioutil.ReadFile(inv.Out); err == nil && bytes.Equal(old, data) { return nodes, false, nil }
+
+    tmp := filepath.Join(filepath.Dir(inv.Out), "." + filepath.Base(inv.Out) + ".tmp")    //prometheus watches the file, it should never see half of one
+    if err = ioutil.WriteFile(tmp, data, 0644); err != nil { return nil, false, fmt.Errorf("Unable to write '%s' :: %s", tmp, err.Error()) }
+    if err = os.Rename(tmp, inv.Out); err != nil { return nil, false, fmt.Errorf("Unable to write '%s' :: %s", inv.Out, err.Error()) }
+    fmt.Printf("Wrote %d nodes to %s\n", len(nodes), inv.Out)
+    return nodes, true, nil
+}
+
+/*! \brief Runs fn every interval until ctrl-c or the -timeout, an error is printed and it's tried again next time
+ *  fn is handed the context to run with, it's cancelled when the watch is stopped
+ */
+func watchEvery (interval time.Duration, parent context.Context, fn func (ctx context.Context) error) error {
+    if interval <= 0 { return fmt.Errorf("-interval has to be more than 0") }
+    if parent == nil { parent = context.Background() }
+    ctx, stop := signal.NotifyContext(parent, os.Interrupt)
+    defer stop()
+
+    for {
+        if err := fn(ctx); err != nil {
+            if ctx.Err() != nil { return nil }
+            fmt.Printf("%s FAILED :: %s\n", time.Now().Format("2006-01-02 15:04:05"), err.Error())
+        }
+        select {
+        case <-time.After(interval):
+        case <-ctx.Done():
+            return nil
+        }
+    }
+}
+
+/*! \brief Writes the inventory every interval until ctrl-c or the -timeout
+ *  Nodes that weren't in the last listing are sent as node.created and ones that left it as node.deleted, the first listing is what they're compared to
+ */
+func watchInventory (inv inventory_t, interval time.Duration, do libraries.DO_c) error {
+    if len(inv.Out) == 0 { return fmt.Errorf("-watch needs a file to keep up to date.  use the -inventory-out option") }
+    var seen map[string]libraries.DO_node_t
+    return watchEvery(interval, do.Ctx, func (ctx context.Context) error {
+        do.Ctx = ctx
+        nodes, _, err := writeInventory(inv, do)
+        if err != nil { return err }
+
+        now := make(map[string]libraries.DO_node_t, len(nodes))
+        for _, n := range(nodes) {
+            now[n.Name] = n
+            if _, ok := seen[n.Name]; !ok && seen != nil { inv.Events.publish("node.created", n.Name, n.IP) }
+        }
+        for name, n := range(seen) {
+            if _, ok := now[name]; !ok { inv.Events.publish("node.deleted", name, n.IP) }
+        }
+        seen = now
+        return nil
+    })
+}
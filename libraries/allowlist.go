@@ -0,0 +1,231 @@
+/*! \file allowlist.go
+    \brief Allowlists of addresses from a file, a url or the ranges github and cloud flare publish, and keeping a firewall rule or cloud flare's ip access rules in line with one
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net"
+    "net/http"
+    "sort"
+    "strings"
+    "encoding/json"
+    "io/ioutil"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const allow_github_meta     = "https://api.github.com/meta"
+const allow_cloudflare_ips  = "https://api.cloudflare.com/client/v4/ips"
+const allow_notes           = "harbormaster allowlist "   //followed by the list's name, it's how we know which access rules are ours
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type cf_access_rule_t struct {
+    ID          string  `json:"id,omitempty"`
+    Mode        string  `json:"mode"`
+    Configuration   struct {
+        Target  string  `json:"target"`
+        Value   string  `json:"value"`
+    }   `json:"configuration"`
+    Notes       string  `json:"notes"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func allowGet (url string) ([]byte, error) {
+    resp, err := http.Get(url)
+    if err != nil { return nil, err }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK { return nil, fmt.Errorf("status code %d from %s", resp.StatusCode, url) }
+    return ioutil.ReadAll(resp.Body)
+}
+
+/*! \brief Cleans up the addresses, single addresses lose a /32 or /128 and anything that isn't an address or a range is an error
+ */
+func normalizeAllowlist (list []string) ([]string, error) {
+    seen := make(map[string]bool)
+    addrs := make([]string, 0, len(list))
+    for _, a := range(list) {
+        a = strings.TrimSpace(a)
+        if i := strings.Index(a, "#"); i >= 0 { a = strings.TrimSpace(a[:i]) }    //comments in files
+        if len(a) == 0 { continue }
+
+        if _, ipNet, err := net.ParseCIDR(a); err == nil {
+            if ones, bits := ipNet.Mask.Size(); ones == bits {
+                a = ipNet.IP.String()
+            } else {
+                a = ipNet.String()
+            }
+        } else if ip := net.ParseIP(a); ip != nil {
+            a = ip.String()
+        } else {
+            return nil, fmt.Errorf("'%s' in the allowlist isn't an ip address or range", a)
+        }
+        if !seen[a] { addrs = append(addrs, a) }
+        seen[a] = true
+    }
+    sort.Strings(addrs)
+    return addrs, nil
+}
+
+/*! \brief Compares the lists, + for what has to be added and - for what has to go
+ */
+func allowDiff (current, wanted []string) []string {
+    have, want := make(map[string]bool), make(map[string]bool)
+    for _, a := range(current) { have[a] = true }
+    for _, a := range(wanted) { want[a] = true }
+
+    diff := make([]string, 0)
+    for _, a := range(wanted) {
+        if !have[a] { diff = append(diff, "+ " + a) }
+    }
+    for _, a := range(current) {
+        if !want[a] { diff = append(diff, "- " + a) }
+    }
+    sort.Slice(diff, func (i, j int) bool { return diff[i][2:] < diff[j][2:] })
+    return diff
+}
+
+/*! \brief The access rule target cloud flare wants for the address
+ */
+func accessTarget (addr string) string {
+    if strings.Contains(addr, "/") { return "ip_range" }
+    if strings.Contains(addr, ":") { return "ip6" }
+    return "ip"
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- ALLOWLIST FUNCTIONS -----------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the addresses from the source, a file or url with one per line or 'github:<key>' for a list from github's meta, ie github:actions, or 'cloudflare' for its edge ranges
+ */
+func FetchAllowlist (source string) ([]string, error) {
+    var list []string
+    switch {
+    case strings.HasPrefix(source, "github:"):
+        data, err := allowGet(allow_github_meta)
+        if err != nil { return nil, err }
+        meta := make(map[string]json.RawMessage)
+        if err = json.Unmarshal(data, &meta); err != nil { return nil, err }
+        key := strings.TrimPrefix(source, "github:")
+        if err = json.Unmarshal(meta[key], &list); err != nil || len(meta[key]) == 0 { return nil, fmt.Errorf("Github's meta doesn't have a list of addresses for '%s'", key) }
+
+    case source == "cloudflare":
+        data, err := allowGet(allow_cloudflare_ips)
+        if err != nil { return nil, err }
+        var ips struct {
+            Result  struct {
+                IPv4    []string    `json:"ipv4_cidrs"`
+                IPv6    []string    `json:"ipv6_cidrs"`
+            }   `json:"result"`
+        }
+        if err = json.Unmarshal(data, &ips); err != nil { return nil, err }
+        list = append(ips.Result.IPv4, ips.Result.IPv6...)
+
+    case strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://"):
+        data, err := allowGet(source)
+        if err != nil { return nil, err }
+        list = strings.Split(string(data), "\n")
+
+    default:
+        data, err := ioutil.ReadFile(source)
+        if err != nil { return nil, fmt.Errorf("Unable to read allowlist '%s' :: %s", source, err.Error()) }
+        list = strings.Split(string(data), "\n")
+    }
+
+    addrs, err := normalizeAllowlist(list)
+    if err == nil && len(addrs) == 0 { err = fmt.Errorf("The allowlist from '%s' is empty, not syncing it so nothing gets locked out", source) }
+    return addrs, err
+}
+
+/*! \brief Makes the inbound rule for the protocol and ports on the firewall allow exactly these addresses, adding the rule when it isn't there
+ *  Returns the address changes, with dryRun nothing is changed
+ */
+func (do DO_c) SyncFirewallAllowlist (name, protocol, ports string, addrs []string, dryRun bool) ([]string, error) {
+    firewalls, err := do.ListFirewalls()
+    if err != nil { return nil, err }
+    var fw *DO_firewall_t
+    for i := range(firewalls) {
+        if firewalls[i].Name == name { fw = &firewalls[i] }
+    }
+    if fw == nil { return nil, fmt.Errorf("Firewall '%s' not found", name) }
+
+    protocol = strings.ToLower(protocol)
+    rule := -1
+    for i, r := range(fw.Inbound) {
+        if strings.EqualFold(r.Protocol, protocol) && r.Ports == ports && r.Sources != nil && len(r.Sources.Tags) == 0 && len(r.Sources.DropletIDs) == 0 && len(r.Sources.LoadBalancers) == 0 { rule = i }
+    }
+    current := make([]string, 0)
+    if rule >= 0 {
+        if current, err = normalizeAllowlist(fw.Inbound[rule].Sources.Addresses); err != nil { return nil, err }
+    }
+
+    diff := allowDiff(current, addrs)
+    if dryRun || len(diff) == 0 { return diff, nil }
+
+    if rule >= 0 {
+        fw.Inbound[rule].Sources.Addresses = addrs
+    } else {
+        fw.Inbound = append(fw.Inbound, DO_fw_rule_t{Protocol: protocol, Ports: ports, Sources: &DO_fw_target_t{Addresses: addrs}})
+    }
+    fmt.Println("Updating firewall: " + fw.Name)
+    jStr, _ := json.Marshal(fw)
+    _, err = do.send("PUT", "firewalls/" + fw.ID, jStr)
+    return diff, err
+}
+
+/*! \brief Makes the zone's ip access rules for the list allow exactly these addresses, rules for other lists and ones we didn't make are left alone
+ *  Returns the address changes, with dryRun nothing is changed
+ */
+func (cf CF_c) SyncAccessAllowlist (name string, addrs []string, dryRun bool) ([]string, error) {
+    notes := allow_notes + name
+    ours := make(map[string]string)     //address to the rule's id
+    current := make([]string, 0)
+    for page, pages := 1, 1; page <= pages; page++ {
+        resp, err := cf.request(fmt.Sprintf("firewall/access_rules/rules?mode=whitelist&page=%d&per_page=%d", page, cf_per_page), nil, nil)
+        if err != nil { return nil, err }
+        var list struct {
+            ResultInfo  struct {
+                TotalPages  int     `json:"total_pages"`
+            }   `json:"result_info"`
+            Result      []cf_access_rule_t  `json:"result"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+        pages = list.ResultInfo.TotalPages
+        for _, r := range(list.Result) {
+            if r.Notes != notes { continue }
+            addr := r.Configuration.Value
+            if n, err := normalizeAllowlist([]string{addr}); err == nil { addr = n[0] }
+            ours[addr] = r.ID
+            current = append(current, addr)
+        }
+    }
+    sort.Strings(current)
+
+    diff := allowDiff(current, addrs)
+    if dryRun { return diff, nil }
+
+    for _, d := range(diff) {
+        addr := d[2:]
+        var err error
+        if d[0] == '+' {
+            rule := cf_access_rule_t{Mode: "whitelist", Notes: notes}
+            rule.Configuration.Target, rule.Configuration.Value = accessTarget(addr), addr
+            jStr, _ := json.Marshal(rule)
+            _, err = cf.request("firewall/access_rules/rules", jStr, nil)
+        } else {
+            err = cf.deleteRequest("firewall/access_rules/rules/" + ours[addr])
+        }
+        if err != nil { return diff, fmt.Errorf("Unable to sync %s in the access rules :: %s", d, err.Error()) }
+    }
+    return diff, nil
+}
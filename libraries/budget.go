@@ -0,0 +1,79 @@
+/*! \file budget.go
+    \brief Counts the api requests a run makes, and stops it before it goes past the budget instead of running into the rate limits
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "sync"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Sits in front of the http transport, Max of 0 means there's no budget and they're only counted
+ */
+type Budget_t struct {
+    Max         int
+    hosts       map[string]int
+    total       int
+    lock        sync.Mutex
+    next        http.RoundTripper
+}
+
+/*! \brief What a request past the budget gets back, it's never sent
+ */
+type budget_error struct {
+    Max         int
+}
+
+func (e budget_error) Error () string {
+    return fmt.Sprintf("Used up the budget of %d api requests, stopping before the rest.  raise -max-requests if this run needs more", e.Max)
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- BUDGET FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Wraps whatever the default transport is now, so every provider's requests count against the same budget
+ */
+func NewBudget (max int) *Budget_t {
+    return &Budget_t{Max: max, hosts: make(map[string]int), next: http.DefaultTransport}
+}
+
+/*! \brief Only the provider api requests are counted, health probes and output posts go straight through
+ */
+func (b *Budget_t) RoundTrip (req *http.Request) (*http.Response, error) {
+    if !providerRequest(req) { return b.next.RoundTrip(req) }
+
+    b.lock.Lock()
+    if b.Max > 0 && b.total >= b.Max {
+        b.lock.Unlock()
+        if req.Body != nil { req.Body.Close() }
+        return nil, budget_error{Max: b.Max}
+    }
+    b.total++
+    b.hosts[req.URL.Host]++
+    b.lock.Unlock()
+    return b.next.RoundTrip(req)
+}
+
+/*! \brief How many requests went out, ie '14 api requests, api.digitalocean.com 12, api.cloudflare.com 2'
+ */
+func (b *Budget_t) String () string {
+    b.lock.Lock()
+    defer b.lock.Unlock()
+
+    hosts := make([]string, 0, len(b.hosts))
+    for h := range(b.hosts) { hosts = append(hosts, h) }
+    sort.Strings(hosts)
+
+    summary := fmt.Sprintf("%d api requests", b.total)
+    if b.Max > 0 { summary += fmt.Sprintf(" of %d", b.Max) }
+    for _, h := range(hosts) { summary += fmt.Sprintf(", %s %d", h, b.hosts[h]) }
+    return summary
+}
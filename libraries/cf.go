@@ -6,18 +6,25 @@ package libraries
 
 import (
     "fmt"
+    "context"
     "net/http"
+    "net/url"
     "io/ioutil"
     "bytes"
     "encoding/json"
     "strings"
+    "sync"
     )
 
 //-------------------------------------------------------------------------------------------------------------------------//
 //----- CONSTS ------------------------------------------------------------------------------------------------------------//
 //-------------------------------------------------------------------------------------------------------------------------//
 
-const cf_base_url          = "https://api.cloudflare.com/client/v4/zones"
+const cf_api_root          = "https://api.cloudflare.com/client/"
+const cf_api_url           = cf_api_root + cf_api_version
+const cf_base_url          = cf_api_url + "/zones"
+const cf_per_page          = 100   //max page size for listing records
+const cf_page_workers      = 4     //how many pages of records we'll request at the same time
 
 //-------------------------------------------------------------------------------------------------------------------------//
 //----- STRUCTS -----------------------------------------------------------------------------------------------------------//
@@ -26,39 +33,109 @@ const cf_base_url          = "https://api.cloudflare.com/client/v4/zones"
 type CF_config_t struct {
     APIKey  string  `json:"api_key"`
     Email   string  `json:"email"`
-    Zone    string  `json:"zone"`
+    Account string  `json:"account_id"`   //needed for account level things, ie email routing destinations
+    Zone    string  `json:"zone"`     //default zone when one isn't picked for the request
+    Zones   map[string]string   `json:"zones"`  //domain to zone id
+    Cache   map[string]CF_cache_t   `json:"cache"`  //domain to cache settings, "default" for any other zone
+    R2      map[string]CF_r2_bucket_config_t    `json:"r2"`    //bucket name to its settings
+    R2AccessKey string  `json:"r2_access_key_id"`    //parent key for temporary r2 credentials
+    BaseURL     string  `json:"base_url"`   //replaces https://api.cloudflare.com/client/v4, ie to go through a gateway or a mock
+    APIVersion  string  `json:"api_version"`    //pins the api version, v4 when it's not set
+    Headers     map[string]string   `json:"headers"`   //added to every api request, $VARS are expanded, ie {"X-Run-ID": "$HARBORMASTER_RUN_ID"}
+    Accounts    map[string]CF_config_t  `json:"accounts"`  //other accounts by name, ie for moving a zone to a client's account
+    Maintenance CF_maintenance_t    `json:"maintenance"`   //page served while -maintenance is on, -maintenance-worker uploads its script
+}
+
+type CF_record_t struct {
+    ID          string  `json:"id"`
+    Type        string  `json:"type"`
+    Name        string  `json:"name"`
+    Content     string  `json:"content"`
+    Proxied     bool    `json:"proxied"`
+    TTL         int     `json:"ttl"`
+    ZoneName    string  `json:"zone_name"`
+}
+
+/*! \brief Error for when cloud flare comes back with a bad status code, so we can tell a missing thing from a failure
+ */
+type cf_status_error struct {
+    Code    int
+    Status  string
+    RayID   string  //cloud flare's id for the request, for support tickets
+}
+
+func (e cf_status_error) Error () string {
+    if len(e.RayID) > 0 { return fmt.Sprintf("Response code: %s (ray id %s)", e.Status, e.RayID) }
+    return fmt.Sprintf("Response code: %s", e.Status)
 }
 
 type CF_c struct {
     Verbose, SuperVerbose     bool
     Config      CF_config_t
+    Ctx         context.Context //optional, its deadline stops requests and waits
+    Cache       *ReadCache_t    //optional, for the read heavy requests
+    ReadOnly    bool            //refuse anything that would change the account
+    Journal     *DNS_journal_t  //optional, every record is noted here by its id before it's changed
 }
 
 //-------------------------------------------------------------------------------------------------------------------------//
 //----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
 //-------------------------------------------------------------------------------------------------------------------------//
 
-func (cf CF_c) request (url string, jStr []byte, put []byte) (body []byte, err error) {
-    var req *http.Request
+/*! \brief Context for our requests and waits, background when one wasn't set
+ */
+func (cf CF_c) context () context.Context {
+    if cf.Ctx == nil { return context.Background() }
+    return cf.Ctx
+}
+
+/*! \brief Does the actual http request against the full url
+ */
+func (cf CF_c) send (method, finalUrl string, data []byte) (body []byte, err error) {
+    return cf.sendType(method, finalUrl, data, "application/json")
+}
+
+/*! \brief Same as send, for the few things that aren't json, ie a worker upload is multipart
+ */
+func (cf CF_c) sendType (method, finalUrl string, data []byte, contentType string) (body []byte, err error) {
+    var journaled func ([]byte)    //notes a record we created, once we know its id
+    if method != "GET" && !cf.ReadOnly {
+        if journaled, err = cf.journalChange(method, finalUrl); err != nil { return nil, err }
+    }
+    if len(cf.Config.BaseURL) > 0 {
+        finalUrl = strings.TrimSuffix(cf.Config.BaseURL, "/") + strings.TrimPrefix(finalUrl, cf_api_url)
+    } else if v := strings.Trim(cf.Config.APIVersion, "/"); len(v) > 0 && v != cf_api_version && strings.HasPrefix(finalUrl, cf_api_url) {
+        finalUrl = cf_api_root + v + strings.TrimPrefix(finalUrl, cf_api_url)
+    }
+    cf.superMessage("url: " + finalUrl)
     
-    if len(jStr) > 0 {    //we're posting data
-        finalUrl := fmt.Sprintf("%s/%s/%s", cf_base_url, cf.Config.Zone, url)
-        cf.superMessage("url: " + finalUrl)
-        req, err = http.NewRequest("POST", finalUrl, bytes.NewBuffer(jStr))
-    } else if len(put) > 0 {  //put request
-        finalUrl := fmt.Sprintf("%s/%s/%s", cf_base_url, cf.Config.Zone, url)
-        cf.superMessage("url: " + finalUrl)
-        req, err = http.NewRequest("PUT", finalUrl, bytes.NewBuffer(put))
-    } else {    //we're doing a get
-        finalUrl := fmt.Sprintf("%s/%s/%s", cf_base_url, cf.Config.Zone, url)
-        cf.superMessage("url: " + finalUrl)
-        req, err = http.NewRequest("GET", finalUrl, nil)
+    var stale []byte
+    var etag string
+    if method != "GET" && cf.ReadOnly && !strings.HasSuffix(finalUrl, "/graphql") {  //analytics queries are posted
+        return nil, readOnlyError(method, finalUrl)
+    } else if method != "GET" {
+        cf.Cache.clear()    //what we're changing could be cached
+    } else if strings.Contains(finalUrl, "/dns_records?") {  //only the domain records get read enough to cache
+        if body = cf.Cache.get(cf.Config.APIKey, finalUrl); body != nil { return }
+        stale, etag = cf.Cache.stale(cf.Config.APIKey, finalUrl)
+        defer func () {
+            if err == nil { cf.Cache.put(cf.Config.APIKey, finalUrl, body, etag) }
+        }()
+    }
+    
+    var req *http.Request
+    if len(data) > 0 {
+        req, err = http.NewRequestWithContext(cf.context(), method, finalUrl, bytes.NewBuffer(data))
+    } else {
+        req, err = http.NewRequestWithContext(cf.context(), method, finalUrl, nil)
     }
     
     if err == nil {
-        req.Header.Set("Content-Type", "application/json")
+        req.Header.Set("Content-Type", contentType)
         req.Header.Set("X-Auth-Email", cf.Config.Email)
         req.Header.Set("X-Auth-Key", cf.Config.APIKey)
+        if stale != nil { req.Header.Set("If-None-Match", etag) }
+        setHeaders(req, cf.Config.Headers)
         
         client := &http.Client{}
         resp, err := client.Do(req)
@@ -66,15 +143,22 @@ func (cf CF_c) request (url string, jStr []byte, put []byte) (body []byte, err e
             defer resp.Body.Close()
             body, _ = ioutil.ReadAll(resp.Body)
             
+            if resp.StatusCode == http.StatusNotModified && stale != nil {    //saving it again starts the ttl over
+                cf.superMessage("Not modified, using the cached response")
+                return stale, nil
+            }
+            etag = resp.Header.Get("ETag")  //saved with the response for next time
+            
             if cf.SuperVerbose {
                 fmt.Println("response Status:", resp.Status)
-                fmt.Println("response Headers:", resp.Header)
-                fmt.Println("response Body:", string(body[:]))
+                fmt.Println("response Headers:", redactHeaders(resp.Header, nil))
+                fmt.Println("response Body:", redactString(string(body), []string{cf.Config.APIKey}))
             }
             
             if resp.StatusCode >= 300 {
-                return nil, fmt.Errorf("Response code: %s", resp.Status)
+                return nil, cf_status_error{Code: resp.StatusCode, Status: resp.Status, RayID: RequestID(resp.Header)}
             }
+            if journaled != nil { journaled(body) }
         } else {
             return nil, err
         }
@@ -83,37 +167,57 @@ func (cf CF_c) request (url string, jStr []byte, put []byte) (body []byte, err e
     return
 }
 
-/*! \brief For when we do a delete request where we aren't expecting a body, only a return code
+/*! \brief Full url for something in the current zone
  */
-func (cf CF_c) deleteRequest (url string) (err error) {
-    req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/%s/%s", cf_base_url, cf.Config.Zone, url), nil)
+func (cf CF_c) zoneUrl (url string) (string, error) {
+    if len(cf.Config.Zone) == 0 { return "", fmt.Errorf("No Cloud Flare zone set.  use the -zone or -d option, or set a default zone in the config") }
+    return fmt.Sprintf("%s/%s/%s", cf_base_url, cf.Config.Zone, url), nil
+}
+
+/*! \brief Requests against the current zone, posts when we have jStr, puts when we have put, otherwise it's a get
+ */
+func (cf CF_c) request (url string, jStr []byte, put []byte) (body []byte, err error) {
+    finalUrl, err := cf.zoneUrl(url)
+    if err != nil { return nil, err }
     
-    if err == nil {
-        req.Header.Set("Content-Type", "application/json")
-        req.Header.Set("X-Auth-Email", cf.Config.Email)
-        req.Header.Set("X-Auth-Key", cf.Config.APIKey)
-        
-        client := &http.Client{}
-        resp, err := client.Do(req)
-        if err == nil {
-            defer resp.Body.Close()
-            
-            if cf.SuperVerbose {
-                fmt.Println("response Status:", resp.Status)
-                fmt.Println("response Headers:", resp.Header)
-            }
-            
-            if resp.StatusCode >= 300 {
-                return fmt.Errorf("Response code: %s", resp.Status)
-            }
-        } else {
-            return err
-        }
+    if len(jStr) > 0 {    //we're posting data
+        return cf.send("POST", finalUrl, jStr)
+    } else if len(put) > 0 {  //put request
+        return cf.send("PUT", finalUrl, put)
     }
-    
+    return cf.send("GET", finalUrl, nil)  //we're doing a get
+}
+
+/*! \brief For when we do a delete request where we aren't expecting a body, only a return code
+ */
+func (cf CF_c) deleteRequest (url string) (err error) {
+    finalUrl, err := cf.zoneUrl(url)
+    if err == nil { _, err = cf.send("DELETE", finalUrl, nil) }
     return
 }
 
+/*! \brief Patches part of something in the current zone
+ */
+func (cf CF_c) patchRequest (url string, data []byte) ([]byte, error) {
+    finalUrl, err := cf.zoneUrl(url)
+    if err != nil { return nil, err }
+    return cf.send("PATCH", finalUrl, data)
+}
+
+/*! \brief Requests against the account rather than the zone
+ */
+func (cf CF_c) accountRequest (method, url string, data []byte) ([]byte, error) {
+    if len(cf.Config.Account) == 0 { return nil, fmt.Errorf("Cloud Flare account_id not set in the config") }
+    return cf.send(method, fmt.Sprintf("%s/accounts/%s/%s", cf_api_url, cf.Config.Account, url), data)
+}
+
+/*! \brief True when the error is cloud flare telling us the thing doesn't exist
+ */
+func cfNotFound (err error) bool {
+    statusErr, ok := err.(cf_status_error)
+    return ok && statusErr.Code == 404
+}
+
 func (cf CF_c) verboseMessage (msg string) {
     if cf.Verbose { fmt.Println(msg) }
 }
@@ -122,111 +226,231 @@ func (cf CF_c) superMessage (msg string) {
     if cf.SuperVerbose { fmt.Println(msg) }
 }
 
+/*! \brief Body for creating or updating a domain record, proxied is left off unless it's being turned on
+ */
+type cf_record_body_t struct {
+    Type    string  `json:"type"`
+    Name    string  `json:"name"`
+    Content string  `json:"content"`
+    Proxied bool    `json:"proxied,omitempty"`
+    TTL     int     `json:"ttl,omitempty"`  //0 leaves it automatic
+}
+
 /*! \brief Creates a domain record when one doesn't exist yet
  */
-func (cf CF_c) createDomainRecord (domainType, subDomain, ip string) (err error) {
-    record := struct { Type    string  `json:"type"`
-        Name    string  `json:"name"`
-        Content string  `json:"content"`
-    }{domainType, subDomain, ip}
-    
-    jStr, _ := json.Marshal(record)
+func (cf CF_c) createDomainRecord (domainType, subDomain, ip string, proxied bool, ttl int) (err error) {
+    jStr, _ := json.Marshal(cf_record_body_t{domainType, subDomain, ip, proxied, ttl})
     _, err = cf.request("dns_records", jStr, nil)
     return
 }
 
 /*! \brief Updates an existing domain record
  */
-func (cf CF_c) updateDomainRecord (id, domainType, subDomain, ip string) (err error) {
-    record := struct { Type    string  `json:"type"`
-        Name    string  `json:"name"`
-        Content string  `json:"content"`
-    }{domainType, subDomain, ip}
-    
-    jStr, _ := json.Marshal(record)
+func (cf CF_c) updateDomainRecord (id, domainType, subDomain, ip string, proxied bool, ttl int) (err error) {
+    jStr, _ := json.Marshal(cf_record_body_t{domainType, subDomain, ip, proxied, ttl})
     _, err = cf.request("dns_records/" + id, nil, jStr)
     return
 }
 
+/*! \brief Gets a single page of domain records, along with the total number of pages
+ */
+func (cf CF_c) getDomainRecordPage (page int) (records []CF_record_t, totalPages int, err error) {
+    resp, err := cf.request(fmt.Sprintf("dns_records?page=%d&per_page=%d", page, cf_per_page), nil, nil)
+    if err == nil {
+        var list struct {
+            ResultInfo  struct {
+                TotalPages  int     `json:"total_pages"`
+            }   `json:"result_info"`
+            
+            Records  []CF_record_t   `json:"result"`
+        }
+        
+        err = compatDecode("cf_record", resp, "result", &list, cf.recordHint())
+        records, totalPages = list.Records, list.ResultInfo.TotalPages
+    }
+    return
+}
+
 /*! \brief Gets a specific domain record from the domain and sub-domain
  */
-func (cf CF_c) getDomainRecord (subDomain string) (string, error) {
-    var err error
+func (cf CF_c) findDomainRecord (subDomain, recordType string) (*CF_record_t, error) {
     pages := 1
     //first step is to get a list of current subdomains from this parent domain
     cf.verboseMessage("Getting list of current subdomains")
     for pages > 0 {
-        nextUrl := fmt.Sprintf("dns_records?page=%d", pages)    //this is the next url to request
-        resp, err := cf.request(nextUrl, nil, nil)
-        if err == nil {
-            var records struct {
-                Success bool    `json:"success"`
-                ResultInfo  struct {
-                    TotalPages  int     `json:"total_pages"`
-                }   `json:"result_info"`
-                
-                Records  []struct {
-                    ID      string  `json:"id"`
-                    Name    string  `json:"name"`
-                    ZoneName    string  `json:"zone_name"`
-                }   `json:"result"`
-            }
-            
-            err = json.Unmarshal(resp, &records)
-            if err == nil {
-                //loop through these records looking for a matched subdomain
-                for _, sd := range (records.Records) {
-                    if strings.Compare(strings.ToLower(sd.Name), fmt.Sprintf("%s.%s", subDomain, sd.ZoneName)) == 0 {  //the record exists
-                        return sd.ID, nil  //we found it
-                    }
-                }
-                
-                //keep searching as long as we have a "next" page
-                if records.ResultInfo.TotalPages > pages {
-                    pages++
-                } else {
-                    pages = 0   //we're done
-                }
-            } else {
-                return "", err
+        records, totalPages, err := cf.getDomainRecordPage(pages)
+        if err != nil { return nil, err }
+        
+        //loop through these records looking for a matched subdomain
+        for _, sd := range (records) {
+            if strings.Compare(strings.ToLower(sd.Name), fmt.Sprintf("%s.%s", subDomain, sd.ZoneName)) == 0 && !recordsCoexist(sd.Type, recordType) {  //the record exists
+                return &sd, nil  //we found it
             }
+        }
+        
+        //keep searching as long as we have a "next" page
+        if totalPages > pages {
+            pages++
         } else {
-            return "", err
+            pages = 0   //we're done
         }
     }
     
     //if we're here it's cause it didn't exist yet
-    return "", err
+    return nil, nil
 }
 
-  //-------------------------------------------------------------------------------------------------------------------------//
- //----- DOMAIN FUNCTIONS --------------------------------------------------------------------------------------------------//
-//-------------------------------------------------------------------------------------------------------------------------//
+/*! \brief Gets the id of a specific domain record, empty when it doesn't exist
+ */
+func (cf CF_c) getDomainRecord (subDomain, recordType string) (string, error) {
+    rec, err := cf.findDomainRecord(subDomain, recordType)
+    if err != nil || rec == nil { return "", err }
+    return rec.ID, nil
+}
 
-/*! \brief Handles full logic of creating, updating, or leaving alone a domain record
+/*! \brief Looks up the zone id for a domain from the api, empty when the account doesn't have that zone
  */
-func (cf CF_c) AssignDomainRecord (domainType, subDomain, ip string) error {
+func (cf CF_c) discoverZone (domain string) (string, error) {
+    resp, err := cf.send("GET", cf_base_url + "?name=" + url.QueryEscape(domain), nil)
+    if err == nil {
+        var zones struct {
+            Result  []struct {
+                ID  string  `json:"id"`
+            }   `json:"result"`
+        }
+        err = json.Unmarshal(resp, &zones)
+        if err == nil && len(zones.Result) > 0 { return zones.Result[0].ID, nil }
+    }
+    return "", err
+}
+
+/*! \brief Creates or updates the domain record
+ */
+func (cf CF_c) assignDomainRecord (domainType, subDomain, ip string, proxied bool) error {
     subDomain = strings.ToLower(subDomain)
-    id, err := cf.getDomainRecord(subDomain)    //see if this already exists
+    id, err := cf.getDomainRecord(subDomain, domainType)    //see if this already exists
     
     if err == nil {
         if len(id) == 0 {  //it doesn't exist yet, so create it
             cf.verboseMessage("SubDomain does not exist, creating...")
-            return cf.createDomainRecord(domainType, subDomain, ip)
+            return cf.createDomainRecord(domainType, subDomain, ip, proxied, 0)
         } else {    //it exists already
             cf.verboseMessage("SubDomain already exists, updating")
-            return cf.updateDomainRecord(id, domainType, subDomain, ip)
+            return cf.updateDomainRecord(id, domainType, subDomain, ip, proxied, 0)
         }
     }
     
     return err
 }
 
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- ZONE FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the domain name of the current zone, ie 'example.com'
+ */
+func (cf CF_c) ZoneName () (string, error) {
+    finalUrl, err := cf.zoneUrl("")
+    if err != nil { return "", err }
+    resp, err := cf.send("GET", strings.TrimSuffix(finalUrl, "/"), nil)
+    if err != nil { return "", err }
+    
+    var zone struct {
+        Result  struct {
+            Name    string  `json:"name"`
+        }   `json:"result"`
+    }
+    err = json.Unmarshal(resp, &zone)
+    return zone.Result.Name, err
+}
+
+/*! \brief Picks the zone the rest of the requests will target
+ *  An explicit zone id wins, then the domain is looked up in the configured zones and then the api.
+ *  With neither passed in we stick with the default zone from the config, if there is one
+ */
+func (cf *CF_c) SelectZone (zone, domain string) error {
+    if len(zone) > 0 {
+        cf.Config.Zone = zone
+        return nil
+    }
+    
+    domain = strings.Trim(strings.ToLower(domain), ".")
+    if len(domain) == 0 { return nil }  //stick with the default, requests that need a zone will complain if there isn't one
+    
+    //walk up the domain so www.example.com matches the example.com zone
+    var candidates []string
+    for parts := strings.Split(domain, "."); len(parts) > 1; parts = parts[1:] {
+        candidates = append(candidates, strings.Join(parts, "."))
+    }
+    
+    for _, name := range(candidates) {
+        for key, id := range(cf.Config.Zones) {
+            if strings.EqualFold(key, name) {
+                cf.Config.Zone = id
+                return nil
+            }
+        }
+    }
+    
+    cf.verboseMessage("Zone not in the config, looking it up")
+    for _, name := range(candidates) {
+        id, err := cf.discoverZone(name)
+        if err != nil { return err }
+        if len(id) > 0 {
+            cf.Config.Zone = id
+            return nil
+        }
+    }
+    
+    return fmt.Errorf("No Cloud Flare zone found for '%s'", domain)
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- DOMAIN FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Handles full logic of creating, updating, or leaving alone a domain record
+ */
+func (cf CF_c) AssignDomainRecord (domainType, subDomain, ip string) error {
+    return cf.assignDomainRecord(domainType, subDomain, ip, false)
+}
+
+/*! \brief Same as AssignDomainRecord, but the traffic goes through cloud flare's proxy
+ */
+func (cf CF_c) AssignProxiedDomainRecord (domainType, subDomain, content string) error {
+    return cf.assignDomainRecord(domainType, subDomain, content, true)
+}
+
+/*! \brief Gets the id of the domain record for the sub domain, empty when it doesn't exist
+ */
+func (cf CF_c) DomainRecordID (domainType, subDomain string) (string, error) {
+    return cf.getDomainRecord(strings.ToLower(subDomain), domainType)
+}
+
+/*! \brief Gets the record in the current zone that setting the type on the sub domain would replace, nil when there isn't one
+ */
+func (cf CF_c) GetDomainRecord (domainType, subDomain string) (*CF_record_t, error) {
+    return cf.findDomainRecord(strings.ToLower(subDomain), domainType)
+}
+
+/*! \brief Points the existing record at the content with the ttl, keeping whether it's proxied.  A ttl of 0 keeps the one it has
+ */
+func (cf CF_c) UpdateDomainRecord (domainType, subDomain, content string, ttl int) error {
+    subDomain = strings.ToLower(subDomain)
+    rec, err := cf.findDomainRecord(subDomain, domainType)
+    if err != nil { return err }
+    if rec == nil { return fmt.Errorf("Domain record %s does not exist", subDomain) }
+
+    if ttl == 0 { ttl = rec.TTL }
+    cf.verboseMessage(fmt.Sprintf("Updating %s to %s with a ttl of %d", subDomain, content, ttl))
+    return cf.updateDomainRecord(rec.ID, domainType, subDomain, content, rec.Proxied, ttl)
+}
+
 /*! \brief Deletes an existing domain record
  */
 func (cf CF_c) DeleteDomainRecord (subDomain string) error {
     subDomain = strings.ToLower(subDomain)
-    id, err := cf.getDomainRecord(subDomain)    //see if this already exists
+    id, err := cf.getDomainRecord(subDomain, "")    //see if this already exists
     
     if err == nil {
         if len(id) == 0 {  //it doesn't exist, so we're good
@@ -240,3 +464,50 @@ func (cf CF_c) DeleteDomainRecord (subDomain string) error {
     return err
 }
 
+/*! \brief Deletes the domain record with the id, ie one from ListDomainRecords
+ */
+func (cf CF_c) DeleteDomainRecordID (id string) error {
+    cf.verboseMessage("Deleting record " + id)
+    return cf.deleteRequest("dns_records/" + id)
+}
+
+/*! \brief Lists all the domain records for the zone, filtered by type, name and content
+ *  Empty filters match everything, the type has to match while the name and content only need to contain the filter
+ */
+func (cf CF_c) ListDomainRecords (recordType, name, content string) ([]CF_record_t, error) {
+    cf.verboseMessage("Getting list of domain records")
+    first, totalPages, err := cf.getDomainRecordPage(1)
+    if err != nil { return nil, err }
+    if totalPages < 1 { totalPages = 1 }    //empty zones report zero pages
+    
+    //request the rest of the pages at the same time
+    pages := make([][]CF_record_t, totalPages + 1)
+    errs := make([]error, totalPages + 1)
+    pages[1] = first
+    
+    slots := make(chan struct{}, cf_page_workers)
+    wg := sync.WaitGroup{}
+    for page := 2; page <= totalPages; page++ {
+        wg.Add(1)
+        slots <- struct{}{}
+        go func (page int) {
+            defer func() { <-slots; wg.Done() }()
+            pages[page], _, errs[page] = cf.getDomainRecordPage(page)
+        }(page)
+    }
+    wg.Wait()
+    
+    records := make([]CF_record_t, 0)
+    for page := 1; page <= totalPages; page++ {
+        if errs[page] != nil { return nil, errs[page] }
+        
+        for _, rec := range(pages[page]) {
+            if len(recordType) > 0 && !strings.EqualFold(rec.Type, recordType) { continue }
+            if len(name) > 0 && !strings.Contains(strings.ToLower(rec.Name), strings.ToLower(name)) { continue }
+            if len(content) > 0 && !strings.Contains(strings.ToLower(rec.Content), strings.ToLower(content)) { continue }
+            records = append(records, rec)
+        }
+    }
+    
+    return records, nil
+}
@@ -0,0 +1,128 @@
+/*! \file cf_analytics.go
+    \brief Cloud flare zone analytics from the graphql api, requests, bandwidth, threats and dns queries per day
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "sort"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const cf_analytics_query    = `query ($zone: string!, $since: Date!, $until: Date!) {
+  viewer {
+    zones(filter: {zoneTag: $zone}) {
+      httpRequests1dGroups(limit: 1000, filter: {date_geq: $since, date_leq: $until}) {
+        dimensions { date }
+        sum { requests cachedRequests bytes cachedBytes threats pageViews }
+        uniq { uniques }
+      }
+      dnsAnalyticsAdaptiveGroups(limit: 1000, filter: {date_geq: $since, date_leq: $until}) {
+        count
+        dimensions { date }
+      }
+    }
+  }
+}`
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type CF_analytics_day_t struct {
+    Date            string  `json:"date"`
+    Requests        int64   `json:"requests"`
+    CachedRequests  int64   `json:"cached_requests"`
+    Bytes           int64   `json:"bytes"`
+    CachedBytes     int64   `json:"cached_bytes"`
+    Threats         int64   `json:"threats"`
+    PageViews       int64   `json:"page_views"`
+    Uniques         int64   `json:"uniques"`
+    DNSQueries      int64   `json:"dns_queries"`
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- ANALYTICS FUNCTIONS -----------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the zone's analytics for each day from since to until, inclusive
+ */
+func (cf CF_c) ZoneAnalytics (since, until time.Time) ([]CF_analytics_day_t, error) {
+    if _, err := cf.zoneUrl(""); err != nil { return nil, err }   //make sure we have a zone
+
+    query := struct {
+        Query       string  `json:"query"`
+        Variables   map[string]string   `json:"variables"`
+    }{cf_analytics_query, map[string]string{"zone": cf.Config.Zone, "since": since.Format("2006-01-02"), "until": until.Format("2006-01-02")}}
+
+    jStr, _ := json.Marshal(query)
+    resp, err := cf.send("POST", cf_api_url + "/graphql", jStr)
+    if err != nil { return nil, err }
+
+    var result struct {
+        Data struct {
+            Viewer struct {
+                Zones []struct {
+                    HTTP []struct {
+                        Dimensions struct {
+                            Date    string  `json:"date"`
+                        }   `json:"dimensions"`
+                        Sum struct {
+                            Requests        int64   `json:"requests"`
+                            CachedRequests  int64   `json:"cachedRequests"`
+                            Bytes           int64   `json:"bytes"`
+                            CachedBytes     int64   `json:"cachedBytes"`
+                            Threats         int64   `json:"threats"`
+                            PageViews       int64   `json:"pageViews"`
+                        }   `json:"sum"`
+                        Uniq struct {
+                            Uniques int64   `json:"uniques"`
+                        }   `json:"uniq"`
+                    }   `json:"httpRequests1dGroups"`
+
+                    DNS []struct {
+                        Count   int64   `json:"count"`
+                        Dimensions struct {
+                            Date    string  `json:"date"`
+                        }   `json:"dimensions"`
+                    }   `json:"dnsAnalyticsAdaptiveGroups"`
+                }   `json:"zones"`
+            }   `json:"viewer"`
+        }   `json:"data"`
+
+        Errors []struct {
+            Message string  `json:"message"`
+        }   `json:"errors"`
+    }
+    if err = json.Unmarshal(resp, &result); err != nil { return nil, err }
+    if len(result.Errors) > 0 { return nil, fmt.Errorf("Analytics query failed :: %s", result.Errors[0].Message) }
+
+    //the http and dns groups come back separately, so line them up by date
+    days := make(map[string]*CF_analytics_day_t)
+    day := func (date string) *CF_analytics_day_t {
+        if _, ok := days[date]; !ok { days[date] = &CF_analytics_day_t{Date: date} }
+        return days[date]
+    }
+
+    for _, zone := range(result.Data.Viewer.Zones) {
+        for _, h := range(zone.HTTP) {
+            d := day(h.Dimensions.Date)
+            d.Requests, d.CachedRequests, d.Bytes, d.CachedBytes = h.Sum.Requests, h.Sum.CachedRequests, h.Sum.Bytes, h.Sum.CachedBytes
+            d.Threats, d.PageViews, d.Uniques = h.Sum.Threats, h.Sum.PageViews, h.Uniq.Uniques
+        }
+        for _, q := range(zone.DNS) {
+            day(q.Dimensions.Date).DNSQueries += q.Count
+        }
+    }
+
+    analytics := make([]CF_analytics_day_t, 0, len(days))
+    for _, d := range(days) { analytics = append(analytics, *d) }
+    sort.Slice(analytics, func (i, j int) bool { return analytics[i].Date < analytics[j].Date })
+    return analytics, nil
+}
@@ -0,0 +1,231 @@
+/*! \file cf_cache.go
+    \brief Cloud flare cache rules and tiered cache/argo settings, applied to a zone from the config
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const cf_cache_entrypoint   = "rulesets/phases/http_request_cache_settings/entrypoint"
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A single cache rule from the config, ttls are in seconds and zero leaves the origin's value alone
+ */
+type CF_cache_rule_t struct {
+    Description     string  `json:"description"`
+    Expression      string  `json:"expression"`
+    Bypass          bool    `json:"bypass"`
+    EdgeTTL         int     `json:"edge_ttl"`
+    BrowserTTL      int     `json:"browser_ttl"`
+}
+
+/*! \brief Cache settings for a zone, empty values for tiered caching and argo leave them as they are
+ */
+type CF_cache_t struct {
+    TieredCaching   string  `json:"tiered_caching"`
+    Argo            string  `json:"argo"`
+    Rules           []CF_cache_rule_t   `json:"rules"`
+}
+
+type cf_ttl_t struct {
+    Mode        string  `json:"mode"`
+    Default     int     `json:"default,omitempty"`
+}
+
+type cf_ruleset_rule_t struct {
+    Description     string  `json:"description"`
+    Expression      string  `json:"expression"`
+    Action          string  `json:"action"`
+    Enabled         bool    `json:"enabled"`
+
+    ActionParameters struct {
+        Cache       bool        `json:"cache"`
+        EdgeTTL     *cf_ttl_t   `json:"edge_ttl,omitempty"`
+        BrowserTTL  *cf_ttl_t   `json:"browser_ttl,omitempty"`
+    }   `json:"action_parameters"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Used to match up rules between the config and the zone
+ */
+func (rule CF_cache_rule_t) key () string {
+    if len(rule.Description) > 0 { return rule.Description }
+    return rule.Expression
+}
+
+/*! \brief Converts our config rule into what the rulesets api is expecting
+ */
+func (rule CF_cache_rule_t) toRuleset () (r cf_ruleset_rule_t) {
+    r.Description, r.Expression, r.Action, r.Enabled = rule.Description, rule.Expression, "set_cache_settings", true
+    r.ActionParameters.Cache = !rule.Bypass
+
+    if !rule.Bypass && rule.EdgeTTL > 0 { r.ActionParameters.EdgeTTL = &cf_ttl_t{Mode: "override_origin", Default: rule.EdgeTTL} }
+    if !rule.Bypass && rule.BrowserTTL > 0 { r.ActionParameters.BrowserTTL = &cf_ttl_t{Mode: "override_origin", Default: rule.BrowserTTL} }
+    return
+}
+
+/*! \brief Converts a rule from the rulesets api back into our config rule
+ */
+func (r cf_ruleset_rule_t) toCacheRule () (rule CF_cache_rule_t) {
+    rule.Description, rule.Expression, rule.Bypass = r.Description, r.Expression, !r.ActionParameters.Cache
+    if r.ActionParameters.EdgeTTL != nil { rule.EdgeTTL = r.ActionParameters.EdgeTTL.Default }
+    if r.ActionParameters.BrowserTTL != nil { rule.BrowserTTL = r.ActionParameters.BrowserTTL.Default }
+    return
+}
+
+/*! \brief Gets the current cache rules for the zone, a zone without any has no entrypoint yet
+ */
+func (cf CF_c) getCacheRules () ([]CF_cache_rule_t, error) {
+    rules := make([]CF_cache_rule_t, 0)
+    resp, err := cf.request(cf_cache_entrypoint, nil, nil)
+    if cfNotFound(err) { return rules, nil }
+    if err != nil { return nil, err }
+
+    var ruleset struct {
+        Result  struct {
+            Rules   []cf_ruleset_rule_t     `json:"rules"`
+        }   `json:"result"`
+    }
+    err = json.Unmarshal(resp, &ruleset)
+    for _, r := range(ruleset.Result.Rules) {
+        rules = append(rules, r.toCacheRule())
+    }
+    return rules, err
+}
+
+/*! \brief Replaces all the cache rules for the zone
+ */
+func (cf CF_c) putCacheRules (rules []CF_cache_rule_t) (err error) {
+    ruleset := struct {
+        Rules   []cf_ruleset_rule_t     `json:"rules"`
+    }{ make([]cf_ruleset_rule_t, 0, len(rules)) }
+
+    for _, rule := range(rules) {
+        ruleset.Rules = append(ruleset.Rules, rule.toRuleset())
+    }
+
+    jStr, _ := json.Marshal(ruleset)
+    _, err = cf.request(cf_cache_entrypoint, nil, jStr)
+    return
+}
+
+/*! \brief Gets the on/off value of a zone setting, ie argo/tiered_caching
+ */
+func (cf CF_c) getZoneSetting (setting string) (string, error) {
+    resp, err := cf.request(setting, nil, nil)
+    if err != nil { return "", err }
+
+    var value struct {
+        Result  struct {
+            Value   string  `json:"value"`
+        }   `json:"result"`
+    }
+    err = json.Unmarshal(resp, &value)
+    return value.Result.Value, err
+}
+
+/*! \brief Sets the on/off value of a zone setting
+ */
+func (cf CF_c) setZoneSetting (setting, value string) (err error) {
+    jStr, _ := json.Marshal(struct {
+        Value   string  `json:"value"`
+    }{value})
+    _, err = cf.patchRequest(setting, jStr)
+    return
+}
+
+/*! \brief Compares the cache rules, returning a line for each difference
+ */
+func diffCacheRules (current, target []CF_cache_rule_t) (changes []string) {
+    existing := make(map[string]CF_cache_rule_t)
+    for _, rule := range(current) { existing[rule.key()] = rule }
+
+    wanted := make(map[string]bool)
+    for _, rule := range(target) {
+        wanted[rule.key()] = true
+        if old, ok := existing[rule.key()]; !ok {
+            changes = append(changes, fmt.Sprintf("+ cache rule '%s' :: %s", rule.key(), rule.Expression))
+        } else if old != rule {
+            changes = append(changes, fmt.Sprintf("~ cache rule '%s' :: bypass %t -> %t, edge ttl %d -> %d, browser ttl %d -> %d, expression '%s' -> '%s'",
+                rule.key(), old.Bypass, rule.Bypass, old.EdgeTTL, rule.EdgeTTL, old.BrowserTTL, rule.BrowserTTL, old.Expression, rule.Expression))
+        }
+    }
+
+    for _, rule := range(current) {
+        if !wanted[rule.key()] { changes = append(changes, fmt.Sprintf("- cache rule '%s' :: %s", rule.key(), rule.Expression)) }
+    }
+
+    //rules run in order, so the same rules in a new order is still a change
+    if len(changes) == 0 && len(current) == len(target) {
+        for i := range(current) {
+            if current[i].key() != target[i].key() {
+                changes = append(changes, "~ cache rule order")
+                break
+            }
+        }
+    }
+    return
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CACHE FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the cache settings from the config for the domain, falling back to the "default" entry
+ */
+func (cf CF_c) CacheSettings (domain string) (CF_cache_t, bool) {
+    for key, settings := range(cf.Config.Cache) {
+        if len(domain) > 0 && strings.EqualFold(key, strings.Trim(domain, ".")) { return settings, true }
+    }
+    settings, ok := cf.Config.Cache["default"]
+    return settings, ok
+}
+
+/*! \brief Makes the zone's cache settings match, returning the list of changes
+ *  With dryRun set we only figure out what would change
+ */
+func (cf CF_c) ApplyCacheSettings (settings CF_cache_t, dryRun bool) (changes []string, err error) {
+    toggles := []struct {
+        setting, value  string
+    }{ {"argo/tiered_caching", settings.TieredCaching}, {"argo/smart_routing", settings.Argo} }
+
+    for _, toggle := range(toggles) {
+        if len(toggle.value) == 0 { continue }   //leave this one alone
+
+        current, err := cf.getZoneSetting(toggle.setting)
+        if err != nil { return changes, err }
+
+        if !strings.EqualFold(current, toggle.value) {
+            changes = append(changes, fmt.Sprintf("~ %s :: %s -> %s", toggle.setting, current, toggle.value))
+            if !dryRun {
+                cf.verboseMessage("Updating " + toggle.setting)
+                if err = cf.setZoneSetting(toggle.setting, strings.ToLower(toggle.value)); err != nil { return changes, err }
+            }
+        }
+    }
+
+    current, err := cf.getCacheRules()
+    if err != nil { return }
+
+    ruleChanges := diffCacheRules(current, settings.Rules)
+    changes = append(changes, ruleChanges...)
+    if len(ruleChanges) > 0 && !dryRun {
+        cf.verboseMessage("Updating cache rules")
+        err = cf.putCacheRules(settings.Rules)
+    }
+    return
+}
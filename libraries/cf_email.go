@@ -0,0 +1,220 @@
+/*! \file cf_email.go
+    \brief Cloud flare email routing, forwarding addresses on a zone to destination addresses
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type cf_email_matcher_t struct {
+    Type        string  `json:"type"`
+    Field       string  `json:"field,omitempty"`
+    Value       string  `json:"value,omitempty"`
+}
+
+type cf_email_action_t struct {
+    Type        string      `json:"type"`
+    Value       []string    `json:"value,omitempty"`
+}
+
+type CF_email_rule_t struct {
+    ID          string  `json:"tag,omitempty"`
+    Name        string  `json:"name"`
+    Enabled     bool    `json:"enabled"`
+    Matchers    []cf_email_matcher_t    `json:"matchers"`
+    Actions     []cf_email_action_t     `json:"actions"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The address this rule matches, * for the catch-all
+ */
+func (rule CF_email_rule_t) From () string {
+    for _, m := range(rule.Matchers) {
+        if m.Type == "all" { return "*" }
+        if m.Type == "literal" && m.Field == "to" { return m.Value }
+    }
+    return ""
+}
+
+/*! \brief Where the rule forwards to
+ */
+func (rule CF_email_rule_t) To () []string {
+    for _, a := range(rule.Actions) {
+        if a.Type == "forward" { return a.Value }
+    }
+    return nil
+}
+
+/*! \brief Makes sure the destination address exists on the account, new ones get a verification email from cloud flare
+ */
+func (cf CF_c) assignEmailDestination (email string) (err error) {
+    resp, err := cf.accountRequest("GET", "email/routing/addresses?per_page=50", nil)
+    if err != nil { return }
+
+    var list struct {
+        Result  []struct {
+            Email       string  `json:"email"`
+            Verified    string  `json:"verified"`
+        }   `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return }
+
+    for _, addr := range(list.Result) {
+        if strings.EqualFold(addr.Email, email) {
+            if len(addr.Verified) == 0 { fmt.Printf("Destination address %s has not been verified yet, check its inbox\n", email) }
+            return nil
+        }
+    }
+
+    cf.verboseMessage("Destination address does not exist, creating...")
+    jStr, _ := json.Marshal(struct {
+        Email   string  `json:"email"`
+    }{email})
+    _, err = cf.accountRequest("POST", "email/routing/addresses", jStr)
+    if err == nil { fmt.Printf("Destination address %s created, cloud flare sent it a verification email\n", email) }
+    return
+}
+
+/*! \brief Gets all the routing rules for the zone, the catch-all is only included when it's enabled
+ */
+func (cf CF_c) getEmailRules () ([]CF_email_rule_t, error) {
+    rules := make([]CF_email_rule_t, 0)
+    for page := 1; page > 0; {
+        resp, err := cf.request(fmt.Sprintf("email/routing/rules?page=%d&per_page=50", page), nil, nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            ResultInfo  struct {
+                TotalPages  int     `json:"total_pages"`
+            }   `json:"result_info"`
+            Result  []CF_email_rule_t   `json:"result"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        rules = append(rules, list.Result...)
+        if list.ResultInfo.TotalPages > page {
+            page++
+        } else {
+            page = 0
+        }
+    }
+
+    resp, err := cf.request("email/routing/rules/catch_all", nil, nil)
+    if err == nil {
+        var catchAll struct {
+            Result  CF_email_rule_t     `json:"result"`
+        }
+        if err = json.Unmarshal(resp, &catchAll); err == nil && catchAll.Result.Enabled {
+            rules = append(rules, catchAll.Result)
+        }
+    }
+    return rules, err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- EMAIL ROUTING FUNCTIONS -------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Turns on email routing for the zone, which also adds the mx and spf records it needs
+ */
+func (cf CF_c) EnableEmailRouting () error {
+    resp, err := cf.request("email/routing", nil, nil)
+    if err != nil { return err }
+
+    var settings struct {
+        Result  struct {
+            Enabled     bool    `json:"enabled"`
+        }   `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &settings); err != nil { return err }
+
+    if settings.Result.Enabled {
+        cf.verboseMessage("Email routing already enabled")
+        return nil
+    }
+
+    cf.verboseMessage("Enabling email routing")
+    _, err = cf.request("email/routing/enable", []byte("{}"), nil)
+    return err
+}
+
+/*! \brief Lists the forwarding rules for the zone
+ */
+func (cf CF_c) ListEmailForwards () ([]CF_email_rule_t, error) {
+    return cf.getEmailRules()
+}
+
+/*! \brief Forwards the from address to the to address, creating or updating the rule as needed
+ *  A from of * sets the catch-all for the zone
+ */
+func (cf CF_c) AssignEmailForward (from, to string) error {
+    from, to = strings.ToLower(from), strings.ToLower(to)
+    err := cf.assignEmailDestination(to)
+    if err != nil { return err }
+
+    rule := CF_email_rule_t{Name: "Forward " + from, Enabled: true,
+        Matchers: []cf_email_matcher_t{ {Type: "literal", Field: "to", Value: from} },
+        Actions: []cf_email_action_t{ {Type: "forward", Value: []string{to}} } }
+
+    if from == "*" {    //the catch-all is always there, we just update it
+        rule.Name, rule.Matchers = "Catch-all", []cf_email_matcher_t{ {Type: "all"} }
+        jStr, _ := json.Marshal(rule)
+        _, err = cf.request("email/routing/rules/catch_all", nil, jStr)
+        return err
+    }
+
+    rules, err := cf.getEmailRules()
+    if err != nil { return err }
+
+    jStr, _ := json.Marshal(rule)
+    for _, existing := range(rules) {
+        if existing.From() != from { continue }
+
+        if dest := existing.To(); len(dest) == 1 && dest[0] == to && existing.Enabled {
+            cf.verboseMessage("Forward already exists and is correct")
+            return nil
+        }
+        cf.verboseMessage("Forward already exists, updating")
+        _, err = cf.request("email/routing/rules/" + existing.ID, nil, jStr)
+        return err
+    }
+
+    cf.verboseMessage("Forward does not exist, creating...")
+    _, err = cf.request("email/routing/rules", jStr, nil)
+    return err
+}
+
+/*! \brief Removes the forwarding rule for the from address, * disables the catch-all
+ */
+func (cf CF_c) DeleteEmailForward (from string) error {
+    from = strings.ToLower(from)
+    if from == "*" {
+        jStr, _ := json.Marshal(CF_email_rule_t{Name: "Catch-all", Matchers: []cf_email_matcher_t{ {Type: "all"} }, Actions: []cf_email_action_t{ {Type: "drop"} }})
+        _, err := cf.request("email/routing/rules/catch_all", nil, jStr)
+        return err
+    }
+
+    rules, err := cf.getEmailRules()
+    if err != nil { return err }
+
+    for _, existing := range(rules) {
+        if existing.From() == from {
+            cf.verboseMessage("Deleting forward for " + from)
+            return cf.deleteRequest("email/routing/rules/" + existing.ID)
+        }
+    }
+
+    cf.verboseMessage("Forward does not exist, nothing to do...")
+    return nil
+}
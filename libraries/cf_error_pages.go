@@ -0,0 +1,67 @@
+/*! \file cf_error_pages.go
+    \brief The zone's custom error pages, what cloud flare shows for its own errors and blocks instead of its default pages
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "strings"
+    "encoding/json"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A custom page, the id is the kind of page, ie 500_errors or waf_block
+ */
+type CF_custom_page_t struct {
+    ID          string  `json:"id"`
+    Description string  `json:"description"`
+    URL         string  `json:"url"`
+    State       string  `json:"state"`     //default or customized
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- ERROR PAGE FUNCTIONS ----------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the zone's custom pages, customized or not
+ */
+func (cf CF_c) ListCustomPages () ([]CF_custom_page_t, error) {
+    resp, err := cf.request("custom_pages", nil, nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Result  []CF_custom_page_t  `json:"result"`
+    }
+    err = json.Unmarshal(resp, &list)
+    return list.Result, err
+}
+
+/*! \brief Points the custom page at the url, cloud flare fetches it from there.  An empty url puts back cloud flare's default page
+ */
+func (cf CF_c) SetCustomPage (id, url string) error {
+    pages, err := cf.ListCustomPages()
+    if err != nil { return err }
+    ids := make([]string, 0, len(pages))
+    var page *CF_custom_page_t
+    for i := range(pages) {
+        ids = append(ids, pages[i].ID)
+        if pages[i].ID == id { page = &pages[i] }
+    }
+    if page == nil { return fmt.Errorf("Unknown custom page '%s'.  The zone has: %s", id, strings.Join(ids, ", ")) }
+
+    state := "customized"
+    if len(url) == 0 { state = "default" }
+    if page.URL == url && page.State == state {
+        cf.verboseMessage(fmt.Sprintf("Custom page %s is already %s, no work to do", id, state))
+        return nil
+    }
+
+    fmt.Printf("Setting custom page %s to %s\n", id, state)
+    jStr, _ := json.Marshal(map[string]string{"url": url, "state": state})
+    _, err = cf.request("custom_pages/" + id, nil, jStr)
+    return err
+}
@@ -0,0 +1,179 @@
+/*! \file cf_hostnames.go
+    \brief Cloud flare custom hostnames (ssl for saas), so customer domains can point at our zone
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net/url"
+    "encoding/json"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const cf_hostname_poll      = time.Second * 10  //how long we wait between checking the validation status
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type cf_validation_record_t struct {
+    Type        string  `json:"type,omitempty"`
+    Name        string  `json:"name,omitempty"`
+    Value       string  `json:"value,omitempty"`
+    TxtName     string  `json:"txt_name,omitempty"`
+    TxtValue    string  `json:"txt_value,omitempty"`
+    HttpUrl     string  `json:"http_url,omitempty"`
+    HttpBody    string  `json:"http_body,omitempty"`
+}
+
+type CF_hostname_t struct {
+    ID          string  `json:"id"`
+    Hostname    string  `json:"hostname"`
+    Status      string  `json:"status"`
+
+    SSL struct {
+        Method      string  `json:"method"`
+        Type        string  `json:"type"`
+        Status      string  `json:"status"`
+        ValidationRecords   []cf_validation_record_t    `json:"validation_records,omitempty"`
+    }   `json:"ssl"`
+
+    OwnershipVerification   cf_validation_record_t  `json:"ownership_verification"`
+    VerificationErrors      []string    `json:"verification_errors,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the custom hostnames, optionally only ones matching the hostname
+ */
+func (cf CF_c) getCustomHostnames (hostname string) ([]CF_hostname_t, error) {
+    hostnames := make([]CF_hostname_t, 0)
+    for page := 1; page > 0; {
+        nextUrl := fmt.Sprintf("custom_hostnames?page=%d&per_page=50", page)
+        if len(hostname) > 0 { nextUrl += "&hostname=" + url.QueryEscape(hostname) }
+
+        resp, err := cf.request(nextUrl, nil, nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            ResultInfo  struct {
+                TotalPages  int     `json:"total_pages"`
+            }   `json:"result_info"`
+            Result  []CF_hostname_t  `json:"result"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        hostnames = append(hostnames, list.Result...)
+        if list.ResultInfo.TotalPages > page {
+            page++
+        } else {
+            page = 0    //we're done
+        }
+    }
+    return hostnames, nil
+}
+
+/*! \brief Gets the custom hostname from its name, nil if it doesn't exist
+ */
+func (cf CF_c) getCustomHostname (hostname string) (*CF_hostname_t, error) {
+    hostnames, err := cf.getCustomHostnames(hostname)
+    if err == nil {
+        for _, h := range(hostnames) {
+            if strings.EqualFold(h.Hostname, hostname) { return &h, nil }
+        }
+    }
+    return nil, err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CUSTOM HOSTNAME FUNCTIONS -----------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Creates a custom hostname with a cloud flare issued certificate, if it doesn't already exist
+ *  sslMethod is how the certificate gets validated, ie 'http', 'txt' or 'email'
+ */
+func (cf CF_c) CreateCustomHostname (hostname, sslMethod string) (*CF_hostname_t, error) {
+    hostname = strings.ToLower(hostname)
+    existing, err := cf.getCustomHostname(hostname)
+    if err != nil { return nil, err }
+
+    if existing != nil {
+        cf.verboseMessage("Custom hostname already exists")
+        return existing, nil
+    }
+
+    cf.verboseMessage("Custom hostname does not exist, creating...")
+    var create struct {
+        Hostname    string  `json:"hostname"`
+        SSL struct {
+            Method  string  `json:"method"`
+            Type    string  `json:"type"`
+        }   `json:"ssl"`
+    }
+    create.Hostname = hostname
+    create.SSL.Method = sslMethod
+    create.SSL.Type = "dv"
+
+    jStr, _ := json.Marshal(create)
+    resp, err := cf.request("custom_hostnames", jStr, nil)
+    if err != nil { return nil, err }
+
+    var created struct {
+        Result  CF_hostname_t   `json:"result"`
+    }
+    err = json.Unmarshal(resp, &created)
+    return &created.Result, err
+}
+
+/*! \brief Lists all the custom hostnames for the zone
+ */
+func (cf CF_c) ListCustomHostnames () ([]CF_hostname_t, error) {
+    return cf.getCustomHostnames("")
+}
+
+/*! \brief Waits for the hostname and its certificate to both be active, checking every 10 seconds up to maxTries
+ */
+func (cf CF_c) WaitForCustomHostname (hostname string, maxTries int) (*CF_hostname_t, error) {
+    for try := 0; try < maxTries; try++ {
+        h, err := cf.getCustomHostname(strings.ToLower(hostname))
+        if err != nil { return nil, err }
+        if h == nil { return nil, fmt.Errorf("Custom hostname '%s' does not exist", hostname) }
+
+        if h.Status == "active" && h.SSL.Status == "active" { return h, nil }   //we're good
+        if cf.Verbose { fmt.Printf("Custom hostname status: %s, ssl status: %s\n", h.Status, h.SSL.Status) }
+
+        if try + 1 < maxTries {
+            select {
+            case <-time.After(cf_hostname_poll):
+            case <-cf.context().Done():
+                return nil, cf.context().Err()
+            }
+        }
+    }
+    return nil, fmt.Errorf("Custom hostname '%s' was not validated in time", hostname)
+}
+
+/*! \brief Deletes an existing custom hostname
+ */
+func (cf CF_c) DeleteCustomHostname (hostname string) error {
+    h, err := cf.getCustomHostname(strings.ToLower(hostname))
+
+    if err == nil {
+        if h == nil {  //it doesn't exist, so we're good
+            cf.verboseMessage("Custom hostname does not exist, nothing to do...")
+        } else {
+            cf.verboseMessage("Deleting custom hostname " + hostname)
+            err = cf.deleteRequest("custom_hostnames/" + h.ID)
+        }
+    }
+
+    return err
+}
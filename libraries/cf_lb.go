@@ -0,0 +1,138 @@
+/*! \file cf_lb.go
+    \brief Cloud flare load balancer pools, the origin weights are how traffic is moved between nodes a bit at a time
+ *  Also geo steered load balancers, sending each part of the world to the pool for the region nearest it
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "reflect"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief An origin in a pool, the weights are relative to the other origins in the pool, 0 to 1
+ */
+type CF_pool_origin_t struct {
+    Name        string  `json:"name"`
+    Address     string  `json:"address"`
+    Enabled     bool    `json:"enabled"`
+    Weight      float64 `json:"weight"`
+    Port        int     `json:"port,omitempty"`
+    Header      json.RawMessage `json:"header,omitempty"`    //kept as it is, ie a host header
+    VirtualNetworkID    string  `json:"virtual_network_id,omitempty"`
+}
+
+type CF_pool_t struct {
+    ID          string  `json:"id"`
+    Name        string  `json:"name"`
+    Origins     []CF_pool_origin_t  `json:"origins"`
+}
+
+/*! \brief A zone's load balancer, the pools are by id and region_pools is keyed by cloud flare's region codes, ie ENAM or WEU
+ */
+type cf_balancer_t struct {
+    ID          string  `json:"id,omitempty"`
+    Name        string  `json:"name"`
+    DefaultPools    []string    `json:"default_pools"`
+    FallbackPool    string      `json:"fallback_pool"`
+    RegionPools     map[string][]string     `json:"region_pools"`
+    SteeringPolicy  string      `json:"steering_policy"`
+    Proxied     bool    `json:"proxied"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The pool with the name or id, nil when there isn't one
+ */
+func (cf CF_c) findPool (name string) (*CF_pool_t, error) {
+    resp, err := cf.accountRequest("GET", "load_balancers/pools", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Result  []CF_pool_t     `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+    for _, pool := range(list.Result) {
+        if strings.EqualFold(pool.Name, name) || pool.ID == name { return &pool, nil }
+    }
+    return nil, nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- POOL FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the load balancer pool on the account by its name or id
+ */
+func (cf CF_c) GetPool (name string) (*CF_pool_t, error) {
+    pool, err := cf.findPool(name)
+    if err == nil && pool == nil { err = fmt.Errorf("Load balancer pool '%s' not found", name) }
+    return pool, err
+}
+
+/*! \brief Replaces the pool's origins with these, ie after changing their weights
+ */
+func (cf CF_c) SetPoolOrigins (pool CF_pool_t) error {
+    cf.verboseMessage("Updating the origins of pool " + pool.Name)
+    jStr, _ := json.Marshal(map[string]interface{}{"origins": pool.Origins})
+    _, err := cf.accountRequest("PATCH", "load_balancers/pools/" + pool.ID, jStr)
+    return err
+}
+
+/*! \brief Makes sure the pool exists with exactly these origins, creating it when it doesn't
+ */
+func (cf CF_c) AssignPool (name string, origins []CF_pool_origin_t) (*CF_pool_t, error) {
+    pool, err := cf.findPool(name)
+    if err != nil { return nil, err }
+    if pool != nil {
+        if reflect.DeepEqual(pool.Origins, origins) { return pool, nil }
+        pool.Origins = origins
+        return pool, cf.SetPoolOrigins(*pool)
+    }
+
+    fmt.Println("Creating load balancer pool: " + name)
+    jStr, _ := json.Marshal(map[string]interface{}{"name": name, "origins": origins})
+    resp, err := cf.accountRequest("POST", "load_balancers/pools", jStr)
+    if err != nil { return nil, err }
+
+    var created struct {
+        Result  CF_pool_t   `json:"result"`
+    }
+    err = json.Unmarshal(resp, &created)
+    return &created.Result, err
+}
+
+/*! \brief Points the hostname at a proxied load balancer that sends each cloud flare region to its pools, regions left out get all of them
+ *  The load balancer is created when it doesn't exist, otherwise its pools and steering are replaced
+ */
+func (cf CF_c) AssignGeoBalancer (hostname string, regionPools map[string][]string, pools []string) error {
+    if len(pools) == 0 { return fmt.Errorf("Load balancer %s needs at least one pool", hostname) }
+    resp, err := cf.request("load_balancers", nil, nil)
+    if err != nil { return err }
+    var list struct {
+        Result  []cf_balancer_t     `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return err }
+
+    lb := cf_balancer_t{Name: hostname, DefaultPools: pools, FallbackPool: pools[0], RegionPools: regionPools, SteeringPolicy: "geo", Proxied: true}
+    for _, existing := range(list.Result) {
+        if strings.EqualFold(existing.Name, hostname) { lb.ID = existing.ID }
+    }
+    jStr, _ := json.Marshal(lb)
+    if len(lb.ID) == 0 {
+        fmt.Println("Creating load balancer: " + hostname)
+        _, err = cf.request("load_balancers", jStr, nil)
+    } else {
+        cf.verboseMessage("Updating load balancer " + hostname)
+        _, err = cf.request("load_balancers/" + lb.ID, nil, jStr)
+    }
+    return err
+}
@@ -0,0 +1,229 @@
+/*! \file cf_maintenance.go
+    \brief Putting a zone into maintenance mode around disruptive changes, either with a worker route or a forwarding page rule
+ *  The worker can be our standard one, uploaded with the page bound to it so there's nothing to write
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "bytes"
+    "strconv"
+    "encoding/json"
+    "mime/multipart"
+    "net/textproto"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const cf_maintenance_module = "maintenance.js"
+
+/*! \brief Serves the bound page to everything with a 503, so crawlers and health checks know it's temporary
+ */
+const cf_maintenance_worker = `export default {
+  async fetch(request, env) {
+    return new Response(env.PAGE, {
+      status: 503,
+      headers: {"content-type": "text/html; charset=utf-8", "retry-after": env.RETRY_AFTER, "cache-control": "no-store"},
+    });
+  },
+};
+`
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Maintenance page from the config, set the script to route to a worker or the url to forward to it with a page rule
+ */
+type CF_maintenance_t struct {
+    Pattern     string  `json:"pattern"`   //ie 'example.com/*'
+    Script      string  `json:"script"`    //name of the worker serving the maintenance page
+    URL         string  `json:"url"`       //where the page rule forwards to, when there's no script
+    Zone        string  `json:"zone"`      //optional, otherwise it's the zone picked for the request
+}
+
+type cf_worker_route_t struct {
+    ID          string  `json:"id,omitempty"`
+    Pattern     string  `json:"pattern"`
+    Script      string  `json:"script,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Makes sure the config has what we need, and switches to its zone when it has one
+ */
+func (cf *CF_c) maintenanceConfig () (CF_maintenance_t, error) {
+    m := cf.Config.Maintenance
+    if len(m.Pattern) == 0 { return m, fmt.Errorf("No maintenance pattern in the cloud_flare config") }
+    if len(m.Script) == 0 && len(m.URL) == 0 { return m, fmt.Errorf("The maintenance config needs a worker script or a url to forward to") }
+    if len(m.Zone) > 0 { cf.Config.Zone = m.Zone }
+    return m, nil
+}
+
+/*! \brief Worker route for the pattern, nil when there isn't one
+ */
+func (cf CF_c) findWorkerRoute (pattern string) (*cf_worker_route_t, error) {
+    resp, err := cf.request("workers/routes", nil, nil)
+    if err != nil { return nil, err }
+
+    var routes struct {
+        Result  []cf_worker_route_t     `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &routes); err != nil { return nil, err }
+    for _, r := range(routes.Result) {
+        if r.Pattern == pattern { return &r, nil }
+    }
+    return nil, nil
+}
+
+/*! \brief Id of our forwarding page rule for the pattern, empty when there isn't one, and how many rules the zone has
+ *  Other page rules on the same pattern are left alone
+ */
+func (cf CF_c) findMaintenanceRule (m CF_maintenance_t) (string, int, error) {
+    resp, err := cf.request("pagerules", nil, nil)
+    if err != nil { return "", 0, err }
+
+    var rules struct {
+        Result  []struct {
+            ID          string  `json:"id"`
+            Targets     []struct {
+                Constraint  struct {
+                    Value   string  `json:"value"`
+                }   `json:"constraint"`
+            }   `json:"targets"`
+            Actions     []struct {
+                ID      string  `json:"id"`
+                Value   struct {
+                    URL     string  `json:"url"`
+                }   `json:"value"`
+            }   `json:"actions"`
+        }   `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &rules); err != nil { return "", 0, err }
+    for _, rule := range(rules.Result) {
+        if len(rule.Targets) != 1 || rule.Targets[0].Constraint.Value != m.Pattern { continue }
+        for _, a := range(rule.Actions) {
+            if a.ID == "forwarding_url" && a.Value.URL == m.URL { return rule.ID, len(rules.Result), nil }
+        }
+    }
+    return "", len(rules.Result), nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- MAINTENANCE FUNCTIONS ---------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Starts serving the maintenance page from the config
+ *  When the pattern already routes to another worker, that script is returned so MaintenanceOff can put it back
+ */
+func (cf CF_c) MaintenanceOn () (previous string, err error) {
+    m, err := cf.maintenanceConfig()
+    if err != nil { return "", err }
+
+    if len(m.Script) > 0 {
+        route, err := cf.findWorkerRoute(m.Pattern)
+        if err != nil { return "", err }
+
+        jStr, _ := json.Marshal(cf_worker_route_t{Pattern: m.Pattern, Script: m.Script})
+        switch {
+        case route == nil:
+            cf.verboseMessage("Adding the maintenance worker route for " + m.Pattern)
+            _, err = cf.request("workers/routes", jStr, nil)
+        case route.Script != m.Script:
+            cf.verboseMessage(fmt.Sprintf("Switching %s from the %s worker to maintenance", m.Pattern, route.Script))
+            previous = route.Script
+            _, err = cf.request("workers/routes/" + route.ID, nil, jStr)
+        default:
+            cf.verboseMessage("Maintenance worker route already in place, no work to do")
+        }
+        return previous, err
+    }
+
+    id, count, err := cf.findMaintenanceRule(m)
+    if err != nil || len(id) > 0 {
+        if len(id) > 0 { cf.verboseMessage("Maintenance page rule already in place, no work to do") }
+        return "", err
+    }
+
+    cf.verboseMessage("Adding the maintenance page rule for " + m.Pattern)
+    rule := map[string]interface{}{
+        "targets": []interface{}{map[string]interface{}{"target": "url", "constraint": map[string]string{"operator": "matches", "value": m.Pattern}}},
+        "actions": []interface{}{map[string]interface{}{"id": "forwarding_url", "value": map[string]interface{}{"url": m.URL, "status_code": 302}}},
+        "priority": count + 1,     //higher wins, so it's ahead of the zone's other rules
+        "status": "active",
+    }
+    jStr, _ := json.Marshal(rule)
+    _, err = cf.request("pagerules", jStr, nil)
+    return "", err
+}
+
+/*! \brief Stops serving the maintenance page, previous is what MaintenanceOn handed back
+ */
+func (cf CF_c) MaintenanceOff (previous string) error {
+    m, err := cf.maintenanceConfig()
+    if err != nil { return err }
+
+    if len(m.Script) > 0 {
+        route, err := cf.findWorkerRoute(m.Pattern)
+        if err != nil { return err }
+
+        switch {
+        case route == nil || route.Script != m.Script:
+            cf.verboseMessage("Maintenance worker route does not exist, nothing to do...")
+        case len(previous) > 0:
+            cf.verboseMessage(fmt.Sprintf("Switching %s back to the %s worker", m.Pattern, previous))
+            jStr, _ := json.Marshal(cf_worker_route_t{Pattern: m.Pattern, Script: previous})
+            _, err = cf.request("workers/routes/" + route.ID, nil, jStr)
+        default:
+            cf.verboseMessage("Removing the maintenance worker route for " + m.Pattern)
+            err = cf.deleteRequest("workers/routes/" + route.ID)
+        }
+        return err
+    }
+
+    id, _, err := cf.findMaintenanceRule(m)
+    if err != nil { return err }
+    if len(id) == 0 {
+        cf.verboseMessage("Maintenance page rule does not exist, nothing to do...")
+        return nil
+    }
+    cf.verboseMessage("Removing the maintenance page rule for " + m.Pattern)
+    return cf.deleteRequest("pagerules/" + id)
+}
+
+/*! \brief Uploads our maintenance worker as the config's script, with the page and how many seconds to tell clients to retry after bound to it
+ *  Uploading again replaces the page, the route is still only added while maintenance mode is on
+ */
+func (cf CF_c) UploadMaintenanceWorker (page []byte, retryAfter int) error {
+    script := cf.Config.Maintenance.Script
+    if len(script) == 0 { return fmt.Errorf("The maintenance config needs a script name to upload the worker as") }
+    if len(page) == 0 { return fmt.Errorf("The maintenance page is empty") }
+
+    metadata, _ := json.Marshal(map[string]interface{}{
+        "main_module": cf_maintenance_module,
+        "compatibility_date": "2024-01-01",
+        "bindings": []map[string]string{
+            {"type": "plain_text", "name": "PAGE", "text": string(page)},
+            {"type": "plain_text", "name": "RETRY_AFTER", "text": strconv.Itoa(retryAfter)},
+        },
+    })
+
+    var body bytes.Buffer
+    form := multipart.NewWriter(&body)
+    part, _ := form.CreatePart(textproto.MIMEHeader{"Content-Disposition": {`form-data; name="metadata"`}, "Content-Type": {"application/json"}})
+    part.Write(metadata)
+    part, _ = form.CreatePart(textproto.MIMEHeader{"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"; filename="%s"`, cf_maintenance_module, cf_maintenance_module)},
+        "Content-Type": {"application/javascript+module"}})
+    part.Write([]byte(cf_maintenance_worker))
+    form.Close()
+
+    if len(cf.Config.Account) == 0 { return fmt.Errorf("Cloud Flare account_id not set in the config") }
+    fmt.Println("Uploading the maintenance worker: " + script)
+    _, err := cf.sendType("PUT", fmt.Sprintf("%s/accounts/%s/workers/scripts/%s", cf_api_url, cf.Config.Account, script), body.Bytes(), form.FormDataContentType())
+    return err
+}
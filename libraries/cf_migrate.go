@@ -0,0 +1,237 @@
+/*! \file cf_migrate.go
+    \brief Moving a zone between cloud flare accounts, exporting its records, page rules and key settings and recreating them in the other account
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "sort"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+//only the fields we can send back when creating the thing, the rest are ids and timestamps cloud flare fills in
+var cf_migrate_record_fields = []string{"type", "name", "content", "ttl", "proxied", "priority", "data", "comment", "tags"}
+var cf_migrate_rule_fields = []string{"targets", "actions", "priority", "status"}
+
+//the zone settings worth carrying over, the rest are left at the new zone's defaults
+var cf_migrate_settings = []string{"ssl", "always_use_https", "automatic_https_rewrites", "min_tls_version", "tls_1_3", "http3", "ipv6", "websockets",
+    "brotli", "security_level", "browser_cache_ttl", "cache_level", "opportunistic_encryption", "email_obfuscation", "hotlink_protection"}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Everything we carry over from a zone, written out with -o so there's a copy of what was moved
+ */
+type CF_zone_export_t struct {
+    Zone        string  `json:"zone"`
+    Records     []map[string]interface{}    `json:"records"`
+    PageRules   []map[string]interface{}    `json:"page_rules"`
+    Settings    map[string]interface{}      `json:"settings"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Copy of the item with only the fields we want
+ */
+func keepFields (item map[string]interface{}, fields []string) map[string]interface{} {
+    kept := make(map[string]interface{})
+    for _, f := range(fields) {
+        if v, ok := item[f]; ok && v != nil { kept[f] = v }
+    }
+    return kept
+}
+
+/*! \brief Compares two exported things, json sorts the map keys so the same fields always give the same string
+ */
+func migrateKey (item map[string]interface{}, skip string) string {
+    copied := make(map[string]interface{})
+    for k, v := range(item) {
+        if k != skip { copied[k] = v }
+    }
+    jStr, _ := json.Marshal(copied)
+    return string(jStr)
+}
+
+/*! \brief A line for the record that reads easily in the diff
+ */
+func recordLine (rec map[string]interface{}) string {
+    line := fmt.Sprintf("record %v %v %v", rec["type"], rec["name"], rec["content"])
+    if rec["proxied"] == true { line += " (proxied)" }
+    return line
+}
+
+func settingValue (value interface{}) string {
+    if str, ok := value.(string); ok { return str }
+    jStr, _ := json.Marshal(value)
+    return string(jStr)
+}
+
+/*! \brief A line for everything in the export that's missing or different in current
+ *  Extra records in current aren't counted, only what the export needs
+ */
+func diffExport (current, export *CF_zone_export_t) []string {
+    diff := make([]string, 0)
+    have := make(map[string]bool)
+    for _, rec := range(current.Records) { have[migrateKey(rec, "")] = true }
+    for _, rec := range(export.Records) {
+        if !have[migrateKey(rec, "")] { diff = append(diff, "+ " + recordLine(rec)) }
+    }
+
+    have = make(map[string]bool)
+    for _, rule := range(current.PageRules) { have[migrateKey(rule, "priority")] = true }   //priorities get renumbered
+    for _, rule := range(export.PageRules) {
+        if !have[migrateKey(rule, "priority")] { diff = append(diff, "+ page rule " + settingValue(rule["targets"])) }
+    }
+
+    names := make([]string, 0, len(export.Settings))
+    for name := range(export.Settings) { names = append(names, name) }
+    sort.Strings(names)
+    for _, name := range(names) {
+        want, got := settingValue(export.Settings[name]), settingValue(current.Settings[name])
+        if want != got { diff = append(diff, fmt.Sprintf("~ setting %s: %s -> %s", name, got, want)) }
+    }
+    return diff
+}
+
+/*! \brief All the domain records for the zone, with every field cloud flare gives us
+ */
+func (cf CF_c) rawDomainRecords () ([]map[string]interface{}, error) {
+    records := make([]map[string]interface{}, 0)
+    var err error
+    pageErr := cf.EachPage("dns_records", func (item json.RawMessage) bool {
+        var rec map[string]interface{}
+        err = json.Unmarshal(item, &rec)
+        records = append(records, rec)
+        return err == nil
+    })
+    if pageErr != nil { return nil, pageErr }
+    return records, err
+}
+
+/*! \brief Creates the zone in the account, it starts out pending until the registrar points at the new name servers
+ */
+func (cf *CF_c) createZone (name string) error {
+    if len(cf.Config.Account) == 0 { return fmt.Errorf("Cloud Flare account_id not set for the account we're moving the zone to") }
+
+    jStr, _ := json.Marshal(map[string]interface{}{"name": name, "account": map[string]string{"id": cf.Config.Account}, "jump_start": false})
+    resp, err := cf.send("POST", cf_base_url, jStr)
+    if err != nil { return err }
+
+    var zone struct {
+        Result  struct {
+            ID      string  `json:"id"`
+            NameServers []string    `json:"name_servers"`
+        }   `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &zone); err != nil { return err }
+
+    cf.Config.Zone = zone.Result.ID
+    fmt.Printf("Created zone %s, point the registrar at %s\n", name, strings.Join(zone.Result.NameServers, ", "))
+    return nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- MIGRATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Exports the records, page rules and key settings of the current zone
+ */
+func (cf CF_c) ExportZone () (*CF_zone_export_t, error) {
+    name, err := cf.ZoneName()
+    if err != nil { return nil, err }
+    export := &CF_zone_export_t{Zone: name, Records: make([]map[string]interface{}, 0), PageRules: make([]map[string]interface{}, 0), Settings: make(map[string]interface{})}
+
+    cf.verboseMessage("Exporting domain records")
+    records, err := cf.rawDomainRecords()
+    if err != nil { return nil, err }
+    for _, rec := range(records) { export.Records = append(export.Records, keepFields(rec, cf_migrate_record_fields)) }
+
+    cf.verboseMessage("Exporting page rules")
+    resp, err := cf.request("pagerules", nil, nil)
+    if err != nil { return nil, err }
+    var rules struct {
+        Result  []map[string]interface{}    `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &rules); err != nil { return nil, err }
+    for _, rule := range(rules.Result) { export.PageRules = append(export.PageRules, keepFields(rule, cf_migrate_rule_fields)) }
+
+    cf.verboseMessage("Exporting zone settings")
+    resp, err = cf.request("settings", nil, nil)
+    if err != nil { return nil, err }
+    var settings struct {
+        Result  []struct {
+            ID      string      `json:"id"`
+            Value   interface{} `json:"value"`
+        }   `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &settings); err != nil { return nil, err }
+    for _, s := range(settings.Result) {
+        if hasString(cf_migrate_settings, s.ID) { export.Settings[s.ID] = s.Value }
+    }
+    return export, nil
+}
+
+/*! \brief Compares the current zone against the export, returning a line for everything missing or different
+ */
+func (cf CF_c) DiffZone (export *CF_zone_export_t) ([]string, error) {
+    current, err := cf.ExportZone()
+    if err != nil { return nil, err }
+    return diffExport(current, export), nil
+}
+
+/*! \brief Recreates the export in the zone with the same name in this account, creating the zone when it doesn't exist yet
+ *  Anything already matching is left alone, so it's safe to run again.  Returns the changes, with dryRun nothing is changed
+ */
+func (cf *CF_c) ImportZone (export *CF_zone_export_t, dryRun bool) ([]string, error) {
+    id, err := cf.discoverZone(export.Zone)
+    if err != nil { return nil, err }
+
+    current := &CF_zone_export_t{Settings: make(map[string]interface{})}
+    if len(id) > 0 {
+        cf.Config.Zone = id
+        if current, err = cf.ExportZone(); err != nil { return nil, err }
+    }
+
+    changes := diffExport(current, export)
+    if len(id) == 0 { changes = append([]string{"+ zone " + export.Zone}, changes...) }
+    if dryRun || len(changes) == 0 { return changes, nil }
+
+    if len(id) == 0 {
+        if err = cf.createZone(export.Zone); err != nil { return changes, err }
+    }
+
+    have := make(map[string]bool)
+    for _, rec := range(current.Records) { have[migrateKey(rec, "")] = true }
+    for _, rec := range(export.Records) {
+        if have[migrateKey(rec, "")] { continue }
+        cf.verboseMessage("Creating " + recordLine(rec))
+        jStr, _ := json.Marshal(rec)
+        if _, err = cf.request("dns_records", jStr, nil); err != nil { return changes, err }
+    }
+
+    have = make(map[string]bool)
+    for _, rule := range(current.PageRules) { have[migrateKey(rule, "priority")] = true }
+    for _, rule := range(export.PageRules) {
+        if have[migrateKey(rule, "priority")] { continue }
+        cf.verboseMessage("Creating page rule " + settingValue(rule["targets"]))
+        jStr, _ := json.Marshal(rule)
+        if _, err = cf.request("pagerules", jStr, nil); err != nil { return changes, err }
+    }
+
+    for name, value := range(export.Settings) {
+        if settingValue(value) == settingValue(current.Settings[name]) { continue }
+        cf.verboseMessage("Setting " + name)
+        jStr, _ := json.Marshal(map[string]interface{}{"value": value})
+        if _, err = cf.patchRequest("settings/" + name, jStr); err != nil { return changes, err }
+    }
+    return changes, nil
+}
@@ -0,0 +1,214 @@
+/*! \file cf_r2.go
+    \brief Cloud flare r2 buckets, along with their cors and lifecycle rules from the config
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "net/url"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type CF_r2_cors_t struct {
+    Origins     []string    `json:"origins"`
+    Methods     []string    `json:"methods"`
+    Headers     []string    `json:"headers,omitempty"`
+    MaxAge      int         `json:"max_age"`
+}
+
+/*! \brief Objects under the prefix are deleted once they're older than the number of days
+ */
+type CF_r2_lifecycle_t struct {
+    ID          string  `json:"id"`
+    Prefix      string  `json:"prefix"`
+    Days        int     `json:"days"`
+}
+
+/*! \brief Settings from the config for a bucket, these get applied when the bucket is created
+ */
+type CF_r2_bucket_config_t struct {
+    Location    string  `json:"location"`
+    Cors        []CF_r2_cors_t      `json:"cors"`
+    Lifecycle   []CF_r2_lifecycle_t `json:"lifecycle"`
+}
+
+type CF_r2_bucket_t struct {
+    Name        string  `json:"name"`
+    Created     string  `json:"creation_date"`
+    Location    string  `json:"location"`
+}
+
+type CF_r2_credentials_t struct {
+    AccessKeyID     string  `json:"accessKeyId"`
+    SecretKey       string  `json:"secretAccessKey"`
+    SessionToken    string  `json:"sessionToken"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Sets the cors rules for the bucket, replacing what's there
+ */
+func (cf CF_c) setBucketCors (bucket string, cors []CF_r2_cors_t) (err error) {
+    type rule_t struct {
+        Allowed struct {
+            Origins []string    `json:"origins"`
+            Methods []string    `json:"methods"`
+            Headers []string    `json:"headers,omitempty"`
+        }   `json:"allowed"`
+        MaxAge  int     `json:"maxAgeSeconds,omitempty"`
+    }
+
+    var body struct {
+        Rules   []rule_t    `json:"rules"`
+    }
+    for _, c := range(cors) {
+        rule := rule_t{MaxAge: c.MaxAge}
+        rule.Allowed.Origins, rule.Allowed.Methods, rule.Allowed.Headers = c.Origins, c.Methods, c.Headers
+        body.Rules = append(body.Rules, rule)
+    }
+
+    jStr, _ := json.Marshal(body)
+    _, err = cf.accountRequest("PUT", "r2/buckets/" + bucket + "/cors", jStr)
+    return
+}
+
+/*! \brief Sets the lifecycle rules for the bucket, replacing what's there
+ */
+func (cf CF_c) setBucketLifecycle (bucket string, lifecycle []CF_r2_lifecycle_t) (err error) {
+    type rule_t struct {
+        ID          string  `json:"id"`
+        Enabled     bool    `json:"enabled"`
+        Conditions  struct {
+            Prefix  string  `json:"prefix"`
+        }   `json:"conditions"`
+        Delete      struct {
+            Condition struct {
+                Type    string  `json:"type"`
+                MaxAge  int     `json:"maxAge"`
+            }   `json:"condition"`
+        }   `json:"deleteObjectsTransition"`
+    }
+
+    var body struct {
+        Rules   []rule_t    `json:"rules"`
+    }
+    for i, l := range(lifecycle) {
+        rule := rule_t{ID: l.ID, Enabled: true}
+        if len(rule.ID) == 0 { rule.ID = fmt.Sprintf("rule-%d", i + 1) }
+        rule.Conditions.Prefix = l.Prefix
+        rule.Delete.Condition.Type = "Age"
+        rule.Delete.Condition.MaxAge = l.Days * 86400
+        body.Rules = append(body.Rules, rule)
+    }
+
+    jStr, _ := json.Marshal(body)
+    _, err = cf.accountRequest("PUT", "r2/buckets/" + bucket + "/lifecycle", jStr)
+    return
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- R2 FUNCTIONS ------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the r2 buckets on the account
+ */
+func (cf CF_c) ListBuckets () ([]CF_r2_bucket_t, error) {
+    resp, err := cf.accountRequest("GET", "r2/buckets?per_page=1000", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Result  struct {
+            Buckets     []CF_r2_bucket_t    `json:"buckets"`
+        }   `json:"result"`
+    }
+    err = json.Unmarshal(resp, &list)
+    return list.Result.Buckets, err
+}
+
+/*! \brief Creates the bucket if it doesn't already exist, then applies the cors and lifecycle rules from the config
+ */
+func (cf CF_c) CreateBucket (name string) error {
+    name = strings.ToLower(name)
+    buckets, err := cf.ListBuckets()
+    if err != nil { return err }
+
+    exists := false
+    for _, b := range(buckets) {
+        if b.Name == name { exists = true }
+    }
+
+    settings := cf.Config.R2[name]
+    if exists {
+        cf.verboseMessage("Bucket already exists")
+    } else {
+        cf.verboseMessage("Bucket does not exist, creating...")
+        jStr, _ := json.Marshal(struct {
+            Name        string  `json:"name"`
+            Location    string  `json:"locationHint,omitempty"`
+        }{name, settings.Location})
+        if _, err = cf.accountRequest("POST", "r2/buckets", jStr); err != nil { return err }
+    }
+
+    if len(settings.Cors) > 0 {
+        cf.verboseMessage("Setting bucket cors rules")
+        if err = cf.setBucketCors(name, settings.Cors); err != nil { return err }
+    }
+    if len(settings.Lifecycle) > 0 {
+        cf.verboseMessage("Setting bucket lifecycle rules")
+        err = cf.setBucketLifecycle(name, settings.Lifecycle)
+    }
+    return err
+}
+
+/*! \brief Deletes the bucket, cloud flare requires it to be empty first
+ */
+func (cf CF_c) DeleteBucket (name string) error {
+    _, err := cf.accountRequest("DELETE", "r2/buckets/" + strings.ToLower(name), nil)
+    if cfNotFound(err) {
+        cf.verboseMessage("Bucket does not exist, nothing to do...")
+        return nil
+    }
+    return err
+}
+
+/*! \brief Uploads the data to the key in the bucket, replacing whatever was there
+ */
+func (cf CF_c) UploadObject (bucket, key string, data []byte, contentType string) error {
+    if len(cf.Config.Account) == 0 { return fmt.Errorf("Cloud Flare account_id not set in the config") }
+    parts := strings.Split(strings.TrimPrefix(key, "/"), "/")
+    for i := range(parts) { parts[i] = url.PathEscape(parts[i]) }
+    _, err := cf.sendType("PUT", fmt.Sprintf("%s/accounts/%s/r2/buckets/%s/objects/%s", cf_api_url, cf.Config.Account, strings.ToLower(bucket), strings.Join(parts, "/")), data, contentType)
+    return err
+}
+
+/*! \brief Generates temporary s3 credentials scoped to the bucket, signed by the r2 access key from the config
+ *  permission is one of admin-read-write, admin-read-only, object-read-write or object-read-only
+ */
+func (cf CF_c) BucketCredentials (bucket, permission string, ttl time.Duration) (*CF_r2_credentials_t, error) {
+    if len(cf.Config.R2AccessKey) == 0 { return nil, fmt.Errorf("Cloud Flare r2_access_key_id not set in the config") }
+
+    jStr, _ := json.Marshal(struct {
+        Bucket      string  `json:"bucket"`
+        ParentKey   string  `json:"parentAccessKeyId"`
+        Permission  string  `json:"permission"`
+        TTL         int     `json:"ttlSeconds"`
+    }{strings.ToLower(bucket), cf.Config.R2AccessKey, permission, int(ttl.Seconds())})
+
+    resp, err := cf.accountRequest("POST", "r2/temp-access-credentials", jStr)
+    if err != nil { return nil, err }
+
+    var creds struct {
+        Result  CF_r2_credentials_t     `json:"result"`
+    }
+    err = json.Unmarshal(resp, &creds)
+    return &creds.Result, err
+}
@@ -0,0 +1,130 @@
+/*! \file cf_spectrum.go
+    \brief Cloud flare spectrum apps, proxying tcp and udp on ports that aren't http so things like game servers get ddos protection
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "net"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type CF_spectrum_app_t struct {
+    ID          string      `json:"id,omitempty"`
+    Protocol    string      `json:"protocol"`    //ie 'tcp/25565' or 'udp/27015-27030'
+    DNS         struct {
+        Type        string  `json:"type"`
+        Name        string  `json:"name"`
+    }   `json:"dns"`
+    OriginDirect    []string    `json:"origin_direct"`  //ie 'tcp://192.0.2.1:25565'
+    IPFirewall  bool        `json:"ip_firewall"`
+    ProxyProtocol   string  `json:"proxy_protocol,omitempty"`
+    TrafficType string      `json:"traffic_type,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the spectrum app for the hostname, nil if it doesn't exist
+ */
+func (cf CF_c) getSpectrumApp (hostname string) (*CF_spectrum_app_t, error) {
+    apps, err := cf.ListSpectrumApps()
+    if err == nil {
+        for _, app := range(apps) {
+            if strings.EqualFold(app.DNS.Name, hostname) { return &app, nil }
+        }
+    }
+    return nil, err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- SPECTRUM FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the spectrum apps for the zone
+ */
+func (cf CF_c) ListSpectrumApps () ([]CF_spectrum_app_t, error) {
+    apps := make([]CF_spectrum_app_t, 0)
+    for page := 1; page > 0; {
+        resp, err := cf.request(fmt.Sprintf("spectrum/apps?page=%d&per_page=50", page), nil, nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            ResultInfo  struct {
+                TotalPages  int     `json:"total_pages"`
+            }   `json:"result_info"`
+            Result  []CF_spectrum_app_t     `json:"result"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        apps = append(apps, list.Result...)
+        if list.ResultInfo.TotalPages > page {
+            page++
+        } else {
+            page = 0    //we're done
+        }
+    }
+    return apps, nil
+}
+
+/*! \brief Creates or updates the spectrum app for the hostname, sending protocol traffic on the ports straight to the ip
+ *  protocol is tcp or udp, and ports is a single port or a range, ie '27015-27030'
+ */
+func (cf CF_c) AssignSpectrumApp (hostname, protocol, ports, ip string) (*CF_spectrum_app_t, error) {
+    protocol, hostname = strings.ToLower(protocol), strings.ToLower(hostname)
+    if protocol != "tcp" && protocol != "udp" { return nil, fmt.Errorf("Spectrum protocol has to be tcp or udp, not '%s'", protocol) }
+    if net.ParseIP(ip) == nil { return nil, fmt.Errorf("Invalid origin ip address '%s'", ip) }
+
+    origin := ip
+    if strings.Contains(ip, ":") { origin = "[" + ip + "]" }    //ipv6
+
+    app := CF_spectrum_app_t{Protocol: protocol + "/" + ports, OriginDirect: []string{fmt.Sprintf("%s://%s:%s", protocol, origin, ports)}, IPFirewall: true, ProxyProtocol: "off", TrafficType: "direct"}
+    app.DNS.Type, app.DNS.Name = "CNAME", hostname
+
+    existing, err := cf.getSpectrumApp(hostname)
+    if err != nil { return nil, err }
+
+    jStr, _ := json.Marshal(app)
+    var resp []byte
+    if existing == nil {
+        cf.verboseMessage("Spectrum app does not exist, creating...")
+        resp, err = cf.request("spectrum/apps", jStr, nil)
+    } else if existing.Protocol == app.Protocol && strings.Join(existing.OriginDirect, ",") == strings.Join(app.OriginDirect, ",") {
+        cf.verboseMessage("Spectrum app already exists and is correct")
+        return existing, nil
+    } else {
+        cf.verboseMessage("Spectrum app already exists, updating")
+        resp, err = cf.request("spectrum/apps/" + existing.ID, nil, jStr)
+    }
+    if err != nil { return nil, err }
+
+    var result struct {
+        Result  CF_spectrum_app_t   `json:"result"`
+    }
+    err = json.Unmarshal(resp, &result)
+    return &result.Result, err
+}
+
+/*! \brief Deletes the spectrum app for the hostname
+ */
+func (cf CF_c) DeleteSpectrumApp (hostname string) error {
+    app, err := cf.getSpectrumApp(hostname)
+
+    if err == nil {
+        if app == nil {  //it doesn't exist, so we're good
+            cf.verboseMessage("Spectrum app does not exist, nothing to do...")
+        } else {
+            cf.verboseMessage("Deleting spectrum app " + hostname)
+            err = cf.deleteRequest("spectrum/apps/" + app.ID)
+        }
+    }
+
+    return err
+}
@@ -0,0 +1,168 @@
+/*! \file cf_tunnel.go
+    \brief Cloud flare tunnels, so droplets can serve traffic without any public ports open
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net/url"
+    "encoding/json"
+    "encoding/base64"
+    "crypto/rand"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const cf_tunnel_domain      = "cfargotunnel.com"
+const cf_cloudflared_deb    = "https://github.com/cloudflare/cloudflared/releases/latest/download/cloudflared-linux-amd64.deb"
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type CF_tunnel_t struct {
+    ID          string  `json:"id"`
+    Name        string  `json:"name"`
+    Created     string  `json:"created_at"`
+    Secret      string  `json:"-"`     //only known when we create the tunnel
+}
+
+type cf_ingress_t struct {
+    Hostname    string  `json:"hostname,omitempty"`
+    Service     string  `json:"service"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the tunnel by its name, nil if it doesn't exist
+ */
+func (cf CF_c) getTunnel (name string) (*CF_tunnel_t, error) {
+    resp, err := cf.accountRequest("GET", "cfd_tunnel?is_deleted=false&name=" + url.QueryEscape(name), nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Result  []CF_tunnel_t   `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+    for _, t := range(list.Result) {
+        if strings.EqualFold(t.Name, name) { return &t, nil }
+    }
+    return nil, nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- TUNNEL FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Creates the tunnel if it doesn't already exist
+ *  The secret is only set on new tunnels, it's what goes in the credentials file
+ */
+func (cf CF_c) CreateTunnel (name string) (*CF_tunnel_t, error) {
+    tunnel, err := cf.getTunnel(name)
+    if err != nil { return nil, err }
+    if tunnel != nil {
+        cf.verboseMessage("Tunnel already exists")
+        return tunnel, nil
+    }
+
+    cf.verboseMessage("Tunnel does not exist, creating...")
+    secret := make([]byte, 32)
+    if _, err = rand.Read(secret); err != nil { return nil, err }
+
+    jStr, _ := json.Marshal(struct {
+        Name        string  `json:"name"`
+        Secret      string  `json:"tunnel_secret"`
+        ConfigSrc   string  `json:"config_src"`
+    }{name, base64.StdEncoding.EncodeToString(secret), "cloudflare"})
+
+    resp, err := cf.accountRequest("POST", "cfd_tunnel", jStr)
+    if err != nil { return nil, err }
+
+    var created struct {
+        Result  CF_tunnel_t     `json:"result"`
+    }
+    err = json.Unmarshal(resp, &created)
+    created.Result.Secret = base64.StdEncoding.EncodeToString(secret)
+    return &created.Result, err
+}
+
+/*! \brief The credentials file cloudflared needs to run the tunnel, only possible right after creating it
+ */
+func (cf CF_c) TunnelCredentials (tunnel *CF_tunnel_t) ([]byte, error) {
+    if len(tunnel.Secret) == 0 { return nil, fmt.Errorf("Tunnel secret is only known when the tunnel is created") }
+
+    return json.MarshalIndent(struct {
+        AccountTag      string
+        TunnelSecret    string
+        TunnelID        string
+    }{cf.Config.Account, tunnel.Secret, tunnel.ID}, "", "  ")
+}
+
+/*! \brief Gets the token used to install the connector as a service
+ */
+func (cf CF_c) TunnelToken (tunnel *CF_tunnel_t) (string, error) {
+    resp, err := cf.accountRequest("GET", "cfd_tunnel/" + tunnel.ID + "/token", nil)
+    if err != nil { return "", err }
+
+    var token struct {
+        Result  string  `json:"result"`
+    }
+    err = json.Unmarshal(resp, &token)
+    return token.Result, err
+}
+
+/*! \brief Sends traffic for the hostname to the service through the tunnel, ie 'http://localhost:80'
+ *  Other hostnames already on the tunnel are left alone
+ */
+func (cf CF_c) RouteTunnel (tunnel *CF_tunnel_t, hostname, service string) error {
+    hostname = strings.ToLower(hostname)
+    resp, err := cf.accountRequest("GET", "cfd_tunnel/" + tunnel.ID + "/configurations", nil)
+    if err != nil && !cfNotFound(err) { return err }
+
+    var current struct {
+        Result  struct {
+            Config  struct {
+                Ingress     []cf_ingress_t  `json:"ingress"`
+            }   `json:"config"`
+        }   `json:"result"`
+    }
+    if len(resp) > 0 {
+        if err = json.Unmarshal(resp, &current); err != nil { return err }
+    }
+
+    //keep every other hostname, the catch-all always has to be last
+    ingress := []cf_ingress_t{ {Hostname: hostname, Service: service} }
+    for _, rule := range(current.Result.Config.Ingress) {
+        if len(rule.Hostname) > 0 && rule.Hostname != hostname { ingress = append(ingress, rule) }
+    }
+    ingress = append(ingress, cf_ingress_t{Service: "http_status:404"})
+
+    var config struct {
+        Config  struct {
+            Ingress     []cf_ingress_t  `json:"ingress"`
+        }   `json:"config"`
+    }
+    config.Config.Ingress = ingress
+    jStr, _ := json.Marshal(config)
+    _, err = cf.accountRequest("PUT", "cfd_tunnel/" + tunnel.ID + "/configurations", jStr)
+    return err
+}
+
+/*! \brief Points the sub domain at the tunnel
+ */
+func (cf CF_c) AssignTunnelRecord (subDomain string, tunnel *CF_tunnel_t) error {
+    return cf.AssignProxiedDomainRecord("CNAME", subDomain, fmt.Sprintf("%s.%s", tunnel.ID, cf_tunnel_domain))
+}
+
+/*! \brief Cloud-init script that installs the connector as a service on a new debian/ubuntu node
+ */
+func TunnelUserData (token string) string {
+    return fmt.Sprintf("#!/bin/bash\ncurl -sL --output /tmp/cloudflared.deb %s\ndpkg -i /tmp/cloudflared.deb\ncloudflared service install %s\n", cf_cloudflared_deb, token)
+}
@@ -0,0 +1,118 @@
+/*! \file chaos.go
+    \brief Injects failures into the api traffic, so the scripts wrapping us can be tested against errors, rate limits and slow responses
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "errors"
+    "io/ioutil"
+    "math/rand"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Sits in front of the http transport, the rates are the chance from 0 to 1 that a request gets each failure
+ */
+type Chaos_t struct {
+    Fail        float64         //500 responses
+    Throttle    float64         //429 responses with a retry-after
+    Error       float64         //the connection fails, no response at all
+    Delay       time.Duration   //requests are held up to this long before going out
+    rand        *rand.Rand
+    lock        sync.Mutex
+    next        http.RoundTripper
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func (c *Chaos_t) roll () float64 {
+    c.lock.Lock()
+    defer c.lock.Unlock()
+    return c.rand.Float64()
+}
+
+/*! \brief Response made up on the spot, it never reaches the api
+ */
+func chaosResponse (req *http.Request, code int, msg string) *http.Response {
+    resp := &http.Response{StatusCode: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code)), Header: http.Header{}, Request: req,
+        Body: ioutil.NopCloser(strings.NewReader(fmt.Sprintf(`{"id":"chaos","message":"%s"}`, msg)))}
+    resp.Header.Set("Content-Type", "application/json")
+    if code == http.StatusTooManyRequests { resp.Header.Set("Retry-After", "1") }
+    return resp
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CHAOS FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Builds the chaos from the spec, ie 'fail=0.1,429=0.05,error=0.02,delay=2s,seed=7'.  Without a seed every run is different
+ *  It wraps whatever the default transport is now, so the recorder sees what actually went out
+ */
+func NewChaos (spec string) (*Chaos_t, error) {
+    c := &Chaos_t{next: http.DefaultTransport}
+    seed := time.Now().UnixNano()
+
+    for _, part := range(strings.Split(spec, ",")) {
+        kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+        if len(kv) != 2 { return nil, fmt.Errorf("Chaos setting '%s' should be name=value", part) }
+
+        var err error
+        switch kv[0] {
+        case "fail":    c.Fail, err = strconv.ParseFloat(kv[1], 64)
+        case "429":     c.Throttle, err = strconv.ParseFloat(kv[1], 64)
+        case "error":   c.Error, err = strconv.ParseFloat(kv[1], 64)
+        case "delay":   c.Delay, err = time.ParseDuration(kv[1])
+        case "seed":    seed, err = strconv.ParseInt(kv[1], 10, 64)
+        default:
+            return nil, fmt.Errorf("Unknown chaos setting '%s', expecting fail, 429, error, delay or seed", kv[0])
+        }
+        if err != nil { return nil, fmt.Errorf("Chaos setting '%s' :: %s", part, err.Error()) }
+    }
+
+    for _, rate := range([]float64{c.Fail, c.Throttle, c.Error}) {
+        if rate < 0 || rate > 1 { return nil, fmt.Errorf("Chaos rates are between 0 and 1") }
+    }
+    c.rand = rand.New(rand.NewSource(seed))
+    return c, nil
+}
+
+/*! \brief Holds the request up, then either fails it or passes it on
+ *  Only the provider api requests, a -health probe or an output post failing would be testing the wrong thing
+ */
+func (c *Chaos_t) RoundTrip (req *http.Request) (*http.Response, error) {
+    if !providerRequest(req) { return c.next.RoundTrip(req) }
+
+    if c.Delay > 0 {
+        timer := time.NewTimer(time.Duration(c.roll() * float64(c.Delay)))
+        select {
+        case <-timer.C:
+        case <-req.Context().Done():
+            timer.Stop()
+            return nil, req.Context().Err()
+        }
+    }
+
+    roll := c.roll()
+    if roll < c.Error + c.Throttle + c.Fail && req.Body != nil { req.Body.Close() }   //it's never sent, but we still own it
+
+    switch {
+    case roll < c.Error:
+        return nil, errors.New("chaos: connection reset")
+    case roll < c.Error + c.Throttle:
+        return chaosResponse(req, http.StatusTooManyRequests, "Too many requests, from chaos"), nil
+    case roll < c.Error + c.Throttle + c.Fail:
+        return chaosResponse(req, http.StatusInternalServerError, "Server error, from chaos"), nil
+    }
+    return c.next.RoundTrip(req)
+}
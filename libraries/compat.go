@@ -0,0 +1,329 @@
+/*! \file compat.go
+    \brief Keeping up with the apis changing under us, shims that fix up responses before they're decoded and a check that probes for drift
+ *  When a provider renames or drops a field the fix goes in here as a shim, instead of in every place that decodes it
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "bytes"
+    "encoding/json"
+    "sort"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_api_version        = "v2"
+const cf_api_version        = "v4"
+
+/*! \brief Shims by the kind of item they fix, the items are already generic json when they get here
+ */
+var compat_shims = map[string][]compat_shim_t {
+    "droplet":      { { "size_slug from size.slug", shimDropletSize } },
+    "size":         { { "price_monthly from price_hourly", shimSizePrice } },
+    "cf_record":    { { "zone_name from the zone", shimRecordZone } },
+}
+
+/*! \brief Which kind the items under a digital ocean list field are
+ */
+var compat_fields = map[string]string {
+    "droplets":     "droplet",
+    "droplet":      "droplet",
+    "sizes":        "size",
+}
+
+/*! \brief The old memory-only size slugs, and the basic size that replaced each of them
+ */
+var do_legacy_sizes = map[string]string {
+    "512mb":    "s-1vcpu-512mb-10gb",
+    "1gb":      "s-1vcpu-1gb",
+    "2gb":      "s-1vcpu-2gb",
+    "4gb":      "s-2vcpu-4gb",
+    "8gb":      "s-4vcpu-8gb",
+    "16gb":     "s-8vcpu-16gb",
+    "32gb":     "s-8vcpu-32gb",
+}
+
+/*! \brief The endpoints we depend on and the fields we read from them, a [] in the path is each item of a list
+ */
+var do_compat_probes = []compat_probe_t {
+    { "account", "", "", []string{ "account.droplet_limit:number", "account.status:string" } },
+    { "sizes?per_page=1", "sizes", "size", []string{ "sizes[].slug:string", "sizes[].memory:number", "sizes[].vcpus:number", "sizes[].disk:number",
+        "sizes[].price_monthly:number", "sizes[].available:bool", "sizes[].regions:array" } },
+    { "regions?per_page=1", "regions", "", []string{ "regions[].slug:string", "regions[].available:bool", "regions[].sizes:array" } },
+    { "droplets?per_page=1", "droplets", "droplet", []string{ "droplets[].id:number", "droplets[].name:string", "droplets[].status:string",
+        "droplets[].size_slug:string", "droplets[].tags:array", "droplets[].region.slug:string", "droplets[].networks.v4:array", "links:object" } },
+    { "floating_ips?per_page=1", "floating_ips", "", []string{ "floating_ips[].ip:string" } },
+    { "domains?per_page=1", "domains", "", []string{ "domains[].name:string" } },
+}
+
+var cf_compat_probes = []compat_probe_t {
+    { "zones?per_page=1", "result", "", []string{ "result[].id:string", "result[].name:string", "result_info.total_pages:number" } },
+    { "dns_records?per_page=1", "result", "cf_record", []string{ "result[].id:string", "result[].type:string", "result[].name:string",
+        "result[].content:string", "result[].proxied:bool", "result[].ttl:number", "result[].zone_name:string", "result_info.total_pages:number" } },
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Fixes up one item, returning true when it changed something.  hint looks up things the item doesn't know, ie its zone's name
+ */
+type compat_shim_t struct {
+    Name    string
+    Fix     func (item map[string]interface{}, hint func (string) string) bool
+}
+
+type compat_probe_t struct {
+    Path    string
+    Field   string      //where the list is, for the shims
+    Kind    string      //which shims apply
+    Fields  []string    //path:type, the type being string, number, bool, array or object
+}
+
+/*! \brief How one endpoint looked against what we expect from it
+ */
+type Compat_t struct {
+    Provider    string  `json:"provider"`
+    Endpoint    string  `json:"endpoint"`
+    Result      string  `json:"result"`    //ok, shimmed, drift or error
+    Detail      string  `json:"detail"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func shimDropletSize (item map[string]interface{}, hint func (string) string) bool {
+    if _, ok := item["size_slug"].(string); ok { return false }
+    size, _ := item["size"].(map[string]interface{})
+    slug, ok := size["slug"].(string)
+    if !ok { return false }
+    item["size_slug"] = slug
+    return true
+}
+
+func shimSizePrice (item map[string]interface{}, hint func (string) string) bool {
+    if _, ok := item["price_monthly"]; ok { return false }
+    hourly, ok := item["price_hourly"].(json.Number)
+    if !ok { return false }
+    h, err := hourly.Float64()
+    if err != nil { return false }
+    item["price_monthly"] = json.Number(fmt.Sprintf("%.2f", h * 672))     //digital ocean caps a month at 672 hours
+    return true
+}
+
+/*! \brief Records stopped carrying their zone's name, it's how we match a sub domain to its record
+ */
+func shimRecordZone (item map[string]interface{}, hint func (string) string) bool {
+    if name, ok := item["zone_name"].(string); ok && len(name) > 0 { return false }
+    if hint == nil { return false }
+    zone := hint("zone_name")
+    if len(zone) == 0 { return false }
+    item["zone_name"] = zone
+    return true
+}
+
+/*! \brief Parses keeping the numbers as they were, so ids don't go through a float on their way back out
+ */
+func compatParse (data []byte) (interface{}, error) {
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+    var doc interface{}
+    err := dec.Decode(&doc)
+    return doc, err
+}
+
+/*! \brief Runs the kind's shims over the item, or each item when it's a list.  applied collects the names of the ones that did something
+ */
+func compatFix (kind string, value interface{}, hint func (string) string, applied map[string]bool) (changed bool) {
+    shims := compat_shims[kind]
+    items, ok := value.([]interface{})
+    if !ok { items = []interface{}{ value } }
+    for _, it := range(items) {
+        item, ok := it.(map[string]interface{})
+        if !ok { continue }
+        for _, shim := range(shims) {
+            if shim.Fix(item, hint) {
+                changed = true
+                if applied != nil { applied[shim.Name] = true }
+            }
+        }
+    }
+    return
+}
+
+/*! \brief Decodes the response into v, after the kind's shims have fixed up what's under field.  Everything that reads a shimmed kind comes through here
+ */
+func compatDecode (kind string, body []byte, field string, v interface{}, hint func (string) string) error {
+    if len(compat_shims[kind]) > 0 {
+        if doc, err := compatParse(body); err == nil {
+            if m, ok := doc.(map[string]interface{}); ok && compatFix(kind, m[field], hint, nil) {
+                body, _ = json.Marshal(m)
+            }
+        }
+    }
+    return json.Unmarshal(body, v)
+}
+
+/*! \brief Same as compatDecode for a single item out of a list
+ */
+func compatItem (kind string, item json.RawMessage, hint func (string) string) json.RawMessage {
+    if len(compat_shims[kind]) == 0 { return item }
+    doc, err := compatParse(item)
+    if err != nil || !compatFix(kind, doc, hint, nil) { return item }
+    fixed, _ := json.Marshal(doc)
+    return fixed
+}
+
+/*! \brief The values at the path, a missing key anywhere along it is reported as the part that's missing
+ */
+func compatWalk (value interface{}, path []string) (found []interface{}, missing string) {
+    if len(path) == 0 { return []interface{}{ value }, "" }
+    key, list := strings.TrimSuffix(path[0], "[]"), strings.HasSuffix(path[0], "[]")
+    m, ok := value.(map[string]interface{})
+    if !ok { return nil, key }
+    next, ok := m[key]
+    if !ok { return nil, key }
+    if !list { return compatWalk(next, path[1:]) }
+
+    items, ok := next.([]interface{})
+    if !ok { return nil, key }
+    for _, item := range(items) {
+        f, miss := compatWalk(item, path[1:])
+        if len(miss) > 0 { return nil, miss }
+        found = append(found, f...)
+    }
+    return
+}
+
+func compatType (value interface{}) string {
+    switch value.(type) {
+    case string:                    return "string"
+    case json.Number:               return "number"
+    case bool:                      return "bool"
+    case []interface{}:             return "array"
+    case map[string]interface{}:    return "object"
+    case nil:                       return "null"
+    }
+    return "unknown"
+}
+
+/*! \brief Checks a probed response against the fields we expect, after the shims have had their go at it
+ */
+func compatCheck (provider, endpoint string, probe compat_probe_t, body []byte, hint func (string) string) Compat_t {
+    result := Compat_t{Provider: provider, Endpoint: endpoint, Result: "ok"}
+    doc, err := compatParse(body)
+    if err != nil {
+        result.Result, result.Detail = "error", "response isn't json :: " + err.Error()
+        return result
+    }
+
+    applied := make(map[string]bool)
+    if m, ok := doc.(map[string]interface{}); ok && len(probe.Kind) > 0 { compatFix(probe.Kind, m[probe.Field], hint, applied) }
+
+    drift := make([]string, 0)
+    for _, f := range(probe.Fields) {
+        parts := strings.SplitN(f, ":", 2)
+        found, missing := compatWalk(doc, strings.Split(parts[0], "."))
+        if len(missing) > 0 {
+            drift = append(drift, fmt.Sprintf("%s is missing", parts[0]))
+            continue
+        }
+        for _, v := range(found) {
+            if t := compatType(v); t != parts[1] {
+                drift = append(drift, fmt.Sprintf("%s is %s not %s", parts[0], t, parts[1]))
+                break
+            }
+        }
+    }
+
+    shims := make([]string, 0, len(applied))
+    for name := range(applied) { shims = append(shims, name) }
+    sort.Strings(shims)
+    switch {
+    case len(drift) > 0:
+        result.Result, result.Detail = "drift", strings.Join(drift, ", ")
+    case len(shims) > 0:
+        result.Result, result.Detail = "shimmed", strings.Join(shims, ", ")
+    }
+    return result
+}
+
+/*! \brief Swaps a retired legacy size slug for the one that replaced it, as long as the old one really is gone
+ */
+func (do DO_c) compatSize (size string) string {
+    next, ok := do_legacy_sizes[size]
+    if !ok { return size }
+    sizes, err := do.getSizes()
+    if err != nil { return size }   //checkCapacity reports it
+    for _, s := range(sizes) {
+        if s.Slug == size && s.Available { return size }
+    }
+    if do.Verbose { fmt.Printf("Size '%s' has been retired, using '%s'\n", size, next) }
+    return next
+}
+
+/*! \brief Looks the zone's name up the first time a record needs it
+ */
+func (cf CF_c) recordHint () func (string) string {
+    var zone *string
+    return func (name string) string {
+        if name != "zone_name" { return "" }
+        if zone == nil {
+            n, _ := cf.ZoneName()
+            zone = &n
+        }
+        return *zone
+    }
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- COMPAT FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Probes the digital ocean endpoints we depend on, warning about fields that have gone missing or changed type
+ */
+func (do DO_c) CompatCheck () []Compat_t {
+    version := do.Config.APIVersion
+    if len(version) == 0 { version = do_api_version }
+    results := make([]Compat_t, 0, len(do_compat_probes))
+    for _, probe := range(do_compat_probes) {
+        endpoint := version + "/" + strings.SplitN(probe.Path, "?", 2)[0]
+        resp, err := do.send("GET", probe.Path, nil)
+        if err != nil {
+            results = append(results, Compat_t{Provider: "digitalocean", Endpoint: endpoint, Result: "error", Detail: err.Error()})
+            continue
+        }
+        results = append(results, compatCheck("digitalocean", endpoint, probe, resp, nil))
+    }
+    return results
+}
+
+/*! \brief Probes the cloud flare endpoints we depend on, the records are from the default zone
+ */
+func (cf CF_c) CompatCheck () []Compat_t {
+    version := cf.Config.APIVersion
+    if len(version) == 0 { version = cf_api_version }
+    results := make([]Compat_t, 0, len(cf_compat_probes))
+    for _, probe := range(cf_compat_probes) {
+        endpoint := version + "/" + strings.SplitN(probe.Path, "?", 2)[0]
+        var resp []byte
+        var err error
+        if strings.HasPrefix(probe.Path, "zones") {
+            resp, err = cf.send("GET", cf_api_url + "/" + probe.Path, nil)
+        } else {
+            resp, err = cf.request(probe.Path, nil, nil)
+        }
+        if err != nil {
+            results = append(results, Compat_t{Provider: "cloudflare", Endpoint: endpoint, Result: "error", Detail: err.Error()})
+            continue
+        }
+        results = append(results, compatCheck("cloudflare", endpoint, probe, resp, cf.recordHint()))
+    }
+    return results
+}
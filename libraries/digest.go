@@ -0,0 +1,115 @@
+/*! \file digest.go
+    \brief Hashes every api response a run gets, so a report can show what the run saw without keeping the responses themselves
+ *  The changes are noted too, with the provider's id for each request, so a support ticket can be matched up with the run
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "io"
+    "hash"
+    "net/http"
+    "sort"
+    "sync"
+    "time"
+    "crypto/sha256"
+    "encoding/hex"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Sits in front of the http transport, each response is hashed with its method, url and status as it's read
+ */
+type Digest_t struct {
+    hashes      []string
+    changes     []Digest_change_t
+    lock        sync.Mutex
+    next        http.RoundTripper
+}
+
+/*! \brief A request that changed something, anything but a GET
+ */
+type Digest_change_t struct {
+    Time        time.Time   `json:"time"`
+    Method      string      `json:"method"`
+    Url         string      `json:"url"`   //without the query
+    Status      int         `json:"status"`
+    RequestID   string      `json:"request_id,omitempty"`
+}
+
+/*! \brief Hashes the body as it's read, and adds the hash to the digest when it's closed
+ */
+type digest_body_t struct {
+    io.ReadCloser
+    h           hash.Hash
+    d           *Digest_t
+    done        bool
+}
+
+func (b *digest_body_t) Read (p []byte) (int, error) {
+    n, err := b.ReadCloser.Read(p)
+    b.h.Write(p[:n])
+    return n, err
+}
+
+func (b *digest_body_t) Close () error {
+    if !b.done {
+        b.done = true
+        io.Copy(b.h, b.ReadCloser)  //whatever the caller didn't read still counts
+        b.d.lock.Lock()
+        b.d.hashes = append(b.d.hashes, hex.EncodeToString(b.h.Sum(nil)))
+        b.d.lock.Unlock()
+    }
+    return b.ReadCloser.Close()
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- DIGEST FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Wraps whatever the default transport is now, like the budget
+ */
+func NewDigest () *Digest_t {
+    return &Digest_t{hashes: make([]string, 0), changes: make([]Digest_change_t, 0), next: http.DefaultTransport}
+}
+
+func (d *Digest_t) RoundTrip (req *http.Request) (*http.Response, error) {
+    resp, err := d.next.RoundTrip(req)
+    if err != nil { return resp, err }
+
+    if req.Method != "GET" && req.Method != "HEAD" {
+        d.lock.Lock()
+        d.changes = append(d.changes, Digest_change_t{Time: time.Now().UTC(), Method: req.Method, Url: req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+            Status: resp.StatusCode, RequestID: RequestID(resp.Header)})
+        d.lock.Unlock()
+    }
+
+    h := sha256.New()
+    fmt.Fprintf(h, "%s %s %d\n", req.Method, req.URL.String(), resp.StatusCode)
+    resp.Body = &digest_body_t{ReadCloser: resp.Body, h: h, d: d}
+    return resp, err
+}
+
+/*! \brief Number of responses and one hash over all of them.  They're sorted first, so requests running at the same time don't change it
+ */
+func (d *Digest_t) Sum () (int, string) {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+
+    hashes := append([]string{}, d.hashes...)
+    sort.Strings(hashes)
+    h := sha256.New()
+    for _, s := range(hashes) { fmt.Fprintln(h, s) }
+    return len(hashes), hex.EncodeToString(h.Sum(nil))
+}
+
+/*! \brief The requests that changed something, in the order they went out
+ */
+func (d *Digest_t) Changes () []Digest_change_t {
+    d.lock.Lock()
+    defer d.lock.Unlock()
+    return append([]Digest_change_t{}, d.changes...)
+}
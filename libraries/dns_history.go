@@ -0,0 +1,242 @@
+/*! \file dns_history.go
+    \brief Keeping a copy of a zone every time we change it, so we can tell what a zone looked like on a date and what changed since
+ *  Each copy is a json file under the history directory, and with git set the directory is a repo with a commit for each one
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "os"
+    "net/http"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "encoding/json"
+    "io/ioutil"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const dns_history_format    = "20060102T150405Z"    //file names, so they sort by time
+
+var dns_history_do_path     = regexp.MustCompile(`/domains/([^/]+)/records`)
+var dns_history_cf_path     = regexp.MustCompile(`/zones/([^/]+)/dns_records`)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The dns_history section of the config, nothing is kept when the directory isn't set
+ */
+type DNS_history_t struct {
+    Dir         string  `json:"dir"`
+    Git         bool    `json:"git"`   //commit each copy, the directory is made a repo when it isn't one
+}
+
+type DNS_zone_record_t struct {
+    Type        string  `json:"type"`
+    Name        string  `json:"name"`
+    Content     string  `json:"content"`
+    Proxied     bool    `json:"proxied,omitempty"`
+}
+
+/*! \brief A zone at a point in time, provider is digital_ocean or cloud_flare
+ */
+type DNS_zone_snapshot_t struct {
+    Time        time.Time   `json:"time"`
+    Provider    string      `json:"provider"`
+    Zone        string      `json:"zone"`
+    By          string      `json:"by,omitempty"`    //who ran harbormaster, empty when the change was found by -dnshistory and made somewhere else
+    Records     []DNS_zone_record_t     `json:"records"`
+}
+
+/*! \brief A record that's different between two snapshots, the change is added, removed or changed
+ */
+type DNS_zone_change_t struct {
+    Change      string  `json:"change"`
+    Type        string  `json:"type"`
+    Name        string  `json:"name"`
+    Before      string  `json:"before,omitempty"`
+    After       string  `json:"after,omitempty"`
+}
+
+/*! \brief Sits in front of the http transport and notes the zones a run changes records in, so they can be saved at the end
+ */
+type ZoneWatch_t struct {
+    DO          map[string]bool     //domains
+    CF          map[string]bool     //zone ids
+    lock        sync.Mutex
+    next        http.RoundTripper
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Where the copies of the zone go
+ */
+func (h DNS_history_t) zoneDir (provider, zone string) string {
+    return filepath.Join(h.Dir, provider, strings.ToLower(zone))
+}
+
+/*! \brief What's on each record for the changes, the content and if cloud flare proxies it
+ */
+func (r DNS_zone_record_t) value () string {
+    if r.Proxied { return r.Content + " (proxied)" }
+    return r.Content
+}
+
+func sortZoneRecords (records []DNS_zone_record_t) {
+    sort.Slice(records, func (i, j int) bool {
+        a, b := records[i], records[j]
+        if a.Name != b.Name { return a.Name < b.Name }
+        if a.Type != b.Type { return a.Type < b.Type }
+        return a.Content < b.Content
+    })
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- HISTORY FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The zone's records as they are now, for a history snapshot
+ */
+func (do DO_c) ZoneSnapshot (domain string) (*DNS_zone_snapshot_t, error) {
+    records, err := do.listDomainRecords(strings.ToLower(domain))
+    if err != nil { return nil, err }
+
+    snap := &DNS_zone_snapshot_t{Time: time.Now().UTC(), Provider: "digital_ocean", Zone: strings.ToLower(domain), Records: make([]DNS_zone_record_t, 0, len(records))}
+    for _, r := range(records) { snap.Records = append(snap.Records, DNS_zone_record_t{Type: r.Type, Name: r.Name, Content: r.Data}) }
+    sortZoneRecords(snap.Records)
+    return snap, nil
+}
+
+/*! \brief The current zone's records as they are now, for a history snapshot
+ */
+func (cf CF_c) ZoneSnapshot () (*DNS_zone_snapshot_t, error) {
+    name, err := cf.ZoneName()
+    if err != nil { return nil, err }
+
+    snap := &DNS_zone_snapshot_t{Time: time.Now().UTC(), Provider: "cloud_flare", Zone: name, Records: make([]DNS_zone_record_t, 0)}
+    err = cf.EachDomainRecord(func (rec CF_record_t) bool {
+        snap.Records = append(snap.Records, DNS_zone_record_t{Type: rec.Type, Name: rec.Name, Content: rec.Content, Proxied: rec.Proxied})
+        return true
+    })
+    if err != nil { return nil, err }
+    sortZoneRecords(snap.Records)
+    return snap, nil
+}
+
+/*! \brief Times of the snapshots we have of the zone, oldest first
+ */
+func (h DNS_history_t) Snapshots (provider, zone string) ([]time.Time, error) {
+    files, err := filepath.Glob(filepath.Join(h.zoneDir(provider, zone), "*.json"))
+    if err != nil { return nil, err }
+
+    times := make([]time.Time, 0, len(files))
+    for _, f := range(files) {
+        if t, err := time.Parse(dns_history_format, strings.TrimSuffix(filepath.Base(f), ".json")); err == nil { times = append(times, t) }
+    }
+    sort.Slice(times, func (i, j int) bool { return times[i].Before(times[j]) })
+    return times, nil
+}
+
+/*! \brief The newest snapshot of the zone from at or before the time, nil when there isn't one that old
+ */
+func (h DNS_history_t) At (provider, zone string, at time.Time) (*DNS_zone_snapshot_t, error) {
+    times, err := h.Snapshots(provider, zone)
+    if err != nil { return nil, err }
+
+    for i := len(times) - 1; i >= 0; i-- {
+        if times[i].After(at) { continue }
+        loc := filepath.Join(h.zoneDir(provider, zone), times[i].Format(dns_history_format) + ".json")
+        data, err := ioutil.ReadFile(loc)
+        if err != nil { return nil, fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+
+        snap := &DNS_zone_snapshot_t{}
+        if err = json.Unmarshal(data, snap); err != nil { return nil, fmt.Errorf("Invalid snapshot file '%s' :: %s", loc, err.Error()) }
+        return snap, nil
+    }
+    return nil, nil
+}
+
+/*! \brief Saves the snapshot, unless the zone looks the same as the last time.  Returns true when it was saved
+ */
+func (h DNS_history_t) Save (snap *DNS_zone_snapshot_t) (bool, error) {
+    if len(h.Dir) == 0 { return false, fmt.Errorf("No dir in the dns_history section of the config") }
+
+    last, err := h.At(snap.Provider, snap.Zone, snap.Time)
+    if err != nil { return false, err }
+    if last != nil && len(DiffZones(last, snap)) == 0 { return false, nil }
+
+    dir := h.zoneDir(snap.Provider, snap.Zone)
+    if err = os.MkdirAll(dir, 0755); err != nil { return false, fmt.Errorf("Unable to make '%s' :: %s", dir, err.Error()) }
+    loc := filepath.Join(dir, snap.Time.Format(dns_history_format) + ".json")
+    jStr, _ := json.MarshalIndent(snap, "", "  ")
+    if err = ioutil.WriteFile(loc, jStr, 0644); err != nil { return false, fmt.Errorf("Unable to write '%s' :: %s", loc, err.Error()) }
+
+    if !h.Git { return true, nil }
+    msg := fmt.Sprintf("%s %s %d records", snap.Provider, snap.Zone, len(snap.Records))
+    if len(snap.By) > 0 { msg += ", by " + snap.By }
+    _, err = GitCommit(h.Dir, msg)
+    return true, err
+}
+
+/*! \brief What's different going from snapshot a to b.  Records with more than one value are matched up by their type and name
+ */
+func DiffZones (a, b *DNS_zone_snapshot_t) []DNS_zone_change_t {
+    values := func (snap *DNS_zone_snapshot_t) (map[string][]string, []string) {
+        m := make(map[string][]string)
+        keys := make([]string, 0)
+        for _, r := range(snap.Records) {
+            key := r.Type + " " + r.Name
+            if _, ok := m[key]; !ok { keys = append(keys, key) }
+            m[key] = append(m[key], r.value())
+        }
+        return m, keys
+    }
+    before, keys := values(a)
+    after, bKeys := values(b)
+    for _, k := range(bKeys) {
+        if _, ok := before[k]; !ok { keys = append(keys, k) }
+    }
+    sort.Strings(keys)
+
+    changes := make([]DNS_zone_change_t, 0)
+    for _, k := range(keys) {
+        parts := strings.SplitN(k, " ", 2)
+        was, now := strings.Join(before[k], " "), strings.Join(after[k], " ")
+        change := DNS_zone_change_t{Type: parts[0], Name: parts[1], Before: was, After: now}
+        switch {
+        case was == now:    continue
+        case len(was) == 0: change.Change = "added"
+        case len(now) == 0: change.Change = "removed"
+        default:            change.Change = "changed"
+        }
+        changes = append(changes, change)
+    }
+    return changes
+}
+
+/*! \brief Wraps whatever the default transport is now, like the budget
+ */
+func NewZoneWatch () *ZoneWatch_t {
+    return &ZoneWatch_t{DO: make(map[string]bool), CF: make(map[string]bool), next: http.DefaultTransport}
+}
+
+func (w *ZoneWatch_t) RoundTrip (req *http.Request) (*http.Response, error) {
+    resp, err := w.next.RoundTrip(req)
+    if err != nil || req.Method == "GET" || resp.StatusCode >= 300 { return resp, err }
+
+    w.lock.Lock()
+    if m := dns_history_do_path.FindStringSubmatch(req.URL.Path); m != nil { w.DO[strings.ToLower(m[1])] = true }
+    if m := dns_history_cf_path.FindStringSubmatch(req.URL.Path); m != nil { w.CF[m[1]] = true }
+    w.lock.Unlock()
+    return resp, err
+}
@@ -0,0 +1,115 @@
+/*! \file dns_purge.go
+    \brief Finding the records that point at an ip address, so they can be deleted or moved before digital ocean hands the address to someone else
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "net"
+    "strconv"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A record pointing at the address, from either provider
+ */
+type DNS_ip_record_t struct {
+    CloudFlare  bool    `json:"cloudflare"`
+    Zone        string  `json:"zone"`      //the domain, or the cloud flare zone's name
+    ZoneID      string  `json:"zone_id,omitempty"`     //cloud flare only
+    ID          string  `json:"id"`
+    Type        string  `json:"type"`
+    Name        string  `json:"name"`      //without the zone, @ for the zone itself
+    Content     string  `json:"content"`
+    TTL         int     `json:"ttl"`
+    Proxied     bool    `json:"proxied,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The same address, so differently written ipv6 addresses still match
+ */
+func sameIP (content string, ip net.IP) bool {
+    parsed := net.ParseIP(strings.TrimSpace(content))
+    return parsed != nil && parsed.Equal(ip)
+}
+
+func (r DNS_ip_record_t) String () string {
+    if r.Name == "@" { return fmt.Sprintf("%s %s", r.Type, r.Zone) }
+    return fmt.Sprintf("%s %s.%s", r.Type, r.Name, r.Zone)
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- PURGE FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The records pointing at the address in the domain, or every domain on the account when it's empty
+ */
+func (do DO_c) RecordsPointingAt (ip, domain string) ([]DNS_ip_record_t, error) {
+    target := net.ParseIP(ip)
+    if target == nil { return nil, fmt.Errorf("'%s' isn't an ip address", ip) }
+
+    domains := []string{strings.ToLower(domain)}
+    if len(domain) == 0 {
+        var err error
+        if domains, err = do.listDomains(); err != nil { return nil, err }
+    }
+
+    found := make([]DNS_ip_record_t, 0)
+    for _, d := range(domains) {
+        records, err := do.listDomainRecords(d)
+        if err != nil { return nil, err }
+        for _, r := range(records) {
+            if sameIP(r.Data, target) { found = append(found, DNS_ip_record_t{Zone: d, ID: strconv.Itoa(r.ID), Type: r.Type, Name: r.Name, Content: r.Data, TTL: r.TTL}) }
+        }
+    }
+    return found, nil
+}
+
+/*! \brief Deletes the record, or points it at retarget when that's set.  The journal notes it on the way out so -undo can put it back
+ */
+func (do DO_c) PurgeRecord (r DNS_ip_record_t, retarget string) error {
+    path := fmt.Sprintf("domains/%s/records/%s", r.Zone, r.ID)
+    if len(retarget) == 0 {
+        _, err := do.send("DELETE", path, nil)
+        return err
+    }
+    jStr, _ := json.Marshal(do_domain_record_t{Type: r.Type, Name: r.Name, Data: retarget, TTL: r.TTL})
+    _, err := do.send("PUT", path, jStr)
+    return err
+}
+
+/*! \brief The records pointing at the address in the current zone
+ */
+func (cf CF_c) RecordsPointingAt (ip string) ([]DNS_ip_record_t, error) {
+    target := net.ParseIP(ip)
+    if target == nil { return nil, fmt.Errorf("'%s' isn't an ip address", ip) }
+
+    found := make([]DNS_ip_record_t, 0)
+    err := cf.EachDomainRecord(func (r CF_record_t) bool {
+        if !sameIP(r.Content, target) { return true }
+        zone := strings.ToLower(r.ZoneName)
+        name := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(r.Name), zone), ".")
+        if len(name) == 0 { name = "@" }
+        found = append(found, DNS_ip_record_t{CloudFlare: true, Zone: zone, ZoneID: cf.Config.Zone, ID: r.ID, Type: r.Type, Name: name, Content: r.Content, TTL: r.TTL, Proxied: r.Proxied})
+        return true
+    })
+    return found, err
+}
+
+/*! \brief Deletes the record, or points it at retarget when that's set, in the record's own zone
+ */
+func (cf CF_c) PurgeRecord (r DNS_ip_record_t, retarget string) error {
+    if len(r.ZoneID) > 0 { cf.Config.Zone = r.ZoneID }
+    if len(retarget) == 0 { return cf.DeleteDomainRecordID(r.ID) }
+    name := r.Name + "." + r.Zone
+    if r.Name == "@" { name = r.Zone }
+    return cf.updateDomainRecord(r.ID, r.Type, name, retarget, r.Proxied, r.TTL)
+}
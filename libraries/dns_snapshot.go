@@ -0,0 +1,270 @@
+/*! \file dns_snapshot.go
+    \brief Snapshots of domain records before a batch of changes, so a half applied batch can be put back the way it was
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+//the urls that change a single record, or create one when there's no id
+var journal_do_path = regexp.MustCompile(`^domains/([^/?]+)/records(?:/(\d+))?$`)
+var journal_cf_path = regexp.MustCompile(`/zones/([^/?]+)/dns_records(?:/([0-9a-fA-F]{32}))?$`)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief What a record looked like before the change, when it didn't exist restoring it deletes what the change created
+ */
+type DNS_snapshot_t struct {
+    CloudFlare  bool    `json:"cloudflare"`
+    Zone        string  `json:"zone,omitempty"`  //cloud flare zone id
+    ID          string  `json:"id,omitempty"`    //the record's id, so records sharing a name are put back one by one.  Older entries go by the name
+    Domain      string  `json:"domain,omitempty"`
+    SubDomain   string  `json:"subdomain"`
+    Type        string  `json:"type"`
+    Existed     bool    `json:"existed"`
+    Content     string  `json:"content,omitempty"`
+    Proxied     bool    `json:"proxied,omitempty"`
+    TTL         int     `json:"ttl,omitempty"`
+}
+
+/*! \brief Snapshots of every record a run changes, taken right before each change so the run can be undone
+ */
+type DNS_journal_t struct {
+    records     []DNS_snapshot_t
+    lock        sync.Mutex
+}
+
+func (snap DNS_snapshot_t) String () string {
+    name := snap.fullName()
+    if !snap.Existed { return fmt.Sprintf("%s %s (didn't exist)", snap.Type, name) }
+    return fmt.Sprintf("%s %s %s", snap.Type, name, snap.Content)
+}
+
+func (j *DNS_journal_t) add (snap DNS_snapshot_t) {
+    j.lock.Lock()
+    j.records = append(j.records, snap)
+    j.lock.Unlock()
+}
+
+/*! \brief What the records looked like, in the order they were changed.  Restoring them backwards undoes the run
+ */
+func (j *DNS_journal_t) Records () []DNS_snapshot_t {
+    j.lock.Lock()
+    defer j.lock.Unlock()
+    return append([]DNS_snapshot_t{}, j.records...)
+}
+
+/*! \brief Snapshot of the digital ocean record with the id as it is now
+ */
+func doRecordSnapshot (domain string, r do_domain_record_t, existed bool) DNS_snapshot_t {
+    return DNS_snapshot_t{ID: strconv.Itoa(r.ID), Domain: domain, SubDomain: strings.ToLower(r.Name), Type: r.Type, Existed: existed, Content: r.Data, TTL: r.TTL}
+}
+
+/*! \brief Snapshot of the cloud flare record with the id, the sub domain is the full name when we don't know the zone's
+ */
+func cfRecordSnapshot (zone string, r CF_record_t, existed bool) DNS_snapshot_t {
+    name, domain := strings.ToLower(r.Name), strings.ToLower(r.ZoneName)
+    if len(domain) > 0 { name = strings.TrimSuffix(strings.TrimSuffix(name, domain), ".") }
+    if len(name) == 0 { name = "@" }
+    return DNS_snapshot_t{CloudFlare: true, Zone: zone, ID: r.ID, Domain: domain, SubDomain: name, Type: r.Type, Existed: existed, Content: r.Content, Proxied: r.Proxied, TTL: r.TTL}
+}
+
+/*! \brief Full name for a snapshot's record, what a deleted one gets created with again
+ */
+func (snap DNS_snapshot_t) fullName () string {
+    if len(snap.Domain) == 0 { return snap.SubDomain }
+    if snap.SubDomain == "@" || len(snap.SubDomain) == 0 { return snap.Domain }
+    return snap.SubDomain + "." + snap.Domain
+}
+
+/*! \brief Every change to a domain record goes through here on its way out, when there's a journal.  Updates and deletes note the record
+ *  by its id before it's touched, creates hand back a func that notes the record they made once it's there, so -undo deletes that one and not another on the same name
+ */
+func (do DO_c) journalChange (method, url string) (func ([]byte), error) {
+    if do.Journal == nil || method == "GET" { return nil, nil }
+    m := journal_do_path.FindStringSubmatch(url)
+    if m == nil { return nil, nil }
+    domain := strings.ToLower(m[1])
+
+    var rec struct {
+        Record  do_domain_record_t  `json:"domain_record"`
+    }
+    if len(m[2]) == 0 {
+        if method != "POST" { return nil, nil }
+        return func (body []byte) {
+            if json.Unmarshal(body, &rec) == nil && rec.Record.ID > 0 { do.Journal.add(doRecordSnapshot(domain, rec.Record, false)) }
+        }, nil
+    }
+
+    body, err := do.send("GET", url, nil)
+    if doNotFound(err) { return nil, nil }     //nothing there to put back
+    if err == nil { err = json.Unmarshal(body, &rec) }
+    if err != nil { return nil, fmt.Errorf("Unable to note record %s before changing it :: %s", m[2], err.Error()) }
+    do.Journal.add(doRecordSnapshot(domain, rec.Record, true))
+    return nil, nil
+}
+
+func (cf CF_c) journalChange (method, finalUrl string) (func ([]byte), error) {
+    if cf.Journal == nil || method == "GET" { return nil, nil }
+    m := journal_cf_path.FindStringSubmatch(finalUrl)
+    if m == nil { return nil, nil }
+
+    var rec struct {
+        Result  CF_record_t     `json:"result"`
+    }
+    if len(m[2]) == 0 {
+        if method != "POST" { return nil, nil }
+        return func (body []byte) {
+            if json.Unmarshal(body, &rec) == nil && len(rec.Result.ID) > 0 { cf.Journal.add(cfRecordSnapshot(m[1], rec.Result, false)) }
+        }, nil
+    }
+
+    body, err := cf.send("GET", finalUrl, nil)
+    if cfNotFound(err) { return nil, nil }
+    if err == nil { err = json.Unmarshal(body, &rec) }
+    if err != nil { return nil, fmt.Errorf("Unable to note record %s before changing it :: %s", m[2], err.Error()) }
+    cf.Journal.add(cfRecordSnapshot(m[1], rec.Result, true))
+    return nil, nil
+}
+
+/*! \brief Puts the record with the snapshot's id back, returning the id it has now.  A record that was deleted comes back with a new one
+ */
+func (do DO_c) restoreRecordID (snap DNS_snapshot_t) (string, error) {
+    path := fmt.Sprintf("domains/%s/records/%s", snap.Domain, snap.ID)
+    var rec struct {
+        Record  do_domain_record_t  `json:"domain_record"`
+    }
+    body, err := do.send("GET", path, nil)
+    if err == nil { err = json.Unmarshal(body, &rec) }
+    if err != nil && !doNotFound(err) { return snap.ID, err }
+    missing := doNotFound(err)
+    dr := rec.Record
+
+    switch {
+    case !snap.Existed && missing:
+        if do.Verbose { fmt.Println("Record is already gone, nothing to do...") }
+    case !snap.Existed:
+        err = do.deleteRequest(path)
+    case missing:
+        jStr, _ := json.Marshal(do_domain_record_t{Type: snap.Type, Name: snap.SubDomain, Data: snap.Content, TTL: snap.TTL})
+        body, err = do.send("POST", fmt.Sprintf("domains/%s/records", snap.Domain), jStr)
+        if err == nil && json.Unmarshal(body, &rec) == nil && rec.Record.ID > 0 { return strconv.Itoa(rec.Record.ID), nil }
+    case dr.Type != snap.Type || dr.Data != snap.Content || (snap.TTL > 0 && dr.TTL != snap.TTL):
+        jStr, _ := json.Marshal(do_domain_record_t{Type: snap.Type, Name: snap.SubDomain, Data: snap.Content, TTL: snap.TTL})
+        _, err = do.send("PUT", path, jStr)
+    default:
+        if do.Verbose { fmt.Println("Record already matches the snapshot") }
+    }
+    return snap.ID, err
+}
+
+func (cf CF_c) restoreRecordID (snap DNS_snapshot_t) (string, error) {
+    var rec struct {
+        Result  CF_record_t     `json:"result"`
+    }
+    body, err := cf.request("dns_records/" + snap.ID, nil, nil)
+    if err == nil { err = json.Unmarshal(body, &rec) }
+    if err != nil && !cfNotFound(err) { return snap.ID, err }
+    missing := cfNotFound(err)
+    r := rec.Result
+
+    switch {
+    case !snap.Existed && missing:
+        cf.verboseMessage("Record is already gone, nothing to do...")
+    case !snap.Existed:
+        err = cf.deleteRequest("dns_records/" + snap.ID)
+    case missing:
+        jStr, _ := json.Marshal(cf_record_body_t{snap.Type, snap.fullName(), snap.Content, snap.Proxied, snap.TTL})
+        body, err = cf.request("dns_records", jStr, nil)
+        if err == nil && json.Unmarshal(body, &rec) == nil && len(rec.Result.ID) > 0 { return rec.Result.ID, nil }
+    case r.Type != snap.Type || r.Content != snap.Content || r.Proxied != snap.Proxied || (snap.TTL > 0 && r.TTL != snap.TTL):
+        err = cf.updateDomainRecord(snap.ID, snap.Type, snap.fullName(), snap.Content, snap.Proxied, snap.TTL)
+    default:
+        cf.verboseMessage("Record already matches the snapshot")
+    }
+    return snap.ID, err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- SNAPSHOT FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Snapshot of the record that setting the type on the sub domain would replace, an empty type is whatever delete would remove
+ */
+func (do DO_c) SnapshotRecord (domain, domainType, subDomain string) (DNS_snapshot_t, error) {
+    domain, subDomain = strings.ToLower(domain), strings.ToLower(subDomain)
+    snap := DNS_snapshot_t{Domain: domain, SubDomain: subDomain, Type: domainType}
+    dr, err := do.getDomainRecord(domain, subDomain, domainType)
+    if err == nil && dr != nil { snap.ID, snap.Existed, snap.Type, snap.Content, snap.TTL = strconv.Itoa(dr.ID), true, dr.Type, dr.Data, dr.TTL }
+    return snap, err
+}
+
+/*! \brief Puts the record back the way the snapshot has it, returning the id it has now.  Ones without an id are found by name
+ */
+func (do DO_c) RestoreRecord (snap DNS_snapshot_t) (string, error) {
+    if len(snap.ID) > 0 { return do.restoreRecordID(snap) }
+    dr, err := do.getDomainRecord(snap.Domain, snap.SubDomain, snap.Type)
+    if err != nil { return "", err }
+
+    switch {
+    case !snap.Existed && dr == nil:
+        if do.Verbose { fmt.Println("SubDomain does not exist, nothing to do...") }
+    case !snap.Existed:
+        err = do.deleteRequest(fmt.Sprintf("domains/%s/records/%d", snap.Domain, dr.ID))
+    case dr == nil:
+        jStr, _ := json.Marshal(do_domain_record_t{Type: snap.Type, Name: snap.SubDomain, Data: snap.Content, TTL: snap.TTL})
+        _, err = do.request(fmt.Sprintf("domains/%s/records", snap.Domain), jStr)
+    case dr.Type != snap.Type || dr.Data != snap.Content || (snap.TTL > 0 && dr.TTL != snap.TTL):
+        jStr, _ := json.Marshal(do_domain_record_t{Type: snap.Type, Name: snap.SubDomain, Data: snap.Content, TTL: snap.TTL})
+        _, err = do.send("PUT", fmt.Sprintf("domains/%s/records/%d", snap.Domain, dr.ID), jStr)
+    default:
+        if do.Verbose { fmt.Println("SubDomain already matches the snapshot") }
+    }
+    return "", err
+}
+
+/*! \brief Snapshot of the record in the current zone that setting the type on the sub domain would replace
+ */
+func (cf CF_c) SnapshotRecord (domainType, subDomain string) (DNS_snapshot_t, error) {
+    subDomain = strings.ToLower(subDomain)
+    snap := DNS_snapshot_t{CloudFlare: true, Zone: cf.Config.Zone, SubDomain: subDomain, Type: domainType}
+    rec, err := cf.findDomainRecord(subDomain, domainType)
+    if err == nil && rec != nil { snap.ID, snap.Existed, snap.Type, snap.Content, snap.Proxied, snap.Domain, snap.TTL = rec.ID, true, rec.Type, rec.Content, rec.Proxied, rec.ZoneName, rec.TTL }
+    return snap, err
+}
+
+/*! \brief Puts the record back the way the snapshot has it, in the snapshot's zone
+ */
+func (cf CF_c) RestoreRecord (snap DNS_snapshot_t) (string, error) {
+    cf.Config.Zone = snap.Zone
+    if len(snap.ID) > 0 { return cf.restoreRecordID(snap) }
+    rec, err := cf.findDomainRecord(snap.SubDomain, snap.Type)
+    if err != nil { return "", err }
+
+    switch {
+    case !snap.Existed && rec == nil:
+        cf.verboseMessage("SubDomain does not exist, nothing to do...")
+    case !snap.Existed:
+        err = cf.deleteRequest("dns_records/" + rec.ID)
+    case rec == nil:
+        err = cf.createDomainRecord(snap.Type, snap.SubDomain, snap.Content, snap.Proxied, snap.TTL)
+    case rec.Type != snap.Type || rec.Content != snap.Content || rec.Proxied != snap.Proxied || (snap.TTL > 0 && rec.TTL != snap.TTL):
+        err = cf.updateDomainRecord(rec.ID, snap.Type, snap.SubDomain, snap.Content, snap.Proxied, snap.TTL)
+    default:
+        cf.verboseMessage("SubDomain already matches the snapshot")
+    }
+    return "", err
+}
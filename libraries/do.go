@@ -6,6 +6,7 @@ package libraries
 
 import (
     "fmt"
+    "context"
     "net/http"
     "io/ioutil"
     "bytes"
@@ -18,7 +19,7 @@ import (
 //----- CONSTS ------------------------------------------------------------------------------------------------------------//
 //-------------------------------------------------------------------------------------------------------------------------//
 
-const do_base_url          = "https://api.digitalocean.com/v2/"
+const do_api_root          = "https://api.digitalocean.com/"
 
 //-------------------------------------------------------------------------------------------------------------------------//
 //----- STRUCTS -----------------------------------------------------------------------------------------------------------//
@@ -26,6 +27,19 @@ const do_base_url          = "https://api.digitalocean.com/v2/"
 
 type DO_config_t struct {
     APIKey  string  `json:"api_key"`
+    SpacesKey       string  `json:"spaces_key"`     //s3 style keys for spaces
+    SpacesSecret    string  `json:"spaces_secret"`
+    Uptime          DO_uptime_config_t  `json:"uptime"`
+    NodePools       map[string]DO_pool_t    `json:"node_pools"`   //kubernetes node pools, by their name
+    RequiredTags    []string    `json:"required_tags"`  //every node needs a tag matching each of these, ie 'team:*'
+    FirewallRules   map[string]DO_rule_set_t    `json:"firewall_rules"`   //named sets that firewalls are composed from
+    RequireOwner    bool    `json:"require_owner"`   //new nodes need -owner
+    RequireNote     bool    `json:"require_note"`    //new nodes need -note
+    Drain           DO_drain_t  `json:"drain"`   //run over ssh before a node is shut down or deleted
+    BaseURL         string  `json:"base_url"`   //replaces the api url, version and all, ie to go through a gateway or a mock
+    APIVersion      string  `json:"api_version"`    //pins the api version, v2 when it's not set
+    Headers         map[string]string   `json:"headers"`   //added to every api request, $VARS are expanded, ie {"X-Operator": "$USER"}
+    Packer          DO_packer_t `json:"packer"`  //template -build-image runs
 }
 
 type do_t struct {
@@ -34,12 +48,20 @@ type do_t struct {
     Size    string  `json:"size,omitempty"`
 }
 
+type do_floating_ip_t struct {
+    IP      string  `json:"ip"`
+    Droplet struct {
+        ID  int     `json:"id"`
+    } `json:"droplet"`
+}
+
+type DO_floating_ip_t struct {
+    IP          string  `json:"ip"`
+    DropletID   int     `json:"droplet_id"`  //0 when it isn't assigned
+}
+
 type do_floating_t struct {
-    FloatingIP  struct {
-        Droplet struct {
-            ID  int     `json:"id"`
-        } `json:"droplet"`
-    } `json:"floating_ip"`
+    FloatingIP  do_floating_ip_t    `json:"floating_ip"`
 }
 
 type do_domain_record_t struct {
@@ -47,13 +69,22 @@ type do_domain_record_t struct {
     Type    string  `json:"type"`
     Name    string  `json:"name"`
     Data    string  `json:"data,omitempty"`
+    TTL     int     `json:"ttl,omitempty"`
+}
+
+type DO_record_t struct {
+    ID      int     `json:"id"`
+    Type    string  `json:"type"`
+    Name    string  `json:"name"`
+    Data    string  `json:"data"`
+    TTL     int     `json:"ttl"`
 }
 
 type do_network_t struct {
     IP      string  `json:"ip_address"`
     Netmask string  `json:"netmask"`
     Gateway string  `json:"gateway"`
-    Type    string  `json:"public"`
+    Type    string  `json:"type"`
 }
 
 type do_droplet_t struct {
@@ -62,36 +93,144 @@ type do_droplet_t struct {
     Memory  int     `json:"memory"`
     Status  string  `json:"status"`
     Locked  bool    `json:"locked"`
+    Tags    []string    `json:"tags"`
+    Created string  `json:"created_at"`
+    SizeSlug    string  `json:"size_slug"`
+    GPUInfo *DO_gpu_info_t  `json:"gpu_info,omitempty"`   //only on gpu droplets
+    VolumeIDs   []string    `json:"volume_ids"`
+    Region  struct {
+        Slug    string  `json:"slug"`
+    }   `json:"region"`
     
     Networks struct {
         V4 []do_network_t   `json:"v4"`
+        V6 []do_network_t   `json:"v6"`    //only when the node has ipv6 enabled
     }   `json:"networks"`
 }
 
 type FileOutput_t struct {
     Droplet     do_droplet_t    `json:"droplet"`
+    App         *DO_app_t       `json:"app,omitempty"`
+    FloatingIP  string          `json:"floating_ip,omitempty"`  //one we reserved for the node
+    OneClick    *DO_image_t     `json:"one_click,omitempty"`    //the 1-Click app it was created from, with its getting started notes
+    Steps       []Step_t        `json:"steps,omitempty"`
+}
+
+/*! \brief Error for when digital ocean comes back with a bad status code
+ */
+type do_status_error struct {
+    Code    int
+    Url     string
+    Body    string
+}
+
+func (e do_status_error) Error () string {
+    var msg struct {
+        Message     string  `json:"message"`
+        RequestID   string  `json:"request_id"`
+    }
+    json.Unmarshal([]byte(e.Body), &msg)
+    if len(msg.RequestID) > 0 { return fmt.Sprintf("Request failed: status code: %d - url: %s - %s (request id %s)", e.Code, e.Url, msg.Message, msg.RequestID) }
+    return fmt.Sprintf("Request failed: status code: %d - url: %s - %s", e.Code, e.Url, msg.Message)
 }
 
 type DO_c struct {
     Verbose, SuperVerbose     bool
     Config      DO_config_t
+    Progress    *Progress_t     //optional, keeps track of the steps in longer operations
+    Ctx         context.Context //optional, its deadline stops requests and waits
+    Cache       *ReadCache_t    //optional, for the read heavy requests
+    Stack       string          //optional, new nodes get tagged as part of it
+    ManagedOnly bool            //refuse to delete nodes we didn't create
+    Ready       DO_ready_t      //optional, what new nodes are waited on for beyond being active
+    SkipDrain   bool            //don't run the drain command from the config
+    Owner       string          //optional, who to ask about new nodes
+    Note        string          //optional, why new nodes exist
+    Expires     time.Time       //optional, when -reap can remove new nodes
+    ReadOnly    bool            //refuse anything that would change the account
+    Journal     *DNS_journal_t  //optional, every record is noted here by its id before it's changed
+    NoLockWait  bool            //fail right away when a node is locked, instead of waiting for it
+    LockWait    time.Duration   //optional, longest we wait for a locked node
 }
 
 //-------------------------------------------------------------------------------------------------------------------------//
 //----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
 //-------------------------------------------------------------------------------------------------------------------------//
 
-func (do DO_c) request (url string, jStr []byte) (body []byte, err error) {
+/*! \brief Context for our requests and waits, background when one wasn't set
+ */
+func (do DO_c) context () context.Context {
+    if do.Ctx == nil { return context.Background() }
+    return do.Ctx
+}
+
+/*! \brief Sleeps, unless the context is done first, then it's the context's error
+ */
+func (do DO_c) sleep (d time.Duration) error {
+    select {
+    case <-time.After(d):
+        return nil
+    case <-do.context().Done():
+        return do.context().Err()
+    }
+}
+
+/*! \brief Only the things we read the most are cached, nodes, domain records, regions and sizes
+ */
+func doCacheable (url string) bool {
+    for _, prefix := range([]string{"droplets?", "regions?", "sizes?", "account"}) {
+        if strings.HasPrefix(url, prefix) { return true }
+    }
+    return strings.HasPrefix(url, "domains/") && strings.Contains(url, "/records?")
+}
+
+/*! \brief Where the api requests go, the base_url from the config when it's set, otherwise the pinned api_version
+ */
+func (do DO_c) baseURL () string {
+    if len(do.Config.BaseURL) == 0 {
+        if len(do.Config.APIVersion) > 0 { return do_api_root + strings.Trim(do.Config.APIVersion, "/") + "/" }
+        return do_api_root + do_api_version + "/"
+    }
+    return strings.TrimSuffix(do.Config.BaseURL, "/") + "/"
+}
+
+/*! \brief Does the actual http request, returning the body along with the status code
+ */
+func (do DO_c) call (method, url string, data []byte) (body []byte, code int, err error) {
+    var stale []byte
+    var etag string
+    var journaled func ([]byte)    //notes a record we created, once we know its id
+    if method != "GET" && do.ReadOnly {
+        return nil, 0, readOnlyError(method, url)
+    } else if method != "GET" {
+        do.Cache.clear()    //what we're changing could be cached
+        if journaled, err = do.journalChange(method, url); err != nil { return nil, 0, err }
+    } else if doCacheable(url) {
+        if body = do.Cache.get(do.Config.APIKey, url); body != nil { return body, 200, nil }
+        stale, etag = do.Cache.stale(do.Config.APIKey, url)
+        defer func () {
+            if err == nil && code == http.StatusNotModified && stale != nil {
+                if do.SuperVerbose { fmt.Println("Not modified, using the cached response") }
+                body, code = stale, 200
+                do.Cache.touch(do.Config.APIKey, url)
+            } else if err == nil && code < 300 {
+                do.Cache.put(do.Config.APIKey, url, body, etag)
+            }
+        }()
+    }
+    
     var req *http.Request
     
-    if len(jStr) > 0 {    //we're posting data
-        req, err = http.NewRequest("POST", do_base_url + url, bytes.NewBuffer(jStr))
-    } else {    //we're doing a get
-        req, err = http.NewRequest("GET", do_base_url + url, nil)
+    if len(data) > 0 {
+        req, err = http.NewRequestWithContext(do.context(), method, do.baseURL() + url, bytes.NewBuffer(data))
+    } else {
+        req, err = http.NewRequestWithContext(do.context(), method, do.baseURL() + url, nil)
     }
     if err == nil {
         req.Header.Set("Content-Type", "application/json")
         req.Header.Set("Authorization", "Bearer " + do.Config.APIKey)
+        if stale != nil { req.Header.Set("If-None-Match", etag) }
+        setHeaders(req, do.Config.Headers)
         
         client := &http.Client{}
         resp, err := client.Do(req)
@@ -99,49 +238,77 @@ func (do DO_c) request (url string, jStr []byte) (body []byte, err error) {
             defer resp.Body.Close()
             
             body, _ = ioutil.ReadAll(resp.Body)
+            code = resp.StatusCode
+            etag = resp.Header.Get("ETag")  //saved with the response for next time
+            if journaled != nil && code < 300 { journaled(body) }
             
             if do.SuperVerbose {
                 fmt.Println("response Status:", resp.Status)
-                fmt.Println("response Headers:", resp.Header)
-                fmt.Println("response Body:", string(body[:]))
+                fmt.Println("response Headers:", redactHeaders(resp.Header, nil))
+                fmt.Println("response Body:", redactString(string(body), []string{do.Config.APIKey}))
             }
         } else {
-            return nil, err
+            return nil, 0, err
         }
     }
     
     return
 }
 
+func (do DO_c) request (url string, jStr []byte) (body []byte, err error) {
+    if len(jStr) > 0 {    //we're posting data
+        body, _, err = do.call("POST", url, jStr)
+    } else {    //we're doing a get
+        body, _, err = do.call("GET", url, nil)
+    }
+    return
+}
+
+/*! \brief Same as request, but for any method, and a bad status code comes back as an error
+ */
+func (do DO_c) send (method, url string, data []byte) ([]byte, error) {
+    body, code, err := do.call(method, url, data)
+    if err == nil && code >= 300 {
+        return nil, do_status_error{Code: code, Url: url, Body: string(body)}
+    }
+    return body, err
+}
+
 /*! \brief For when we do a delete request where we aren't expecting a body, only a return code
  */
 func (do DO_c) deleteRequest (url string) (err error) {
-    req, err := http.NewRequest("DELETE", do_base_url + url, nil)
-    
-    if err == nil {
-        req.Header.Set("Content-Type", "application/json")
-        req.Header.Set("Authorization", "Bearer " + do.Config.APIKey)
-        
-        client := &http.Client{}
-        resp, err := client.Do(req)
-        if err == nil {
-            defer resp.Body.Close()
-            if do.SuperVerbose {
-                fmt.Println("response Status:", resp.Status)
-                fmt.Println("response Headers:", resp.Header)
-            }
-            
-            if resp.StatusCode != 204 {
-                return fmt.Errorf("Delete request failed: status code: %d - url: %s", resp.StatusCode, url)
-            }
-        } else {
-            return err
+    body, code, err := do.call("DELETE", url, nil)
+    if err == nil && code != 204 {
+        var msg struct {
+            RequestID   string  `json:"request_id"`
         }
+        if json.Unmarshal(body, &msg) == nil && len(msg.RequestID) > 0 { return fmt.Errorf("Delete request failed: status code: %d - url: %s (request id %s)", code, url, msg.RequestID) }
+        return fmt.Errorf("Delete request failed: status code: %d - url: %s", code, url)
     }
-    
     return
 }
 
+/*! \brief What a change gets back in read only mode, before anything is sent
+ */
+func readOnlyError (method, url string) error {
+    return fmt.Errorf("Read only mode, refusing to %s %s.  Drop -read-only, or read_only from the config, to make changes", method, url)
+}
+
+/*! \brief True when the error is digital ocean telling us the thing doesn't exist
+ */
+func doNotFound (err error) bool {
+    statusErr, ok := err.(do_status_error)
+    return ok && statusErr.Code == 404
+}
+
+/*! \brief A and AAAA records for the same name live side by side, everything else replaces what's there
+ *  An empty type matches any record
+ */
+func recordsCoexist (a, b string) bool {
+    a, b = strings.ToUpper(a), strings.ToUpper(b)
+    return (a == "A" && b == "AAAA") || (a == "AAAA" && b == "A")
+}
+
 /*! \brief Creates a domain record when one doesn't exist yet
  */
 func (do DO_c) createDomainRecord (domain, domainType, subDomain, ip string) (err error) {
@@ -167,7 +334,7 @@ func (do DO_c) shutdownNode (droplet *do_droplet_t) (err error) {
             jStr, _ = json.Marshal(simple)
             if do.Verbose { fmt.Println("Powering OFF node") }
             _, err = do.request(fmt.Sprintf("droplets/%d/actions", droplet.ID), jStr)   //issue the poweroff command
-            time.Sleep(time.Second * 5)
+            if err == nil { err = do.sleep(time.Second * 5) }
         }
     }
     return
@@ -184,14 +351,22 @@ func (do DO_c) startNode (droplet *do_droplet_t) (err error) {
 }
 
 /*! \brief Gets the info about a droplet from its id
+ *  An empty droplet when the request fails, the callers are polling or refreshing one we already have
  */
 func (do DO_c) getDropletFromID (id int) (*do_droplet_t) {
-    resp, _ := do.request(fmt.Sprintf("droplets/%d", id), nil)   //get the status
+    droplet, _ := do.dropletFromID(id)
+    return droplet
+}
+
+/*! \brief Same as getDropletFromID but with the error, for when an empty droplet can't stand in for the real one
+ */
+func (do DO_c) dropletFromID (id int) (*do_droplet_t, error) {
+    resp, err := do.request(fmt.Sprintf("droplets/%d", id), nil)   //get the status
     var m struct {
         Droplet do_droplet_t    `json:"droplet"`
     }
-    json.Unmarshal(resp, &m)
-    return &m.Droplet
+    if err == nil { err = compatDecode("droplet", resp, "droplet", &m, nil) }
+    return &m.Droplet, err
 }
 
 /*! \brief Gets the node's info from it's name
@@ -207,7 +382,7 @@ func (do DO_c) getDropletFromName (name string) (*do_droplet_t, error) {
             var droplets struct {
                 Droplets []do_droplet_t    `json:"droplets"`
             }
-            err = json.Unmarshal(resp, &droplets)
+            err = compatDecode("droplet", resp, "droplets", &droplets, nil)
             
             for _, drop := range(droplets.Droplets) {
                 if strings.Compare(strings.ToLower(drop.Name), name) == 0 { //this is our node!
@@ -228,9 +403,9 @@ func (do DO_c) getDropletFromName (name string) (*do_droplet_t, error) {
     return  nil, nil    //won't get here
 }
 
-/*! \brief Gets a specific domain record from the domain and sub-domain
+/*! \brief Gets a specific domain record from the domain and sub-domain, one that the type would replace when it's set
  */
-func (do DO_c) getDomainRecord (domain, subDomain string) (dr *do_domain_record_t, err error) {
+func (do DO_c) getDomainRecord (domain, subDomain, recordType string) (dr *do_domain_record_t, err error) {
     pages := 1
     //first step is to get a list of current subdomains from this parent domain
     if do.Verbose { fmt.Println("Getting list of current subdomains") }
@@ -250,7 +425,7 @@ func (do DO_c) getDomainRecord (domain, subDomain string) (dr *do_domain_record_
             if err == nil {
                 //loop through these records looking for a matched subdomain
                 for _, sd := range (records.Records) {
-                    if strings.Compare(strings.ToLower(sd.Name), subDomain) == 0 {  //the record exists
+                    if strings.Compare(strings.ToLower(sd.Name), subDomain) == 0 && !recordsCoexist(sd.Type, recordType) {  //the record exists
                         return &sd, nil  //we found it
                     }
                 }
@@ -276,7 +451,7 @@ func (do DO_c) getDomainRecord (domain, subDomain string) (dr *do_domain_record_
 /*! \brief Simple function that waits for a node to be the status we're looking for
  */
 func (do DO_c) waitForNodeStatus (id int, status string, maxTries int) bool {
-    time.Sleep(time.Second * 3)
+    if do.sleep(time.Second * 3) != nil { return false }    //we ran out of time
     dStatus := do.getDropletFromID(id)
     
     if dStatus.Status == status { return true } //we're good
@@ -313,12 +488,55 @@ func (do DO_c) GetFloatingIP (ip string) (int, error) {
     }
 }
 
+/*! \brief Lists the floating ips on the account, with the node each one is assigned to
+ */
+func (do DO_c) ListFloatingIPs () ([]DO_floating_ip_t, error) {
+    ips := make([]DO_floating_ip_t, 0)
+    var err error
+    pageErr := do.EachPage("floating_ips", "floating_ips", func (item json.RawMessage) bool {
+        var f do_floating_ip_t
+        err = json.Unmarshal(item, &f)
+        ips = append(ips, DO_floating_ip_t{IP: f.IP, DropletID: f.Droplet.ID})
+        return err == nil
+    })
+    if pageErr != nil { return nil, pageErr }
+    return ips, err
+}
+
+/*! \brief Gets a floating ip address for the node, reserving a new one in its region when it doesn't already have one
+ */
+func (do DO_c) ReserveFloatingIP (id int) (string, error) {
+    existing := ""
+    var err error
+    pageErr := do.EachPage("floating_ips", "floating_ips", func (item json.RawMessage) bool {
+        var f do_floating_ip_t
+        if err = json.Unmarshal(item, &f); err != nil { return false }
+        if f.Droplet.ID == id { existing = f.IP }
+        return len(existing) == 0
+    })
+    if pageErr != nil { return "", pageErr }
+    if err != nil { return "", err }
+    if len(existing) > 0 {
+        if do.Verbose { fmt.Printf("Node already has floating ip %s\n", existing) }
+        return existing, nil
+    }
+
+    if do.Verbose { fmt.Println("Reserving a new floating ip") }
+    jStr, _ := json.Marshal(do_t{ID: id})   //reserves it in the node's region and assigns it
+    resp, err := do.send("POST", "floating_ips", jStr)
+    if err != nil { return "", err }
+
+    floater := do_floating_t{}
+    err = json.Unmarshal(resp, &floater)
+    return floater.FloatingIP.IP, err
+}
+
 /*! \brief Handles full logic of creating, updating, or leaving alone a domain record
  */
 func (do DO_c) AssignDomainRecord (domain, domainType, subDomain, ip string) error {
     domain = strings.ToLower(domain)
     subDomain = strings.ToLower(subDomain)
-    dr, err := do.getDomainRecord(domain, subDomain)    //see if this already exists
+    dr, err := do.getDomainRecord(domain, subDomain, domainType)    //see if this already exists
     
     if err == nil {
         if dr == nil {  //it doesn't exist yet, so create it
@@ -339,12 +557,62 @@ func (do DO_c) AssignDomainRecord (domain, domainType, subDomain, ip string) err
     return err
 }
 
+/*! \brief Gets the id of the domain record for the sub domain, empty when it doesn't exist
+ */
+func (do DO_c) DomainRecordID (domain, domainType, subDomain string) (string, error) {
+    dr, err := do.getDomainRecord(strings.ToLower(domain), strings.ToLower(subDomain), domainType)
+    if err != nil || dr == nil { return "", err }
+    return fmt.Sprint(dr.ID), nil
+}
+
+/*! \brief Gets the record that setting the type on the sub domain would replace, nil when there isn't one
+ */
+func (do DO_c) GetDomainRecord (domain, domainType, subDomain string) (*DO_record_t, error) {
+    dr, err := do.getDomainRecord(strings.ToLower(domain), strings.ToLower(subDomain), domainType)
+    if err != nil || dr == nil { return nil, err }
+    rec := DO_record_t(*dr)
+    return &rec, nil
+}
+
+/*! \brief Points the existing record at the content with the ttl, a ttl of 0 keeps the one it has
+ */
+func (do DO_c) UpdateDomainRecord (domain, domainType, subDomain, content string, ttl int) error {
+    domain = strings.ToLower(domain)
+    subDomain = strings.ToLower(subDomain)
+    dr, err := do.getDomainRecord(domain, subDomain, domainType)
+    if err != nil { return err }
+    if dr == nil { return fmt.Errorf("Domain record %s.%s does not exist", subDomain, domain) }
+
+    if ttl == 0 { ttl = dr.TTL }
+    if do.Verbose { fmt.Printf("Updating %s to %s with a ttl of %d\n", subDomain, content, ttl) }
+    jStr, _ := json.Marshal(do_domain_record_t{Type: domainType, Name: subDomain, Data: content, TTL: ttl})
+    _, err = do.send("PUT", fmt.Sprintf("domains/%s/records/%d", domain, dr.ID), jStr)
+    return err
+}
+
+/*! \brief Lists all the records in the domain
+ */
+func (do DO_c) ListDomainRecords (domain string) ([]DO_record_t, error) {
+    records, err := do.listDomainRecords(strings.ToLower(domain))
+    if err != nil { return nil, err }
+    list := make([]DO_record_t, 0, len(records))
+    for _, r := range(records) { list = append(list, DO_record_t(r)) }
+    return list, nil
+}
+
+/*! \brief Deletes the domain record with the id, ie one from ListDomainRecords
+ */
+func (do DO_c) DeleteDomainRecordID (domain, id string) error {
+    if do.Verbose { fmt.Println("Deleting record " + id) }
+    return do.deleteRequest(fmt.Sprintf("domains/%s/records/%s", strings.ToLower(domain), id))
+}
+
 /*! \brief Deletes an existing domain record
  */
 func (do DO_c) DeleteDomainRecord (domain, subDomain string) error {
     domain = strings.ToLower(domain)
     subDomain = strings.ToLower(subDomain)
-    dr, err := do.getDomainRecord(domain, subDomain)    //see if this already exists
+    dr, err := do.getDomainRecord(domain, subDomain, "")    //see if this already exists
     
     if err == nil {
         if dr == nil {  //it doesn't exist, so we're good
@@ -364,14 +632,24 @@ func (do DO_c) DeleteDomainRecord (domain, subDomain string) error {
 
 
 /*! \brief Creates a new node, if it doesn't already exist
+ *  userData is an optional cloud-init script that runs on the node's first boot
  */
-func (do DO_c) CreateNode (name, region, tag, size, image, sshKey string, fileOutput *FileOutput_t) (err error) {
+func (do DO_c) CreateNode (name, region, tag, size, image, sshKey, userData string, fileOutput *FileOutput_t) (err error) {
     //see if the droplet already exists
     droplet, err := do.getDropletFromName (name)
     
     if err == nil {
         if droplet == nil {  //we didn't get a droplet back
+            if err = do.checkInfo(); err != nil { return }
+            size = do.compatSize(size)
+            err = do.Progress.Step("check capacity " + name, func() error { return do.checkCapacity(region, size, 1) })
+            if err != nil { return }
             if do.Verbose { fmt.Println("Node does not exist, creating...") }
+            var hostKey *do_host_key_t
+            if len(do.Ready.KnownHosts) > 0 {   //known before it boots, so the first connection can already be checked
+                if hostKey, err = newHostKey(name); err != nil { return }
+                userData = hostKey.userData(userData)
+            }
             var node = struct {
                 Name    string  `json:"name"`
                 Region  string  `json:"region"`
@@ -379,21 +657,33 @@ func (do DO_c) CreateNode (name, region, tag, size, image, sshKey string, fileOu
                 Image   string  `json:"image"`
                 Keys    []string    `json:"ssh_keys,omitempty"`
                 Tags    []string    `json:"tags,omitempty"`
-            }{Name: name, Region: region, Size: size, Image: image}
+                UserData    string  `json:"user_data,omitempty"`
+            }{Name: name, Region: region, Size: size, Image: image, UserData: userData}
             
             //see if we have any sshkeys for this
             if len(sshKey) > 0 { node.Keys = append(node.Keys, sshKey) }
             
-            //see if we have any tag for this node
-            if len(tag) > 0 { node.Tags = append(node.Tags, tag) }
+            //see if we have any tags for this node
+            node.Tags = append(node.Tags, splitTags(tag)...)
+            node.Tags = append(node.Tags, do.managedTags(image)...)
             
             jStr, _ := json.Marshal(node)
-            _, err = do.request("droplets", jStr)
+            err = do.Progress.Step("create node " + name, func() (err error) {
+                _, err = do.request("droplets", jStr)
+                return
+            })
             
             if err == nil {
-                //we need to give digital ocean a few seconds to assign an ip address
-                time.Sleep(5 * time.Second)
-                droplet, err = do.getDropletFromName (name) //get the droplet again, we need the ip address
+                err = do.Progress.Step("wait for ip address " + name, func() (err error) {
+                    //we need to give digital ocean a few seconds to assign an ip address
+                    if err = do.sleep(5 * time.Second); err == nil {
+                        droplet, err = do.getDropletFromName (name) //get the droplet again, we need the ip address
+                    }
+                    return
+                })
+            }
+            if err == nil && hostKey != nil && droplet != nil {
+                err = do.Progress.Step("known host " + name, func() error { return do.trustHostKey(droplet, hostKey) })
             }
             
             if do.Verbose { fmt.Println("New node created successfully") }
@@ -401,6 +691,10 @@ func (do DO_c) CreateNode (name, region, tag, size, image, sshKey string, fileOu
             if do.Verbose { fmt.Println("Node by that name already exists") }
         }
         
+        if err == nil && droplet != nil && (do.Ready.SSH || do.Ready.CloudInit) {  //active isn't the same as usable
+            if err = do.WaitForReady(droplet.ID); err == nil { droplet = do.getDropletFromID(droplet.ID) }
+        }
+        
         if err == nil && droplet != nil { //this worked
             fileOutput.Droplet = *droplet
         }
@@ -409,15 +703,63 @@ func (do DO_c) CreateNode (name, region, tag, size, image, sshKey string, fileOu
     return
 }
 
+/*! \brief Gets the id and public ip address of the node from its name
+ */
+func (do DO_c) NodeAddress (name string) (int, string, error) {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return 0, "", err }
+    if droplet == nil { return 0, "", fmt.Errorf("Node '%s' does not exist", name) }
+    
+    droplet = do.getDropletFromID(droplet.ID)   //the list can be cached, and we want the ip address it has now
+    for _, n := range(droplet.Networks.V4) {
+        if n.Type == "public" { return droplet.ID, n.IP, nil }
+    }
+    return droplet.ID, "", fmt.Errorf("Node '%s' doesn't have a public ip address yet", name)
+}
+
+/*! \brief Fills in the output with the node's current info, found is false when there isn't a node by that name
+ */
+func (do DO_c) GetNode (name string, fileOutput *FileOutput_t) (found bool, err error) {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil || droplet == nil { return false, err }
+
+    current, err := do.dropletFromID(droplet.ID)   //the list can be cached
+    if err != nil { return false, err }
+    fileOutput.Droplet = *current
+    return true, nil
+}
+
+/*! \brief Gets the node's public ipv6 address, empty when it doesn't have ipv6 enabled
+ */
+func (do DO_c) NodeIPv6 (name string) (string, error) {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return "", err }
+    if droplet == nil { return "", fmt.Errorf("Node '%s' does not exist", name) }
+    
+    for _, n := range(do.getDropletFromID(droplet.ID).Networks.V6) {
+        if n.Type == "public" { return n.IP, nil }
+    }
+    return "", nil
+}
+
 /*! \brief This will delete a node
  */
 func (do DO_c) DeleteNode (name string) (err error) {
     droplet, err := do.getDropletFromName (name)
     
     if err == nil {
-        if droplet != nil {    //we have a droplet we want to remove
+        if droplet != nil && do.ManagedOnly && !hasString(droplet.Tags, do_managed_tag) {
+            err = fmt.Errorf("Node '%s' wasn't created by harbormaster, it doesn't have the %s tag", name, do_managed_tag)
+        } else if droplet != nil {    //we have a droplet we want to remove
+            err = do.Progress.Step("drain " + name, func() error { return do.drainNode(droplet) })
+            if err != nil { return }
             fmt.Println("Deleting node: " + name)
-            err = do.deleteRequest(fmt.Sprintf("droplets/%d", droplet.ID))     //delete it
+            err = do.whenUnlocked(droplet, func () error {
+                _, err := do.send("DELETE", fmt.Sprintf("droplets/%d", droplet.ID), nil)     //delete it
+                return err
+            })
+            if err == nil && do.Ready.Delete { err = do.WaitForDeleted(droplet) }
+            if err == nil { err = do.forgetHostKey(droplet) }
         } else {
             if do.Verbose { fmt.Println("Droplet does not exist, nothing to do...") }
         }
@@ -434,31 +776,48 @@ func (do DO_c) ResizeNode (name, size string) (err error) {
     
     if err == nil {
         if droplet != nil {    //we have a droplet we want to remove
+            //before we shut it down for nothing
+            size = do.compatSize(size)
+            err = do.Progress.Step("check capacity " + name, func() error { return do.checkCapacity(droplet.Region.Slug, size, 0) })
+            if err != nil { return }
             fmt.Println("Resizing node: " + name)
-            err = do.shutdownNode(droplet)  //first step is to shut it down
+            err = do.Progress.Step("drain " + name, func() error { return do.drainNode(droplet) })
+            if err != nil { return }
+            err = do.Progress.Step("shut down " + name, func() error { return do.whenUnlocked(droplet, func () error { return do.shutdownNode(droplet) }) })  //first step is to shut it down
             if err == nil {
                 //now we issue the resize
                 simple := do_t{Type: "resize", Size: size}
                 jStr, _ := json.Marshal(simple)
-                if do.Verbose { fmt.Println("Resizing node '%s' to %s", name, size) }
-                _, err = do.request(fmt.Sprintf("droplets/%d/actions", droplet.ID), jStr)   //issue the resize command
+                if do.Verbose { fmt.Printf("Resizing node '%s' to %s\n", name, size) }
+                err = do.Progress.Step("resize " + name, func() error {
+                    return do.whenUnlocked(droplet, func () error {
+                        _, err := do.send("POST", fmt.Sprintf("droplets/%d/actions", droplet.ID), jStr)   //issue the resize command
+                        return err
+                    })
+                })
                 
                 //this can take a while, so we wait a minute, but we want the node to start as soon as possible
                 if err == nil {
-                    locked := true
                     fmt.Println("Waiting for node to finish resize")
-                    for locked {
-                        time.Sleep(time.Second * 20)    //wait a little while, this takes some time
-                        dStatus := do.getDropletFromID(droplet.ID)
-                        
-                        if !dStatus.Locked {    //we've been waiting for this moment
-                            do.startNode(droplet)   //start this node
-                            locked = false
+                    err = do.Progress.Step("wait for resize " + name, func() error {
+                        locked := true
+                        for locked {
+                            if err := do.sleep(time.Second * 20); err != nil { return err }    //wait a little while, this takes some time
+                            dStatus := do.getDropletFromID(droplet.ID)
+                            
+                            if !dStatus.Locked {    //we've been waiting for this moment
+                                do.startNode(droplet)   //start this node
+                                locked = false
+                            }
                         }
-                    }
+                        return nil
+                    })
                     
                     //now we just wait for the node to be active
-                    do.waitForNodeStatus(droplet.ID, "active", 10)
+                    if err == nil { err = do.Progress.Step("wait for active " + name, func() error {
+                        if !do.waitForNodeStatus(droplet.ID, "active", 10) { return fmt.Errorf("Node not active yet") }
+                        return nil
+                    }) }
                 }
             }
         } else {
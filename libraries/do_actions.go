@@ -0,0 +1,131 @@
+/*! \file do_actions.go
+    \brief Digital ocean actions, the history of what's been done on the account and waiting on ones still running
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_action_poll        = time.Second * 5   //how long we wait between checking on an action
+const do_lock_poll          = time.Second * 15
+const do_lock_wait          = 30 * time.Minute  //backups can hold a node for a while
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_action_t struct {
+    ID              int     `json:"id"`
+    Status          string  `json:"status"`    //in-progress, completed or errored
+    Type            string  `json:"type"`
+    StartedAt       string  `json:"started_at"`
+    CompletedAt     string  `json:"completed_at"`
+    ResourceID      int     `json:"resource_id"`
+    ResourceType    string  `json:"resource_type"`
+    Region          string  `json:"region_slug"`
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- ACTION FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the most recent actions, newest first, for the whole account or just the node when it's set
+ */
+func (do DO_c) ListActions (node string, limit int) ([]DO_action_t, error) {
+    path := "actions"
+    if len(node) > 0 {
+        droplet, err := do.getDropletFromName(node)
+        if err != nil { return nil, err }
+        if droplet == nil { return nil, fmt.Errorf("Node '%s' does not exist", node) }
+        path = fmt.Sprintf("droplets/%d/actions", droplet.ID)
+    }
+
+    perPage := limit
+    if perPage > 200 { perPage = 200 }  //the most digital ocean gives us at once
+
+    actions := make([]DO_action_t, 0)
+    for page := 1; len(actions) < limit; page++ {
+        resp, err := do.send("GET", fmt.Sprintf("%s?page=%d&per_page=%d", path, page, perPage), nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            Actions     []DO_action_t   `json:"actions"`
+            Links   struct {
+                Pages   struct {
+                    Next    string  `json:"next"`
+                }   `json:"pages"`
+            }   `json:"links"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        actions = append(actions, list.Actions...)
+        if len(list.Links.Pages.Next) == 0 { break }
+    }
+    if len(actions) > limit { actions = actions[:limit] }
+    return actions, nil
+}
+
+/*! \brief Waits for the action to finish, ie one started by a run that was interrupted
+ */
+func (do DO_c) WaitForAction (id int, maxWait time.Duration) (*DO_action_t, error) {
+    for start := time.Now(); time.Since(start) < maxWait; {
+        resp, err := do.send("GET", fmt.Sprintf("actions/%d", id), nil)
+        if err != nil { return nil, err }
+
+        var result struct {
+            Action  DO_action_t     `json:"action"`
+        }
+        if err = json.Unmarshal(resp, &result); err != nil { return nil, err }
+
+        if do.Verbose { fmt.Printf("Action %d %s: %s\n", id, result.Action.Type, result.Action.Status) }
+        switch result.Action.Status {
+        case "completed":
+            return &result.Action, nil
+        case "errored":
+            return &result.Action, fmt.Errorf("Action %d %s errored", id, result.Action.Type)
+        }
+        if err = do.sleep(do_action_poll); err != nil { return nil, err }
+    }
+    return nil, fmt.Errorf("Action %d did not finish in time", id)
+}
+
+/*! \brief True when digital ocean turned the action down because the node is locked, ie by a backup
+ */
+func doLocked (err error) bool {
+    statusErr, ok := err.(do_status_error)
+    return ok && statusErr.Code == 422 && strings.Contains(strings.ToLower(statusErr.Body), "pending event")
+}
+
+/*! \brief Runs fn once the node isn't locked, ie by a backup or another action, so it queues behind them instead of failing
+ *  fn is tried again if it's turned down for the node being locked after all.  With NoLockWait a locked node is an error right away
+ */
+func (do DO_c) whenUnlocked (droplet *do_droplet_t, fn func () error) error {
+    maxWait := do.LockWait
+    if maxWait <= 0 { maxWait = do_lock_wait }
+
+    waiting := false
+    for start := time.Now(); ; {
+        if current := do.getDropletFromID(droplet.ID); current.Locked {
+            if do.NoLockWait { return fmt.Errorf("Node '%s' is locked, ie by a backup or another action.  Leave off -no-wait to wait for it", droplet.Name) }
+        } else {
+            err := fn()
+            if !doLocked(err) || do.NoLockWait { return err }
+        }
+
+        if time.Since(start) >= maxWait { return fmt.Errorf("Node '%s' was still locked after %s", droplet.Name, maxWait) }
+        if !waiting {
+            waiting = true
+            fmt.Printf("Node %s is locked, waiting up to %s for it\n", droplet.Name, maxWait)
+        }
+        if err := do.sleep(do_lock_poll); err != nil { return err }
+    }
+}
@@ -0,0 +1,191 @@
+/*! \file do_apps.go
+    \brief Digital ocean app platform, creating and updating apps from a spec and watching their deployments
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_deploy_poll        = time.Second * 10  //how long we wait between checking on a deployment
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_deployment_t struct {
+    ID          string  `json:"id"`
+    Phase       string  `json:"phase"`
+    Cause       string  `json:"cause,omitempty"`
+    Progress    struct {
+        SuccessSteps    int     `json:"success_steps"`
+        TotalSteps      int     `json:"total_steps"`
+        ErrorSteps      int     `json:"error_steps"`
+    }   `json:"progress"`
+}
+
+type DO_app_t struct {
+    ID          string  `json:"id"`
+    LiveURL     string  `json:"live_url"`
+    Spec        json.RawMessage     `json:"spec"`
+    Deployment  *DO_deployment_t    `json:"deployment,omitempty"`   //the one we kicked off
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Name of the app from its spec
+ */
+func (app DO_app_t) Name () string {
+    var spec struct {
+        Name    string  `json:"name"`
+    }
+    json.Unmarshal(app.Spec, &spec)
+    return spec.Name
+}
+
+/*! \brief Gets the app by its name, nil if it doesn't exist
+ */
+func (do DO_c) getApp (name string) (*DO_app_t, error) {
+    for page := 1; page > 0; page++ {
+        resp, err := do.send("GET", fmt.Sprintf("apps?page=%d&per_page=100", page), nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            Apps    []DO_app_t  `json:"apps"`
+            Links   struct {
+                Pages   struct {
+                    Next    string  `json:"next"`
+                }   `json:"pages"`
+            }   `json:"links"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        for _, app := range(list.Apps) {
+            if strings.EqualFold(app.Name(), name) { return &app, nil }
+        }
+        if len(list.Links.Pages.Next) == 0 { break }
+    }
+    return nil, nil
+}
+
+/*! \brief Gets the newest deployment for the app
+ */
+func (do DO_c) latestDeployment (appID string) (*DO_deployment_t, error) {
+    resp, err := do.send("GET", "apps/" + appID + "/deployments?page=1&per_page=1", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Deployments     []DO_deployment_t   `json:"deployments"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+    if len(list.Deployments) == 0 { return nil, fmt.Errorf("App has no deployments") }
+    return &list.Deployments[0], nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- APP FUNCTIONS -----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Creates the app from the spec, or updates the existing app with the same name
+ *  Either one kicks off a new deployment, which is returned with the app
+ */
+func (do DO_c) AssignApp (spec []byte) (*DO_app_t, error) {
+    desired := DO_app_t{Spec: spec}
+    if len(desired.Name()) == 0 { return nil, fmt.Errorf("App spec requires a name") }
+
+    existing, err := do.getApp(desired.Name())
+    if err != nil { return nil, err }
+
+    jStr, _ := json.Marshal(struct {
+        Spec    json.RawMessage     `json:"spec"`
+    }{spec})
+
+    var resp []byte
+    if existing == nil {
+        if do.Verbose { fmt.Println("App does not exist, creating...") }
+        resp, err = do.send("POST", "apps", jStr)
+    } else {
+        if do.Verbose { fmt.Println("App already exists, updating") }
+        resp, err = do.send("PUT", "apps/" + existing.ID, jStr)
+    }
+    if err != nil { return nil, err }
+
+    var result struct {
+        App     DO_app_t    `json:"app"`
+    }
+    if err = json.Unmarshal(resp, &result); err != nil { return nil, err }
+
+    result.App.Deployment, err = do.latestDeployment(result.App.ID)
+    return &result.App, err
+}
+
+/*! \brief Starts a new deployment of an existing app
+ */
+func (do DO_c) DeployApp (name string, forceBuild bool) (*DO_app_t, error) {
+    app, err := do.getApp(name)
+    if err != nil { return nil, err }
+    if app == nil { return nil, fmt.Errorf("App '%s' does not exist", name) }
+
+    jStr, _ := json.Marshal(struct {
+        ForceBuild  bool    `json:"force_build"`
+    }{forceBuild})
+    resp, err := do.send("POST", "apps/" + app.ID + "/deployments", jStr)
+    if err != nil { return nil, err }
+
+    var result struct {
+        Deployment  DO_deployment_t     `json:"deployment"`
+    }
+    err = json.Unmarshal(resp, &result)
+    app.Deployment = &result.Deployment
+    return app, err
+}
+
+/*! \brief Waits for the app's deployment to finish, printing its progress, and refreshes the app for its live url
+ */
+func (do DO_c) WaitForDeployment (app *DO_app_t, maxWait time.Duration) error {
+    if app.Deployment == nil { return fmt.Errorf("App has no deployment to wait for") }
+
+    lastPhase := ""
+    for start := time.Now(); time.Since(start) < maxWait; {
+        resp, err := do.send("GET", "apps/" + app.ID + "/deployments/" + app.Deployment.ID, nil)
+        if err != nil { return err }
+
+        var result struct {
+            Deployment  DO_deployment_t     `json:"deployment"`
+        }
+        if err = json.Unmarshal(resp, &result); err != nil { return err }
+        app.Deployment = &result.Deployment
+
+        p := result.Deployment.Progress
+        if result.Deployment.Phase != lastPhase || do.Verbose {
+            fmt.Printf("Deployment %s: %d of %d steps\n", result.Deployment.Phase, p.SuccessSteps, p.TotalSteps)
+            lastPhase = result.Deployment.Phase
+        }
+
+        switch result.Deployment.Phase {
+        case "ACTIVE":
+            resp, err = do.send("GET", "apps/" + app.ID, nil)   //the live url can change with the deployment
+            if err == nil {
+                var refreshed struct {
+                    App     DO_app_t    `json:"app"`
+                }
+                if err = json.Unmarshal(resp, &refreshed); err == nil { app.LiveURL = refreshed.App.LiveURL }
+            }
+            return err
+        case "ERROR", "CANCELED", "SUPERSEDED":
+            return fmt.Errorf("Deployment %s ended as %s with %d failed steps", result.Deployment.ID, result.Deployment.Phase, p.ErrorSteps)
+        }
+        if err = do.sleep(do_deploy_poll); err != nil { return err }
+    }
+    return fmt.Errorf("Deployment %s did not finish in time", app.Deployment.ID)
+}
@@ -0,0 +1,116 @@
+/*! \file do_balancers.go
+    \brief Digital ocean load balancers, listing them and keeping a stack's balancer in line with what it should forward
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "reflect"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Traffic coming in on the entry port going to the target port on the nodes, ie http 80 to http 8080
+ */
+type DO_forwarding_rule_t struct {
+    EntryProtocol   string  `json:"entry_protocol"`
+    EntryPort       int     `json:"entry_port"`
+    TargetProtocol  string  `json:"target_protocol"`
+    TargetPort      int     `json:"target_port"`
+    CertificateID   string  `json:"certificate_id,omitempty"`    //for https entries
+    TLSPassthrough  bool    `json:"tls_passthrough,omitempty"`
+}
+
+/*! \brief How the balancer decides a node is up, digital ocean's defaults are used when it's left out
+ */
+type DO_health_check_t struct {
+    Protocol    string  `json:"protocol"`
+    Port        int     `json:"port"`
+    Path        string  `json:"path,omitempty"`
+}
+
+type DO_balancer_t struct {
+    ID          string  `json:"id"`
+    Name        string  `json:"name"`
+    IP          string  `json:"ip"`
+    Status      string  `json:"status"`
+    Tag         string  `json:"tag"`     //the nodes it sends traffic to, when it's by tag instead of ids
+    DropletIDs  []int   `json:"droplet_ids"`
+    ForwardingRules []DO_forwarding_rule_t  `json:"forwarding_rules"`
+}
+
+type do_balancer_body_t struct {
+    Name        string  `json:"name"`
+    Region      string  `json:"region"`
+    Tag         string  `json:"tag"`
+    ForwardingRules []DO_forwarding_rule_t  `json:"forwarding_rules"`
+    HealthCheck *DO_health_check_t  `json:"health_check,omitempty"`
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- BALANCER FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the load balancers on the account
+ */
+func (do DO_c) ListLoadBalancers () ([]DO_balancer_t, error) {
+    balancers := make([]DO_balancer_t, 0)
+    var err error
+    pageErr := do.EachPage("load_balancers", "load_balancers", func (item json.RawMessage) bool {
+        var lb DO_balancer_t
+        err = json.Unmarshal(item, &lb)
+        balancers = append(balancers, lb)
+        return err == nil
+    })
+    if pageErr != nil { return nil, pageErr }
+    return balancers, err
+}
+
+/*! \brief Creates or updates the balancer for the stack, it sends traffic to every node tagged as part of the stack
+ *  Waits for a new balancer to get its ip address, so records can be pointed at it
+ */
+func (do DO_c) AssignLoadBalancer (name, region, stack string, rules []DO_forwarding_rule_t, health *DO_health_check_t) (*DO_balancer_t, error) {
+    if len(rules) == 0 { return nil, fmt.Errorf("Load balancer '%s' needs at least one forwarding rule", name) }
+    wanted := do_balancer_body_t{Name: name, Region: region, Tag: do_stack_tag + tagValue(stack), ForwardingRules: rules, HealthCheck: health}
+
+    balancers, err := do.ListLoadBalancers()
+    if err != nil { return nil, err }
+    var existing *DO_balancer_t
+    for i := range(balancers) {
+        if balancers[i].Name == name { existing = &balancers[i] }
+    }
+
+    jStr, _ := json.Marshal(wanted)
+    var resp []byte
+    switch {
+    case existing == nil:
+        fmt.Println("Creating load balancer: " + name)
+        resp, err = do.send("POST", "load_balancers", jStr)
+    case existing.Tag != wanted.Tag || !reflect.DeepEqual(existing.ForwardingRules, rules):
+        fmt.Println("Updating load balancer: " + name)
+        resp, err = do.send("PUT", "load_balancers/" + existing.ID, jStr)
+    default:
+        if do.Verbose { fmt.Println("Load balancer already matches, nothing to do...") }
+        return existing, nil
+    }
+    if err != nil { return nil, err }
+
+    var created struct {
+        Balancer    DO_balancer_t   `json:"load_balancer"`
+    }
+    if err = json.Unmarshal(resp, &created); err != nil { return nil, err }
+    lb := &created.Balancer
+
+    err = do.waitUntil("the load balancer's ip address", func () (bool, error) {
+        if len(lb.IP) > 0 { return true, nil }
+        resp, err := do.send("GET", "load_balancers/" + lb.ID, nil)
+        if err == nil { err = json.Unmarshal(resp, &created) }
+        lb = &created.Balancer
+        return len(lb.IP) > 0, err
+    })
+    return lb, err
+}
@@ -0,0 +1,176 @@
+/*! \file do_capacity.go
+    \brief Disk, memory and load from the nodes over ssh, put next to what their size gives them so the ones that need to grow stand out
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Prints a line for each thing we collect, the root disk's use, total and available memory in mb, the load averages and cpus
+ */
+const do_capacity_script = `echo disk $(df -P / | awk 'NR==2 {print $5}' | tr -d %)
+echo mem $(free -m | awk '/^Mem:/ {print $2, $7}')
+echo load $(cut -d' ' -f1-3 /proc/loadavg)
+echo cpus $(nproc)`
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Where a node becomes a resize candidate, disk and memory are percent used and load is the 5 minute average per cpu
+ */
+type DO_capacity_limits_t struct {
+    Disk        float64
+    Memory      float64
+    Load        float64
+}
+
+/*! \brief A node's row in the capacity report, memory is in mb and disk in gb like the sizes
+ */
+type DO_capacity_t struct {
+    Node        string      `json:"node"`
+    Size        string      `json:"size"`
+    VCPUs       int         `json:"vcpus"`
+    Memory      int         `json:"memory"`
+    Disk        int         `json:"disk"`
+    PriceMonthly    float64 `json:"price_monthly"`
+    DiskUsed    float64     `json:"disk_used"`     //percent
+    MemoryUsed  float64     `json:"memory_used"`   //percent, counting what the kernel can give back as free
+    Load        [3]float64  `json:"load"`
+    LoadPerCPU  float64     `json:"load_per_cpu"`  //the 5 minute average
+    Over        []string    `json:"over"`          //what's past the limits, it's a resize candidate when there's anything here
+    Suggest     string      `json:"suggest,omitempty"` //the cheapest size in the same class with more of what's over
+    Error       string      `json:"error,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Every size by its slug, including the ones that can't be used for new nodes anymore since nodes can still be on them
+ */
+func (do DO_c) sizeMap () (map[string]do_size_t, error) {
+    sizes, err := do.getSizes()
+    if err != nil { return nil, err }
+    bySlug := make(map[string]do_size_t, len(sizes))
+    for _, s := range(sizes) { bySlug[s.Slug] = s }
+    return bySlug, nil
+}
+
+/*! \brief The cheapest available size in the region and the current size's class with at least as much of everything, and more of what's asked for
+ */
+func nextSize (sizes map[string]do_size_t, current, region string, cpu, memory, disk bool) string {
+    cur, ok := sizes[current]
+    if !ok { return "" }
+    best := ""
+    for slug, s := range(sizes) {
+        if !s.Available || !hasString(s.Regions, region) || sizeClass(slug) != sizeClass(current) || slug == current { continue }
+        if s.VCPUs < cur.VCPUs || s.Memory < cur.Memory || s.Disk < cur.Disk { continue }
+        if (cpu && s.VCPUs == cur.VCPUs) || (memory && s.Memory == cur.Memory) || (disk && s.Disk == cur.Disk) { continue }
+        if len(best) == 0 || s.PriceMonthly < sizes[best].PriceMonthly || (s.PriceMonthly == sizes[best].PriceMonthly && slug < best) { best = slug }
+    }
+    return best
+}
+
+/*! \brief Reads the collector script's output into the row
+ */
+func parseCapacity (out string, row *DO_capacity_t) error {
+    cpus := 0
+    for _, line := range(strings.Split(out, "\n")) {
+        fields := strings.Fields(line)
+        if len(fields) < 2 { continue }
+        vals := make([]float64, 0, len(fields) - 1)
+        for _, f := range(fields[1:]) {
+            v, err := strconv.ParseFloat(f, 64)
+            if err != nil { return fmt.Errorf("Unexpected %s from the node :: %s", fields[0], line) }
+            vals = append(vals, v)
+        }
+
+        switch {
+        case fields[0] == "disk":
+            row.DiskUsed = vals[0]
+        case fields[0] == "mem" && len(vals) == 2 && vals[0] > 0:
+            row.MemoryUsed = float64(int((vals[0] - vals[1]) / vals[0] * 1000)) / 10
+        case fields[0] == "load" && len(vals) == 3:
+            copy(row.Load[:], vals)
+        case fields[0] == "cpus":
+            cpus = int(vals[0])
+        }
+    }
+    if cpus == 0 { return fmt.Errorf("Node didn't say how many cpus it has :: %s", strings.TrimSpace(out)) }
+    row.LoadPerCPU = float64(int(row.Load[1] / float64(cpus) * 100)) / 100
+    return nil
+}
+
+/*! \brief Collects from the node and checks it against the limits
+ */
+func (do DO_c) nodeCapacity (node DO_node_t, sizes map[string]do_size_t, limits DO_capacity_limits_t) *DO_capacity_t {
+    size := sizes[node.Size]
+    row := &DO_capacity_t{Node: node.Name, Size: node.Size, VCPUs: size.VCPUs, Memory: size.Memory, Disk: size.Disk, PriceMonthly: size.PriceMonthly, Over: make([]string, 0)}
+    if len(node.IP) == 0 {
+        row.Error = "Node doesn't have a public ip address"
+        return row
+    }
+
+    out, err := do.sshCommand(do.context(), node.IP, do_capacity_script)
+    if err == nil { err = parseCapacity(string(out), row) }
+    if err != nil {
+        row.Error = err.Error()
+        if len(out) > 0 { row.Error += " :: " + lastLines(string(out), 2) }
+        return row
+    }
+
+    over := func (what string, val, limit float64, format string) bool {
+        if limit <= 0 || val <= limit { return false }
+        row.Over = append(row.Over, what + " " + fmt.Sprintf(format, val))
+        return true
+    }
+    disk := over("disk", row.DiskUsed, limits.Disk, "%.0f%%")
+    memory := over("memory", row.MemoryUsed, limits.Memory, "%.0f%%")
+    cpu := over("load", row.LoadPerCPU, limits.Load, "%.2f/cpu")
+    if disk || memory || cpu { row.Suggest = nextSize(sizes, node.Size, node.Region, cpu, memory, disk) }
+    return row
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CAPACITY FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Collects from the nodes over ssh, at most concurrency at a time, resize candidates are first and then it's by name
+ *  A node that can't be reached has the error in its row, the rest of the report still happens
+ */
+func (do DO_c) CapacityReport (nodes []DO_node_t, limits DO_capacity_limits_t, concurrency int) ([]*DO_capacity_t, error) {
+    sizes, err := do.sizeMap()
+    if err != nil { return nil, err }
+
+    if concurrency < 1 { concurrency = 1 }
+    rows := make([]*DO_capacity_t, len(nodes))
+    slots := make(chan struct{}, concurrency)
+    wg := sync.WaitGroup{}
+    for i, n := range(nodes) {
+        wg.Add(1)
+        go func (i int, n DO_node_t) {
+            defer wg.Done()
+            slots <- struct{}{}
+            defer func() { <-slots }()
+            rows[i] = do.nodeCapacity(n, sizes, limits)
+        }(i, n)
+    }
+    wg.Wait()
+
+    sort.SliceStable(rows, func (i, j int) bool {
+        if (len(rows[i].Over) > 0) != (len(rows[j].Over) > 0) { return len(rows[i].Over) > 0 }
+        return rows[i].Node < rows[j].Node
+    })
+    return rows, nil
+}
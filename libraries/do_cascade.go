@@ -0,0 +1,201 @@
+/*! \file do_cascade.go
+    \brief Deleting a node along with everything that points at it, so records aren't left behind for whoever gets its ip address next
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_detach_wait        = 5 * time.Minute
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_cascade_record_t struct {
+    Domain      string  `json:"domain"`
+    ID          int     `json:"id"`
+    Type        string  `json:"type"`
+    Name        string  `json:"name"`
+    Data        string  `json:"data"`
+}
+
+/*! \brief Everything tied to the node that goes when it does, from NodeCascade
+ */
+type DO_cascade_t struct {
+    Node        string      `json:"node"`
+    ID          int         `json:"id"`
+    Region      string      `json:"region"`
+    IPs         []string    `json:"ips"`
+    Records     []DO_cascade_record_t   `json:"records"`
+    Volumes     []string    `json:"volumes"`
+    Firewalls   []string    `json:"firewalls"`   //the ones with the node by its id, tagged ones let go on their own
+    Balancers   []string    `json:"balancers"`
+    FloatingIP  string      `json:"floating_ip,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Names of all the domains on the account
+ */
+func (do DO_c) listDomains () ([]string, error) {
+    domains := make([]string, 0)
+    var err error
+    pageErr := do.EachPage("domains", "domains", func (item json.RawMessage) bool {
+        var d struct {
+            Name    string  `json:"name"`
+        }
+        err = json.Unmarshal(item, &d)
+        domains = append(domains, d.Name)
+        return err == nil
+    })
+    if pageErr != nil { return nil, pageErr }
+    return domains, err
+}
+
+func hasInt (list []int, val int) bool {
+    for _, l := range(list) {
+        if l == val { return true }
+    }
+    return false
+}
+
+/*! \brief Takes the node out of the firewall or load balancer, path is ie 'firewalls/<id>/droplets'
+ */
+func (do DO_c) removeDroplet (path string, id int) error {
+    jStr, _ := json.Marshal(map[string][]int{"droplet_ids": []int{id}})
+    _, err := do.send("DELETE", path, jStr)
+    return err
+}
+
+/*! \brief Detaches the volume from the node and waits for it to finish
+ */
+func (do DO_c) detachVolume (volume string, c *DO_cascade_t) error {
+    fmt.Printf("Detaching volume %s from %s\n", volume, c.Node)
+    jStr, _ := json.Marshal(map[string]interface{}{"type": "detach", "droplet_id": c.ID, "region": c.Region})
+    resp, err := do.send("POST", "volumes/" + volume + "/actions", jStr)
+    if err != nil { return err }
+
+    var action struct {
+        Action  DO_action_t     `json:"action"`
+    }
+    if err = json.Unmarshal(resp, &action); err != nil { return err }
+    _, err = do.WaitForAction(action.Action.ID, do_detach_wait)
+    return err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CASCADE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Finds everything tied to the node, the records pointing at its addresses are looked for in the domain, or every domain when it's empty
+ *  Returns nil when the node doesn't exist
+ */
+func (do DO_c) NodeCascade (name, domain string) (*DO_cascade_t, error) {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil || droplet == nil { return nil, err }
+
+    node := dropletNode(*droplet)
+    c := &DO_cascade_t{Node: droplet.Name, ID: droplet.ID, Region: droplet.Region.Slug, Volumes: droplet.VolumeIDs, IPs: make([]string, 0),
+        Records: make([]DO_cascade_record_t, 0), Firewalls: make([]string, 0), Balancers: make([]string, 0)}
+    if c.Volumes == nil { c.Volumes = make([]string, 0) }
+    for _, ip := range([]string{node.IP, node.PrivateIP, node.IPv6}) {
+        if len(ip) > 0 { c.IPs = append(c.IPs, ip) }
+    }
+
+    domains := []string{domain}
+    if len(domain) == 0 {
+        if domains, err = do.listDomains(); err != nil { return nil, err }
+    }
+    for _, d := range(domains) {
+        records, err := do.listDomainRecords(d)
+        if err != nil { return nil, err }
+        for _, r := range(records) {
+            if hasString(c.IPs, r.Data) { c.Records = append(c.Records, DO_cascade_record_t{Domain: d, ID: r.ID, Type: r.Type, Name: r.Name, Data: r.Data}) }
+        }
+    }
+
+    firewalls, err := do.ListFirewalls()
+    if err != nil { return nil, err }
+    for _, fw := range(firewalls) {
+        if hasInt(fw.DropletIDs, c.ID) { c.Firewalls = append(c.Firewalls, fw.ID) }
+    }
+
+    balancers, err := do.ListLoadBalancers()
+    if err != nil { return nil, err }
+    for _, lb := range(balancers) {
+        if len(lb.Tag) == 0 && hasInt(lb.DropletIDs, c.ID) { c.Balancers = append(c.Balancers, lb.ID) }
+    }
+
+    ips, err := do.ListFloatingIPs()
+    if err != nil { return nil, err }
+    for _, ip := range(ips) {
+        if ip.DropletID == c.ID { c.FloatingIP = ip.IP }
+    }
+    return c, nil
+}
+
+/*! \brief Removes the records, floating ip, firewalls and balancers from the node, drains it and detaches its volumes, then deletes it
+ *  The volumes are only deleted with deleteVolumes, otherwise they're left detached
+ */
+func (do DO_c) CascadeDelete (c *DO_cascade_t, deleteVolumes bool) error {
+    err := do.Progress.Step("remove records " + c.Node, func () error {
+        for _, r := range(c.Records) {
+            fmt.Printf("Deleting %s record %s.%s -> %s\n", r.Type, r.Name, r.Domain, r.Data)
+            if err := do.deleteRequest(fmt.Sprintf("domains/%s/records/%d", r.Domain, r.ID)); err != nil { return err }
+        }
+        return nil
+    })
+    if err != nil { return err }
+
+    err = do.Progress.Step("detach network " + c.Node, func () error {
+        if len(c.FloatingIP) > 0 {
+            fmt.Printf("Unassigning floating ip %s\n", c.FloatingIP)
+            jStr, _ := json.Marshal(do_t{Type: "unassign"})
+            if _, err := do.send("POST", fmt.Sprintf("floating_ips/%s/actions", c.FloatingIP), jStr); err != nil { return err }
+        }
+        for _, id := range(c.Firewalls) {
+            if do.Verbose { fmt.Printf("Removing %s from firewall %s\n", c.Node, id) }
+            if err := do.removeDroplet("firewalls/" + id + "/droplets", c.ID); err != nil { return err }
+        }
+        for _, id := range(c.Balancers) {
+            if do.Verbose { fmt.Printf("Removing %s from load balancer %s\n", c.Node, id) }
+            if err := do.removeDroplet("load_balancers/" + id + "/droplets", c.ID); err != nil { return err }
+        }
+        return nil
+    })
+    if err != nil { return err }
+
+    if len(c.Volumes) > 0 {     //they come off once it's drained, otherwise DeleteNode drains it like always
+        droplet := do.getDropletFromID(c.ID)
+        if err = do.Progress.Step("drain " + c.Node, func () error { return do.drainNode(droplet) }); err != nil { return err }
+        do.SkipDrain = true
+
+        err = do.Progress.Step("detach volumes " + c.Node, func () error {
+            for _, v := range(c.Volumes) {
+                if err := do.detachVolume(v, c); err != nil { return err }
+            }
+            return nil
+        })
+        if err != nil { return err }
+    }
+
+    if err = do.DeleteNode(c.Node); err != nil || !deleteVolumes || len(c.Volumes) == 0 { return err }
+    return do.Progress.Step("delete volumes " + c.Node, func () error {
+        for _, v := range(c.Volumes) {
+            fmt.Println("Deleting volume: " + v)
+            if err := do.deleteRequest("volumes/" + v); err != nil { return err }
+        }
+        return nil
+    })
+}
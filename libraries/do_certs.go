@@ -0,0 +1,144 @@
+/*! \file do_certs.go
+    \brief Digital ocean certificates, uploaded custom ones or managed let's encrypt ones, used by the cdn
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_cert_t struct {
+    ID          string      `json:"id"`
+    Name        string      `json:"name"`
+    Type        string      `json:"type"`
+    State       string      `json:"state"`
+    NotAfter    time.Time   `json:"not_after"`
+    DNSNames    []string    `json:"dns_names"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the certificate by its name or id, nil if it doesn't exist
+ */
+func (do DO_c) getCertificate (nameOrID string) (*DO_cert_t, error) {
+    certs, err := do.ListCertificates()
+    if err == nil {
+        for _, cert := range(certs) {
+            if cert.ID == nameOrID || strings.EqualFold(cert.Name, nameOrID) { return &cert, nil }
+        }
+    }
+    return nil, err
+}
+
+/*! \brief Creates the certificate, unless one by that name is already there
+ */
+func (do DO_c) createCertificate (cert interface{}, name string) (*DO_cert_t, error) {
+    existing, err := do.getCertificate(name)
+    if err != nil { return nil, err }
+    if existing != nil {
+        if do.Verbose { fmt.Println("Certificate already exists") }
+        return existing, nil
+    }
+
+    if do.Verbose { fmt.Println("Certificate does not exist, creating...") }
+    jStr, _ := json.Marshal(cert)
+    resp, err := do.send("POST", "certificates", jStr)
+    if err != nil { return nil, err }
+
+    var created struct {
+        Certificate     DO_cert_t   `json:"certificate"`
+    }
+    err = json.Unmarshal(resp, &created)
+    return &created.Certificate, err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CERTIFICATE FUNCTIONS ---------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Days until the certificate expires
+ */
+func (cert DO_cert_t) DaysLeft () int {
+    return int(time.Until(cert.NotAfter).Hours() / 24)
+}
+
+/*! \brief Lists all the certificates
+ */
+func (do DO_c) ListCertificates () ([]DO_cert_t, error) {
+    certs := make([]DO_cert_t, 0)
+    for page := 1; page > 0; page++ {
+        resp, err := do.send("GET", fmt.Sprintf("certificates?page=%d&per_page=100", page), nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            Certificates    []DO_cert_t     `json:"certificates"`
+            Links   struct {
+                Pages   struct {
+                    Next    string  `json:"next"`
+                }   `json:"pages"`
+            }   `json:"links"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        certs = append(certs, list.Certificates...)
+        if len(list.Links.Pages.Next) == 0 { break }
+    }
+    return certs, nil
+}
+
+/*! \brief Gets the id of the certificate from its name, ids are passed straight through
+ */
+func (do DO_c) CertificateID (nameOrID string) (string, error) {
+    if len(nameOrID) == 0 { return "", nil }
+
+    cert, err := do.getCertificate(nameOrID)
+    if err != nil { return "", err }
+    if cert == nil { return "", fmt.Errorf("Certificate '%s' does not exist", nameOrID) }
+    return cert.ID, nil
+}
+
+/*! \brief Uploads a custom certificate, the key, certificate and chain are all pem encoded
+ */
+func (do DO_c) UploadCertificate (name, privateKey, leaf, chain string) (*DO_cert_t, error) {
+    return do.createCertificate(struct {
+        Name        string  `json:"name"`
+        Type        string  `json:"type"`
+        PrivateKey  string  `json:"private_key"`
+        Leaf        string  `json:"leaf_certificate"`
+        Chain       string  `json:"certificate_chain,omitempty"`
+    }{name, "custom", privateKey, leaf, chain}, name)
+}
+
+/*! \brief Creates a let's encrypt certificate managed by digital ocean, the domains need to use digital ocean's dns
+ */
+func (do DO_c) CreateManagedCertificate (name string, dnsNames []string) (*DO_cert_t, error) {
+    return do.createCertificate(struct {
+        Name        string      `json:"name"`
+        Type        string      `json:"type"`
+        DNSNames    []string    `json:"dns_names"`
+    }{name, "lets_encrypt", dnsNames}, name)
+}
+
+/*! \brief Deletes the certificate by its name or id
+ */
+func (do DO_c) DeleteCertificate (nameOrID string) error {
+    cert, err := do.getCertificate(nameOrID)
+    if err == nil {
+        if cert == nil {
+            if do.Verbose { fmt.Println("Certificate does not exist, nothing to do...") }
+        } else {
+            err = do.deleteRequest("certificates/" + cert.ID)
+        }
+    }
+    return err
+}
@@ -0,0 +1,71 @@
+/*! \file do_console.go
+    \brief Getting on-call into a broken node, the console and recovery links along with the power cycle and password reset actions
+ *  The api doesn't hand out console sessions or boot the recovery iso, so those are links into the dashboard
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_dashboard_url      = "https://cloud.digitalocean.com/droplets/"
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_console_t struct {
+    ID          int     `json:"id"`
+    Name        string  `json:"name"`
+    Status      string  `json:"status"`
+    IP          string  `json:"ip"`
+    ConsoleURL  string  `json:"console_url"`
+    RecoveryURL string  `json:"recovery_url"`    //where the recovery iso is turned on
+    Action      *DO_action_t    `json:"action,omitempty"`   //the power cycle or password reset we ran
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CONSOLE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the console and recovery links for the node, running the action first when it's set
+ *  action is power_cycle to hard reboot it or password_reset to have a new root password emailed for the console login
+ */
+func (do DO_c) NodeConsole (name, action string) (*DO_console_t, error) {
+    if len(action) > 0 && action != "power_cycle" && action != "password_reset" {
+        return nil, fmt.Errorf("Unknown console action '%s', expecting power_cycle or password_reset", action)
+    }
+
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return nil, err }
+    if droplet == nil { return nil, fmt.Errorf("Node '%s' does not exist", name) }
+
+    console := &DO_console_t{ID: droplet.ID, Name: droplet.Name, ConsoleURL: fmt.Sprintf("%s%d/console", do_dashboard_url, droplet.ID), RecoveryURL: fmt.Sprintf("%s%d/recovery", do_dashboard_url, droplet.ID)}
+    if len(action) > 0 {
+        fmt.Printf("Running %s on %s\n", action, name)
+        jStr, _ := json.Marshal(do_t{Type: action})
+        var resp []byte
+        err := do.whenUnlocked(droplet, func () (err error) {
+            resp, err = do.send("POST", fmt.Sprintf("droplets/%d/actions", droplet.ID), jStr)
+            return
+        })
+        if err != nil { return nil, err }
+
+        var started struct {
+            Action  DO_action_t     `json:"action"`
+        }
+        if err = json.Unmarshal(resp, &started); err != nil { return nil, err }
+        if console.Action, err = do.WaitForAction(started.Action.ID, time.Minute * 5); err != nil { return console, err }
+    }
+
+    droplet = do.getDropletFromID(droplet.ID)    //the status after the action
+    console.Status, console.IP = droplet.Status, droplet.publicIP()
+    return console, nil
+}
@@ -0,0 +1,268 @@
+/*! \file do_databases.go
+    \brief Digital ocean managed databases, their connection pools, read only replicas, maintenance windows and forks
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net/url"
+    "encoding/json"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_database_t struct {
+    ID          string  `json:"id"`
+    Name        string  `json:"name"`
+    Engine      string  `json:"engine"`
+    Version     string  `json:"version"`
+    Region      string  `json:"region"`
+    Size        string  `json:"size"`
+    NumNodes    int     `json:"num_nodes"`
+    Status      string  `json:"status"`
+    Maintenance struct {
+        Day     string  `json:"day"`
+        Hour    string  `json:"hour"`
+    }   `json:"maintenance_window"`
+}
+
+/*! \brief PgBouncer connection pool, mode is session, transaction or statement
+ */
+type DO_db_pool_t struct {
+    Name        string  `json:"name"`
+    Mode        string  `json:"mode"`
+    Size        int     `json:"size"`
+    DB          string  `json:"db"`
+    User        string  `json:"user,omitempty"`
+}
+
+type DO_replica_t struct {
+    Name        string  `json:"name"`
+    Region      string  `json:"region"`
+    Size        string  `json:"size"`
+    Status      string  `json:"status,omitempty"`
+    Connection  struct {
+        Host    string  `json:"host"`
+        Port    int     `json:"port"`
+    }   `json:"connection"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the database cluster by its name, it not existing is an error
+ */
+func (do DO_c) getDatabase (name string) (*DO_database_t, error) {
+    resp, err := do.send("GET", "databases", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Databases   []DO_database_t     `json:"databases"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+    for _, db := range(list.Databases) {
+        if strings.EqualFold(db.Name, name) { return &db, nil }
+    }
+    return nil, fmt.Errorf("Database cluster '%s' does not exist", name)
+}
+
+/*! \brief Gets the connection pools for the database cluster by its id
+ */
+func (do DO_c) getDatabasePools (id string) ([]DO_db_pool_t, error) {
+    resp, err := do.send("GET", "databases/" + id + "/pools", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Pools   []DO_db_pool_t  `json:"pools"`
+    }
+    err = json.Unmarshal(resp, &list)
+    return list.Pools, err
+}
+
+/*! \brief Gets the read only replicas for the database cluster by its id
+ */
+func (do DO_c) getReplicas (id string) ([]DO_replica_t, error) {
+    resp, err := do.send("GET", "databases/" + id + "/replicas", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Replicas    []DO_replica_t  `json:"replicas"`
+    }
+    err = json.Unmarshal(resp, &list)
+    return list.Replicas, err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- POOL FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the connection pools for the database cluster
+ */
+func (do DO_c) ListDatabasePools (database string) ([]DO_db_pool_t, error) {
+    db, err := do.getDatabase(database)
+    if err != nil { return nil, err }
+    return do.getDatabasePools(db.ID)
+}
+
+/*! \brief Creates the connection pool, or updates the existing one with the same name
+ *  Without a user the pool connects as whoever the client logs in as
+ */
+func (do DO_c) AssignDatabasePool (database string, pool DO_db_pool_t) error {
+    db, err := do.getDatabase(database)
+    if err != nil { return err }
+    pools, err := do.getDatabasePools(db.ID)
+    if err != nil { return err }
+
+    jStr, _ := json.Marshal(pool)
+    for _, existing := range(pools) {
+        if existing.Name != pool.Name { continue }
+
+        if existing == pool {
+            if do.Verbose { fmt.Println("Connection pool already set, nothing to do...") }
+            return nil
+        }
+        if do.Verbose { fmt.Println("Connection pool already exists, updating") }
+        _, err = do.send("PUT", "databases/" + db.ID + "/pools/" + url.PathEscape(pool.Name), jStr)
+        return err
+    }
+
+    if do.Verbose { fmt.Println("Connection pool does not exist, creating...") }
+    _, err = do.send("POST", "databases/" + db.ID + "/pools", jStr)
+    return err
+}
+
+/*! \brief Deletes the connection pool
+ */
+func (do DO_c) DeleteDatabasePool (database, name string) error {
+    db, err := do.getDatabase(database)
+    if err != nil { return err }
+
+    _, err = do.send("DELETE", "databases/" + db.ID + "/pools/" + url.PathEscape(name), nil)
+    if doNotFound(err) {
+        if do.Verbose { fmt.Println("Connection pool does not exist, nothing to do...") }
+        return nil
+    }
+    return err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- REPLICA FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the read only replicas of the database cluster
+ */
+func (do DO_c) ListReplicas (database string) ([]DO_replica_t, error) {
+    db, err := do.getDatabase(database)
+    if err != nil { return nil, err }
+
+    return do.getReplicas(db.ID)
+}
+
+/*! \brief Creates the read only replica, if one with that name doesn't already exist
+ *  Region and size default to the ones of the database cluster
+ */
+func (do DO_c) CreateReplica (database, name, region, size string) (*DO_replica_t, error) {
+    db, err := do.getDatabase(database)
+    if err != nil { return nil, err }
+
+    replicas, err := do.getReplicas(db.ID)
+    if err != nil { return nil, err }
+    for _, r := range(replicas) {
+        if strings.EqualFold(r.Name, name) {
+            if do.Verbose { fmt.Println("Replica already exists") }
+            return &r, nil
+        }
+    }
+
+    if len(region) == 0 { region = db.Region }
+    if len(size) == 0 { size = db.Size }
+
+    if do.Verbose { fmt.Println("Replica does not exist, creating...") }
+    jStr, _ := json.Marshal(DO_replica_t{Name: name, Region: region, Size: size})
+    resp, err := do.send("POST", "databases/" + db.ID + "/replicas", jStr)
+    if err != nil { return nil, err }
+
+    var created struct {
+        Replica     DO_replica_t    `json:"replica"`
+    }
+    err = json.Unmarshal(resp, &created)
+    return &created.Replica, err
+}
+
+/*! \brief Deletes the read only replica
+ */
+func (do DO_c) DeleteReplica (database, name string) error {
+    db, err := do.getDatabase(database)
+    if err != nil { return err }
+
+    _, err = do.send("DELETE", "databases/" + db.ID + "/replicas/" + url.PathEscape(name), nil)
+    if doNotFound(err) {
+        if do.Verbose { fmt.Println("Replica does not exist, nothing to do...") }
+        return nil
+    }
+    return err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- DATABASE FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Sets when the database cluster gets its updates, the day is ie 'tuesday' and the hour is utc, ie '14:00'
+ */
+func (do DO_c) SetMaintenanceWindow (database, day, hour string) error {
+    db, err := do.getDatabase(database)
+    if err != nil { return err }
+
+    day = strings.ToLower(day)
+    if db.Maintenance.Day == day && strings.HasPrefix(db.Maintenance.Hour, hour) {
+        if do.Verbose { fmt.Println("Maintenance window already set, nothing to do...") }
+        return nil
+    }
+
+    jStr, _ := json.Marshal(struct {
+        Day     string  `json:"day"`
+        Hour    string  `json:"hour"`
+    }{day, hour})
+    _, err = do.send("PUT", "databases/" + db.ID + "/maintenance", jStr)
+    return err
+}
+
+/*! \brief Creates a new database cluster from the backups of another, as it was at the point in time
+ *  A zero time uses the latest backup.  This is how we restore too, the original is left alone
+ */
+func (do DO_c) ForkDatabase (database, name string, at time.Time) (*DO_database_t, error) {
+    db, err := do.getDatabase(database)
+    if err != nil { return nil, err }
+
+    restore := struct {
+        DatabaseName    string  `json:"database_name"`
+        CreatedAt       string  `json:"backup_created_at,omitempty"`
+    }{DatabaseName: db.Name}
+    if !at.IsZero() { restore.CreatedAt = at.UTC().Format(time.RFC3339) }
+
+    if do.Verbose { fmt.Printf("Forking database %s to %s\n", db.Name, name) }
+    jStr, _ := json.Marshal(struct {
+        Name        string  `json:"name"`
+        Engine      string  `json:"engine"`
+        Version     string  `json:"version"`
+        Region      string  `json:"region"`
+        Size        string  `json:"size"`
+        NumNodes    int     `json:"num_nodes"`
+        Restore     interface{}     `json:"backup_restore"`
+    }{name, db.Engine, db.Version, db.Region, db.Size, db.NumNodes, restore})
+    resp, err := do.send("POST", "databases", jStr)
+    if err != nil { return nil, err }
+
+    var created struct {
+        Database    DO_database_t   `json:"database"`
+    }
+    err = json.Unmarshal(resp, &created)
+    return &created.Database, err
+}
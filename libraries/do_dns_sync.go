@@ -0,0 +1,171 @@
+/*! \file do_dns_sync.go
+    \brief Keeps the A records in a domain in step with the nodes that have a tag
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "sort"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_sync_owner_prefix  = "_hm-sync."    //TXT record next to each A record the sync manages, so we only ever remove our own
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief One thing the sync did, or would do with a dry run
+ */
+type DO_sync_change_t struct {
+    Action      string  `json:"action"`  //create, adopt, update, delete or conflict
+    Name        string  `json:"name"`
+    IP          string  `json:"ip"`
+    Message     string  `json:"message,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief All the records in the domain
+ */
+func (do DO_c) listDomainRecords (domain string) ([]do_domain_record_t, error) {
+    records := make([]do_domain_record_t, 0)
+    var err error
+    pageErr := do.EachPage("domains/" + domain + "/records", "domain_records", func (item json.RawMessage) bool {
+        var r do_domain_record_t
+        err = json.Unmarshal(item, &r)
+        records = append(records, r)
+        return err == nil
+    })
+    if pageErr != nil { return nil, pageErr }
+    return records, err
+}
+
+/*! \brief What goes in the owner TXT record, the tag keeps two syncs on the same domain from removing each other's records
+ */
+func syncOwner (tag string) string {
+    return "heritage=harbormaster,tag=" + tag
+}
+
+/*! \brief Makes the change to the domain, existing is what's there now for the name
+ */
+func (do DO_c) applySyncChange (domain, tag string, change DO_sync_change_t, existing []do_domain_record_t) (err error) {
+    if do.Verbose { fmt.Printf("%s %s.%s %s\n", change.Action, change.Name, domain, change.IP) }
+
+    switch change.Action {
+    case "create":
+        jStr, _ := json.Marshal(do_domain_record_t{Type: "A", Name: change.Name, Data: change.IP})
+        if _, err = do.send("POST", fmt.Sprintf("domains/%s/records", domain), jStr); err != nil { return }
+        if len(existing) > 0 { return } //the owner TXT is still there from before
+        fallthrough
+
+    case "adopt":   //the A record is already right, it just needs marking as ours
+        jStr, _ := json.Marshal(do_domain_record_t{Type: "TXT", Name: do_sync_owner_prefix + change.Name, Data: syncOwner(tag)})
+        _, err = do.send("POST", fmt.Sprintf("domains/%s/records", domain), jStr)
+
+    case "update":
+        jStr, _ := json.Marshal(do_domain_record_t{Type: "A", Name: change.Name, Data: change.IP})
+        for _, r := range(existing) {
+            if r.Type == "A" {
+                if _, err = do.send("PUT", fmt.Sprintf("domains/%s/records/%d", domain, r.ID), jStr); err != nil { return }
+            }
+        }
+
+    case "delete":
+        for _, r := range(existing) {
+            if r.Type == "A" || r.Type == "TXT" {
+                if err = do.DeleteDomainRecordID(domain, fmt.Sprint(r.ID)); err != nil { return }
+            }
+        }
+    }
+    return
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- SYNC FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Makes sure every node with the tag has an A record named after it in the domain, pointing at its public or private ip
+ *  Records the sync created for nodes that are gone are removed.  A record we didn't create pointing somewhere else is left alone as a conflict
+ *  Nodes without an ip yet keep the record they have.  allowed is asked about every name before anything changes, ie for the protected records
+ */
+func (do DO_c) SyncNodeRecords (domain, tag string, private, dryRun bool, allowed func (name string) error) ([]DO_sync_change_t, error) {
+    domain = strings.ToLower(domain)
+    nodes, err := do.ListNodes(tag, "")
+    if err != nil { return nil, err }
+    records, err := do.listDomainRecords(domain)
+    if err != nil { return nil, err }
+
+    byName := make(map[string][]do_domain_record_t)   //the A records and our owner TXT records, by the name they're for
+    owned := make(map[string]bool)
+    for _, r := range(records) {
+        name := strings.ToLower(r.Name)
+        if r.Type == "A" {
+            byName[name] = append(byName[name], r)
+        } else if r.Type == "TXT" && strings.HasPrefix(name, do_sync_owner_prefix) && strings.Trim(r.Data, `"`) == syncOwner(tag) {
+            name = strings.TrimPrefix(name, do_sync_owner_prefix)
+            byName[name] = append(byName[name], r)
+            owned[name] = true
+        }
+    }
+
+    changes := make([]DO_sync_change_t, 0)
+    wanted := make(map[string]bool)
+    for _, n := range(nodes) {
+        name, ip := strings.ToLower(n.Name), n.IP
+        if private { ip = n.PrivateIP }
+        wanted[name] = true     //even without an ip, it's still there and its record stays
+        if len(ip) == 0 { continue }    //nothing to point it at yet
+
+        current := ""
+        for _, r := range(byName[name]) {
+            if r.Type == "A" { current = r.Data }
+        }
+
+        switch {
+        case len(current) == 0:
+            changes = append(changes, DO_sync_change_t{Action: "create", Name: name, IP: ip})
+        case !owned[name] && current != ip:
+            changes = append(changes, DO_sync_change_t{Action: "conflict", Name: name, IP: ip, Message: "Existing record points at " + current + " and wasn't created by the sync"})
+        case !owned[name]:  //points at the right place, so we take it over
+            changes = append(changes, DO_sync_change_t{Action: "adopt", Name: name, IP: ip})
+        case current != ip:
+            changes = append(changes, DO_sync_change_t{Action: "update", Name: name, IP: ip})
+        }
+    }
+
+    gone := make([]string, 0)
+    for name := range(owned) {
+        if !wanted[name] { gone = append(gone, name) }
+    }
+    sort.Strings(gone)
+    for _, name := range(gone) {
+        change := DO_sync_change_t{Action: "delete", Name: name}
+        for _, r := range(byName[name]) {
+            if r.Type == "A" { change.IP = r.Data }
+        }
+        changes = append(changes, change)
+    }
+
+    for _, change := range(changes) {
+        if change.Action == "conflict" || allowed == nil { continue }
+        if err = allowed(change.Name); err != nil { return nil, err }    //nothing was changed
+    }
+
+    conflicts := 0
+    for _, change := range(changes) {
+        if change.Action == "conflict" { conflicts++ }
+        if dryRun { continue }
+        if err = do.applySyncChange(domain, tag, change, byName[change.Name]); err != nil { return changes, err }
+    }
+    if conflicts > 0 { return changes, fmt.Errorf("%d records in %s conflict with the nodes and were left alone", conflicts, domain) }
+    return changes, nil
+}
@@ -0,0 +1,58 @@
+/*! \file do_exec.go
+    \brief Running a command on a node over ssh with its output streamed back, so the droplet listing is the host list instead of one kept by hand
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "io"
+    "os/exec"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief How the command went on a node
+ */
+type DO_exec_t struct {
+    Node        string  `json:"node"`
+    IP          string  `json:"ip"`
+    ExitCode    int     `json:"exit_code"`     //-1 when the command didn't get to run or finish, ie ssh couldn't connect
+    Seconds     float64 `json:"seconds"`
+    Result      string  `json:"result"`        //ok, or the error
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- EXEC FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Runs the command on the node over ssh as the ready user, stdout and stderr both go to out as they come
+ */
+func (do DO_c) ExecNode (node DO_node_t, command string, out io.Writer) *DO_exec_t {
+    start := time.Now()
+    result := &DO_exec_t{Node: node.Name, IP: node.IP, ExitCode: -1, Result: "ok"}
+    err := do.execNode(node, command, out, result)
+    result.Seconds = time.Since(start).Round(time.Millisecond).Seconds()
+    if err != nil { result.Result = err.Error() }
+    return result
+}
+
+func (do DO_c) execNode (node DO_node_t, command string, out io.Writer, result *DO_exec_t) error {
+    if do.ReadOnly { return readOnlyError("run a command on", node.Name) }
+    if len(node.IP) == 0 { return fmt.Errorf("Node '%s' doesn't have a public ip address to run the command on", node.Name) }
+
+    cmd := do.sshCmd(do.context(), node.IP, command)
+    cmd.Stdout, cmd.Stderr = out, out
+    err := cmd.Run()
+    if exitErr, ok := err.(*exec.ExitError); ok {
+        result.ExitCode = exitErr.ExitCode()
+        if result.ExitCode == 255 { return fmt.Errorf("ssh to %s failed", node.IP) }     //ssh's own errors, the command never ran
+        return fmt.Errorf("exit status %d", result.ExitCode)
+    }
+    if err != nil { return fmt.Errorf("Unable to run ssh :: %s", err.Error()) }
+    result.ExitCode = 0
+    return nil
+}
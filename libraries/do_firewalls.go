@@ -0,0 +1,225 @@
+/*! \file do_firewalls.go
+    \brief Digital ocean cloud firewalls, built from the named rule sets in the config and applied to a stack's nodes by their tag
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "sort"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Where traffic comes from or goes to, ie addresses '0.0.0.0/0' or the tag 'hm:stack:db'
+ */
+type DO_fw_target_t struct {
+    Addresses   []string    `json:"addresses,omitempty"`
+    Tags        []string    `json:"tags,omitempty"`
+    DropletIDs  []int       `json:"droplet_ids,omitempty"`
+    LoadBalancers   []string    `json:"load_balancer_uids,omitempty"`
+}
+
+type DO_fw_rule_t struct {
+    Protocol    string      `json:"protocol"`    //tcp, udp or icmp
+    Ports       string      `json:"ports,omitempty"`     //ie '22', '8000-9000' or 'all', icmp doesn't have any
+    Sources     *DO_fw_target_t `json:"sources,omitempty"`   //inbound rules
+    Destinations    *DO_fw_target_t `json:"destinations,omitempty"`  //outbound rules
+}
+
+/*! \brief A named set of rules from the config, ie 'web' or 'ssh-from-office'
+ */
+type DO_rule_set_t struct {
+    Inbound     []DO_fw_rule_t  `json:"inbound"`
+    Outbound    []DO_fw_rule_t  `json:"outbound"`
+}
+
+type DO_firewall_t struct {
+    ID          string          `json:"id,omitempty"`
+    Name        string          `json:"name"`
+    Status      string          `json:"status,omitempty"`
+    Inbound     []DO_fw_rule_t  `json:"inbound_rules"`
+    Outbound    []DO_fw_rule_t  `json:"outbound_rules"`
+    Tags        []string        `json:"tags"`
+    DropletIDs  []int           `json:"droplet_ids,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A single line for the rule, so two rules can be compared and the diff reads easily
+ */
+func (rule DO_fw_rule_t) key (direction string) string {
+    ports := rule.Ports
+    if ports == "0" || len(ports) == 0 { ports = "all" }   //digital ocean hands back 0 for all ports
+
+    target, word := rule.Sources, "from"
+    if direction == "outbound" { target, word = rule.Destinations, "to" }
+
+    parts := make([]string, 0)
+    if target != nil {
+        parts = append(parts, target.Addresses...)
+        for _, t := range(target.Tags) { parts = append(parts, "tag:" + t) }
+        for _, id := range(target.DropletIDs) { parts = append(parts, fmt.Sprintf("droplet:%d", id)) }
+        for _, lb := range(target.LoadBalancers) { parts = append(parts, "lb:" + lb) }
+    }
+    sort.Strings(parts)
+    return fmt.Sprintf("%s %s %s %s %s", direction, strings.ToLower(rule.Protocol), ports, word, strings.Join(parts, ","))
+}
+
+func ruleKeys (fw DO_firewall_t) map[string]bool {
+    keys := make(map[string]bool)
+    for _, r := range(fw.Inbound) { keys[r.key("inbound")] = true }
+    for _, r := range(fw.Outbound) { keys[r.key("outbound")] = true }
+    return keys
+}
+
+/*! \brief Name of the firewall for the stack, firewall names can only have letters, numbers, dots and dashes
+ */
+func firewallName (stack string) string {
+    return "hm-" + strings.NewReplacer(":", "-", "_", "-").Replace(tagValue(stack))
+}
+
+/*! \brief Puts the named rule sets from the config together, when none of them have outbound rules everything outbound is allowed
+ *  Rules in more than one set are only added once
+ */
+func (do DO_c) composeRules (sets []string) (DO_rule_set_t, error) {
+    composed := DO_rule_set_t{}
+    seen := make(map[string]bool)
+    for _, name := range(sets) {
+        set, ok := do.Config.FirewallRules[strings.TrimSpace(name)]
+        if !ok { return composed, fmt.Errorf("Rule set '%s' not found in the firewall_rules of the config", name) }
+        for _, r := range(set.Inbound) {
+            if !seen[r.key("inbound")] { composed.Inbound = append(composed.Inbound, r) }
+            seen[r.key("inbound")] = true
+        }
+        for _, r := range(set.Outbound) {
+            if !seen[r.key("outbound")] { composed.Outbound = append(composed.Outbound, r) }
+            seen[r.key("outbound")] = true
+        }
+    }
+
+    if len(composed.Outbound) == 0 {
+        anywhere := &DO_fw_target_t{Addresses: []string{"0.0.0.0/0", "::/0"}}
+        for _, proto := range([]string{"tcp", "udp", "icmp"}) {
+            rule := DO_fw_rule_t{Protocol: proto, Destinations: anywhere}
+            if proto != "icmp" { rule.Ports = "all" }
+            composed.Outbound = append(composed.Outbound, rule)
+        }
+    }
+    return composed, nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- FIREWALL FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists all the firewalls on the account
+ */
+func (do DO_c) ListFirewalls () ([]DO_firewall_t, error) {
+    firewalls := make([]DO_firewall_t, 0)
+    var err error
+    pageErr := do.EachPage("firewalls", "firewalls", func (item json.RawMessage) bool {
+        var fw DO_firewall_t
+        err = json.Unmarshal(item, &fw)
+        firewalls = append(firewalls, fw)
+        return err == nil
+    })
+    if pageErr != nil { return nil, pageErr }
+    return firewalls, err
+}
+
+/*! \brief Creates or updates the stack's firewall from the rule sets, it applies to every node tagged as part of the stack
+ *  Returns the rule changes, + for added and - for removed.  With dryRun nothing is changed
+ */
+func (do DO_c) ApplyFirewall (stack string, sets []string, dryRun bool) ([]string, error) {
+    rules, err := do.composeRules(sets)
+    if err != nil { return nil, err }
+
+    wanted := DO_firewall_t{Name: firewallName(stack), Inbound: rules.Inbound, Outbound: rules.Outbound, Tags: []string{do_stack_tag + tagValue(stack)}}
+
+    firewalls, err := do.ListFirewalls()
+    if err != nil { return nil, err }
+    var existing *DO_firewall_t
+    for i := range(firewalls) {
+        if firewalls[i].Name == wanted.Name { existing = &firewalls[i] }
+    }
+
+    current := make(map[string]bool)
+    if existing != nil { current = ruleKeys(*existing) }
+    want := ruleKeys(wanted)
+
+    diff := make([]string, 0)
+    for k := range(want) {
+        if !current[k] { diff = append(diff, "+ " + k) }
+    }
+    for k := range(current) {
+        if !want[k] { diff = append(diff, "- " + k) }
+    }
+    sort.Slice(diff, func (i, j int) bool { return diff[i][2:] < diff[j][2:] })
+
+    if dryRun { return diff, nil }
+
+    jStr, _ := json.Marshal(wanted)
+    if existing == nil {
+        fmt.Println("Creating firewall: " + wanted.Name)
+        _, err = do.send("POST", "firewalls", jStr)
+    } else if len(diff) > 0 || !hasString(existing.Tags, wanted.Tags[0]) {
+        fmt.Println("Updating firewall: " + wanted.Name)
+        _, err = do.send("PUT", "firewalls/" + existing.ID, jStr)
+    } else if do.Verbose {
+        fmt.Println("Firewall already matches, nothing to do...")
+    }
+    return diff, err
+}
+
+/*! \brief The firewalls that apply to the node, by its id or one of its tags
+ */
+func (do DO_c) NodeFirewalls (name string) ([]DO_firewall_t, error) {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return nil, err }
+    if droplet == nil { return nil, fmt.Errorf("Node '%s' does not exist", name) }
+
+    firewalls, err := do.ListFirewalls()
+    if err != nil { return nil, err }
+    applies := make([]DO_firewall_t, 0)
+    for _, fw := range(firewalls) {
+        ours := false
+        for _, id := range(fw.DropletIDs) { ours = ours || id == droplet.ID }
+        for _, t := range(fw.Tags) { ours = ours || hasString(droplet.Tags, t) }
+        if ours { applies = append(applies, fw) }
+    }
+    return applies, nil
+}
+
+/*! \brief Adds the inbound rule to the firewall, leaving the rest of its rules alone
+ */
+func (do DO_c) AddFirewallRule (id string, rule DO_fw_rule_t) error {
+    if do.Verbose { fmt.Println("Adding firewall rule " + rule.key("inbound")) }
+    jStr, _ := json.Marshal(map[string][]DO_fw_rule_t{"inbound_rules": []DO_fw_rule_t{rule}})
+    _, err := do.send("POST", "firewalls/" + id + "/rules", jStr)
+    return err
+}
+
+/*! \brief Removes the inbound rule from the firewall, false when it wasn't there anymore, ie -fw put the rule sets back or the firewall is gone
+ */
+func (do DO_c) RemoveFirewallRule (id string, rule DO_fw_rule_t) (bool, error) {
+    resp, err := do.send("GET", "firewalls/" + id, nil)
+    if doNotFound(err) { return false, nil }
+    if err != nil { return false, err }
+    var fw struct {
+        Firewall    DO_firewall_t   `json:"firewall"`
+    }
+    if err = json.Unmarshal(resp, &fw); err != nil { return false, err }
+    if !ruleKeys(fw.Firewall)[rule.key("inbound")] { return false, nil }
+
+    if do.Verbose { fmt.Println("Removing firewall rule " + rule.key("inbound")) }
+    jStr, _ := json.Marshal(map[string][]DO_fw_rule_t{"inbound_rules": []DO_fw_rule_t{rule}})
+    _, err = do.send("DELETE", "firewalls/" + id + "/rules", jStr)
+    return err == nil, err
+}
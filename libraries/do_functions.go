@@ -0,0 +1,179 @@
+/*! \file do_functions.go
+    \brief Digital ocean functions namespaces and their scheduled triggers, for our cron style jobs
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net/url"
+    "encoding/json"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_namespace_t struct {
+    ID          string  `json:"namespace"`
+    Label       string  `json:"label"`
+    Region      string  `json:"region"`
+    APIHost     string  `json:"api_host"`
+}
+
+type DO_trigger_t struct {
+    Name        string  `json:"name"`
+    Function    string  `json:"function"`
+    Type        string  `json:"type"`
+    Enabled     bool    `json:"is_enabled"`
+    Schedule    struct {
+        Cron    string          `json:"cron"`
+        Body    json.RawMessage `json:"body,omitempty"`
+    }   `json:"scheduled_details"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the namespace by its label, nil if it doesn't exist
+ */
+func (do DO_c) getNamespace (label string) (*DO_namespace_t, error) {
+    namespaces, err := do.ListNamespaces()
+    if err == nil {
+        for _, ns := range(namespaces) {
+            if strings.EqualFold(ns.Label, label) { return &ns, nil }
+        }
+    }
+    return nil, err
+}
+
+/*! \brief Same as getNamespace, but it not existing is an error
+ */
+func (do DO_c) requireNamespace (label string) (*DO_namespace_t, error) {
+    ns, err := do.getNamespace(label)
+    if err == nil && ns == nil { err = fmt.Errorf("Functions namespace '%s' does not exist", label) }
+    return ns, err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- FUNCTIONS FUNCTIONS -----------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists all the functions namespaces
+ */
+func (do DO_c) ListNamespaces () ([]DO_namespace_t, error) {
+    resp, err := do.send("GET", "functions/namespaces", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Namespaces  []DO_namespace_t    `json:"namespaces"`
+    }
+    err = json.Unmarshal(resp, &list)
+    return list.Namespaces, err
+}
+
+/*! \brief Creates the namespace in the region, if one with the label doesn't already exist
+ */
+func (do DO_c) CreateNamespace (label, region string) (*DO_namespace_t, error) {
+    existing, err := do.getNamespace(label)
+    if err != nil { return nil, err }
+    if existing != nil {
+        if do.Verbose { fmt.Println("Functions namespace already exists") }
+        return existing, nil
+    }
+
+    if do.Verbose { fmt.Println("Functions namespace does not exist, creating...") }
+    jStr, _ := json.Marshal(struct {
+        Label   string  `json:"label"`
+        Region  string  `json:"region"`
+    }{label, region})
+    resp, err := do.send("POST", "functions/namespaces", jStr)
+    if err != nil { return nil, err }
+
+    var created struct {
+        Namespace   DO_namespace_t  `json:"namespace"`
+    }
+    err = json.Unmarshal(resp, &created)
+    return &created.Namespace, err
+}
+
+/*! \brief Deletes the namespace, along with all its functions and triggers
+ */
+func (do DO_c) DeleteNamespace (label string) error {
+    ns, err := do.getNamespace(label)
+    if err == nil {
+        if ns == nil {
+            if do.Verbose { fmt.Println("Functions namespace does not exist, nothing to do...") }
+        } else {
+            err = do.deleteRequest("functions/namespaces/" + ns.ID)
+        }
+    }
+    return err
+}
+
+/*! \brief Lists the triggers in the namespace
+ */
+func (do DO_c) ListTriggers (label string) ([]DO_trigger_t, error) {
+    ns, err := do.requireNamespace(label)
+    if err != nil { return nil, err }
+
+    resp, err := do.send("GET", "functions/namespaces/" + ns.ID + "/triggers", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Triggers    []DO_trigger_t  `json:"triggers"`
+    }
+    err = json.Unmarshal(resp, &list)
+    return list.Triggers, err
+}
+
+/*! \brief Creates the scheduled trigger for the function, or updates its schedule if it already exists
+ *  body is optional json passed to the function each time it runs
+ */
+func (do DO_c) AssignTrigger (label, name, function, cron, body string) error {
+    ns, err := do.requireNamespace(label)
+    if err != nil { return err }
+
+    if len(body) > 0 && !json.Valid([]byte(body)) { return fmt.Errorf("Trigger body needs to be json") }
+
+    triggers, err := do.ListTriggers(label)
+    if err != nil { return err }
+
+    trigger := DO_trigger_t{Name: name, Function: function, Type: "SCHEDULED", Enabled: true}
+    trigger.Schedule.Cron = cron
+    if len(body) > 0 { trigger.Schedule.Body = json.RawMessage(body) }
+
+    for _, existing := range(triggers) {
+        if existing.Name != name { continue }
+
+        if existing.Function != function { return fmt.Errorf("Trigger '%s' already exists for function '%s'", name, existing.Function) }
+        if do.Verbose { fmt.Println("Trigger already exists, updating") }
+        jStr, _ := json.Marshal(struct {
+            Enabled     bool    `json:"is_enabled"`
+            Schedule    interface{} `json:"scheduled_details"`
+        }{true, trigger.Schedule})
+        _, err = do.send("PUT", "functions/namespaces/" + ns.ID + "/triggers/" + url.PathEscape(name), jStr)
+        return err
+    }
+
+    if do.Verbose { fmt.Println("Trigger does not exist, creating...") }
+    jStr, _ := json.Marshal(trigger)
+    _, err = do.send("POST", "functions/namespaces/" + ns.ID + "/triggers", jStr)
+    return err
+}
+
+/*! \brief Deletes the trigger from the namespace
+ */
+func (do DO_c) DeleteTrigger (label, name string) error {
+    ns, err := do.requireNamespace(label)
+    if err != nil { return err }
+
+    _, err = do.send("DELETE", "functions/namespaces/" + ns.ID + "/triggers/" + url.PathEscape(name), nil)
+    if doNotFound(err) {
+        if do.Verbose { fmt.Println("Trigger does not exist, nothing to do...") }
+        return nil
+    }
+    return err
+}
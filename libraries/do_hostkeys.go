@@ -0,0 +1,110 @@
+/*! \file do_hostkeys.go
+    \brief A managed known_hosts file, so ssh to our nodes checks their host keys instead of trusting whatever answers first
+ *  New nodes are given a host key we made through cloud-init, so it's known before the node ever boots.  Deleting a node takes its entries out
+ *  The private key goes in the user data, which is kept out of traces and recordings
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "sync"
+    "path/filepath"
+    "io/ioutil"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A host key we made for a node
+ */
+type do_host_key_t struct {
+    Private     string
+    Public      string  //ie 'ssh-ed25519 AAAA...'
+}
+
+var known_hosts_lock sync.Mutex    //bulk creates nodes at the same time
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Makes an ed25519 host key for the node with ssh-keygen
+ */
+func newHostKey (name string) (*do_host_key_t, error) {
+    dir, err := ioutil.TempDir("", "harbormaster-hostkey")
+    if err != nil { return nil, err }
+    defer os.RemoveAll(dir)
+
+    loc := filepath.Join(dir, "key")
+    if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", loc).CombinedOutput(); err != nil {
+        return nil, fmt.Errorf("Unable to make a host key with ssh-keygen :: %s %s", err.Error(), strings.TrimSpace(string(out)))
+    }
+    private, err := ioutil.ReadFile(loc)
+    if err != nil { return nil, err }
+    public, err := ioutil.ReadFile(loc + ".pub")
+    if err != nil { return nil, err }
+
+    fields := strings.Fields(string(public))
+    if len(fields) < 2 { return nil, fmt.Errorf("Unexpected public key from ssh-keygen") }
+    return &do_host_key_t{Private: string(private), Public: fields[0] + " " + fields[1]}, nil
+}
+
+/*! \brief User data that has cloud-init replace the image's host keys with ours, and not make any others
+ */
+func (key do_host_key_t) userData (userData string) string {
+    private := "    " + strings.ReplaceAll(strings.TrimSpace(key.Private), "\n", "\n    ")
+    config := fmt.Sprintf("#cloud-config\nssh_deletekeys: true\nssh_genkeytypes: []\nssh_keys:\n  ed25519_private: |\n%s\n  ed25519_public: %s\n", private, key.Public)
+    return combineUserData(config, userData)
+}
+
+/*! \brief Takes the hosts out of the known hosts file, it's fine when they aren't in it
+ */
+func removeKnownHosts (file string, hosts ...string) error {
+    if _, err := os.Stat(file); os.IsNotExist(err) { return nil }
+    for _, host := range(hosts) {
+        if len(host) == 0 { continue }
+        if out, err := exec.Command("ssh-keygen", "-R", host, "-f", file).CombinedOutput(); err != nil {
+            return fmt.Errorf("Unable to remove %s from %s :: %s %s", host, file, err.Error(), strings.TrimSpace(string(out)))
+        }
+    }
+    os.Remove(file + ".old")    //ssh-keygen leaves a backup
+    return nil
+}
+
+/*! \brief Waits for the node's address and puts its host key in the known hosts file under its name and address
+ */
+func (do DO_c) trustHostKey (droplet *do_droplet_t, key *do_host_key_t) error {
+    ip := ""
+    err := do.waitUntil("an ip address for " + droplet.Name, func () (bool, error) {
+        ip = do.getDropletFromID(droplet.ID).publicIP()
+        return len(ip) > 0, nil
+    })
+    if err != nil { return err }
+
+    known_hosts_lock.Lock()
+    defer known_hosts_lock.Unlock()
+    file := do.Ready.KnownHosts
+    if err = removeKnownHosts(file, droplet.Name, ip); err != nil { return err }   //whatever had the address or name before
+
+    os.MkdirAll(filepath.Dir(file), 0700)
+    f, err := os.OpenFile(file, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0600)
+    if err != nil { return fmt.Errorf("Unable to open '%s' :: %s", file, err.Error()) }
+    defer f.Close()
+    if _, err = fmt.Fprintf(f, "%s,%s %s\n", droplet.Name, ip, key.Public); err != nil { return err }
+    if do.Verbose { fmt.Printf("Added the host key for %s to %s\n", droplet.Name, file) }
+    return nil
+}
+
+/*! \brief Takes a deleted node out of the known hosts file
+ */
+func (do DO_c) forgetHostKey (droplet *do_droplet_t) error {
+    if len(do.Ready.KnownHosts) == 0 { return nil }
+    known_hosts_lock.Lock()
+    defer known_hosts_lock.Unlock()
+    return removeKnownHosts(do.Ready.KnownHosts, droplet.Name, droplet.publicIP())
+}
@@ -0,0 +1,186 @@
+/*! \file do_images.go
+    \brief Digital ocean snapshots and custom images, pruning the old ones so they don't pile up on the bill
+ *  Also the 1-Click marketplace apps nodes can be created from
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "path"
+    "encoding/json"
+    "sort"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_snapshot_prefix    = "snapshot:"   //images like this get resolved to one of our snapshots when creating a node
+const do_one_click_prefix   = "app:"        //1-Click marketplace apps, ie 'app:docker-20-04'
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_image_t struct {
+    ID          int         `json:"id"`
+    Name        string      `json:"name"`
+    Type        string      `json:"type"`    //snapshot, backup or custom
+    Distribution    string  `json:"distribution"`
+    Regions     []string    `json:"regions"`
+    Created     time.Time   `json:"created_at"`
+    SizeGB      float64     `json:"size_gigabytes"`
+    Slug        string      `json:"slug,omitempty"`      //only the public images have one
+    Description string      `json:"description,omitempty"`   //for the 1-Click apps this is how to get started with them
+    Status      string      `json:"status,omitempty"`    //new ones are pending until they're available
+}
+
+type DO_one_click_t struct {
+    Slug        string      `json:"slug"`
+    Type        string      `json:"type"`    //droplet or kubernetes
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Our images with names matching the pattern, newest first.  The pattern uses shell style wildcards, ie 'webserver-*'
+ *  Backups are left out, digital ocean handles those on its own
+ */
+func (do DO_c) matchingImages (pattern string) ([]DO_image_t, error) {
+    if _, err := path.Match(pattern, ""); err != nil { return nil, fmt.Errorf("Invalid image pattern '%s'", pattern) }
+
+    images, err := do.ListImages()
+    if err != nil { return nil, err }
+
+    matches := make([]DO_image_t, 0)
+    for _, img := range(images) {
+        if ok, _ := path.Match(pattern, img.Name); ok && img.Type != "backup" { matches = append(matches, img) }
+    }
+    sort.Slice(matches, func (i, j int) bool { return matches[i].Created.After(matches[j].Created) })
+    return matches, nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- IMAGE FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists all our private images, snapshots and custom ones
+ */
+func (do DO_c) ListImages () ([]DO_image_t, error) {
+    images := make([]DO_image_t, 0)
+    for page := 1; page > 0; page++ {
+        resp, err := do.send("GET", fmt.Sprintf("images?private=true&page=%d&per_page=100", page), nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            Images  []DO_image_t    `json:"images"`
+            Links   struct {
+                Pages   struct {
+                    Next    string  `json:"next"`
+                }   `json:"pages"`
+            }   `json:"links"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        images = append(images, list.Images...)
+        if len(list.Links.Pages.Next) == 0 { break }
+    }
+    return images, nil
+}
+
+/*! \brief Deletes the images matching the pattern that are older than the number of days, always keeping the newest ones
+ *  Returns what was removed, or with dryRun what would have been
+ */
+func (do DO_c) PruneImages (pattern string, days, keep int, dryRun bool) ([]DO_image_t, error) {
+    images, err := do.matchingImages(pattern)
+    if err != nil { return nil, err }
+
+    cutoff := time.Now().AddDate(0, 0, -days)
+    pruned := make([]DO_image_t, 0)
+    for i, img := range(images) {
+        if i < keep || img.Created.After(cutoff) { continue }
+
+        if !dryRun {
+            if do.Verbose { fmt.Printf("Deleting image %s from %s\n", img.Name, img.Created.Format("2006-01-02")) }
+            if err = do.deleteRequest(fmt.Sprintf("images/%d", img.ID)); err != nil { return pruned, err }
+        }
+        pruned = append(pruned, img)
+    }
+    return pruned, nil
+}
+
+/*! \brief Lists the 1-Click marketplace apps, only the ones of the type when it's set, ie 'droplet'
+ */
+func (do DO_c) ListOneClicks (kind string) ([]DO_one_click_t, error) {
+    url := "1-clicks"
+    if len(kind) > 0 { url += "?type=" + kind }
+    resp, err := do.request(url, nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        OneClicks   []DO_one_click_t    `json:"1_clicks"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+    sort.Slice(list.OneClicks, func (i, j int) bool { return list.OneClicks[i].Slug < list.OneClicks[j].Slug })
+    return list.OneClicks, nil
+}
+
+/*! \brief Image for the 1-Click app, making sure nodes can be created from it in the region
+ *  Its description has the app's getting started notes
+ */
+func (do DO_c) OneClickImage (slug, region string) (*DO_image_t, error) {
+    slug = strings.TrimPrefix(slug, do_one_click_prefix)
+    apps, err := do.ListOneClicks("droplet")
+    if err != nil { return nil, err }
+
+    found := false
+    for _, a := range(apps) { found = found || a.Slug == slug }
+    if !found { return nil, fmt.Errorf("No 1-Click app '%s' for nodes, -oneclicks lists them", slug) }
+
+    resp, err := do.request("images/" + slug, nil)
+    if err != nil { return nil, err }
+    var img struct {
+        Image   DO_image_t  `json:"image"`
+    }
+    if err = json.Unmarshal(resp, &img); err != nil { return nil, err }
+    if len(region) > 0 && !hasString(img.Image.Regions, region) {
+        return nil, fmt.Errorf("1-Click app '%s' isn't available in %s, only in %s", slug, region, strings.Join(img.Image.Regions, ", "))
+    }
+    return &img.Image, nil
+}
+
+/*! \brief Turns an image like 'snapshot:webserver-*' into the id of the matching snapshot in the region
+ *  When more than one matches, latest picks the newest, otherwise it's an error.  1-Click apps like 'app:docker-20-04' are checked and become their slug
+ *  Other images are passed straight through
+ */
+func (do DO_c) ResolveImage (image, region string, latest bool) (string, error) {
+    if strings.HasPrefix(image, do_one_click_prefix) {
+        if _, err := do.OneClickImage(image, region); err != nil { return "", err }
+        return strings.TrimPrefix(image, do_one_click_prefix), nil
+    }
+    if !strings.HasPrefix(image, do_snapshot_prefix) { return image, nil }
+
+    pattern := strings.TrimPrefix(image, do_snapshot_prefix)
+    images, err := do.matchingImages(pattern)
+    if err != nil { return "", err }
+
+    matches := make([]DO_image_t, 0)
+    for _, img := range(images) {
+        for _, r := range(img.Regions) {
+            if r == region { matches = append(matches, img) }
+        }
+    }
+
+    if len(matches) == 0 {
+        if len(images) > 0 { return "", fmt.Errorf("No snapshot matching '%s' in region %s, %d in other regions", pattern, region, len(images)) }
+        return "", fmt.Errorf("No snapshot matching '%s'", pattern)
+    }
+    if len(matches) > 1 && !latest { return "", fmt.Errorf("%d snapshots match '%s', use -latest to pick the newest", len(matches), pattern) }
+
+    if do.Verbose { fmt.Printf("Using snapshot %s from %s\n", matches[0].Name, matches[0].Created.Format("2006-01-02 15:04")) }
+    return fmt.Sprint(matches[0].ID), nil
+}
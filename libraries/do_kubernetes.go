@@ -0,0 +1,212 @@
+/*! \file do_kubernetes.go
+    \brief Digital ocean kubernetes, node pools from the config, cluster upgrades and short lived kubeconfigs
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_taint_t struct {
+    Key         string  `json:"key"`
+    Value       string  `json:"value"`
+    Effect      string  `json:"effect"`   //NoSchedule, PreferNoSchedule or NoExecute
+}
+
+/*! \brief Node pool, this is also how they're set in the config
+ *  With AutoScale set, count is only the starting size and the pool stays between min and max nodes
+ */
+type DO_pool_t struct {
+    ID          string      `json:"id,omitempty"`
+    Name        string      `json:"name"`
+    Size        string      `json:"size"`
+    Count       int         `json:"count"`
+    AutoScale   bool        `json:"auto_scale"`
+    MinNodes    int         `json:"min_nodes"`
+    MaxNodes    int         `json:"max_nodes"`
+    Tags        []string    `json:"tags,omitempty"`
+    Labels      map[string]string   `json:"labels"`
+    Taints      []DO_taint_t        `json:"taints"`    //the api wants these, even when they're empty, to clear them
+}
+
+type DO_cluster_t struct {
+    ID          string      `json:"id"`
+    Name        string      `json:"name"`
+    Region      string      `json:"region"`
+    Version     string      `json:"version"`
+    SurgeUpgrade    bool    `json:"surge_upgrade"`
+    Status      struct {
+        State   string  `json:"state"`
+    }   `json:"status"`
+    NodePools   []DO_pool_t `json:"node_pools"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the cluster by its name, it not existing is an error
+ */
+func (do DO_c) getCluster (name string) (*DO_cluster_t, error) {
+    clusters, err := do.ListClusters()
+    if err != nil { return nil, err }
+
+    for _, cluster := range(clusters) {
+        if strings.EqualFold(cluster.Name, name) { return &cluster, nil }
+    }
+    return nil, fmt.Errorf("Kubernetes cluster '%s' does not exist", name)
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- KUBERNETES FUNCTIONS ----------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists all the kubernetes clusters, along with their node pools
+ */
+func (do DO_c) ListClusters () ([]DO_cluster_t, error) {
+    clusters := make([]DO_cluster_t, 0)
+    for page := 1; page > 0; page++ {
+        resp, err := do.send("GET", fmt.Sprintf("kubernetes/clusters?page=%d&per_page=100", page), nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            Clusters    []DO_cluster_t  `json:"kubernetes_clusters"`
+            Links   struct {
+                Pages   struct {
+                    Next    string  `json:"next"`
+                }   `json:"pages"`
+            }   `json:"links"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        clusters = append(clusters, list.Clusters...)
+        if len(list.Links.Pages.Next) == 0 { break }
+    }
+    return clusters, nil
+}
+
+/*! \brief Lists the node pools in the cluster
+ */
+func (do DO_c) ListPools (cluster string) ([]DO_pool_t, error) {
+    c, err := do.getCluster(cluster)
+    if err != nil { return nil, err }
+    return c.NodePools, nil
+}
+
+/*! \brief Creates the node pool from the config, or updates the existing one with its name
+ *  The size of an existing pool can't be changed, that needs a new pool
+ */
+func (do DO_c) AssignPool (cluster string, pool DO_pool_t) (*DO_pool_t, error) {
+    c, err := do.getCluster(cluster)
+    if err != nil { return nil, err }
+
+    if pool.AutoScale && (pool.MinNodes > pool.MaxNodes || pool.MaxNodes < 1) {
+        return nil, fmt.Errorf("Node pool '%s' needs max_nodes of at least 1, and no less than min_nodes", pool.Name)
+    }
+    if pool.Labels == nil { pool.Labels = make(map[string]string) }
+    if pool.Taints == nil { pool.Taints = make([]DO_taint_t, 0) }
+
+    var existing *DO_pool_t
+    for i := range(c.NodePools) {
+        if strings.EqualFold(c.NodePools[i].Name, pool.Name) { existing = &c.NodePools[i] }
+    }
+
+    var resp []byte
+    if existing == nil {
+        if do.Verbose { fmt.Println("Node pool does not exist, creating...") }
+        jStr, _ := json.Marshal(pool)
+        resp, err = do.send("POST", "kubernetes/clusters/" + c.ID + "/node_pools", jStr)
+    } else {
+        if len(pool.Size) > 0 && pool.Size != existing.Size {
+            return nil, fmt.Errorf("Node pool '%s' is %s, its size can't be changed to %s", pool.Name, existing.Size, pool.Size)
+        }
+        if do.Verbose { fmt.Println("Node pool already exists, updating") }
+        pool.Size = ""
+        jStr, _ := json.Marshal(pool)
+        resp, err = do.send("PUT", "kubernetes/clusters/" + c.ID + "/node_pools/" + existing.ID, jStr)
+    }
+    if err != nil { return nil, err }
+
+    var result struct {
+        NodePool    DO_pool_t   `json:"node_pool"`
+    }
+    err = json.Unmarshal(resp, &result)
+    return &result.NodePool, err
+}
+
+/*! \brief Deletes the node pool from the cluster, along with its nodes
+ */
+func (do DO_c) DeletePool (cluster, name string) error {
+    c, err := do.getCluster(cluster)
+    if err != nil { return err }
+
+    for _, pool := range(c.NodePools) {
+        if strings.EqualFold(pool.Name, name) { return do.deleteRequest("kubernetes/clusters/" + c.ID + "/node_pools/" + pool.ID) }
+    }
+    if do.Verbose { fmt.Println("Node pool does not exist, nothing to do...") }
+    return nil
+}
+
+/*! \brief Upgrades the cluster to the version, or the newest one available when it's empty
+ *  surge creates new nodes before draining the old ones, so the pools keep their capacity during the upgrade
+ */
+func (do DO_c) UpgradeCluster (cluster, version string, surge bool) (string, error) {
+    c, err := do.getCluster(cluster)
+    if err != nil { return "", err }
+
+    resp, err := do.send("GET", "kubernetes/clusters/" + c.ID + "/upgrades", nil)
+    if err != nil { return "", err }
+
+    var upgrades struct {
+        Versions    []struct {
+            Slug    string  `json:"slug"`
+        }   `json:"available_upgrade_versions"`
+    }
+    if err = json.Unmarshal(resp, &upgrades); err != nil { return "", err }
+
+    target := ""
+    for _, v := range(upgrades.Versions) {
+        if len(version) == 0 || v.Slug == version || strings.HasPrefix(v.Slug, version + "-") { target = v.Slug }  //they're oldest to newest
+    }
+    if len(target) == 0 {
+        if len(version) == 0 || c.Version == version || strings.HasPrefix(c.Version, version + "-") {
+            if do.Verbose { fmt.Println("Cluster already up to date, nothing to do...") }
+            return c.Version, nil
+        }
+        return "", fmt.Errorf("Cluster '%s' can't be upgraded from %s to %s", cluster, c.Version, version)
+    }
+
+    if c.SurgeUpgrade != surge {
+        if do.Verbose { fmt.Printf("Setting surge upgrade to %t\n", surge) }
+        jStr, _ := json.Marshal(struct {
+            Name    string  `json:"name"`
+            Surge   bool    `json:"surge_upgrade"`
+        }{c.Name, surge})
+        if _, err = do.send("PUT", "kubernetes/clusters/" + c.ID, jStr); err != nil { return "", err }
+    }
+
+    jStr, _ := json.Marshal(struct {
+        Version     string  `json:"version"`
+    }{target})
+    _, err = do.send("POST", "kubernetes/clusters/" + c.ID + "/upgrade", jStr)
+    return target, err
+}
+
+/*! \brief Gets the kubeconfig for the cluster, with credentials that expire after expiry seconds
+ *  With 0 the credentials last as long as the api key does
+ */
+func (do DO_c) Kubeconfig (cluster string, expiry int) ([]byte, error) {
+    c, err := do.getCluster(cluster)
+    if err != nil { return nil, err }
+
+    path := "kubernetes/clusters/" + c.ID + "/kubeconfig"
+    if expiry > 0 { path += fmt.Sprintf("?expiry_seconds=%d", expiry) }
+    return do.send("GET", path, nil)
+}
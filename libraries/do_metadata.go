@@ -0,0 +1,102 @@
+/*! \file do_metadata.go
+    \brief Reading the droplet metadata service, for when harbormaster is running on the node it's configuring
+ *  The service is only reachable from the droplet itself and doesn't need the api key
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_metadata_url       = "http://169.254.169.254/metadata/v1.json"
+const do_metadata_timeout   = 3 * time.Second   //it's link local, so anything longer means we're not on a droplet
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type do_metadata_iface_t struct {
+    IPv4    struct {
+        IP      string  `json:"ip_address"`
+    }   `json:"ipv4"`
+    IPv6    struct {
+        IP      string  `json:"ip_address"`
+    }   `json:"ipv6"`
+}
+
+/*! \brief What the metadata service knows about the droplet we're running on
+ */
+type DO_metadata_t struct {
+    DropletID   int         `json:"droplet_id"`
+    Hostname    string      `json:"hostname"`
+    Region      string      `json:"region"`
+    Tags        []string    `json:"tags"`
+    UserData    string      `json:"user_data"`
+    PublicKeys  []string    `json:"public_keys"`
+    Interfaces  struct {
+        Public  []do_metadata_iface_t   `json:"public"`
+        Private []do_metadata_iface_t   `json:"private"`
+    }   `json:"interfaces"`
+}
+
+/*! \brief Public ipv4 address of the droplet, empty when it doesn't have one
+ */
+func (meta DO_metadata_t) PublicIP () string {
+    if len(meta.Interfaces.Public) == 0 { return "" }
+    return meta.Interfaces.Public[0].IPv4.IP
+}
+
+/*! \brief Private ipv4 address of the droplet, empty when it isn't on a vpc
+ */
+func (meta DO_metadata_t) PrivateIP () string {
+    if len(meta.Interfaces.Private) == 0 { return "" }
+    return meta.Interfaces.Private[0].IPv4.IP
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- METADATA FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the metadata of the droplet we're running on, this fails anywhere else
+ */
+func (do DO_c) Metadata () (*DO_metadata_t, error) {
+    req, err := http.NewRequestWithContext(do.context(), "GET", do_metadata_url, nil)
+    if err != nil { return nil, err }
+
+    client := &http.Client{Timeout: do_metadata_timeout}
+    resp, err := client.Do(req)
+    if err != nil { return nil, fmt.Errorf("Unable to reach the metadata service, this only works on a droplet :: %s", err.Error()) }
+    defer resp.Body.Close()
+
+    body, _ := ioutil.ReadAll(resp.Body)
+    if do.SuperVerbose { fmt.Println("metadata:", string(body)) }
+    if resp.StatusCode >= 300 { return nil, fmt.Errorf("Metadata service response code: %s", resp.Status) }
+
+    meta := &DO_metadata_t{}
+    if err = json.Unmarshal(body, meta); err != nil { return nil, err }
+    return meta, nil
+}
+
+/*! \brief Adds the tag to the node, ie so a balancer or firewall going by the tag picks it up once it's ready
+ *  More than one can be added with commas between them, ie 'web,staging'
+ */
+func (do DO_c) TagNode (id int, tag string) error {
+    tags := splitTags(tag)
+    for _, t := range(tags) {
+        if do_tag_invalid.MatchString(t) { return fmt.Errorf("Tag '%s' can only have letters, numbers, dashes, underscores and colons", t) }
+    }
+    for _, t := range(tags) {
+        if do.Verbose { fmt.Printf("Adding the tag %s to node %d\n", t, id) }
+        if err := do.tagResources("POST", t, []int{id}); err != nil { return err }
+    }
+    return nil
+}
@@ -0,0 +1,204 @@
+/*! \file do_metrics.go
+    \brief Cpu and memory use from digital ocean's monitoring, and the size each node should be on going by it
+ *  The metrics come from the monitoring agent on the node, nodes without it don't get a recommendation
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "time"
+    "encoding/json"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_rightsize_up_cpu       = 80    //95th percentile cpu percent that means a bigger size
+const do_rightsize_up_memory    = 85
+const do_rightsize_fit_cpu      = 50    //a smaller size has to keep the 95th percentile under these
+const do_rightsize_fit_memory   = 60
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type do_metric_series_t struct {
+    Metric      map[string]string   `json:"metric"`
+    Values      [][]interface{}     `json:"values"`    //[unix time, "value"]
+}
+
+/*! \brief A node's use over the window and the size it should be on, percents are of what its current size has
+ */
+type DO_rightsize_t struct {
+    Node        string      `json:"node"`
+    Size        string      `json:"size"`
+    CPUAvg      float64     `json:"cpu_avg"`
+    CPUP95      float64     `json:"cpu_p95"`
+    MemoryAvg   float64     `json:"memory_avg"`
+    MemoryP95   float64     `json:"memory_p95"`
+    Change      string      `json:"change"`        //up, down, keep, or unknown without metrics
+    Suggest     string      `json:"suggest,omitempty"`
+    MonthlyDelta    float64 `json:"monthly_delta"` //what the suggested size costs over the current one, negative is a saving
+    Reason      string      `json:"reason,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the droplet metric over the window, ie cpu or memory_total
+ */
+func (do DO_c) metric (name string, id int, start, end time.Time) ([]do_metric_series_t, error) {
+    resp, err := do.send("GET", fmt.Sprintf("monitoring/metrics/droplet/%s?host_id=%d&start=%d&end=%d", name, id, start.Unix(), end.Unix()), nil)
+    if err != nil { return nil, err }
+
+    var metrics struct {
+        Data    struct {
+            Result  []do_metric_series_t    `json:"result"`
+        }   `json:"data"`
+    }
+    err = json.Unmarshal(resp, &metrics)
+    return metrics.Data.Result, err
+}
+
+/*! \brief The series' values by their time, added up when there's more than one series
+ */
+func metricPoints (series []do_metric_series_t, points map[int64]float64) map[int64]float64 {
+    if points == nil { points = make(map[int64]float64) }
+    for _, s := range(series) {
+        for _, v := range(s.Values) {
+            if len(v) < 2 { continue }
+            ts, ok := v[0].(float64)
+            str, ok2 := v[1].(string)
+            if !ok || !ok2 { continue }
+            if val, err := strconv.ParseFloat(str, 64); err == nil { points[int64(ts)] += val }
+        }
+    }
+    return points
+}
+
+func sortedTimes (points map[int64]float64) []int64 {
+    times := make([]int64, 0, len(points))
+    for t := range(points) { times = append(times, t) }
+    sort.Slice(times, func (i, j int) bool { return times[i] < times[j] })
+    return times
+}
+
+/*! \brief The average and 95th percentile, rounded to a tenth
+ */
+func avgP95 (vals []float64) (float64, float64) {
+    if len(vals) == 0 { return 0, 0 }
+    sorted := append([]float64{}, vals...)
+    sort.Float64s(sorted)
+    sum := 0.0
+    for _, v := range(sorted) { sum += v }
+    p95 := sorted[int(math.Ceil(float64(len(sorted)) * 0.95)) - 1]
+    return math.Round(sum / float64(len(sorted)) * 10) / 10, math.Round(p95 * 10) / 10
+}
+
+/*! \brief Cpu percent between each sample, the cpu metric is seconds spent in each mode so it's the share of the change that wasn't idle
+ */
+func cpuUse (series []do_metric_series_t) []float64 {
+    idle := make([]do_metric_series_t, 0)
+    for _, s := range(series) {
+        if s.Metric["mode"] == "idle" { idle = append(idle, s) }
+    }
+    total, idles := metricPoints(series, nil), metricPoints(idle, nil)
+
+    use := make([]float64, 0, len(total))
+    times := sortedTimes(total)
+    for i := 1; i < len(times); i++ {
+        dTotal, dIdle := total[times[i]] - total[times[i - 1]], idles[times[i]] - idles[times[i - 1]]
+        if dTotal <= 0 || dIdle < 0 { continue }    //counters start over when the node reboots
+        use = append(use, (1 - dIdle / dTotal) * 100)
+    }
+    return use
+}
+
+/*! \brief Memory percent used at each sample, what the kernel can give back counts as free
+ */
+func memoryUse (total, available []do_metric_series_t) []float64 {
+    totals, avail := metricPoints(total, nil), metricPoints(available, nil)
+    use := make([]float64, 0, len(totals))
+    for _, t := range(sortedTimes(totals)) {
+        a, ok := avail[t]
+        if !ok || totals[t] <= 0 { continue }
+        use = append(use, (1 - a / totals[t]) * 100)
+    }
+    return use
+}
+
+/*! \brief The cheapest available size in the region and class that's cheaper than the current one and still fits the use
+ *  Digital ocean can't shrink a disk, so only sizes with at least the current disk count
+ */
+func smallerSize (sizes map[string]do_size_t, current, region string, cpuP95, memoryP95 float64) string {
+    cur, ok := sizes[current]
+    if !ok { return "" }
+    best := ""
+    for slug, s := range(sizes) {
+        if !s.Available || !hasString(s.Regions, region) || sizeClass(slug) != sizeClass(current) || s.PriceMonthly >= cur.PriceMonthly { continue }
+        if s.Disk < cur.Disk || s.VCPUs == 0 || s.Memory == 0 { continue }
+        if cpuP95 * float64(cur.VCPUs) / float64(s.VCPUs) > do_rightsize_fit_cpu || memoryP95 * float64(cur.Memory) / float64(s.Memory) > do_rightsize_fit_memory { continue }
+        if len(best) == 0 || s.PriceMonthly < sizes[best].PriceMonthly || (s.PriceMonthly == sizes[best].PriceMonthly && slug < best) { best = slug }
+    }
+    return best
+}
+
+/*! \brief Works out the node's use and what it should change to
+ */
+func (do DO_c) rightsizeNode (node DO_node_t, sizes map[string]do_size_t, start, end time.Time) (*DO_rightsize_t, error) {
+    row := &DO_rightsize_t{Node: node.Name, Size: node.Size, Change: "unknown"}
+    cpu, err := do.metric("cpu", node.ID, start, end)
+    if err != nil { return nil, err }
+    total, err := do.metric("memory_total", node.ID, start, end)
+    if err != nil { return nil, err }
+    available, err := do.metric("memory_available", node.ID, start, end)
+    if err != nil { return nil, err }
+
+    cpuVals, memVals := cpuUse(cpu), memoryUse(total, available)
+    if len(cpuVals) == 0 || len(memVals) == 0 {
+        row.Reason = "No metrics, is the monitoring agent installed?"
+        return row, nil
+    }
+    row.CPUAvg, row.CPUP95 = avgP95(cpuVals)
+    row.MemoryAvg, row.MemoryP95 = avgP95(memVals)
+
+    row.Change = "keep"
+    cpuHigh, memHigh := row.CPUP95 > do_rightsize_up_cpu, row.MemoryP95 > do_rightsize_up_memory
+    if cpuHigh || memHigh {
+        row.Change, row.Suggest = "up", nextSize(sizes, node.Size, node.Region, cpuHigh, memHigh, false)
+        row.Reason = fmt.Sprintf("95th percentile cpu %.0f%%, memory %.0f%%", row.CPUP95, row.MemoryP95)
+        if len(row.Suggest) == 0 { row.Reason += ", there's no bigger size in its class" }
+    } else if row.Suggest = smallerSize(sizes, node.Size, node.Region, row.CPUP95, row.MemoryP95); len(row.Suggest) > 0 {
+        row.Change = "down"
+        row.Reason = fmt.Sprintf("95th percentile cpu %.0f%%, memory %.0f%% fit on %s", row.CPUP95, row.MemoryP95, row.Suggest)
+    }
+    if len(row.Suggest) > 0 { row.MonthlyDelta = math.Round((sizes[row.Suggest].PriceMonthly - sizes[node.Size].PriceMonthly) * 100) / 100 }
+    return row, nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- METRICS FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Recommends a size for each of the nodes from their cpu and memory over the window, ie the last week
+ */
+func (do DO_c) Rightsize (nodes []DO_node_t, window time.Duration) ([]*DO_rightsize_t, error) {
+    sizes, err := do.sizeMap()
+    if err != nil { return nil, err }
+
+    end := time.Now()
+    start := end.Add(-window)
+    rows := make([]*DO_rightsize_t, 0, len(nodes))
+    for _, n := range(nodes) {
+        row, err := do.rightsizeNode(n, sizes, start, end)
+        if err != nil { return rows, fmt.Errorf("Unable to get the metrics for %s :: %s", n.Name, err.Error()) }
+        rows = append(rows, row)
+    }
+    return rows, nil
+}
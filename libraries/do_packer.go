@@ -0,0 +1,184 @@
+/*! \file do_packer.go
+    \brief Building snapshots with the packer template from the config, and rebuilding nodes from them
+ *  Packer gets our digital ocean credentials and the snapshot name in its environment, so the template doesn't need its own copies
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "bufio"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "time"
+    "encoding/json"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_packer_comma       = "%!(PACKER_COMMA)"    //how the machine readable output escapes commas in its fields
+const do_rebuild_wait       = 10 * time.Minute
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The packer section of the config.  The snapshot is named <name>-YYYYMMDDHHMM and the template gets it as the snapshot_name variable
+ */
+type DO_packer_t struct {
+    Template    string  `json:"template"`
+    Name        string  `json:"name"`      //from the template's file name when it's not set
+    Binary      string  `json:"binary"`    //packer when it's not set
+    Vars        map[string]string   `json:"vars"`  //more variables for the template
+    Record      string  `json:"record"`    //optional file each build is added to as a line of json
+}
+
+/*! \brief What BuildImage made
+ */
+type DO_image_build_t struct {
+    ID          int         `json:"id"`
+    Name        string      `json:"name"`
+    Regions     []string    `json:"regions"`
+    Template    string      `json:"template"`
+    Built       time.Time   `json:"built"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Name for the snapshot, ie 'webserver-202610151230' for webserver.pkr.hcl
+ */
+func (p DO_packer_t) snapshotName () string {
+    name := p.Name
+    if len(name) == 0 {
+        name = filepath.Base(p.Template)
+        for _, ext := range([]string{".json", ".hcl", ".pkr"}) { name = strings.TrimSuffix(name, ext) }
+    }
+    return name + "-" + time.Now().UTC().Format("200601021504")
+}
+
+/*! \brief Runs packer, printing what it says as it goes, and returns the id of the snapshot it made
+ */
+func (do DO_c) runPacker (snapshot string) (int, error) {
+    p := do.Config.Packer
+    binary := p.Binary
+    if len(binary) == 0 { binary = "packer" }
+
+    cmd := exec.CommandContext(do.context(), binary, "build", "-machine-readable", "-color=false", p.Template)
+    cmd.Env = append(os.Environ(), "DIGITALOCEAN_TOKEN=" + do.Config.APIKey, "DIGITALOCEAN_API_TOKEN=" + do.Config.APIKey,
+        "PKR_VAR_do_token=" + do.Config.APIKey, "PKR_VAR_snapshot_name=" + snapshot)   //unused PKR_VAR_ ones are ignored
+    for k, v := range(p.Vars) { cmd.Env = append(cmd.Env, "PKR_VAR_" + k + "=" + v) }
+    cmd.Stderr = os.Stderr
+
+    stdout, err := cmd.StdoutPipe()
+    if err != nil { return 0, err }
+    if err = cmd.Start(); err != nil { return 0, fmt.Errorf("Unable to run %s :: %s", binary, err.Error()) }
+
+    id := 0
+    scanner := bufio.NewScanner(stdout)
+    for scanner.Scan() {    //timestamp,target,type,data...
+        fields := strings.Split(scanner.Text(), ",")
+        if len(fields) < 4 { continue }
+        for i := range(fields) { fields[i] = strings.ReplaceAll(strings.ReplaceAll(fields[i], do_packer_comma, ","), "\\n", "\n") }
+
+        switch {
+        case fields[2] == "ui" && len(fields) > 4:
+            fmt.Println(fields[4])
+        case fields[2] == "artifact" && len(fields) > 5 && fields[4] == "id":  //ie 'nyc3,sfo3:123456'
+            fmt.Sscan(fields[5][strings.LastIndex(fields[5], ":") + 1:], &id)
+        }
+    }
+    if err = cmd.Wait(); err != nil { return 0, fmt.Errorf("Packer build of %s failed :: %s", p.Template, err.Error()) }
+    if id == 0 { return 0, fmt.Errorf("Packer finished without telling us the snapshot it made, check the template uses the digitalocean builder") }
+    return id, nil
+}
+
+/*! \brief Adds the build to the record file from the config
+ */
+func (p DO_packer_t) record (build *DO_image_build_t) error {
+    if len(p.Record) == 0 { return nil }
+    f, err := os.OpenFile(p.Record, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
+    if err != nil { return fmt.Errorf("Unable to open '%s' file :: %s", p.Record, err.Error()) }
+    defer f.Close()
+
+    jStr, _ := json.Marshal(build)
+    _, err = f.Write(append(jStr, '\n'))
+    return err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- PACKER FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Builds a snapshot with the packer template from the config and waits for digital ocean to say it's available
+ */
+func (do DO_c) BuildImage () (*DO_image_build_t, error) {
+    p := do.Config.Packer
+    if len(p.Template) == 0 { return nil, fmt.Errorf("No packer template in the digital_ocean section of the config") }
+    if do.ReadOnly { return nil, readOnlyError("packer build", p.Template) }
+
+    build := &DO_image_build_t{Name: p.snapshotName(), Template: p.Template}
+    err := do.Progress.Step("packer build " + build.Name, func () (err error) {
+        build.ID, err = do.runPacker(build.Name)
+        return
+    })
+    if err != nil { return nil, err }
+
+    err = do.Progress.Step("wait for snapshot " + build.Name, func () error {
+        return do.waitUntil("snapshot " + build.Name + " to be available", func () (bool, error) {
+            resp, err := do.send("GET", fmt.Sprintf("images/%d", build.ID), nil)
+            if err != nil { return false, err }
+
+            var image struct {
+                Image   DO_image_t  `json:"image"`
+            }
+            if err = json.Unmarshal(resp, &image); err != nil { return false, err }
+            build.Name, build.Regions = image.Image.Name, image.Image.Regions     //the template might not have used our name
+            return image.Image.Status == "available", nil
+        })
+    })
+    if err != nil { return nil, err }
+
+    build.Built = time.Now()
+    fmt.Printf("Built snapshot %s, id %d\n", build.Name, build.ID)
+    return build, p.record(build)
+}
+
+/*! \brief Recreates the node from the image in place, so it keeps its name, addresses, tags and volumes
+ *  It's drained first, then we wait for it to be ready again like a new node
+ */
+func (do DO_c) RebuildNode (name, image string) error {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return err }
+    if droplet == nil { return fmt.Errorf("Node '%s' does not exist", name) }
+    if do.ManagedOnly && !hasString(droplet.Tags, do_managed_tag) {
+        return fmt.Errorf("Node '%s' wasn't created by harbormaster, it doesn't have the %s tag", name, do_managed_tag)
+    }
+
+    if err = do.Progress.Step("drain " + name, func () error { return do.drainNode(droplet) }); err != nil { return err }
+
+    fmt.Printf("Rebuilding node %s from %s\n", name, image)
+    err = do.Progress.Step("rebuild " + name, func () error {
+        jStr, _ := json.Marshal(map[string]string{"type": "rebuild", "image": image})
+        var resp []byte
+        err := do.whenUnlocked(droplet, func () (err error) {
+            resp, err = do.send("POST", fmt.Sprintf("droplets/%d/actions", droplet.ID), jStr)
+            return
+        })
+        if err != nil { return err }
+
+        var action struct {
+            Action  DO_action_t     `json:"action"`
+        }
+        if err = json.Unmarshal(resp, &action); err != nil { return err }
+        _, err = do.WaitForAction(action.Action.ID, do_rebuild_wait)
+        return err
+    })
+    if err != nil { return err }
+    return do.WaitForReady(droplet.ID)
+}
@@ -0,0 +1,130 @@
+/*! \file do_patch.go
+    \brief OS updates on a node over ssh, drained first and rebooted when the updates need it, so a tag's worth of nodes can be patched one at a time
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "context"
+    "encoding/json"
+    "os/exec"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_patch_timeout      = 30 * time.Minute
+const do_patch_reboot       = "HM_REBOOT_REQUIRED"  //the script prints this when the updates need a reboot
+const do_reboot_wait        = 5 * time.Minute
+
+/*! \brief Updates with whichever package manager the node has, and says whether it needs a reboot for them
+ */
+const do_patch_script = `set -e
+if command -v apt-get >/dev/null 2>&1; then
+    export DEBIAN_FRONTEND=noninteractive
+    apt-get -q update
+    apt-get -q -y -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold dist-upgrade
+    if [ -f /var/run/reboot-required ]; then echo ` + do_patch_reboot + `; fi
+elif command -v dnf >/dev/null 2>&1 || command -v yum >/dev/null 2>&1; then
+    PM=$(command -v dnf || command -v yum)
+    $PM -q -y upgrade
+    if command -v needs-restarting >/dev/null 2>&1 && ! needs-restarting -r >/dev/null 2>&1; then echo ` + do_patch_reboot + `; fi
+else
+    echo "No apt-get, dnf or yum on this node" >&2
+    exit 1
+fi`
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief How patching a node went
+ */
+type DO_patch_t struct {
+    Node        string  `json:"node"`
+    IP          string  `json:"ip"`
+    Rebooted    bool    `json:"rebooted"`
+    Seconds     float64 `json:"seconds"`
+    Result      string  `json:"result"`    //ok, or the error
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- PATCH FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Drains the node, runs the updates and reboots it when they need it, waiting for ssh to be back
+ *  The result is filled in either way, the error is also in it
+ */
+func (do DO_c) PatchNode (name string) (*DO_patch_t, error) {
+    start := time.Now()
+    result := &DO_patch_t{Node: name, Result: "ok"}
+    err := do.patchNode(name, result)
+    result.Seconds = time.Since(start).Round(time.Second).Seconds()
+    if err != nil { result.Result = err.Error() }
+    return result, err
+}
+
+func (do DO_c) patchNode (name string, result *DO_patch_t) error {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return err }
+    if droplet == nil { return fmt.Errorf("Node '%s' does not exist", name) }
+    if do.ReadOnly { return readOnlyError("patch", name) }
+    droplet = do.getDropletFromID(droplet.ID)   //the list can be cached
+    result.IP = droplet.publicIP()
+    if len(result.IP) == 0 { return fmt.Errorf("Node '%s' doesn't have a public ip address to patch it over", name) }
+
+    if err = do.Progress.Step("drain " + name, func () error { return do.drainNode(droplet) }); err != nil { return err }
+
+    reboot := false
+    fmt.Println("Patching node " + name)
+    err = do.Progress.Step("patch " + name, func () error {
+        ctx, cancel := context.WithTimeout(do.context(), do_patch_timeout)
+        defer cancel()
+        script := do_patch_script
+        if len(do.Ready.User) > 0 && do.Ready.User != "root" { script = "sudo -n sh -c '" + strings.ReplaceAll(script, "'", `'\''`) + "'" }
+        out, err := do.sshCommand(ctx, result.IP, script)
+        if do.Verbose && len(out) > 0 { fmt.Println(strings.TrimSpace(string(out))) }
+        if err != nil {
+            if _, ok := err.(*exec.ExitError); ok { err = fmt.Errorf("%s :: %s", err.Error(), lastLines(string(out), 5)) }
+            return fmt.Errorf("Updates on %s failed :: %s", name, err.Error())
+        }
+        reboot = strings.Contains(string(out), do_patch_reboot)
+        return nil
+    })
+    if err != nil || !reboot { return err }
+
+    fmt.Printf("Rebooting node %s for its updates\n", name)
+    err = do.Progress.Step("reboot " + name, func () error {
+        jStr, _ := json.Marshal(map[string]string{"type": "reboot"})
+        var resp []byte
+        err := do.whenUnlocked(droplet, func () (err error) {
+            resp, err = do.send("POST", fmt.Sprintf("droplets/%d/actions", droplet.ID), jStr)
+            return
+        })
+        if err != nil { return err }
+
+        var action struct {
+            Action  DO_action_t     `json:"action"`
+        }
+        if err = json.Unmarshal(resp, &action); err != nil { return err }
+        _, err = do.WaitForAction(action.Action.ID, do_reboot_wait)
+        return err
+    })
+    if err != nil { return err }
+    result.Rebooted = true
+
+    do.Ready.SSH = true     //it's only back once we can get in again
+    return do.WaitForReady(droplet.ID)
+}
+
+/*! \brief The last few lines of the output, for errors that would otherwise be a whole apt run
+ */
+func lastLines (out string, n int) string {
+    lines := strings.Split(strings.TrimSpace(out), "\n")
+    if len(lines) > n { lines = lines[len(lines) - n:] }
+    return strings.Join(lines, " / ")
+}
@@ -0,0 +1,87 @@
+/*! \file do_ptr.go
+    \brief Reverse dns for our nodes.  Digital ocean sets the PTR record from the node's name, so the name has to be the hostname mail is sent as
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net"
+    "encoding/json"
+    "regexp"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+var do_fqdn_check = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,}$`)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Digital ocean only sets a PTR record when the node's name is a fully qualified domain name, ie 'mail.example.com'
+ */
+func isFQDN (name string) bool {
+    return do_fqdn_check.MatchString(strings.ToLower(strings.TrimSuffix(name, ".")))
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- PTR FUNCTIONS -----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Returns a warning for anything that stops the node's reverse dns from matching its name
+ *  The name has to be a fqdn, it has to resolve to the node's ip, and the ip's PTR has to resolve back to the name
+ */
+func (do DO_c) CheckReverseDNS (name string) ([]string, error) {
+    _, ip, err := do.NodeAddress(name)
+    if err != nil { return nil, err }
+
+    warnings := make([]string, 0)
+    if !isFQDN(name) {
+        warnings = append(warnings, fmt.Sprintf("Node name '%s' isn't a fully qualified domain name, so digital ocean won't set a PTR record for %s.  use -rename to fix it", name, ip))
+        return warnings, nil    //nothing else can match
+    }
+
+    addrs, err := net.LookupHost(name)
+    if err != nil {
+        warnings = append(warnings, fmt.Sprintf("'%s' doesn't resolve, it needs an A record pointing at %s", name, ip))
+    } else if !hasString(addrs, ip) {
+        warnings = append(warnings, fmt.Sprintf("'%s' resolves to %s, not the node's ip %s", name, strings.Join(addrs, ", "), ip))
+    }
+
+    ptrs, err := net.LookupAddr(ip)
+    if err != nil || len(ptrs) == 0 {
+        warnings = append(warnings, fmt.Sprintf("No PTR record for %s yet, it can take a few minutes after a rename", ip))
+    } else if !strings.EqualFold(strings.TrimSuffix(ptrs[0], "."), name) {
+        warnings = append(warnings, fmt.Sprintf("PTR record for %s is '%s', not '%s'", ip, strings.TrimSuffix(ptrs[0], "."), name))
+    }
+    return warnings, nil
+}
+
+/*! \brief Renames the node, which also sets its PTR record when the new name is a fqdn
+ */
+func (do DO_c) RenameNode (name, newName string) error {
+    if !isFQDN(newName) && do.Verbose { fmt.Printf("'%s' isn't a fully qualified domain name, so the node won't get a PTR record\n", newName) }
+
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return err }
+    if droplet == nil {
+        renamed, err := do.getDropletFromName(newName)
+        if err == nil && renamed == nil { err = fmt.Errorf("Node '%s' does not exist", name) }
+        if err == nil && do.Verbose { fmt.Println("Node already renamed, nothing to do...") }
+        return err
+    }
+
+    fmt.Printf("Renaming node %s to %s\n", name, newName)
+    jStr, _ := json.Marshal(struct {
+        Type    string  `json:"type"`
+        Name    string  `json:"name"`
+    }{Type: "rename", Name: newName})
+    return do.whenUnlocked(droplet, func () error {
+        _, err := do.send("POST", fmt.Sprintf("droplets/%d/actions", droplet.ID), jStr)
+        return err
+    })
+}
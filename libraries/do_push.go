@@ -0,0 +1,78 @@
+/*! \file do_push.go
+    \brief Copying files to a node over sftp and running a reload command after, for small config changes between full deploys
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "os/exec"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A local file and where it goes on the node
+ */
+type DO_push_file_t struct {
+    Local       string  `json:"local"`
+    Remote      string  `json:"remote"`
+}
+
+/*! \brief How the push went on a node
+ */
+type DO_push_t struct {
+    Node        string  `json:"node"`
+    IP          string  `json:"ip"`
+    Files       int     `json:"files"`         //how many were copied, sftp stops at the first failure so it is 0 or all of them
+    Reloaded    bool    `json:"reloaded"`
+    Seconds     float64 `json:"seconds"`
+    Result      string  `json:"result"`        //ok, or the error
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- PUSH FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Copies the files to the node as the ready user and then runs the reload command, when there is one
+ *  The reload is skipped if any of the files didn't make it
+ */
+func (do DO_c) PushFiles (node DO_node_t, files []DO_push_file_t, reload string) *DO_push_t {
+    start := time.Now()
+    result := &DO_push_t{Node: node.Name, IP: node.IP, Result: "ok"}
+    err := do.pushFiles(node, files, reload, result)
+    result.Seconds = time.Since(start).Round(time.Millisecond).Seconds()
+    if err != nil { result.Result = err.Error() }
+    return result
+}
+
+func (do DO_c) pushFiles (node DO_node_t, files []DO_push_file_t, reload string, result *DO_push_t) error {
+    if do.ReadOnly { return readOnlyError("push files to", node.Name) }
+    if len(node.IP) == 0 { return fmt.Errorf("Node '%s' doesn't have a public ip address to push to", node.Name) }
+
+    batch := make([]string, 0, len(files))
+    for _, f := range(files) {
+        if strings.ContainsAny(f.Local + f.Remote, "\"\n") { return fmt.Errorf("Can't push '%s' to '%s', quotes and newlines aren't allowed in the paths", f.Local, f.Remote) }
+        batch = append(batch, fmt.Sprintf(`put "%s" "%s"`, f.Local, f.Remote))
+    }
+
+    cmd := exec.CommandContext(do.context(), "sftp", append([]string{"-b", "-"}, do.sshArgs(node.IP)...)...)
+    cmd.Stdin = strings.NewReader(strings.Join(batch, "\n") + "\n")
+    out, err := cmd.CombinedOutput()
+    if do.Verbose && len(out) > 0 { fmt.Println(strings.TrimSpace(string(out))) }
+    if err != nil {
+        if _, ok := err.(*exec.ExitError); ok { return fmt.Errorf("sftp to %s failed :: %s", node.IP, lastLines(string(out), 3)) }
+        return fmt.Errorf("Unable to run sftp :: %s", err.Error())
+    }
+    result.Files = len(files)
+    if len(reload) == 0 { return nil }
+
+    out, err = do.sshCommand(do.context(), node.IP, reload)
+    if do.Verbose && len(out) > 0 { fmt.Println(strings.TrimSpace(string(out))) }
+    if err != nil { return fmt.Errorf("Reload failed :: %s :: %s", err.Error(), lastLines(string(out), 3)) }
+    result.Reloaded = true
+    return nil
+}
@@ -0,0 +1,181 @@
+/*! \file do_ready.go
+    \brief Waiting for a new node to actually be usable, digital ocean says it's active minutes before ssh answers and cloud-init is done
+ *  Also draining a node over ssh before it's shut down or deleted
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "context"
+    "net"
+    "os/exec"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_ready_interval     = 5 * time.Second
+const do_ready_tries        = 120  //10 minutes for each of the waits, -create-timeout can cut it shorter
+const do_boot_finished      = "/var/lib/cloud/instance/boot-finished"
+const do_drain_timeout      = 300  //seconds, when the config doesn't say
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief What CreateNode waits for after the node is active, nothing when both are false
+ *  The user and identity are also what the drain command is run with, and Delete is the same idea for DeleteNode
+ */
+type DO_ready_t struct {
+    SSH         bool    //port 22 accepts connections
+    CloudInit   bool    //ssh in and wait for cloud-init to finish, this implies SSH
+    Delete      bool    //after deleting, wait for the node to be out of the listings and its floating ip released
+    User        string  //who we ssh in as, root when it's empty
+    Identity    string  //optional private key file for ssh
+    KnownHosts  string  //managed known_hosts file, when it's set ssh only trusts the host keys in it and new nodes get theirs added
+}
+
+/*! \brief Command from the config run on a node before it's shut down for a resize or deleted, ie 'systemctl stop app'
+ */
+type DO_drain_t struct {
+    Command     string  `json:"command"`
+    Timeout     int     `json:"timeout"`   //seconds we wait for it, 300 when it's not set
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Public ip of the droplet, empty when it doesn't have one yet
+ */
+func (droplet do_droplet_t) publicIP () string {
+    for _, n := range(droplet.Networks.V4) {
+        if n.Type == "public" { return n.IP }
+    }
+    return ""
+}
+
+/*! \brief Keeps trying the check until it's true, the tries run out or the context is done
+ */
+func (do DO_c) waitUntil (what string, check func () (bool, error)) error {
+    for try := 0; try < do_ready_tries; try++ {
+        ok, err := check()
+        if err != nil || ok { return err }
+        if do.Verbose { fmt.Printf("Waiting for %s...\n", what) }
+        if err = do.sleep(do_ready_interval); err != nil { return err }
+    }
+    return fmt.Errorf("Gave up waiting for %s", what)
+}
+
+/*! \brief Runs the command on the node over ssh, the host key is trusted the first time we see it unless there's a managed known hosts file
+ */
+func (do DO_c) sshCommand (ctx context.Context, ip string, command ...string) ([]byte, error) {
+    return do.sshCmd(ctx, ip, command...).CombinedOutput()
+}
+
+func (do DO_c) sshCmd (ctx context.Context, ip string, command ...string) *exec.Cmd {
+    return exec.CommandContext(ctx, "ssh", append(do.sshArgs(ip), command...)...)
+}
+
+/*! \brief The options and user@ip that ssh and sftp both take
+ */
+func (do DO_c) sshArgs (ip string) []string {
+    user := do.Ready.User
+    if len(user) == 0 { user = "root" }
+
+    args := []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new", "-o", "ConnectTimeout=10"}
+    if len(do.Ready.KnownHosts) > 0 { args = []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile=" + do.Ready.KnownHosts, "-o", "ConnectTimeout=10"} }
+    if len(do.Ready.Identity) > 0 { args = append(args, "-i", do.Ready.Identity) }
+    return append(args, user + "@" + ip)
+}
+
+/*! \brief Tries to ssh in and see if cloud-init wrote its boot finished file
+ */
+func (do DO_c) cloudInitFinished (ip string) (bool, error) {
+    out, err := do.sshCommand(do.context(), ip, "test", "-f", do_boot_finished)
+    if err == nil { return true, nil }
+    if _, ok := err.(*exec.ExitError); !ok { return false, fmt.Errorf("Unable to run ssh :: %s", err.Error()) }
+    if do.SuperVerbose && len(out) > 0 { fmt.Println(strings.TrimSpace(string(out))) }
+    return false, do.context().Err()    //ssh failing is expected until the node's keys are in place
+}
+
+/*! \brief Runs the drain command from the config on the node and waits for it, nodes that aren't running are left alone
+ */
+func (do DO_c) drainNode (droplet *do_droplet_t) error {
+    if len(do.Config.Drain.Command) == 0 || do.SkipDrain || droplet.Status != "active" { return nil }
+    if do.ReadOnly { return readOnlyError("drain", droplet.Name) }
+    ip := droplet.publicIP()
+    if len(ip) == 0 { return fmt.Errorf("Node '%s' doesn't have a public ip address to run the drain command on", droplet.Name) }
+
+    timeout := do.Config.Drain.Timeout
+    if timeout <= 0 { timeout = do_drain_timeout }
+    ctx, cancel := context.WithTimeout(do.context(), time.Duration(timeout) * time.Second)
+    defer cancel()
+
+    fmt.Printf("Draining node %s: %s\n", droplet.Name, do.Config.Drain.Command)
+    out, err := do.sshCommand(ctx, ip, do.Config.Drain.Command)
+    if do.Verbose && len(out) > 0 { fmt.Println(strings.TrimSpace(string(out))) }
+    if err != nil {
+        if ctx.Err() != nil && do.context().Err() == nil { err = fmt.Errorf("it took longer than %d seconds", timeout) }
+        return fmt.Errorf("Drain command on %s failed, use -skip-drain to go ahead anyway :: %s", droplet.Name, err.Error())
+    }
+    return nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- READY FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Waits for the deleted node to really be gone, so the records cleaned up after it aren't racing it still being listed
+ *  The floating ip it had has to be released too
+ */
+func (do DO_c) WaitForDeleted (droplet *do_droplet_t) error {
+    return do.Progress.Step("wait for delete " + droplet.Name, func () error {
+        return do.waitUntil(droplet.Name + " to be gone", func () (bool, error) {
+            if _, err := do.send("GET", fmt.Sprintf("droplets/%d", droplet.ID), nil); !doNotFound(err) { return false, do.context().Err() }
+
+            do.Cache.clear()    //the listings would otherwise keep showing it
+            listed, err := do.getDropletFromName(droplet.Name)
+            if err != nil || (listed != nil && listed.ID == droplet.ID) { return false, do.context().Err() }
+
+            ips, err := do.ListFloatingIPs()
+            if err != nil { return false, do.context().Err() }
+            for _, ip := range(ips) {
+                if ip.DropletID == droplet.ID { return false, nil }
+            }
+            return true, nil
+        })
+    })
+}
+
+/*! \brief Waits for the node to be active, then for whatever else Ready asks for
+ */
+func (do DO_c) WaitForReady (id int) error {
+    droplet := &do_droplet_t{}
+    err := do.Progress.Step(fmt.Sprintf("wait for active %d", id), func () error {
+        return do.waitUntil("the node to be active", func () (bool, error) {
+            droplet = do.getDropletFromID(id)
+            return droplet.Status == "active" && len(droplet.publicIP()) > 0, nil
+        })
+    })
+    if err != nil || (!do.Ready.SSH && !do.Ready.CloudInit) { return err }
+
+    ip := droplet.publicIP()
+    err = do.Progress.Step("wait for ssh " + droplet.Name, func () error {
+        return do.waitUntil("ssh on " + ip, func () (bool, error) {
+            conn, err := (&net.Dialer{Timeout: do_ready_interval}).DialContext(do.context(), "tcp", net.JoinHostPort(ip, "22"))
+            if err != nil { return false, do.context().Err() }
+            conn.Close()
+            return true, nil
+        })
+    })
+    if err != nil || !do.Ready.CloudInit { return err }
+
+    return do.Progress.Step("wait for cloud-init " + droplet.Name, func () error {
+        return do.waitUntil("cloud-init to finish on " + ip, func () (bool, error) { return do.cloudInitFinished(ip) })
+    })
+}
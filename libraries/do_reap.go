@@ -0,0 +1,119 @@
+/*! \file do_reap.go
+    \brief Finding what's safe to clean up, nodes and volumes past the expiry tag they were created with and addresses and volumes nothing is using
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_expires_tag        = "hm:expires:"
+const do_expires_format     = "200601021504"    //utc, tags can't have spaces or dashes in the time
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Something Reapable found, the type is node, volume or floating_ip
+ */
+type DO_reap_t struct {
+    Type        string  `json:"type"`
+    ID          string  `json:"id"`
+    Name        string  `json:"name"`
+    Region      string  `json:"region"`
+    Reason      string  `json:"reason"`    //ie 'expired 2026-10-12 15:30' or 'unattached'
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief When the resource expires from its tag, false when it doesn't have one we can read
+ */
+func expiresAt (tags []string) (time.Time, bool) {
+    for _, t := range(tags) {
+        if !strings.HasPrefix(t, do_expires_tag) { continue }
+        at, err := time.Parse(do_expires_format, strings.TrimPrefix(t, do_expires_tag))
+        if err == nil { return at, true }
+    }
+    return time.Time{}, false
+}
+
+func expiredReason (at time.Time) string {
+    return "expired " + at.Format("2006-01-02 15:04")
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- REAP FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Nodes and volumes past their expiry tag, floating ips that aren't assigned and volumes that aren't attached
+ *  Nothing is removed, hand them to ReapResource for that
+ */
+func (do DO_c) Reapable () ([]DO_reap_t, error) {
+    now := time.Now()
+    reap := make([]DO_reap_t, 0)
+
+    var err error
+    pageErr := do.EachPage("droplets?tag_name=" + do_managed_tag, "droplets", func (item json.RawMessage) bool {  //only we set the expiry
+        var d do_droplet_t
+        if err = json.Unmarshal(item, &d); err != nil { return false }
+        if at, ok := expiresAt(d.Tags); ok && at.Before(now) {
+            reap = append(reap, DO_reap_t{Type: "node", ID: fmt.Sprint(d.ID), Name: d.Name, Region: d.Region.Slug, Reason: expiredReason(at)})
+        }
+        return true
+    })
+    if pageErr != nil { return nil, pageErr }
+    if err != nil { return nil, err }
+
+    pageErr = do.EachPage("volumes", "volumes", func (item json.RawMessage) bool {
+        var v do_volume_t
+        if err = json.Unmarshal(item, &v); err != nil { return false }
+        if at, ok := expiresAt(v.Tags); ok && at.Before(now) {
+            reap = append(reap, DO_reap_t{Type: "volume", ID: v.ID, Name: v.Name, Region: v.Region.Slug, Reason: expiredReason(at)})
+        } else if len(v.DropletIDs) == 0 {
+            reap = append(reap, DO_reap_t{Type: "volume", ID: v.ID, Name: v.Name, Region: v.Region.Slug, Reason: fmt.Sprintf("unattached, %dgb", v.SizeGB)})
+        }
+        return true
+    })
+    if pageErr != nil { return nil, pageErr }
+    if err != nil { return nil, err }
+
+    pageErr = do.EachPage("floating_ips", "floating_ips", func (item json.RawMessage) bool {
+        var f struct {
+            do_floating_ip_t
+            Region  struct {
+                Slug    string  `json:"slug"`
+            }   `json:"region"`
+        }
+        if err = json.Unmarshal(item, &f); err != nil { return false }
+        if f.Droplet.ID == 0 { reap = append(reap, DO_reap_t{Type: "floating_ip", ID: f.IP, Name: f.IP, Region: f.Region.Slug, Reason: "unassigned"}) }
+        return true
+    })
+    if pageErr != nil { return nil, pageErr }
+    return reap, err
+}
+
+/*! \brief Removes what Reapable found, nodes go through DeleteNode so they're drained first
+ */
+func (do DO_c) ReapResource (r DO_reap_t) error {
+    switch r.Type {
+    case "node":
+        return do.DeleteNode(r.Name)
+    case "volume":
+        fmt.Println("Deleting volume: " + r.Name)
+        return do.deleteRequest("volumes/" + r.ID)
+    case "floating_ip":
+        fmt.Println("Releasing floating ip: " + r.ID)
+        return do.deleteRequest("floating_ips/" + r.ID)
+    }
+    return fmt.Errorf("Unknown resource type '%s' to reap", r.Type)
+}
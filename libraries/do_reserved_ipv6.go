@@ -0,0 +1,81 @@
+/*! \file do_reserved_ipv6.go
+    \brief Digital ocean reserved ipv6 addresses, the ipv6 side of floating ips so dual stack services can move both together
+ *  The node needs ipv6 enabled before one can be assigned to it
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type do_reserved_ipv6_t struct {
+    IP          string  `json:"ip"`
+    Region      string  `json:"region_slug"`
+    Droplet     struct {
+        ID      int     `json:"id"`
+    }   `json:"droplet"`
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- RESERVED IPV6 FUNCTIONS -------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Id of the node the reserved ipv6 address is assigned to, 0 when it isn't
+ */
+func (do DO_c) GetReservedIPv6 (ip string) (int, error) {
+    resp, err := do.send("GET", "reserved_ipv6/" + ip, nil)
+    if err != nil { return 0, err }
+
+    var reserved struct {
+        IP      do_reserved_ipv6_t  `json:"reserved_ipv6"`
+    }
+    err = json.Unmarshal(resp, &reserved)
+    return reserved.IP.Droplet.ID, err
+}
+
+/*! \brief Assigns the reserved ipv6 address to the node, moving it off whatever had it
+ */
+func (do DO_c) AssignReservedIPv6 (ip string, id int) error {
+    jStr, _ := json.Marshal(do_t{Type: "assign", ID: id})
+    _, err := do.send("POST", "reserved_ipv6/" + ip + "/actions", jStr)
+    return err
+}
+
+/*! \brief Gets a reserved ipv6 address for the node, reserving a new one in its region when it doesn't already have one
+ */
+func (do DO_c) ReserveIPv6 (id int) (string, error) {
+    existing := ""
+    var err error
+    pageErr := do.EachPage("reserved_ipv6", "reserved_ipv6s", func (item json.RawMessage) bool {
+        var r do_reserved_ipv6_t
+        if err = json.Unmarshal(item, &r); err != nil { return false }
+        if r.Droplet.ID == id { existing = r.IP }
+        return len(existing) == 0
+    })
+    if pageErr != nil { return "", pageErr }
+    if err != nil { return "", err }
+    if len(existing) > 0 {
+        if do.Verbose { fmt.Printf("Node already has reserved ipv6 %s\n", existing) }
+        return existing, nil
+    }
+
+    droplet := do.getDropletFromID(id)
+    if droplet.ID == 0 { return "", fmt.Errorf("Node %d does not exist", id) }
+
+    if do.Verbose { fmt.Println("Reserving a new ipv6 address in " + droplet.Region.Slug) }
+    jStr, _ := json.Marshal(map[string]string{"region_slug": droplet.Region.Slug})    //unlike ipv4 it can't be assigned as it's reserved
+    resp, err := do.send("POST", "reserved_ipv6", jStr)
+    if err != nil { return "", err }
+
+    var reserved struct {
+        IP      do_reserved_ipv6_t  `json:"reserved_ipv6"`
+    }
+    if err = json.Unmarshal(resp, &reserved); err != nil { return "", err }
+    return reserved.IP.IP, do.AssignReservedIPv6(reserved.IP.IP, id)
+}
@@ -0,0 +1,138 @@
+/*! \file do_secrets.go
+    \brief Handing a new node its application secrets, either in its user data or over ssh once it's up
+ *  The values only ever go to the node, they aren't printed and the user data is scrubbed from traces and recordings
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "bytes"
+    "context"
+    "strings"
+    "time"
+    "encoding/base64"
+    "io/ioutil"
+    "mime"
+    "mime/multipart"
+    "net/mail"
+    "net/textproto"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_secret_timeout = 2 * time.Minute
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Where the secrets file goes on the node and who can read it
+ */
+type DO_secret_file_t struct {
+    Path        string
+    Mode        string  //ie 0600
+    Owner       string  //user or user:group, root when it's empty
+    Content     []byte
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func (f DO_secret_file_t) check () error {
+    if !strings.HasPrefix(f.Path, "/") { return fmt.Errorf("Secrets path '%s' has to be absolute", f.Path) }
+    if strings.ContainsAny(f.Path + f.Owner + f.Mode, "'\"\n ") { return fmt.Errorf("Secrets path, owner and mode can't have quotes or spaces") }
+    return nil
+}
+
+func (f DO_secret_file_t) owner () string {
+    if len(f.Owner) == 0 { return "root" }
+    return f.Owner
+}
+
+func (f DO_secret_file_t) mode () string {
+    if len(f.Mode) == 0 { return "0600" }
+    return f.Mode
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- SECRET FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief User data that writes the secrets file on first boot and then runs the user data we already had, if any
+ *  Anyone on the node can read its user data from the metadata service, SendSecretFile doesn't leave a copy there
+ */
+func SecretUserData (f DO_secret_file_t, userData string) (string, error) {
+    if err := f.check(); err != nil { return "", err }
+    config := fmt.Sprintf("#cloud-config\nwrite_files:\n- path: %s\n  permissions: '%s'\n  owner: '%s'\n  encoding: b64\n  content: %s\n",
+        f.Path, f.mode(), f.owner(), base64.StdEncoding.EncodeToString(f.Content))
+    return combineUserData(config, userData), nil
+}
+
+/*! \brief Our cloud config along with the user data we already had, cloud-init runs both when they're parts of a multipart message
+ *  User data that's already multipart, ie from an earlier call, gets ours added to its parts
+ */
+func combineUserData (config, userData string) string {
+    if len(userData) == 0 { return config }
+
+    parts := [][2]string{{"text/cloud-config", config}}
+    if existing := userDataParts(userData); existing != nil {
+        parts = append(parts, existing...)
+    } else if strings.HasPrefix(userData, "#!") {
+        parts = append(parts, [2]string{"text/x-shellscript", userData})
+    } else {
+        parts = append(parts, [2]string{"text/cloud-config", userData})
+    }
+
+    var body bytes.Buffer
+    form := multipart.NewWriter(&body)
+    for _, part := range(parts) {
+        w, _ := form.CreatePart(textproto.MIMEHeader{"Content-Type": {part[0] + `; charset="utf-8"`}, "MIME-Version": {"1.0"}})
+        w.Write([]byte(part[1]))
+    }
+    form.Close()
+    return fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n\n%s", form.Boundary(), body.String())
+}
+
+/*! \brief The type and content of each part of multipart user data, nil when it isn't multipart
+ */
+func userDataParts (userData string) [][2]string {
+    msg, err := mail.ReadMessage(strings.NewReader(userData))
+    if err != nil { return nil }
+    mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+    if err != nil || mediaType != "multipart/mixed" { return nil }
+
+    parts := make([][2]string, 0)
+    reader := multipart.NewReader(msg.Body, params["boundary"])
+    for {
+        part, err := reader.NextPart()
+        if err != nil { break }
+        content, _ := ioutil.ReadAll(part)
+        partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+        parts = append(parts, [2]string{partType, string(content)})
+    }
+    return parts
+}
+
+/*! \brief Writes the secrets file on the node over ssh, the content goes over stdin so it's never on a command line
+ *  It's written next to the path with the owner and mode set and then moved into place, so it's never readable by anyone else
+ */
+func (do DO_c) SendSecretFile (ip string, f DO_secret_file_t) error {
+    if err := f.check(); err != nil { return err }
+    if do.ReadOnly { return readOnlyError("send secrets to", ip) }
+    tmp := f.Path + ".harbormaster"
+    script := fmt.Sprintf("umask 077 && mkdir -p \"$(dirname '%s')\" && cat > '%s' && chown '%s' '%s' && chmod '%s' '%s' && mv -f '%s' '%s'",
+        f.Path, tmp, f.owner(), tmp, f.mode(), tmp, tmp, f.Path)
+    if len(do.Ready.User) > 0 && do.Ready.User != "root" { script = "sudo -n sh -c \"" + strings.ReplaceAll(script, "\"", "\\\"") + "\"" }
+
+    ctx, cancel := context.WithTimeout(do.context(), do_secret_timeout)
+    defer cancel()
+    cmd := do.sshCmd(ctx, ip, script)
+    cmd.Stdin = bytes.NewReader(f.Content)
+    out, err := cmd.CombinedOutput()
+    if err != nil { return fmt.Errorf("Unable to write the secrets to %s :: %s :: %s", ip, err.Error(), lastLines(string(out), 2)) }
+    return nil
+}
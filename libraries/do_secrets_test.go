@@ -0,0 +1,62 @@
+package libraries
+
+import (
+    "io/ioutil"
+    "mime"
+    "mime/multipart"
+    "net/mail"
+    "reflect"
+    "strings"
+    "testing"
+    )
+
+/*! \brief The content type and body of each part of multipart user data
+ */
+func secretParts (t *testing.T, userData string) [][2]string {
+    msg, err := mail.ReadMessage(strings.NewReader(userData))
+    if err != nil { t.Fatal(err) }
+    _, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+    if err != nil { t.Fatal(err) }
+
+    parts := make([][2]string, 0)
+    reader := multipart.NewReader(msg.Body, params["boundary"])
+    for {
+        part, err := reader.NextPart()
+        if err != nil { break }
+        content, _ := ioutil.ReadAll(part)
+        partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+        parts = append(parts, [2]string{partType, string(content)})
+    }
+    return parts
+}
+
+func TestSecretUserData (t *testing.T) {
+    f := DO_secret_file_t{Path: "/etc/app/secrets", Owner: "app", Content: []byte("KEY=value\n")}
+    config := "#cloud-config\nwrite_files:\n- path: /etc/app/secrets\n  permissions: '0600'\n  owner: 'app'\n  encoding: b64\n  content: S0VZPXZhbHVlCg==\n"
+    script := "#!/bin/bash\necho hello\n"
+    other := "#cloud-config\npackages:\n- nginx\n"
+
+    tests := []struct {
+        name        string
+        userData    string
+        parts       [][2]string     //nil when it's our config on its own
+    }{
+        {"nothing else", "", nil},
+        {"script", script, [][2]string{{"text/cloud-config", config}, {"text/x-shellscript", script}}},
+        {"cloud config", other, [][2]string{{"text/cloud-config", config}, {"text/cloud-config", other}}},
+    }
+
+    for _, tt := range(tests) {
+        userData, err := SecretUserData(f, tt.userData)
+        if err != nil { t.Fatalf("%s: %s", tt.name, err) }
+        if tt.parts == nil {
+            if userData != config { t.Errorf("%s: got %s, expecting %s", tt.name, userData, config) }
+            continue
+        }
+        if parts := secretParts(t, userData); !reflect.DeepEqual(parts, tt.parts) { t.Errorf("%s: got %q, expecting %q", tt.name, parts, tt.parts) }
+    }
+
+    for _, bad := range([]DO_secret_file_t{{Path: "etc/app/secrets"}, {Path: "/etc/app/my secrets"}, {Path: "/etc/app/secrets", Owner: "app'"}}) {
+        if _, err := SecretUserData(bad, ""); err == nil { t.Errorf("Expecting an error for %+v", bad) }
+    }
+}
@@ -0,0 +1,110 @@
+/*! \file do_select.go
+    \brief Picking nodes with a simple expression instead of a single tag, ie 'tag=web AND region=nyc3' or 'tag=web,staging'
+ *  Terms are joined with AND, commas between values mean any of them, and a term without a key is a tag.  A plain tag works like it always has
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "path"
+    "regexp"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+var do_select_and           = regexp.MustCompile(`(?i)\s+and\s+`)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type do_select_term_t struct {
+    key         string
+    values      []string
+}
+
+/*! \brief A parsed selection, nodes have to match every term.  Empty matches everything
+ */
+type DO_selector_t []do_select_term_t
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief What the node has for the key, tags can be more than one
+ */
+func selectField (node DO_node_t, key string) []string {
+    switch key {
+    case "tag":     return node.Tags
+    case "name":    return []string{node.Name}
+    case "region":  return []string{node.Region}
+    case "size":    return []string{node.Size}
+    case "stack":   return []string{node.Stack}
+    case "status":  return []string{node.Status}
+    case "owner":   return []string{node.Owner}
+    }
+    return nil
+}
+
+/*! \brief A tag every matching node has, so digital ocean can do the first pass of the filtering.  Empty when there isn't one
+ */
+func (sel DO_selector_t) apiTag () string {
+    for _, term := range(sel) {
+        if len(term.values) != 1 || strings.ContainsAny(term.values[0], "*?[") { continue }
+        switch term.key {
+        case "tag":     return term.values[0]
+        case "stack":   return do_stack_tag + tagValue(term.values[0])
+        }
+    }
+    return ""
+}
+
+func (sel DO_selector_t) matches (node DO_node_t) bool {
+    for _, term := range(sel) {
+        found := false
+        for _, have := range(selectField(node, term.key)) {
+            for _, want := range(term.values) {
+                ok, _ := path.Match(want, have)     //names can be patterns, ie 'web-*'
+                found = found || ok
+            }
+        }
+        if !found { return false }
+    }
+    return true
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- SELECT FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Parses the expression, the keys are tag, name, region, size, stack, status and owner
+ */
+func ParseSelector (expr string) (DO_selector_t, error) {
+    sel := make(DO_selector_t, 0)
+    expr = strings.TrimSpace(expr)
+    if len(expr) == 0 { return sel, nil }
+
+    for _, part := range(do_select_and.Split(expr, -1)) {
+        term := do_select_term_t{key: "tag"}
+        if kv := strings.SplitN(part, "=", 2); len(kv) == 2 {
+            term.key, part = strings.ToLower(strings.TrimSpace(kv[0])), kv[1]
+        }
+        if selectField(DO_node_t{}, term.key) == nil && term.key != "tag" {
+            return nil, fmt.Errorf("Unknown key '%s' in '%s', expecting tag, name, region, size, stack, status or owner", term.key, expr)
+        }
+        for _, val := range(strings.Split(part, ",")) {
+            val = strings.TrimSpace(val)
+            if len(val) == 0 { continue }
+            if _, err := path.Match(val, ""); err != nil { return nil, fmt.Errorf("Invalid pattern '%s' in '%s'", val, expr) }
+            if term.key == "stack" { val = strings.ToLower(val) }   //the tag we read it from is lower case
+            term.values = append(term.values, val)
+        }
+        if len(term.values) == 0 { return nil, fmt.Errorf("Nothing to match for %s in '%s'", term.key, expr) }
+        sel = append(sel, term)
+    }
+    return sel, nil
+}
@@ -0,0 +1,57 @@
+package libraries
+
+import (
+    "reflect"
+    "testing"
+    )
+
+func TestParseSelector (t *testing.T) {
+    tests := []struct {
+        expr        string
+        sel         DO_selector_t
+        apiTag      string
+        fails       bool
+    }{
+        {"", DO_selector_t{}, "", false},
+        {"web", DO_selector_t{{"tag", []string{"web"}}}, "web", false},
+        {"tag=web AND region=nyc3", DO_selector_t{{"tag", []string{"web"}}, {"region", []string{"nyc3"}}}, "web", false},
+        {"tag=web,staging and Region = nyc3, sfo3", DO_selector_t{{"tag", []string{"web", "staging"}}, {"region", []string{"nyc3", "sfo3"}}}, "", false},
+        {"name=web-* AND stack=Demo", DO_selector_t{{"name", []string{"web-*"}}, {"stack", []string{"demo"}}}, do_stack_tag + "demo", false},
+        {"tag=web-*", DO_selector_t{{"tag", []string{"web-*"}}}, "", false},
+        {"colour=blue", nil, "", true},
+        {"region=", nil, "", true},
+        {"name=web-[", nil, "", true},
+    }
+
+    for _, tt := range(tests) {
+        sel, err := ParseSelector(tt.expr)
+        if tt.fails {
+            if err == nil { t.Errorf("'%s': expecting an error", tt.expr) }
+            continue
+        }
+        if err != nil { t.Errorf("'%s': %s", tt.expr, err); continue }
+        if !reflect.DeepEqual(sel, tt.sel) { t.Errorf("'%s': got %v, expecting %v", tt.expr, sel, tt.sel) }
+        if sel.apiTag() != tt.apiTag { t.Errorf("'%s': api tag '%s', expecting '%s'", tt.expr, sel.apiTag(), tt.apiTag) }
+    }
+}
+
+func TestSelectorMatches (t *testing.T) {
+    node := DO_node_t{Name: "web-1", Region: "nyc3", Size: "s-1vcpu-1gb", Tags: []string{"web", "staging"}, Stack: "demo", Status: "active"}
+    tests := []struct {
+        expr        string
+        matches     bool
+    }{
+        {"", true},
+        {"staging", true},
+        {"tag=api,web AND region=nyc3", true},
+        {"name=web-* and status=active", true},
+        {"region=sfo3", false},
+        {"web AND owner=sam", false},
+    }
+
+    for _, tt := range(tests) {
+        sel, err := ParseSelector(tt.expr)
+        if err != nil { t.Fatalf("'%s': %s", tt.expr, err) }
+        if sel.matches(node) != tt.matches { t.Errorf("'%s': matches %v, expecting %v", tt.expr, !tt.matches, tt.matches) }
+    }
+}
@@ -0,0 +1,225 @@
+/*! \file do_sizes.go
+    \brief Checks the size and region we're asking for are actually available, before digital ocean gives us a cryptic error
+ *  Also the size classes, ie basic, the premium intel and amd ones, and gpus
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_max_suggestions    = 5 //how many alternatives we list when something isn't available
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The gpus on a size or droplet, digital ocean leaves this off for everything else
+ */
+type DO_gpu_info_t struct {
+    Count       int     `json:"count"`
+    Model       string  `json:"model"`
+    VRAM        struct {
+        Amount  int     `json:"amount"`
+        Unit    string  `json:"unit"`
+    }   `json:"vram"`
+}
+
+func (gpu *DO_gpu_info_t) String () string {
+    if gpu == nil || gpu.Count == 0 { return "" }
+    return fmt.Sprintf("%dx %s %d%s", gpu.Count, gpu.Model, gpu.VRAM.Amount, gpu.VRAM.Unit)
+}
+
+type do_size_t struct {
+    Slug        string      `json:"slug"`
+    Memory      int         `json:"memory"`
+    VCPUs       int         `json:"vcpus"`
+    Disk        int         `json:"disk"`
+    PriceMonthly    float64 `json:"price_monthly"`
+    Available   bool        `json:"available"`
+    Regions     []string    `json:"regions"`
+    GPUInfo     *DO_gpu_info_t  `json:"gpu_info"`
+}
+
+/*! \brief A size for listing, memory is in mb and disk in gb
+ */
+type DO_size_t struct {
+    Slug        string      `json:"slug"`
+    Class       string      `json:"class"`
+    Memory      int         `json:"memory"`
+    VCPUs       int         `json:"vcpus"`
+    Disk        int         `json:"disk"`
+    PriceMonthly    float64 `json:"price_monthly"`
+    GPU         string      `json:"gpu,omitempty"`
+    Regions     []string    `json:"regions"`
+}
+
+type do_region_t struct {
+    Slug        string      `json:"slug"`
+    Available   bool        `json:"available"`
+    Sizes       []string    `json:"sizes"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func hasString (list []string, val string) bool {
+    for _, l := range(list) {
+        if l == val { return true }
+    }
+    return false
+}
+
+func removeString (list []string, val string) []string {
+    out := make([]string, 0, len(list))
+    for _, l := range(list) {
+        if l != val { out = append(out, l) }
+    }
+    return out
+}
+
+/*! \brief Class of the size from its slug, ie 's-2vcpu-4gb-amd' is premium-amd and 'gpu-h100x1-80gb' is gpu
+ */
+func sizeClass (slug string) string {
+    switch {
+    case strings.HasPrefix(slug, "gpu-"):       return "gpu"
+    case strings.HasSuffix(slug, "-intel"):     return "premium-intel"
+    case strings.HasSuffix(slug, "-amd"):       return "premium-amd"
+    case strings.HasPrefix(slug, "c-") || strings.HasPrefix(slug, "c2-"):   return "cpu-optimized"
+    case strings.HasPrefix(slug, "m-") || strings.HasPrefix(slug, "m3-") || strings.HasPrefix(slug, "m6-"):  return "memory-optimized"
+    case strings.HasPrefix(slug, "so-") || strings.HasPrefix(slug, "so1_5-"):   return "storage-optimized"
+    case strings.HasPrefix(slug, "g-") || strings.HasPrefix(slug, "gd-"):  return "general-purpose"
+    }
+    return "basic"
+}
+
+/*! \brief Joins the first few suggestions, so the error stays readable
+ */
+func suggestions (list []string) string {
+    if len(list) > do_max_suggestions { list = append(list[:do_max_suggestions:do_max_suggestions], "...") }
+    return strings.Join(list, ", ")
+}
+
+func (do DO_c) getSizes () ([]do_size_t, error) {
+    resp, err := do.send("GET", "sizes?per_page=200", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Sizes   []do_size_t     `json:"sizes"`
+    }
+    err = compatDecode("size", resp, "sizes", &list, nil)
+    return list.Sizes, err
+}
+
+func (do DO_c) getRegions () ([]do_region_t, error) {
+    resp, err := do.send("GET", "regions?per_page=200", nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Regions     []do_region_t   `json:"regions"`
+    }
+    err = json.Unmarshal(resp, &list)
+    return list.Regions, err
+}
+
+/*! \brief Makes sure the account has room for more nodes
+ */
+func (do DO_c) checkDropletLimit (newNodes int) error {
+    resp, err := do.send("GET", "account", nil)
+    if err != nil { return err }
+
+    var account struct {
+        Account     struct {
+            DropletLimit    int     `json:"droplet_limit"`
+        }   `json:"account"`
+    }
+    if err = json.Unmarshal(resp, &account); err != nil { return err }
+
+    resp, err = do.send("GET", "droplets?page=1&per_page=1", nil)
+    if err != nil { return err }
+
+    var droplets struct {
+        Meta    struct {
+            Total   int     `json:"total"`
+        }   `json:"meta"`
+    }
+    if err = json.Unmarshal(resp, &droplets); err != nil { return err }
+
+    if droplets.Meta.Total + newNodes > account.Account.DropletLimit {
+        return fmt.Errorf("Droplet limit reached, the account has %d of %d droplets.  Delete some or ask digital ocean to raise the limit", droplets.Meta.Total, account.Account.DropletLimit)
+    }
+    return nil
+}
+
+/*! \brief Makes sure the size can be used in the region, and that there's room on the account for the new nodes
+ *  The error suggests other regions with the size, and other sizes in the region
+ */
+func (do DO_c) checkCapacity (region, size string, newNodes int) error {
+    sizes, err := do.getSizes()
+    if err != nil { return err }
+    regions, err := do.getRegions()
+    if err != nil { return err }
+
+    var target *do_size_t
+    for i := range(sizes) {
+        if sizes[i].Slug == size { target = &sizes[i] }
+    }
+
+    var targetRegion *do_region_t
+    for i := range(regions) {
+        if regions[i].Slug == region { targetRegion = &regions[i] }
+    }
+
+    if target != nil && target.GPUInfo != nil && target.GPUInfo.Count > 0 && (!target.Available || !hasString(target.Regions, region)) {  //gpus are only in a few regions, so that's what helps
+        return fmt.Errorf("GPU size '%s' (%s) is not available in region '%s'.  Regions with it: %s", size, target.GPUInfo, region, suggestions(target.Regions))
+    }
+
+    if target == nil || !target.Available {
+        alts := make([]string, 0)
+        for _, s := range(sizes) {
+            if s.Available && targetRegion != nil && hasString(targetRegion.Sizes, s.Slug) && strings.Contains(s.Slug, strings.TrimPrefix(size, "s-")) { alts = append(alts, s.Slug) }
+        }
+        if len(alts) == 0 { return fmt.Errorf("Size '%s' is not available", size) }
+        return fmt.Errorf("Size '%s' is not available.  Similar sizes: %s", size, suggestions(alts))
+    }
+
+    if targetRegion == nil || !targetRegion.Available || !hasString(targetRegion.Sizes, size) {
+        alts := make([]string, 0)
+        for _, r := range(regions) {
+            if r.Available && hasString(r.Sizes, size) { alts = append(alts, r.Slug) }
+        }
+
+        altSizes := make([]string, 0)
+        if targetRegion != nil && targetRegion.Available {
+            for _, s := range(sizes) {  //same memory and cpus, ie the older or newer slug for it
+                if s.Memory == target.Memory && s.VCPUs == target.VCPUs && hasString(targetRegion.Sizes, s.Slug) { altSizes = append(altSizes, s.Slug) }
+            }
+        }
+        return fmt.Errorf("Size '%s' is not available in region '%s'.  Regions with it: %s.  Sizes like it in %s: %s", size, region, suggestions(alts), region, suggestions(altSizes))
+    }
+
+    if newNodes > 0 { return do.checkDropletLimit(newNodes) }
+    return nil
+}
+
+/*! \brief Lists the sizes that can be used, only the ones in the region and class when they're set, ie class 'gpu'
+ */
+func (do DO_c) ListSizes (region, class string) ([]DO_size_t, error) {
+    sizes, err := do.getSizes()
+    if err != nil { return nil, err }
+
+    list := make([]DO_size_t, 0)
+    for _, s := range(sizes) {
+        if !s.Available || (len(region) > 0 && !hasString(s.Regions, region)) || (len(class) > 0 && sizeClass(s.Slug) != class) { continue }
+        list = append(list, DO_size_t{Slug: s.Slug, Class: sizeClass(s.Slug), Memory: s.Memory, VCPUs: s.VCPUs, Disk: s.Disk, PriceMonthly: s.PriceMonthly, GPU: s.GPUInfo.String(), Regions: s.Regions})
+    }
+    return list, nil
+}
@@ -0,0 +1,289 @@
+/*! \file do_spaces.go
+    \brief Digital ocean spaces buckets through their s3 api, and the cdn endpoints in front of them
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "io/ioutil"
+    "bytes"
+    "encoding/json"
+    "encoding/xml"
+    "encoding/hex"
+    "crypto/hmac"
+    "crypto/sha256"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_spaces_domain      = "digitaloceanspaces.com"
+const do_spaces_sign_region = "us-east-1"   //spaces wants this in the signature, the real region is in the host
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type DO_bucket_t struct {
+    Name        string  `xml:"Name" json:"name"`
+    Created     string  `xml:"CreationDate" json:"created"`
+}
+
+type DO_cdn_t struct {
+    ID              string  `json:"id,omitempty"`
+    Origin          string  `json:"origin"`
+    Endpoint        string  `json:"endpoint,omitempty"`
+    TTL             int     `json:"ttl,omitempty"`
+    CertificateID   string  `json:"certificate_id,omitempty"`
+    CustomDomain    string  `json:"custom_domain,omitempty"`
+    Created         string  `json:"created_at,omitempty"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func hmacSHA256 (key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
+
+func sha256Hex (data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+/*! \brief Request against the spaces s3 api, signed with aws signature v4
+ *  path is the bucket and key, ie '/my-bucket/some/file.json', or just '/' for the account
+ */
+func (do DO_c) spacesRequest (method, region, path string, data []byte, headers map[string]string) ([]byte, error) {
+    if len(do.Config.SpacesKey) == 0 || len(do.Config.SpacesSecret) == 0 {
+        return nil, fmt.Errorf("Digital Ocean spaces_key and spaces_secret not set in the config")
+    }
+
+    if do.ReadOnly && method != "GET" && method != "HEAD" { return nil, readOnlyError(method, path) }
+
+    //each part of the path gets escaped on its own
+    parts := strings.Split(path, "/")
+    for i := range(parts) { parts[i] = url.PathEscape(parts[i]) }
+    path = strings.Join(parts, "/")
+
+    host := region + "." + do_spaces_domain
+    now := time.Now().UTC()
+    amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+    payloadHash := sha256Hex(data)
+
+    canonicalRequest := strings.Join([]string{method, path, "",
+        "host:" + host, "x-amz-content-sha256:" + payloadHash, "x-amz-date:" + amzDate, "",
+        "host;x-amz-content-sha256;x-amz-date", payloadHash}, "\n")
+    scope := day + "/" + do_spaces_sign_region + "/s3/aws4_request"
+    toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+    key := hmacSHA256([]byte("AWS4" + do.Config.SpacesSecret), day)
+    for _, part := range([]string{do_spaces_sign_region, "s3", "aws4_request"}) { key = hmacSHA256(key, part) }
+    signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+    req, err := http.NewRequestWithContext(do.context(), method, "https://" + host + path, bytes.NewBuffer(data))
+    if err != nil { return nil, err }
+
+    req.Header.Set("x-amz-date", amzDate)
+    req.Header.Set("x-amz-content-sha256", payloadHash)
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s", do.Config.SpacesKey, scope, signature))
+    for name, val := range(headers) { req.Header.Set(name, val) }  //not signed, so only things like the content type
+
+    client := &http.Client{}
+    resp, err := client.Do(req)
+    if err != nil { return nil, err }
+    defer resp.Body.Close()
+
+    body, _ := ioutil.ReadAll(resp.Body)
+    if do.SuperVerbose {
+        fmt.Println("response Status:", resp.Status)
+        fmt.Println("response Body:", redactString(string(body), []string{do.Config.SpacesSecret}))
+    }
+    if resp.StatusCode >= 300 { return nil, do_status_error{Code: resp.StatusCode, Url: method + " " + path, Body: string(body)} }
+    return body, nil
+}
+
+/*! \brief Gets the cdn endpoint in front of the bucket, nil if there isn't one
+ */
+func (do DO_c) getCDN (origin string) (*DO_cdn_t, error) {
+    cdns, err := do.ListCDNs()
+    if err == nil {
+        for _, cdn := range(cdns) {
+            if strings.EqualFold(cdn.Origin, origin) { return &cdn, nil }
+        }
+    }
+    return nil, err
+}
+
+/*! \brief Host name for the bucket, this is the origin for its cdn endpoint
+ */
+func bucketOrigin (bucket, region string) string {
+    return fmt.Sprintf("%s.%s.%s", strings.ToLower(bucket), region, do_spaces_domain)
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- SPACES FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the buckets, spaces shows every bucket for the account no matter which region we ask
+ */
+func (do DO_c) ListBuckets (region string) ([]DO_bucket_t, error) {
+    resp, err := do.spacesRequest("GET", region, "/", nil, nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Buckets     []DO_bucket_t   `xml:"Buckets>Bucket"`
+    }
+    err = xml.Unmarshal(resp, &list)
+    return list.Buckets, err
+}
+
+/*! \brief Creates the bucket in the region if it doesn't already exist
+ */
+func (do DO_c) CreateBucket (name, region string) error {
+    name = strings.ToLower(name)
+    buckets, err := do.ListBuckets(region)
+    if err != nil { return err }
+
+    for _, b := range(buckets) {
+        if b.Name == name {
+            if do.Verbose { fmt.Println("Bucket already exists") }
+            return nil
+        }
+    }
+
+    if do.Verbose { fmt.Println("Bucket does not exist, creating...") }
+    _, err = do.spacesRequest("PUT", region, "/" + name, nil, nil)
+    return err
+}
+
+/*! \brief Deletes the bucket, it needs to be empty first
+ */
+func (do DO_c) DeleteBucket (name, region string) error {
+    _, err := do.spacesRequest("DELETE", region, "/" + strings.ToLower(name), nil, nil)
+    return err
+}
+
+/*! \brief Downloads the key from the bucket, found is false when it isn't there
+ */
+func (do DO_c) DownloadObject (bucket, region, key string) (data []byte, found bool, err error) {
+    data, err = do.spacesRequest("GET", region, "/" + strings.ToLower(bucket) + "/" + strings.TrimPrefix(key, "/"), nil, nil)
+    if doNotFound(err) { return nil, false, nil }
+    return data, err == nil, err
+}
+
+/*! \brief Uploads the data to the key in the bucket, replacing whatever was there
+ */
+func (do DO_c) UploadObject (bucket, region, key string, data []byte, contentType string) error {
+    _, err := do.spacesRequest("PUT", region, "/" + strings.ToLower(bucket) + "/" + strings.TrimPrefix(key, "/"), data, map[string]string{"Content-Type": contentType})
+    return err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CDN FUNCTIONS -----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists all the cdn endpoints
+ */
+func (do DO_c) ListCDNs () ([]DO_cdn_t, error) {
+    cdns := make([]DO_cdn_t, 0)
+    for page := 1; page > 0; page++ {
+        resp, err := do.send("GET", fmt.Sprintf("cdn/endpoints?page=%d&per_page=100", page), nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            Endpoints   []DO_cdn_t  `json:"endpoints"`
+            Links   struct {
+                Pages   struct {
+                    Next    string  `json:"next"`
+                }   `json:"pages"`
+            }   `json:"links"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        cdns = append(cdns, list.Endpoints...)
+        if len(list.Links.Pages.Next) == 0 { break }
+    }
+    return cdns, nil
+}
+
+/*! \brief Puts a cdn endpoint in front of the bucket, or updates the one that's there
+ *  A custom domain needs a certificate, by name or id, and gets its CNAME created in the domain
+ */
+func (do DO_c) AssignCDN (bucket, region string, ttl int, domain, subDomain, certificate string) (*DO_cdn_t, error) {
+    certificateID, err := do.CertificateID(certificate)
+    if err != nil { return nil, err }
+
+    origin := bucketOrigin(bucket, region)
+    cdn := DO_cdn_t{Origin: origin, TTL: ttl, CertificateID: certificateID}
+    if len(subDomain) > 0 {
+        if len(certificateID) == 0 { return nil, fmt.Errorf("A custom domain on a cdn endpoint requires a certificate") }
+        cdn.CustomDomain = strings.ToLower(subDomain + "." + domain)
+    }
+
+    existing, err := do.getCDN(origin)
+    if err != nil { return nil, err }
+
+    var resp []byte
+    if existing == nil {
+        if do.Verbose { fmt.Println("CDN endpoint does not exist, creating...") }
+        jStr, _ := json.Marshal(cdn)
+        resp, err = do.send("POST", "cdn/endpoints", jStr)
+    } else {
+        if do.Verbose { fmt.Println("CDN endpoint already exists, updating") }
+        jStr, _ := json.Marshal(struct {
+            TTL             int     `json:"ttl,omitempty"`
+            CertificateID   string  `json:"certificate_id,omitempty"`
+            CustomDomain    string  `json:"custom_domain,omitempty"`
+        }{cdn.TTL, cdn.CertificateID, cdn.CustomDomain})
+        resp, err = do.send("PUT", "cdn/endpoints/" + existing.ID, jStr)
+    }
+    if err != nil { return nil, err }
+
+    var result struct {
+        Endpoint    DO_cdn_t    `json:"endpoint"`
+    }
+    if err = json.Unmarshal(resp, &result); err != nil { return nil, err }
+
+    if len(subDomain) > 0 { //the custom domain points at the cdn
+        err = do.AssignDomainRecord(domain, "CNAME", subDomain, result.Endpoint.Endpoint + ".")
+    }
+    return &result.Endpoint, err
+}
+
+/*! \brief Purges the cdn cache for the bucket, files can use wildcards and * purges everything
+ */
+func (do DO_c) PurgeCDN (bucket, region string, files []string) error {
+    cdn, err := do.getCDN(bucketOrigin(bucket, region))
+    if err != nil { return err }
+    if cdn == nil { return fmt.Errorf("No cdn endpoint for bucket '%s'", bucket) }
+
+    jStr, _ := json.Marshal(struct {
+        Files   []string    `json:"files"`
+    }{files})
+    _, err = do.send("DELETE", "cdn/endpoints/" + cdn.ID + "/cache", jStr)
+    return err
+}
+
+/*! \brief Removes the cdn endpoint from in front of the bucket
+ */
+func (do DO_c) DeleteCDN (bucket, region string) error {
+    cdn, err := do.getCDN(bucketOrigin(bucket, region))
+    if err == nil {
+        if cdn == nil {
+            if do.Verbose { fmt.Println("CDN endpoint does not exist, nothing to do...") }
+        } else {
+            err = do.deleteRequest("cdn/endpoints/" + cdn.ID)
+        }
+    }
+    return err
+}
@@ -0,0 +1,100 @@
+/*! \file do_stack_diff.go
+    \brief Comparing two stacks, ie staging and prod, by their nodes, sizes, images, firewall rules and records
+ *  The stack's own name is swapped for {stack} so web-1 in staging lines up with web-1 in prod
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Something the two stacks don't agree on, empty when the stack doesn't have it at all
+ */
+type DO_stack_diff_t struct {
+    Field       string  `json:"field"`     //ie 'nodes', 'size s-2vcpu-4gb' or 'firewall inbound tcp 22 from 0.0.0.0/0'
+    A           string  `json:"a"`
+    B           string  `json:"b"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Everything we compare about the stack, with the stack's name taken out of it
+ *  Counts are kept as the value, rules and records are just there or not
+ */
+func (do DO_c) stackState (stack, domain string) (map[string]string, error) {
+    generic := func (val string) string {
+        val = strings.ReplaceAll(val, do_stack_tag + tagValue(stack), do_stack_tag + "{stack}")
+        return strings.ReplaceAll(val, stack, "{stack}")
+    }
+
+    nodes, err := do.ListNodes("", stack)
+    if err != nil { return nil, err }
+
+    counts := make(map[string]int)
+    names := make(map[string]string)    //ip to the node's generic name, for the records
+    for _, n := range(nodes) {
+        counts["nodes"]++
+        counts["size " + n.Size]++
+        counts["image " + n.Template]++
+        counts["region " + n.Region]++
+        for _, ip := range([]string{n.IP, n.PrivateIP, n.IPv6}) {
+            if len(ip) > 0 { names[ip] = generic(n.Name) }
+        }
+    }
+
+    state := make(map[string]string)
+    for field, count := range(counts) { state[field] = fmt.Sprint(count) }
+
+    firewalls, err := do.ListFirewalls()
+    if err != nil { return nil, err }
+    for _, fw := range(firewalls) {
+        if fw.Name != firewallName(stack) { continue }
+        for key := range(ruleKeys(fw)) { state["firewall " + generic(key)] = "yes" }
+    }
+
+    if len(domain) > 0 {
+        records, err := do.listDomainRecords(domain)
+        if err != nil { return nil, err }
+        for _, r := range(records) {
+            if node, ok := names[r.Data]; ok { state[fmt.Sprintf("record %s %s -> %s", r.Type, generic(r.Name), node)] = "yes" }
+        }
+    }
+    return state, nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- DIFF FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Compares the two stacks, the records are only compared when the domain is set
+ *  Returns what's different, nothing when the stacks match
+ */
+func (do DO_c) DiffStacks (a, b, domain string) ([]DO_stack_diff_t, error) {
+    if len(a) == 0 || len(b) == 0 { return nil, fmt.Errorf("Two stacks are needed to compare") }
+    stateA, err := do.stackState(a, domain)
+    if err != nil { return nil, err }
+    stateB, err := do.stackState(b, domain)
+    if err != nil { return nil, err }
+
+    fields := make([]string, 0, len(stateA) + len(stateB))
+    for f := range(stateA) { fields = append(fields, f) }
+    for f := range(stateB) {
+        if _, ok := stateA[f]; !ok { fields = append(fields, f) }
+    }
+    sort.Strings(fields)
+
+    diff := make([]DO_stack_diff_t, 0)
+    for _, f := range(fields) {
+        if stateA[f] != stateB[f] { diff = append(diff, DO_stack_diff_t{Field: f, A: stateA[f], B: stateB[f]}) }
+    }
+    return diff, nil
+}
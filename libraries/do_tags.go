@@ -0,0 +1,271 @@
+/*! \file do_tags.go
+    \brief Tags we put on the nodes we create, so we know which ones are ours and where they came from
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "path"
+    "encoding/json"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_managed_tag        = "hm:managed"  //every node we create gets this
+const do_stack_tag          = "hm:stack:"
+const do_created_tag        = "hm:created:"
+const do_template_tag       = "hm:template:"
+const do_owner_tag          = "hm:owner:"
+const do_note_tag           = "hm:note:"    //spaces are kept as underscores
+const do_tag_max            = 255
+
+var do_tag_invalid = regexp.MustCompile(`[^a-zA-Z0-9_\-:]`)  //digital ocean only allows these in tags, so no = signs
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A node for listing, with the harbormaster tags pulled out
+ */
+type DO_node_t struct {
+    ID          int         `json:"id"`
+    Name        string      `json:"name"`
+    Status      string      `json:"status"`
+    Region      string      `json:"region"`
+    Size        string      `json:"size"`
+    GPU         string      `json:"gpu,omitempty"`   //ie '1x nvidia_h100 80gib'
+    IP          string      `json:"ip"`
+    PrivateIP   string      `json:"private_ip,omitempty"`
+    IPv6        string      `json:"ipv6,omitempty"`
+    Tags        []string    `json:"tags"`
+    Managed     bool        `json:"managed"`
+    Stack       string      `json:"stack,omitempty"`
+    Created     string      `json:"created,omitempty"`   //from our tag, YYYYMMDD
+    Template    string      `json:"template,omitempty"`
+    Owner       string      `json:"owner,omitempty"`
+    Note        string      `json:"note,omitempty"`  //why the node exists
+    Expires     string      `json:"expires,omitempty"`   //from our tag, when -reap can remove it
+}
+
+/*! \brief A node that's missing some of the required tags
+ */
+type DO_tag_audit_t struct {
+    ID          int         `json:"id"`
+    Name        string      `json:"name"`
+    Missing     []string    `json:"missing"`
+}
+
+/*! \brief Tags to add and remove on the nodes with names matching the pattern, ie 'web-*'
+ */
+type DO_retag_t struct {
+    Match       string      `json:"match"`
+    Add         []string    `json:"add"`
+    Remove      []string    `json:"remove"`
+}
+
+/*! \brief One tag added or removed from a node
+ */
+type DO_tag_change_t struct {
+    Node        string  `json:"node"`
+    Action      string  `json:"action"`  //add or remove
+    Tag         string  `json:"tag"`
+}
+
+type do_tag_resources_t struct {
+    Resources   []do_tag_resource_t `json:"resources"`
+}
+
+type do_tag_resource_t struct {
+    ID          string  `json:"resource_id"`
+    Type        string  `json:"resource_type"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Cleans up a value so it can be used in a tag
+ */
+func tagValue (val string) string {
+    return do_tag_invalid.ReplaceAllString(strings.ToLower(val), "_")
+}
+
+/*! \brief The tags from a comma separated list, ie from more than one -tag flag
+ */
+func splitTags (list string) []string {
+    tags := make([]string, 0)
+    for _, t := range(strings.Split(list, ",")) {
+        if t = strings.TrimSpace(t); len(t) > 0 { tags = append(tags, t) }
+    }
+    return tags
+}
+
+/*! \brief Tag for the owner or note, cut down to what digital ocean allows.  Empty when there's no value
+ */
+func infoTag (prefix, val string) string {
+    if len(val) == 0 { return "" }
+    tag := prefix + tagValue(strings.TrimSpace(val))
+    if len(tag) > do_tag_max { tag = tag[:do_tag_max] }
+    return tag
+}
+
+/*! \brief The tags for a node we're creating from the image
+ */
+func (do DO_c) managedTags (image string) []string {
+    tags := []string{do_managed_tag, do_created_tag + time.Now().UTC().Format("20060102"), do_template_tag + tagValue(image)}
+    if len(do.Stack) > 0 { tags = append(tags, do_stack_tag + tagValue(do.Stack)) }
+    if !do.Expires.IsZero() { tags = append(tags, do_expires_tag + do.Expires.UTC().Format(do_expires_format)) }
+    for _, t := range([]string{infoTag(do_owner_tag, do.Owner), infoTag(do_note_tag, do.Note)}) {
+        if len(t) > 0 { tags = append(tags, t) }
+    }
+    return tags
+}
+
+/*! \brief Makes sure a new node has the owner and note the config requires
+ */
+func (do DO_c) checkInfo () error {
+    if do.Config.RequireOwner && len(strings.TrimSpace(do.Owner)) == 0 { return fmt.Errorf("The config requires an owner for new nodes.  use the -owner option") }
+    if do.Config.RequireNote && len(strings.TrimSpace(do.Note)) == 0 { return fmt.Errorf("The config requires a note on why new nodes exist.  use the -note option") }
+    return nil
+}
+
+/*! \brief Adds or removes the tag on all the nodes at once
+ */
+func (do DO_c) tagResources (method, tag string, ids []int) error {
+    if method == "POST" {   //the tag has to exist before anything can have it
+        jStr, _ := json.Marshal(map[string]string{"name": tag})
+        if _, err := do.send("POST", "tags", jStr); err != nil { return err }
+    }
+
+    list := do_tag_resources_t{}
+    for _, id := range(ids) {
+        list.Resources = append(list.Resources, do_tag_resource_t{ID: fmt.Sprint(id), Type: "droplet"})
+    }
+    jStr, _ := json.Marshal(list)
+    _, err := do.send(method, fmt.Sprintf("tags/%s/resources", tag), jStr)
+    return err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- TAG FUNCTIONS -----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists the nodes, only the ones matching the tag when it's set, and only the ones in the stack when that's set
+ */
+func (do DO_c) ListNodes (tag, stack string) ([]DO_node_t, error) {
+    if len(stack) > 0 {
+        if len(tag) > 0 { tag += " AND " }
+        tag += "stack=" + tagValue(stack)
+    }
+
+    nodes := make([]DO_node_t, 0)
+    err := do.EachNode(tag, func (node DO_node_t) bool {
+        nodes = append(nodes, node)
+        return true
+    })
+    if err != nil { return nil, err }
+    return nodes, nil
+}
+
+/*! \brief Finds the nodes missing any of the required tags from the config, only looking at the ones with the tag when it's set
+ */
+func (do DO_c) AuditTags (tag string) ([]DO_tag_audit_t, error) {
+    if len(do.Config.RequiredTags) == 0 { return nil, fmt.Errorf("No required_tags in the digital_ocean section of the config") }
+    for _, req := range(do.Config.RequiredTags) {
+        if _, err := path.Match(req, ""); err != nil { return nil, fmt.Errorf("Invalid required tag '%s'", req) }
+    }
+
+    nodes, err := do.ListNodes(tag, "")
+    if err != nil { return nil, err }
+
+    audit := make([]DO_tag_audit_t, 0)
+    for _, n := range(nodes) {
+        missing := make([]string, 0)
+        for _, req := range(do.Config.RequiredTags) {
+            found := false
+            for _, t := range(n.Tags) {
+                if ok, _ := path.Match(req, t); ok { found = true }
+            }
+            if !found { missing = append(missing, req) }
+        }
+        if len(missing) > 0 { audit = append(audit, DO_tag_audit_t{ID: n.ID, Name: n.Name, Missing: missing}) }
+    }
+    return audit, nil
+}
+
+/*! \brief Adds and removes tags on the nodes matching each rule, one request per tag however many nodes it's on
+ *  Only the changes that are needed are made, and with dryRun they're just returned
+ */
+func (do DO_c) Retag (rules []DO_retag_t, dryRun bool) ([]DO_tag_change_t, error) {
+    nodes, err := do.ListNodes("", "")
+    if err != nil { return nil, err }
+
+    changes := make([]DO_tag_change_t, 0)
+    adds, removes := make(map[string][]int), make(map[string][]int)
+    for _, rule := range(rules) {
+        if _, err := path.Match(rule.Match, ""); err != nil { return nil, fmt.Errorf("Invalid node pattern '%s'", rule.Match) }
+        for _, t := range(append(append([]string{}, rule.Add...), rule.Remove...)) {
+            if len(t) == 0 || do_tag_invalid.MatchString(t) { return nil, fmt.Errorf("Invalid tag '%s', tags can only have letters, numbers, colons, dashes and underscores", t) }
+        }
+
+        for i := range(nodes) {
+            n := &nodes[i]  //keep its tags up to date, so a later rule doesn't repeat the change
+            if ok, _ := path.Match(rule.Match, n.Name); !ok { continue }
+            for _, t := range(rule.Add) {
+                if !hasString(n.Tags, t) {
+                    n.Tags = append(n.Tags, t)
+                    adds[t] = append(adds[t], n.ID)
+                    changes = append(changes, DO_tag_change_t{Node: n.Name, Action: "add", Tag: t})
+                }
+            }
+            for _, t := range(rule.Remove) {
+                if hasString(n.Tags, t) {
+                    n.Tags = removeString(n.Tags, t)
+                    removes[t] = append(removes[t], n.ID)
+                    changes = append(changes, DO_tag_change_t{Node: n.Name, Action: "remove", Tag: t})
+                }
+            }
+        }
+    }
+    if dryRun { return changes, nil }
+
+    for _, todo := range([]struct { method string; tags map[string][]int }{{"POST", adds}, {"DELETE", removes}}) {
+        tags := make([]string, 0, len(todo.tags))
+        for t := range(todo.tags) { tags = append(tags, t) }
+        sort.Strings(tags)
+
+        for _, t := range(tags) {
+            if do.Verbose { fmt.Printf("%s tag %s on %d nodes\n", todo.method, t, len(todo.tags[t])) }
+            if err = do.tagResources(todo.method, t, todo.tags[t]); err != nil { return changes, err }
+        }
+    }
+    return changes, nil
+}
+
+/*! \brief Sets the owner and note on the node, replacing what it had.  Empty ones are left as they are
+ */
+func (do DO_c) SetNodeInfo (name, owner, note string) ([]DO_tag_change_t, error) {
+    droplet, err := do.getDropletFromName(name)
+    if err != nil { return nil, err }
+    if droplet == nil { return nil, fmt.Errorf("Node '%s' does not exist", name) }
+
+    changes := make([]DO_tag_change_t, 0)
+    for _, info := range([]struct { prefix, tag string }{{do_owner_tag, infoTag(do_owner_tag, owner)}, {do_note_tag, infoTag(do_note_tag, note)}}) {
+        if len(info.tag) == 0 || hasString(droplet.Tags, info.tag) { continue }
+        for _, t := range(droplet.Tags) {
+            if !strings.HasPrefix(t, info.prefix) { continue }
+            if err = do.tagResources("DELETE", t, []int{droplet.ID}); err != nil { return changes, err }
+            changes = append(changes, DO_tag_change_t{Node: droplet.Name, Action: "remove", Tag: t})
+        }
+        if err = do.tagResources("POST", info.tag, []int{droplet.ID}); err != nil { return changes, err }
+        changes = append(changes, DO_tag_change_t{Node: droplet.Name, Action: "add", Tag: info.tag})
+    }
+    return changes, nil
+}
@@ -0,0 +1,196 @@
+/*! \file do_uptime.go
+    \brief Digital ocean uptime checks, along with the alert policies from the config
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type do_slack_t struct {
+    Channel     string  `json:"channel"`
+    URL         string  `json:"url"`
+}
+
+/*! \brief Alert policy from the config, it's added to every check we create
+ *  Type is one of latency, down, down_global or ssl_expiry, period is how long it has to be true, ie '2m'
+ */
+type DO_uptime_alert_t struct {
+    Name        string  `json:"name"`
+    Type        string  `json:"type"`
+    Threshold   int     `json:"threshold,omitempty"`
+    Comparison  string  `json:"comparison,omitempty"`
+    Period      string  `json:"period"`
+    Emails      []string        `json:"emails"`
+    Slack       []do_slack_t    `json:"slack"`
+}
+
+type do_uptime_alert_body_t struct {
+    Name        string  `json:"name"`
+    Type        string  `json:"type"`
+    Threshold   int     `json:"threshold,omitempty"`
+    Comparison  string  `json:"comparison,omitempty"`
+    Period      string  `json:"period"`
+    Notifications struct {
+        Email   []string        `json:"email"`     //the api wants these, even when they're empty
+        Slack   []do_slack_t    `json:"slack"`
+    }   `json:"notifications"`
+}
+
+/*! \brief Uptime settings from the config
+ *  With Auto set, every sub domain we create gets a check, AutoType is ping, http or https
+ */
+type DO_uptime_config_t struct {
+    Auto        bool        `json:"auto"`
+    AutoType    string      `json:"auto_type"`
+    Regions     []string    `json:"regions"`
+    Alerts      []DO_uptime_alert_t     `json:"alerts"`
+}
+
+type DO_uptime_check_t struct {
+    ID          string      `json:"id,omitempty"`
+    Name        string      `json:"name"`
+    Type        string      `json:"type"`
+    Target      string      `json:"target"`
+    Regions     []string    `json:"regions"`
+    Enabled     bool        `json:"enabled"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Gets the uptime check by its name, nil if it doesn't exist
+ */
+func (do DO_c) getUptimeCheck (name string) (*DO_uptime_check_t, error) {
+    checks, err := do.ListUptimeChecks()
+    if err == nil {
+        for _, check := range(checks) {
+            if strings.EqualFold(check.Name, name) { return &check, nil }
+        }
+    }
+    return nil, err
+}
+
+/*! \brief Adds any of the alert policies from the config that the check doesn't have yet
+ */
+func (do DO_c) assignUptimeAlerts (check *DO_uptime_check_t) error {
+    resp, err := do.send("GET", "uptime/checks/" + check.ID + "/alerts", nil)
+    if err != nil { return err }
+
+    var list struct {
+        Alerts  []struct {
+            Name    string  `json:"name"`
+        }   `json:"alerts"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return err }
+
+    for _, alert := range(do.Config.Uptime.Alerts) {
+        exists := false
+        for _, existing := range(list.Alerts) {
+            if strings.EqualFold(existing.Name, alert.Name) { exists = true }
+        }
+        if exists { continue }
+
+        if do.Verbose { fmt.Println("Adding uptime alert " + alert.Name) }
+        body := do_uptime_alert_body_t{Name: alert.Name, Type: alert.Type, Threshold: alert.Threshold, Comparison: alert.Comparison, Period: alert.Period}
+        body.Notifications.Email, body.Notifications.Slack = append([]string{}, alert.Emails...), append([]do_slack_t{}, alert.Slack...)
+
+        jStr, _ := json.Marshal(body)
+        if _, err = do.send("POST", "uptime/checks/" + check.ID + "/alerts", jStr); err != nil { return err }
+    }
+    return nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- UPTIME FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Lists all the uptime checks
+ */
+func (do DO_c) ListUptimeChecks () ([]DO_uptime_check_t, error) {
+    checks := make([]DO_uptime_check_t, 0)
+    for page := 1; page > 0; page++ {
+        resp, err := do.send("GET", fmt.Sprintf("uptime/checks?page=%d&per_page=100", page), nil)
+        if err != nil { return nil, err }
+
+        var list struct {
+            Checks  []DO_uptime_check_t     `json:"checks"`
+            Links   struct {
+                Pages   struct {
+                    Next    string  `json:"next"`
+                }   `json:"pages"`
+            }   `json:"links"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+
+        checks = append(checks, list.Checks...)
+        if len(list.Links.Pages.Next) == 0 { break }
+    }
+    return checks, nil
+}
+
+/*! \brief Creates the uptime check, or updates the existing one with the same name, and adds the alerts from the config
+ *  checkType is ping, http or https.  Ping targets a host or ip, the others a url
+ */
+func (do DO_c) AssignUptimeCheck (name, checkType, target string) (*DO_uptime_check_t, error) {
+    check := DO_uptime_check_t{Name: name, Type: checkType, Target: target, Regions: do.Config.Uptime.Regions, Enabled: true}
+    if len(check.Regions) == 0 { check.Regions = []string{"us_east", "us_west", "eu_west", "se_asia"} }
+
+    existing, err := do.getUptimeCheck(name)
+    if err != nil { return nil, err }
+
+    jStr, _ := json.Marshal(check)
+    var resp []byte
+    if existing == nil {
+        if do.Verbose { fmt.Println("Uptime check does not exist, creating...") }
+        resp, err = do.send("POST", "uptime/checks", jStr)
+    } else {
+        if do.Verbose { fmt.Println("Uptime check already exists, updating") }
+        resp, err = do.send("PUT", "uptime/checks/" + existing.ID, jStr)
+    }
+    if err != nil { return nil, err }
+
+    var result struct {
+        Check   DO_uptime_check_t   `json:"check"`
+    }
+    if err = json.Unmarshal(resp, &result); err != nil { return nil, err }
+
+    err = do.assignUptimeAlerts(&result.Check)
+    return &result.Check, err
+}
+
+/*! \brief Creates the check for a host we just gave a dns name, when the config asks for it
+ */
+func (do DO_c) AutoUptimeCheck (host string) error {
+    if !do.Config.Uptime.Auto { return nil }
+
+    checkType, target := strings.ToLower(do.Config.Uptime.AutoType), host
+    if len(checkType) == 0 { checkType = "ping" }
+    if checkType != "ping" { target = checkType + "://" + host }
+
+    if do.Verbose { fmt.Println("Setting uptime check for " + host) }
+    _, err := do.AssignUptimeCheck(host, checkType, target)
+    return err
+}
+
+/*! \brief Deletes the uptime check, and its alerts
+ */
+func (do DO_c) DeleteUptimeCheck (name string) error {
+    check, err := do.getUptimeCheck(name)
+    if err == nil {
+        if check == nil {
+            if do.Verbose { fmt.Println("Uptime check does not exist, nothing to do...") }
+        } else {
+            err = do.deleteRequest("uptime/checks/" + check.ID)
+        }
+    }
+    return err
+}
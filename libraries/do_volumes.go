@@ -0,0 +1,199 @@
+/*! \file do_volumes.go
+    \brief Block storage volumes, snapshotting them on a schedule and rebuilding a node's data from the newest snapshot
+ *  Snapshots are named after their volume with the time on the end, ie 'pgdata-202610151200', so -match 'pgdata-*' finds them
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "path"
+    "encoding/json"
+    "sort"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_attach_wait        = 5 * time.Minute
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type do_volume_t struct {
+    ID          string      `json:"id"`
+    Name        string      `json:"name"`
+    SizeGB      int         `json:"size_gigabytes"`
+    DropletIDs  []int       `json:"droplet_ids"`
+    Tags        []string    `json:"tags"`
+    Region      struct {
+        Slug    string  `json:"slug"`
+    }   `json:"region"`
+}
+
+type DO_volume_snapshot_t struct {
+    ID          string      `json:"id"`
+    Name        string      `json:"name"`
+    VolumeID    string      `json:"resource_id"`
+    Regions     []string    `json:"regions"`
+    Created     time.Time   `json:"created_at"`
+    MinDiskSize int         `json:"min_disk_size"`   //gb the volume made from it needs
+    SizeGB      float64     `json:"size_gigabytes"`
+}
+
+/*! \brief Volume made from a snapshot by RestoreVolume
+ */
+type DO_volume_t struct {
+    ID          string      `json:"id"`
+    Name        string      `json:"name"`
+    Region      string      `json:"region"`
+    SizeGB      int         `json:"size_gigabytes"`
+    Snapshot    string      `json:"snapshot"`
+    Node        string      `json:"node,omitempty"`  //what it was attached to
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The volume with the name in the region, nil when there isn't one
+ */
+func (do DO_c) getVolume (name, region string) (*do_volume_t, error) {
+    resp, err := do.send("GET", fmt.Sprintf("volumes?name=%s&region=%s", name, region), nil)
+    if err != nil { return nil, err }
+
+    var list struct {
+        Volumes     []do_volume_t   `json:"volumes"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { return nil, err }
+    if len(list.Volumes) == 0 { return nil, nil }
+    return &list.Volumes[0], nil
+}
+
+/*! \brief Volume snapshots with names matching the pattern, newest first
+ */
+func (do DO_c) matchingVolumeSnapshots (pattern string) ([]DO_volume_snapshot_t, error) {
+    if _, err := path.Match(pattern, ""); err != nil { return nil, fmt.Errorf("Invalid snapshot pattern '%s'", pattern) }
+
+    matches := make([]DO_volume_snapshot_t, 0)
+    var err error
+    pageErr := do.EachPage("snapshots?resource_type=volume", "snapshots", func (item json.RawMessage) bool {
+        var snap DO_volume_snapshot_t
+        if err = json.Unmarshal(item, &snap); err != nil { return false }
+        if ok, _ := path.Match(pattern, snap.Name); ok { matches = append(matches, snap) }
+        return true
+    })
+    if pageErr != nil { return nil, pageErr }
+    if err != nil { return nil, err }
+    sort.Slice(matches, func (i, j int) bool { return matches[i].Created.After(matches[j].Created) })
+    return matches, nil
+}
+
+/*! \brief Attaches the volume to the node and waits for it to finish
+ */
+func (do DO_c) attachVolume (volumeID, region string, dropletID int) error {
+    jStr, _ := json.Marshal(map[string]interface{}{"type": "attach", "droplet_id": dropletID, "region": region})
+    resp, err := do.send("POST", "volumes/" + volumeID + "/actions", jStr)
+    if err != nil { return err }
+
+    var action struct {
+        Action  DO_action_t     `json:"action"`
+    }
+    if err = json.Unmarshal(resp, &action); err != nil { return err }
+    _, err = do.WaitForAction(action.Action.ID, do_attach_wait)
+    return err
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- VOLUME FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Takes a snapshot of the volume, named after it with the time on the end
+ */
+func (do DO_c) SnapshotVolume (name, region string) (*DO_volume_snapshot_t, error) {
+    volume, err := do.getVolume(name, region)
+    if err != nil { return nil, err }
+    if volume == nil { return nil, fmt.Errorf("Volume '%s' does not exist in %s", name, region) }
+
+    snapName := fmt.Sprintf("%s-%s", volume.Name, time.Now().UTC().Format("200601021504"))
+    fmt.Printf("Snapshotting volume %s as %s\n", volume.Name, snapName)
+    jStr, _ := json.Marshal(map[string]interface{}{"name": snapName, "tags": []string{do_managed_tag}})
+    resp, err := do.send("POST", "volumes/" + volume.ID + "/snapshots", jStr)
+    if err != nil { return nil, err }
+
+    var snap struct {
+        Snapshot    DO_volume_snapshot_t    `json:"snapshot"`
+    }
+    err = json.Unmarshal(resp, &snap)
+    return &snap.Snapshot, err
+}
+
+/*! \brief Deletes the volume snapshots matching the pattern that are older than the number of days, always keeping the newest ones
+ *  The same retention as PruneImages, returns what was removed, or with dryRun what would have been
+ */
+func (do DO_c) PruneVolumeSnapshots (pattern string, days, keep int, dryRun bool) ([]DO_volume_snapshot_t, error) {
+    snaps, err := do.matchingVolumeSnapshots(pattern)
+    if err != nil { return nil, err }
+
+    cutoff := time.Now().AddDate(0, 0, -days)
+    pruned := make([]DO_volume_snapshot_t, 0)
+    for i, snap := range(snaps) {
+        if i < keep || snap.Created.After(cutoff) { continue }
+
+        if !dryRun {
+            if do.Verbose { fmt.Printf("Deleting volume snapshot %s from %s\n", snap.Name, snap.Created.Format("2006-01-02")) }
+            if err = do.deleteRequest("snapshots/" + snap.ID); err != nil { return pruned, err }
+        }
+        pruned = append(pruned, snap)
+    }
+    return pruned, nil
+}
+
+/*! \brief Makes a new volume from the newest snapshot matching the pattern in the region, and attaches it to the node when it's set
+ *  The volume is named after the snapshot, so it's clear which data it has
+ */
+func (do DO_c) RestoreVolume (pattern, region, node string) (*DO_volume_t, error) {
+    var droplet *do_droplet_t
+    if len(node) > 0 {
+        var err error
+        if droplet, err = do.getDropletFromName(node); err != nil { return nil, err }
+        if droplet == nil { return nil, fmt.Errorf("Node '%s' does not exist", node) }
+        region = droplet.Region.Slug    //volumes only attach in their own region
+    }
+
+    snaps, err := do.matchingVolumeSnapshots(pattern)
+    if err != nil { return nil, err }
+    var snap *DO_volume_snapshot_t
+    for i := range(snaps) {
+        if hasString(snaps[i].Regions, region) { snap = &snaps[i]; break }
+    }
+    if snap == nil { return nil, fmt.Errorf("No volume snapshot matching '%s' in %s", pattern, region) }
+
+    volume := &DO_volume_t{Name: snap.Name, Region: region, SizeGB: snap.MinDiskSize, Snapshot: snap.Name, Node: node}
+    existing, err := do.getVolume(snap.Name, region)
+    if err != nil { return nil, err }
+    if existing != nil {
+        if do.Verbose { fmt.Printf("Volume %s already exists\n", existing.Name) }
+        volume.ID = existing.ID
+        if droplet != nil && hasInt(existing.DropletIDs, droplet.ID) { return volume, nil }
+    } else {
+        fmt.Printf("Creating volume %s from the snapshot from %s\n", snap.Name, snap.Created.Format("2006-01-02 15:04"))
+        jStr, _ := json.Marshal(map[string]interface{}{"name": snap.Name, "size_gigabytes": snap.MinDiskSize, "snapshot_id": snap.ID, "region": region,
+            "tags": []string{do_managed_tag}})
+        resp, err := do.send("POST", "volumes", jStr)
+        if err != nil { return nil, err }
+
+        var created struct {
+            Volume  do_volume_t     `json:"volume"`
+        }
+        if err = json.Unmarshal(resp, &created); err != nil { return nil, err }
+        volume.ID = created.Volume.ID
+    }
+
+    if droplet == nil { return volume, nil }
+    fmt.Printf("Attaching volume %s to %s\n", volume.Name, droplet.Name)
+    return volume, do.Progress.Step("attach volume " + volume.Name, func () error { return do.attachVolume(volume.ID, region, droplet.ID) })
+}
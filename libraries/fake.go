@@ -0,0 +1,1007 @@
+/*! \file fake.go
+    \brief A pretend digital ocean and cloud flare behind the http transport, for demos and tests without a cloud account
+ *  Nodes boot, actions take a while and ids look like the real ones.  The state is kept in a file so one run picks up where the last left off
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "os"
+    "bytes"
+    "io/ioutil"
+    "math/rand"
+    "net/http"
+    "net/url"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "encoding/json"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const Fake_domain       = "example.com"     //the domain both providers start out with
+const Fake_zone_id      = "f4ce0000000000000000000000000001"
+const Fake_account_id   = "f4ce00000000000000000000000000a1"
+
+const fake_state_file   = "fake_provider.json"
+const fake_droplet_limit    = 25
+
+var fake_regions = []string{"nyc1", "nyc3", "sfo3", "tor1", "ams3", "lon1", "fra1", "blr1", "sgp1", "syd1"}
+
+var fake_sizes = []do_size_t{
+    {Slug: "s-1vcpu-512mb-10gb", Memory: 512, VCPUs: 1, Disk: 10, PriceMonthly: 4},
+    {Slug: "s-1vcpu-1gb", Memory: 1024, VCPUs: 1, Disk: 25, PriceMonthly: 6},
+    {Slug: "s-1vcpu-2gb", Memory: 2048, VCPUs: 1, Disk: 50, PriceMonthly: 12},
+    {Slug: "s-2vcpu-2gb", Memory: 2048, VCPUs: 2, Disk: 60, PriceMonthly: 18},
+    {Slug: "s-2vcpu-4gb", Memory: 4096, VCPUs: 2, Disk: 80, PriceMonthly: 24},
+    {Slug: "s-4vcpu-8gb", Memory: 8192, VCPUs: 4, Disk: 160, PriceMonthly: 48},
+    {Slug: "s-8vcpu-16gb", Memory: 16384, VCPUs: 8, Disk: 320, PriceMonthly: 96},
+    {Slug: "c-2", Memory: 4096, VCPUs: 2, Disk: 25, PriceMonthly: 42},
+    {Slug: "c-4", Memory: 8192, VCPUs: 4, Disk: 50, PriceMonthly: 84},
+    {Slug: "1gb", Memory: 1024, VCPUs: 1, Disk: 25, PriceMonthly: 6},    //the older slugs -size still makes
+    {Slug: "2gb", Memory: 2048, VCPUs: 1, Disk: 50, PriceMonthly: 12},
+    {Slug: "4gb", Memory: 4096, VCPUs: 2, Disk: 80, PriceMonthly: 24},
+    {Slug: "8gb", Memory: 8192, VCPUs: 4, Disk: 160, PriceMonthly: 48},
+    {Slug: "16gb", Memory: 16384, VCPUs: 8, Disk: 320, PriceMonthly: 96},
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type fake_droplet_t struct {
+    ID          int         `json:"id"`
+    Name        string      `json:"name"`
+    Region      string      `json:"region"`
+    Size        string      `json:"size"`
+    Image       string      `json:"image"`
+    Tags        []string    `json:"tags"`
+    IP          string      `json:"ip"`
+    PrivateIP   string      `json:"private_ip"`
+    Status      string      `json:"status"`    //new until it's booted, then active or off
+    Locked      bool        `json:"locked"`
+    Created     time.Time   `json:"created"`
+    ActiveAt    time.Time   `json:"active_at"`
+}
+
+type fake_action_t struct {
+    DO_action_t
+    Size        string      `json:"size,omitempty"`  //for a resize
+    Done        time.Time   `json:"done"`
+}
+
+type fake_floating_ip_t struct {
+    IP          string      `json:"ip"`
+    Region      string      `json:"region"`
+    DropletID   int         `json:"droplet_id"`
+}
+
+/*! \brief A balancer is new until it has its ip address, like a node booting
+ */
+type fake_balancer_t struct {
+    DO_balancer_t
+    Region      string      `json:"region"`
+    HealthCheck *DO_health_check_t  `json:"health_check,omitempty"`
+    ActiveAt    time.Time   `json:"active_at"`
+}
+
+type fake_zone_t struct {
+    ID          string      `json:"id"`
+    Name        string      `json:"name"`
+    Records     []CF_record_t   `json:"records"`
+    Balancers   []*cf_balancer_t    `json:"load_balancers,omitempty"`
+}
+
+/*! \brief Everything the fake account has, it's what's saved between runs
+ */
+type fake_state_t struct {
+    NextID      int         `json:"next_id"`
+    Droplets    []*fake_droplet_t   `json:"droplets"`
+    Actions     []*fake_action_t    `json:"actions"`
+    FloatingIPs []*fake_floating_ip_t   `json:"floating_ips"`
+    Domains     map[string][]DO_record_t    `json:"domains"`
+    Zones       []*fake_zone_t      `json:"zones"`
+    Tags        []string    `json:"tags"`
+    Firewalls   []*DO_firewall_t    `json:"firewalls,omitempty"`
+    Balancers   []*fake_balancer_t  `json:"load_balancers,omitempty"`
+    Pools       []*CF_pool_t        `json:"pools,omitempty"`     //cloud flare load balancer pools, they're on the account
+}
+
+/*! \brief Answers the digital ocean and cloud flare api requests itself, anything else, ie health probes, goes on to the real transport
+ */
+type Fake_t struct {
+    File        string          //where the state is kept, empty keeps it in memory for the run
+    Boot        time.Duration   //how long a new node takes to be active
+    Action      time.Duration   //how long shutdowns, resizes and the like take
+    Latency     time.Duration   //requests take up to this long to answer
+    rand        *rand.Rand
+    lock        sync.Mutex
+    state       fake_state_t
+    next        http.RoundTripper
+}
+
+/*! \brief What a request gets back
+ */
+type fake_reply_t struct {
+    code        int
+    body        interface{}
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func fakeSize (slug string) *do_size_t {
+    for i := range(fake_sizes) {
+        if fake_sizes[i].Slug == slug { return &fake_sizes[i] }
+    }
+    return nil
+}
+
+func doError (code int, id, msg string) fake_reply_t {
+    return fake_reply_t{code, map[string]string{"id": id, "message": msg, "request_id": fakeRequestID()}}
+}
+
+/*! \brief Made up like the real ones, so errors and reports show where they'd be
+ */
+func fakeRequestID () string {
+    return fmt.Sprintf("%08x-fake-%04x", rand.Uint32(), rand.Intn(0x10000))
+}
+
+func doNotFoundReply () fake_reply_t {
+    return doError(http.StatusNotFound, "not_found", "The resource you were accessing could not be found.")
+}
+
+func cfReply (code int, result interface{}) fake_reply_t {
+    return fake_reply_t{code, map[string]interface{}{"success": true, "errors": []string{}, "messages": []string{}, "result": result}}
+}
+
+func cfError (code int, msg string) fake_reply_t {
+    return fake_reply_t{code, map[string]interface{}{"success": false, "errors": []map[string]interface{}{{"code": 1000 + code, "message": msg}}, "messages": []string{}, "result": nil}}
+}
+
+/*! \brief The page asked for out of the list, with the number of pages
+ */
+func fakePage (query url.Values, total, defaultPer int) (start, end, page, pages int) {
+    page, _ = strconv.Atoi(query.Get("page"))
+    per, _ := strconv.Atoi(query.Get("per_page"))
+    if page < 1 { page = 1 }
+    if per < 1 { per = defaultPer }
+    pages = (total + per - 1) / per
+    start, end = (page - 1) * per, page * per
+    if start > total { start = total }
+    if end > total { end = total }
+    return
+}
+
+/*! \brief A digital ocean list, with the next link when there's more
+ */
+func doList (req *http.Request, field string, total int, item func (i int) interface{}) fake_reply_t {
+    start, end, page, pages := fakePage(req.URL.Query(), total, 20)
+    items := make([]interface{}, 0, end - start)
+    for i := start; i < end; i++ { items = append(items, item(i)) }
+
+    links := map[string]interface{}{}
+    if page < pages {
+        next := *req.URL
+        q := next.Query()
+        q.Set("page", fmt.Sprint(page + 1))
+        next.RawQuery = q.Encode()
+        links["pages"] = map[string]string{"next": next.String()}
+    }
+    return fake_reply_t{http.StatusOK, map[string]interface{}{field: items, "links": links, "meta": map[string]int{"total": total}}}
+}
+
+func (f *Fake_t) nextID () int {
+    f.state.NextID++
+    return f.state.NextID
+}
+
+/*! \brief An address nothing else in the account has
+ */
+func (f *Fake_t) address (prefix string) string {
+    for {
+        ip := fmt.Sprintf("%s.%d.%d", prefix, f.rand.Intn(254) + 1, f.rand.Intn(254) + 1)
+        taken := false
+        for _, d := range(f.state.Droplets) { taken = taken || d.IP == ip || d.PrivateIP == ip }
+        for _, fip := range(f.state.FloatingIPs) { taken = taken || fip.IP == ip }
+        for _, b := range(f.state.Balancers) { taken = taken || b.IP == ip }
+        if !taken { return ip }
+    }
+}
+
+func (f *Fake_t) hexID () string {
+    b := make([]byte, 16)
+    f.rand.Read(b)
+    return fmt.Sprintf("%x", b)
+}
+
+func (f *Fake_t) droplet (id string) *fake_droplet_t {
+    n, _ := strconv.Atoi(id)
+    for _, d := range(f.state.Droplets) {
+        if d.ID == n { return d }
+    }
+    return nil
+}
+
+func (f *Fake_t) floatingIP (ip string) *fake_floating_ip_t {
+    for _, fip := range(f.state.FloatingIPs) {
+        if fip.IP == ip { return fip }
+    }
+    return nil
+}
+
+/*! \brief Ids like the ones firewalls and load balancers get
+ */
+func (f *Fake_t) uuid () string {
+    h := f.hexID()
+    return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func (f *Fake_t) zone (id string) *fake_zone_t {
+    for _, z := range(f.state.Zones) {
+        if z.ID == id { return z }
+    }
+    return nil
+}
+
+/*! \brief Catches the state up to now, nodes that have booted are active and actions that are done have happened
+ */
+func (f *Fake_t) settle (now time.Time) {
+    for _, d := range(f.state.Droplets) {
+        if d.Status == "new" && !now.Before(d.ActiveAt) { d.Status = "active" }
+    }
+    for _, b := range(f.state.Balancers) {
+        if b.Status == "new" && !now.Before(b.ActiveAt) { b.Status, b.IP = "active", f.address("134.209") }
+    }
+    for _, a := range(f.state.Actions) {
+        if a.Status != "in-progress" || now.Before(a.Done) { continue }
+        a.Status, a.CompletedAt = "completed", a.Done.UTC().Format(time.RFC3339)
+        d := f.droplet(fmt.Sprint(a.ResourceID))
+        if d == nil || a.ResourceType != "droplet" { continue }
+        switch a.Type {
+        case "shutdown", "power_off":   d.Status = "off"
+        case "power_on", "reboot", "power_cycle", "rebuild":   d.Status = "active"
+        case "resize":
+            d.Size, d.Locked = a.Size, false
+        }
+    }
+}
+
+/*! \brief The droplet the way digital ocean shows it
+ */
+func (f *Fake_t) dropletJSON (d *fake_droplet_t) do_droplet_t {
+    out := do_droplet_t{ID: d.ID, Name: d.Name, Status: d.Status, Locked: d.Locked, Tags: append([]string{}, d.Tags...), Created: d.Created.UTC().Format(time.RFC3339), SizeSlug: d.Size, VolumeIDs: []string{}}
+    if s := fakeSize(d.Size); s != nil { out.Memory = s.Memory }
+    out.Region.Slug = d.Region
+    out.Networks.V4 = []do_network_t{{IP: d.IP, Netmask: "255.255.240.0", Gateway: d.IP[:strings.LastIndex(d.IP, ".")] + ".1", Type: "public"},
+        {IP: d.PrivateIP, Netmask: "255.255.0.0", Gateway: "10.10.0.1", Type: "private"}}
+    out.Networks.V6 = []do_network_t{}
+    return out
+}
+
+func (f *Fake_t) newAction (kind string, resourceID int, resourceType, region string, took time.Duration) *fake_action_t {
+    now := time.Now()
+    a := &fake_action_t{Done: now.Add(took)}
+    a.ID, a.Status, a.Type, a.StartedAt = f.nextID(), "in-progress", kind, now.UTC().Format(time.RFC3339)
+    a.ResourceID, a.ResourceType, a.Region = resourceID, resourceType, region
+    f.state.Actions = append(f.state.Actions, a)
+    return a
+}
+
+func (f *Fake_t) tag (name string) {
+    if !hasString(f.state.Tags, name) { f.state.Tags = append(f.state.Tags, name) }
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- DIGITAL OCEAN ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func (f *Fake_t) digitalOcean (req *http.Request, path []string, body []byte) fake_reply_t {
+    method := req.Method
+    switch {
+    case path[0] == "account":
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"account": map[string]interface{}{"droplet_limit": fake_droplet_limit, "floating_ip_limit": 5, "status": "active", "email": "demo@" + Fake_domain}}}
+
+    case path[0] == "sizes":
+        sizes := make([]do_size_t, 0, len(fake_sizes))
+        for _, s := range(fake_sizes) {
+            s.Available, s.Regions = true, fake_regions
+            sizes = append(sizes, s)
+        }
+        return doList(req, "sizes", len(sizes), func (i int) interface{} { return sizes[i] })
+
+    case path[0] == "regions":
+        slugs := make([]string, 0, len(fake_sizes))
+        for _, s := range(fake_sizes) { slugs = append(slugs, s.Slug) }
+        return doList(req, "regions", len(fake_regions), func (i int) interface{} { return do_region_t{Slug: fake_regions[i], Available: true, Sizes: slugs} })
+
+    case path[0] == "images" && len(path) == 1:
+        return doList(req, "images", 0, nil)    //no snapshots of our own
+
+    case path[0] == "images":
+        img := DO_image_t{ID: 100000 + len(path[1]), Name: path[1], Type: "base", Distribution: "Ubuntu", Regions: fake_regions, Slug: path[1], Status: "available"}
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"image": img}}
+
+    case path[0] == "droplets":
+        return f.droplets(req, path, body)
+
+    case path[0] == "actions" && len(path) == 2:
+        for _, a := range(f.state.Actions) {
+            if fmt.Sprint(a.ID) == path[1] { return fake_reply_t{http.StatusOK, map[string]interface{}{"action": a.DO_action_t}} }
+        }
+        return doNotFoundReply()
+
+    case path[0] == "tags" && len(path) == 1 && method == "POST":
+        var tag struct {
+            Name    string  `json:"name"`
+        }
+        json.Unmarshal(body, &tag)
+        f.tag(tag.Name)
+        return fake_reply_t{http.StatusCreated, map[string]interface{}{"tag": map[string]string{"name": tag.Name}}}
+
+    case path[0] == "tags" && len(path) == 3 && path[2] == "resources":
+        var list do_tag_resources_t
+        json.Unmarshal(body, &list)
+        for _, r := range(list.Resources) {
+            d := f.droplet(r.ID)
+            if d == nil { continue }
+            kept := make([]string, 0, len(d.Tags))
+            for _, t := range(d.Tags) {
+                if t != path[1] { kept = append(kept, t) }
+            }
+            if method == "POST" { kept = append(kept, path[1]) }
+            d.Tags = kept
+        }
+        return fake_reply_t{http.StatusNoContent, nil}
+
+    case path[0] == "floating_ips":
+        return f.floatingIPs(req, path, body)
+
+    case path[0] == "domains":
+        return f.domains(req, path, body)
+
+    case path[0] == "firewalls":
+        return f.firewalls(req, path, body)
+
+    case path[0] == "load_balancers":
+        return f.balancers(req, path, body)
+    }
+    return doError(http.StatusNotImplemented, "not_simulated", fmt.Sprintf("The fake provider doesn't simulate %s /v2/%s", method, strings.Join(path, "/")))
+}
+
+func (f *Fake_t) droplets (req *http.Request, path []string, body []byte) fake_reply_t {
+    switch {
+    case len(path) == 1 && req.Method == "GET":
+        tag := req.URL.Query().Get("tag_name")
+        list := make([]*fake_droplet_t, 0, len(f.state.Droplets))
+        for _, d := range(f.state.Droplets) {
+            if len(tag) == 0 || hasString(d.Tags, tag) { list = append(list, d) }
+        }
+        return doList(req, "droplets", len(list), func (i int) interface{} { return f.dropletJSON(list[i]) })
+
+    case len(path) == 1 && req.Method == "POST":
+        var node struct {
+            Name    string  `json:"name"`
+            Region  string  `json:"region"`
+            Size    string  `json:"size"`
+            Image   json.RawMessage `json:"image"`
+            Tags    []string    `json:"tags"`
+        }
+        if err := json.Unmarshal(body, &node); err != nil || len(node.Name) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Name is required") }
+        if fakeSize(node.Size) == nil { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "You specified an invalid size for Droplet creation.") }
+        if !hasString(fake_regions, node.Region) { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "You specified an invalid region for Droplet creation.") }
+        if len(f.state.Droplets) >= fake_droplet_limit { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "creating this/these droplet(s) will exceed your droplet limit") }
+
+        now := time.Now()
+        d := &fake_droplet_t{ID: 300000000 + f.rand.Intn(99999999), Name: node.Name, Region: node.Region, Size: node.Size, Image: strings.Trim(string(node.Image), `"`),
+            Tags: append([]string{}, node.Tags...), IP: f.address("164.90"), PrivateIP: f.address("10.10"), Status: "new", Created: now, ActiveAt: now.Add(f.Boot)}
+        for _, t := range(d.Tags) { f.tag(t) }
+        f.state.Droplets = append(f.state.Droplets, d)
+        f.newAction("create", d.ID, "droplet", d.Region, f.Boot)
+        return fake_reply_t{http.StatusAccepted, map[string]interface{}{"droplet": f.dropletJSON(d)}}
+    }
+
+    d := f.droplet(path[1])
+    if d == nil { return doNotFoundReply() }
+
+    switch {
+    case len(path) == 2 && req.Method == "GET":
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"droplet": f.dropletJSON(d)}}
+
+    case len(path) == 2 && req.Method == "DELETE":
+        if d.Locked { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Droplet already has a pending event.") }
+        kept := make([]*fake_droplet_t, 0, len(f.state.Droplets))
+        for _, o := range(f.state.Droplets) {
+            if o != d { kept = append(kept, o) }
+        }
+        f.state.Droplets = kept
+        for _, fip := range(f.state.FloatingIPs) {
+            if fip.DropletID == d.ID { fip.DropletID = 0 }
+        }
+        return fake_reply_t{http.StatusNoContent, nil}
+
+    case len(path) == 3 && path[2] == "actions" && req.Method == "GET":
+        list := make([]DO_action_t, 0)
+        for _, a := range(f.state.Actions) {
+            if a.ResourceType == "droplet" && a.ResourceID == d.ID { list = append(list, a.DO_action_t) }
+        }
+        return doList(req, "actions", len(list), func (i int) interface{} { return list[i] })
+
+    case len(path) == 3 && path[2] == "actions":
+        var action do_t
+        json.Unmarshal(body, &action)
+        if d.Locked { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Droplet already has a pending event.") }
+        took := f.Action
+        switch action.Type {
+        case "shutdown", "power_off", "power_on", "reboot", "power_cycle", "rebuild", "snapshot", "enable_ipv6", "enable_backups", "disable_backups":
+        case "resize":
+            if fakeSize(action.Size) == nil { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "You specified an invalid size for Droplet resize.") }
+            if d.Status != "off" { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Droplet must be powered off to resize.") }
+            d.Locked, took = true, 3 * f.Action     //resizes are the slow ones
+        default:
+            return doError(http.StatusUnprocessableEntity, "unprocessable_entity", fmt.Sprintf("The fake provider doesn't simulate the %s action", action.Type))
+        }
+        a := f.newAction(action.Type, d.ID, "droplet", d.Region, took)
+        a.Size = action.Size
+        return fake_reply_t{http.StatusCreated, map[string]interface{}{"action": a.DO_action_t}}
+    }
+    return doError(http.StatusNotImplemented, "not_simulated", fmt.Sprintf("The fake provider doesn't simulate %s /v2/%s", req.Method, strings.Join(path, "/")))
+}
+
+func (f *Fake_t) floatingIPJSON (fip *fake_floating_ip_t) map[string]interface{} {
+    out := map[string]interface{}{"ip": fip.IP, "region": map[string]string{"slug": fip.Region}, "droplet": nil, "locked": false}
+    if d := f.droplet(fmt.Sprint(fip.DropletID)); d != nil { out["droplet"] = f.dropletJSON(d) }
+    return out
+}
+
+func (f *Fake_t) floatingIPs (req *http.Request, path []string, body []byte) fake_reply_t {
+    switch {
+    case len(path) == 1 && req.Method == "GET":
+        return doList(req, "floating_ips", len(f.state.FloatingIPs), func (i int) interface{} { return f.floatingIPJSON(f.state.FloatingIPs[i]) })
+
+    case len(path) == 1 && req.Method == "POST":
+        var ask struct {
+            DropletID   int     `json:"droplet_id"`
+            Region      string  `json:"region"`
+        }
+        json.Unmarshal(body, &ask)
+        fip := &fake_floating_ip_t{IP: f.address("45.55"), Region: ask.Region, DropletID: ask.DropletID}
+        if d := f.droplet(fmt.Sprint(ask.DropletID)); d != nil {
+            fip.Region = d.Region
+        } else if ask.DropletID > 0 {
+            return doNotFoundReply()
+        }
+        if len(fip.Region) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "A droplet or region is required") }
+        f.state.FloatingIPs = append(f.state.FloatingIPs, fip)
+        return fake_reply_t{http.StatusAccepted, map[string]interface{}{"floating_ip": f.floatingIPJSON(fip)}}
+    }
+
+    fip := f.floatingIP(path[1])
+    if fip == nil { return doNotFoundReply() }
+
+    switch {
+    case len(path) == 2 && req.Method == "GET":
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"floating_ip": f.floatingIPJSON(fip)}}
+
+    case len(path) == 2 && req.Method == "DELETE":
+        kept := make([]*fake_floating_ip_t, 0, len(f.state.FloatingIPs))
+        for _, o := range(f.state.FloatingIPs) {
+            if o != fip { kept = append(kept, o) }
+        }
+        f.state.FloatingIPs = kept
+        return fake_reply_t{http.StatusNoContent, nil}
+
+    case len(path) == 3 && path[2] == "actions" && req.Method == "POST":
+        var action do_t
+        json.Unmarshal(body, &action)
+        switch action.Type {
+        case "assign":
+            d := f.droplet(fmt.Sprint(action.ID))
+            if d == nil { return doNotFoundReply() }
+            if d.Region != fip.Region { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "The floating ip and droplet have to be in the same region") }
+            fip.DropletID = d.ID
+        case "unassign":
+            fip.DropletID = 0
+        default:
+            return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Unknown floating ip action " + action.Type)
+        }
+        a := f.newAction(action.Type + "_ip", 0, "floating_ip", fip.Region, 0)     //these are quick
+        return fake_reply_t{http.StatusCreated, map[string]interface{}{"action": a.DO_action_t}}
+    }
+    return doError(http.StatusNotImplemented, "not_simulated", fmt.Sprintf("The fake provider doesn't simulate %s /v2/%s", req.Method, strings.Join(path, "/")))
+}
+
+func (f *Fake_t) domains (req *http.Request, path []string, body []byte) fake_reply_t {
+    if len(path) == 1 && req.Method == "GET" {
+        names := make([]string, 0, len(f.state.Domains))
+        for name := range(f.state.Domains) { names = append(names, name) }
+        sort.Strings(names)
+        return doList(req, "domains", len(names), func (i int) interface{} { return map[string]interface{}{"name": names[i], "ttl": 1800} })
+    }
+    if len(path) == 1 && req.Method == "POST" {
+        var domain struct {
+            Name    string  `json:"name"`
+        }
+        json.Unmarshal(body, &domain)
+        name := strings.ToLower(domain.Name)
+        if _, ok := f.state.Domains[name]; ok || len(name) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Name already exists") }
+        f.state.Domains[name] = []DO_record_t{}
+        return fake_reply_t{http.StatusCreated, map[string]interface{}{"domain": map[string]interface{}{"name": name, "ttl": 1800}}}
+    }
+
+    name := strings.ToLower(path[1])
+    records, ok := f.state.Domains[name]
+    if !ok { return doNotFoundReply() }
+    if len(path) == 2 && req.Method == "GET" { return fake_reply_t{http.StatusOK, map[string]interface{}{"domain": map[string]interface{}{"name": name, "ttl": 1800}}} }
+    if len(path) < 3 || path[2] != "records" { return doError(http.StatusNotImplemented, "not_simulated", fmt.Sprintf("The fake provider doesn't simulate %s /v2/%s", req.Method, strings.Join(path, "/"))) }
+
+    if len(path) == 3 {
+        switch req.Method {
+        case "GET":
+            q := req.URL.Query()
+            list := make([]DO_record_t, 0, len(records))
+            for _, r := range(records) {
+                if (len(q.Get("type")) == 0 || r.Type == q.Get("type")) && (len(q.Get("name")) == 0 || r.Name == q.Get("name") || r.Name + "." + name == q.Get("name")) { list = append(list, r) }
+            }
+            return doList(req, "domain_records", len(list), func (i int) interface{} { return list[i] })
+        case "POST":
+            var r DO_record_t
+            if err := json.Unmarshal(body, &r); err != nil || len(r.Type) == 0 || len(r.Name) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Type and name are required") }
+            if r.TTL == 0 { r.TTL = 1800 }
+            r.ID, r.Type, r.Name = f.nextID(), strings.ToUpper(r.Type), strings.ToLower(r.Name)
+            f.state.Domains[name] = append(records, r)
+            return fake_reply_t{http.StatusCreated, map[string]interface{}{"domain_record": r}}
+        }
+    }
+
+    for i := range(records) {
+        if fmt.Sprint(records[i].ID) != path[3] { continue }
+        switch req.Method {
+        case "GET":
+            return fake_reply_t{http.StatusOK, map[string]interface{}{"domain_record": records[i]}}
+        case "PUT", "PATCH":
+            var r DO_record_t
+            json.Unmarshal(body, &r)
+            if len(r.Type) > 0 { records[i].Type = strings.ToUpper(r.Type) }
+            if len(r.Name) > 0 { records[i].Name = strings.ToLower(r.Name) }
+            if len(r.Data) > 0 { records[i].Data = r.Data }
+            if r.TTL > 0 { records[i].TTL = r.TTL }
+            return fake_reply_t{http.StatusOK, map[string]interface{}{"domain_record": records[i]}}
+        case "DELETE":
+            f.state.Domains[name] = append(records[:i:i], records[i+1:]...)
+            return fake_reply_t{http.StatusNoContent, nil}
+        }
+    }
+    return doNotFoundReply()
+}
+
+/*! \brief Adds the rules to the firewall, or takes them out, matching them the way ApplyFirewall compares them
+ */
+func fakeFirewallRules (fw *DO_firewall_t, body []byte, add bool) {
+    var change struct {
+        Inbound     []DO_fw_rule_t  `json:"inbound_rules"`
+        Outbound    []DO_fw_rule_t  `json:"outbound_rules"`
+    }
+    json.Unmarshal(body, &change)
+    apply := func (rules, changes []DO_fw_rule_t, direction string) []DO_fw_rule_t {
+        for _, c := range(changes) {
+            kept := make([]DO_fw_rule_t, 0, len(rules) + 1)
+            for _, r := range(rules) {
+                if r.key(direction) != c.key(direction) { kept = append(kept, r) }
+            }
+            if add { kept = append(kept, c) }
+            rules = kept
+        }
+        return rules
+    }
+    fw.Inbound, fw.Outbound = apply(fw.Inbound, change.Inbound, "inbound"), apply(fw.Outbound, change.Outbound, "outbound")
+}
+
+func (f *Fake_t) firewalls (req *http.Request, path []string, body []byte) fake_reply_t {
+    if len(path) == 1 {
+        switch req.Method {
+        case "GET":
+            return doList(req, "firewalls", len(f.state.Firewalls), func (i int) interface{} { return f.state.Firewalls[i] })
+        case "POST":
+            var fw DO_firewall_t
+            if err := json.Unmarshal(body, &fw); err != nil || len(fw.Name) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Name is required") }
+            for _, o := range(f.state.Firewalls) {
+                if o.Name == fw.Name { return doError(http.StatusConflict, "conflict", "A firewall with this name already exists") }
+            }
+            fw.ID, fw.Status = f.uuid(), "succeeded"
+            for _, t := range(fw.Tags) { f.tag(t) }
+            f.state.Firewalls = append(f.state.Firewalls, &fw)
+            return fake_reply_t{http.StatusAccepted, map[string]interface{}{"firewall": fw}}
+        }
+    }
+
+    var fw *DO_firewall_t
+    for _, o := range(f.state.Firewalls) {
+        if o.ID == path[1] { fw = o }
+    }
+    if fw == nil { return doNotFoundReply() }
+
+    switch {
+    case len(path) == 2 && req.Method == "GET":
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"firewall": fw}}
+
+    case len(path) == 2 && req.Method == "PUT":
+        var wanted DO_firewall_t
+        if err := json.Unmarshal(body, &wanted); err != nil || len(wanted.Name) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Name is required") }
+        wanted.ID, wanted.Status = fw.ID, fw.Status
+        for _, t := range(wanted.Tags) { f.tag(t) }
+        *fw = wanted
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"firewall": fw}}
+
+    case len(path) == 2 && req.Method == "DELETE":
+        kept := make([]*DO_firewall_t, 0, len(f.state.Firewalls))
+        for _, o := range(f.state.Firewalls) {
+            if o != fw { kept = append(kept, o) }
+        }
+        f.state.Firewalls = kept
+        return fake_reply_t{http.StatusNoContent, nil}
+
+    case len(path) == 3 && path[2] == "rules" && (req.Method == "POST" || req.Method == "DELETE"):
+        fakeFirewallRules(fw, body, req.Method == "POST")
+        return fake_reply_t{http.StatusNoContent, nil}
+    }
+    return doError(http.StatusNotImplemented, "not_simulated", fmt.Sprintf("The fake provider doesn't simulate %s /v2/%s", req.Method, strings.Join(path, "/")))
+}
+
+func (f *Fake_t) balancers (req *http.Request, path []string, body []byte) fake_reply_t {
+    var ask do_balancer_body_t
+    if req.Method == "POST" || req.Method == "PUT" {
+        if err := json.Unmarshal(body, &ask); err != nil || len(ask.Name) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "Name is required") }
+        if len(ask.ForwardingRules) == 0 { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "At least one forwarding rule is required") }
+        if !hasString(fake_regions, ask.Region) { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "You specified an invalid region for the load balancer.") }
+    }
+
+    if len(path) == 1 {
+        switch req.Method {
+        case "GET":
+            return doList(req, "load_balancers", len(f.state.Balancers), func (i int) interface{} { return f.state.Balancers[i].DO_balancer_t })
+        case "POST":
+            b := &fake_balancer_t{Region: ask.Region, HealthCheck: ask.HealthCheck, ActiveAt: time.Now().Add(f.Action)}
+            b.ID, b.Name, b.Status, b.Tag, b.DropletIDs, b.ForwardingRules = f.uuid(), ask.Name, "new", ask.Tag, []int{}, ask.ForwardingRules
+            if len(b.Tag) > 0 { f.tag(b.Tag) }
+            f.state.Balancers = append(f.state.Balancers, b)
+            return fake_reply_t{http.StatusAccepted, map[string]interface{}{"load_balancer": b.DO_balancer_t}}
+        }
+    }
+
+    var b *fake_balancer_t
+    for _, o := range(f.state.Balancers) {
+        if o.ID == path[1] { b = o }
+    }
+    if b == nil { return doNotFoundReply() }
+
+    switch {
+    case len(path) == 2 && req.Method == "GET":
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"load_balancer": b.DO_balancer_t}}
+
+    case len(path) == 2 && req.Method == "PUT":
+        if ask.Region != b.Region { return doError(http.StatusUnprocessableEntity, "unprocessable_entity", "A load balancer's region can't be changed") }
+        b.Name, b.Tag, b.ForwardingRules, b.HealthCheck = ask.Name, ask.Tag, ask.ForwardingRules, ask.HealthCheck
+        if len(b.Tag) > 0 { f.tag(b.Tag) }
+        return fake_reply_t{http.StatusOK, map[string]interface{}{"load_balancer": b.DO_balancer_t}}
+
+    case len(path) == 2 && req.Method == "DELETE":
+        kept := make([]*fake_balancer_t, 0, len(f.state.Balancers))
+        for _, o := range(f.state.Balancers) {
+            if o != b { kept = append(kept, o) }
+        }
+        f.state.Balancers = kept
+        return fake_reply_t{http.StatusNoContent, nil}
+    }
+    return doError(http.StatusNotImplemented, "not_simulated", fmt.Sprintf("The fake provider doesn't simulate %s /v2/%s", req.Method, strings.Join(path, "/")))
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CLOUD FLARE -----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The load balancer pools on the account, the origins are replaced whole the way SetPoolOrigins sends them
+ */
+func (f *Fake_t) pools (req *http.Request, path []string, body []byte) fake_reply_t {
+    if len(path) < 4 || path[1] != Fake_account_id || path[2] != "load_balancers" || path[3] != "pools" {
+        if len(path) > 1 && path[1] != Fake_account_id { return cfError(http.StatusForbidden, "Authentication error") }
+        return cfError(http.StatusNotImplemented, fmt.Sprintf("The fake provider doesn't simulate %s /client/v4/%s", req.Method, strings.Join(path, "/")))
+    }
+
+    if len(path) == 4 {
+        switch req.Method {
+        case "GET":
+            return cfReply(http.StatusOK, f.state.Pools)
+        case "POST":
+            var pool CF_pool_t
+            if err := json.Unmarshal(body, &pool); err != nil || len(pool.Name) == 0 { return cfError(http.StatusBadRequest, "A pool needs a name") }
+            if len(pool.Origins) == 0 { return cfError(http.StatusBadRequest, "A pool needs at least one origin") }
+            for _, o := range(f.state.Pools) {
+                if o.Name == pool.Name { return cfError(http.StatusBadRequest, "A pool with that name already exists") }
+            }
+            pool.ID = f.hexID()
+            f.state.Pools = append(f.state.Pools, &pool)
+            return cfReply(http.StatusOK, pool)
+        }
+    }
+
+    for _, pool := range(f.state.Pools) {
+        if len(path) != 5 || pool.ID != path[4] { continue }
+        switch req.Method {
+        case "GET":
+            return cfReply(http.StatusOK, pool)
+        case "PATCH":
+            var change struct {
+                Origins     []CF_pool_origin_t  `json:"origins"`
+            }
+            if err := json.Unmarshal(body, &change); err != nil || len(change.Origins) == 0 { return cfError(http.StatusBadRequest, "A pool needs at least one origin") }
+            pool.Origins = change.Origins
+            return cfReply(http.StatusOK, pool)
+        }
+    }
+    return cfError(http.StatusNotFound, "Pool not found")
+}
+
+/*! \brief The zone's load balancers, a put replaces the whole balancer and every pool it names has to exist
+ */
+func (f *Fake_t) zoneBalancers (req *http.Request, z *fake_zone_t, path []string, body []byte) fake_reply_t {
+    var lb cf_balancer_t
+    if req.Method == "POST" || req.Method == "PUT" {
+        if err := json.Unmarshal(body, &lb); err != nil || len(lb.Name) == 0 { return cfError(http.StatusBadRequest, "A load balancer needs a name") }
+        named := append([]string{lb.FallbackPool}, lb.DefaultPools...)
+        for _, pools := range(lb.RegionPools) { named = append(named, pools...) }
+        for _, id := range(named) {
+            found := false
+            for _, pool := range(f.state.Pools) { found = found || pool.ID == id }
+            if !found { return cfError(http.StatusBadRequest, fmt.Sprintf("Pool '%s' not found", id)) }
+        }
+    }
+
+    if len(path) == 3 {
+        switch req.Method {
+        case "GET":
+            return cfReply(http.StatusOK, z.Balancers)
+        case "POST":
+            for _, o := range(z.Balancers) {
+                if strings.EqualFold(o.Name, lb.Name) { return cfError(http.StatusBadRequest, "A load balancer with that name already exists") }
+            }
+            lb.ID = f.hexID()
+            z.Balancers = append(z.Balancers, &lb)
+            return cfReply(http.StatusOK, lb)
+        }
+    }
+
+    for i, o := range(z.Balancers) {
+        if len(path) != 4 || o.ID != path[3] { continue }
+        switch req.Method {
+        case "GET":
+            return cfReply(http.StatusOK, o)
+        case "PUT":
+            lb.ID = o.ID
+            z.Balancers[i] = &lb
+            return cfReply(http.StatusOK, lb)
+        case "DELETE":
+            z.Balancers = append(z.Balancers[:i:i], z.Balancers[i+1:]...)
+            return cfReply(http.StatusOK, map[string]string{"id": o.ID})
+        }
+    }
+    return cfError(http.StatusNotFound, "Load balancer not found")
+}
+
+func (f *Fake_t) cloudFlare (req *http.Request, path []string, body []byte) fake_reply_t {
+    if path[0] == "accounts" { return f.pools(req, path, body) }
+    if path[0] != "zones" { return cfError(http.StatusNotImplemented, fmt.Sprintf("The fake provider doesn't simulate %s /client/v4/%s", req.Method, strings.Join(path, "/"))) }
+
+    if len(path) == 1 {
+        name := strings.ToLower(req.URL.Query().Get("name"))
+        list := make([]map[string]string, 0)
+        for _, z := range(f.state.Zones) {
+            if len(name) == 0 || z.Name == name { list = append(list, map[string]string{"id": z.ID, "name": z.Name, "status": "active"}) }
+        }
+        reply := cfReply(http.StatusOK, list)
+        reply.body.(map[string]interface{})["result_info"] = map[string]int{"page": 1, "per_page": len(list), "count": len(list), "total_count": len(list), "total_pages": 1}
+        return reply
+    }
+
+    z := f.zone(path[1])
+    if z == nil { return cfError(http.StatusNotFound, "Invalid zone identifier") }
+    if len(path) == 2 { return cfReply(http.StatusOK, map[string]string{"id": z.ID, "name": z.Name, "status": "active"}) }
+    if path[2] == "load_balancers" { return f.zoneBalancers(req, z, path, body) }
+    if path[2] != "dns_records" { return cfError(http.StatusNotImplemented, fmt.Sprintf("The fake provider doesn't simulate %s /client/v4/zones/%s/%s", req.Method, z.ID, strings.Join(path[2:], "/"))) }
+
+    fullName := func (name string) string {
+        name = strings.ToLower(strings.TrimSuffix(name, "."))
+        if name == "@" || len(name) == 0 { return z.Name }
+        if name != z.Name && !strings.HasSuffix(name, "." + z.Name) { name += "." + z.Name }
+        return name
+    }
+
+    if len(path) == 3 {
+        switch req.Method {
+        case "GET":
+            q := req.URL.Query()
+            list := make([]CF_record_t, 0, len(z.Records))
+            for _, r := range(z.Records) {
+                if (len(q.Get("type")) == 0 || r.Type == q.Get("type")) && (len(q.Get("name")) == 0 || r.Name == fullName(q.Get("name"))) { list = append(list, r) }
+            }
+            start, end, page, pages := fakePage(q, len(list), 100)
+            per, _ := strconv.Atoi(q.Get("per_page"))
+            if per < 1 { per = 100 }
+            reply := cfReply(http.StatusOK, list[start:end])
+            reply.body.(map[string]interface{})["result_info"] = map[string]int{"page": page, "per_page": per, "count": end - start, "total_count": len(list), "total_pages": pages}
+            return reply
+        case "POST":
+            var r cf_record_body_t
+            if err := json.Unmarshal(body, &r); err != nil || len(r.Type) == 0 || len(r.Name) == 0 { return cfError(http.StatusBadRequest, "Type and name are required") }
+            if r.TTL == 0 { r.TTL = 1 }     //automatic
+            rec := CF_record_t{ID: f.hexID(), Type: strings.ToUpper(r.Type), Name: fullName(r.Name), Content: r.Content, Proxied: r.Proxied, TTL: r.TTL, ZoneName: z.Name}
+            z.Records = append(z.Records, rec)
+            return cfReply(http.StatusOK, rec)
+        }
+    }
+
+    for i := range(z.Records) {
+        if z.Records[i].ID != path[3] { continue }
+        switch req.Method {
+        case "GET":
+            return cfReply(http.StatusOK, z.Records[i])
+        case "PUT", "PATCH":
+            var r struct {
+                Type    string  `json:"type"`
+                Name    string  `json:"name"`
+                Content string  `json:"content"`
+                Proxied *bool   `json:"proxied"`
+                TTL     int     `json:"ttl"`
+            }
+            json.Unmarshal(body, &r)
+            if len(r.Type) > 0 { z.Records[i].Type = strings.ToUpper(r.Type) }
+            if len(r.Name) > 0 { z.Records[i].Name = fullName(r.Name) }
+            if len(r.Content) > 0 { z.Records[i].Content = r.Content }
+            if r.Proxied != nil {
+                z.Records[i].Proxied = *r.Proxied
+            } else if req.Method == "PUT" {
+                z.Records[i].Proxied = false    //a put replaces the whole record
+            }
+            if r.TTL > 0 { z.Records[i].TTL = r.TTL }
+            return cfReply(http.StatusOK, z.Records[i])
+        case "DELETE":
+            id := z.Records[i].ID
+            z.Records = append(z.Records[:i:i], z.Records[i+1:]...)
+            return cfReply(http.StatusOK, map[string]string{"id": id})
+        }
+    }
+    return cfError(http.StatusNotFound, "Record not found")
+}
+
+func (f *Fake_t) load () error {
+    f.state = fake_state_t{NextID: 1000, Domains: map[string][]DO_record_t{Fake_domain: {}}, Zones: []*fake_zone_t{{ID: Fake_zone_id, Name: Fake_domain, Records: []CF_record_t{}}}}
+    if len(f.File) == 0 { return nil }
+    data, err := ioutil.ReadFile(f.File)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return fmt.Errorf("Unable to read the fake provider's state '%s' :: %s", f.File, err.Error()) }
+    if err = json.Unmarshal(data, &f.state); err != nil { return fmt.Errorf("Invalid fake provider state '%s', reset it with -provider fake:reset :: %s", f.File, err.Error()) }
+    if f.state.Domains == nil { f.state.Domains = make(map[string][]DO_record_t) }
+    return nil
+}
+
+func (f *Fake_t) save () error {
+    if len(f.File) == 0 { return nil }
+    jStr, _ := json.MarshalIndent(f.state, "", "  ")
+    os.MkdirAll(filepath.Dir(f.File), 0755)
+    return ioutil.WriteFile(f.File, jStr, 0644)
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- FAKE FUNCTIONS --------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Builds the fake from the spec after 'fake:', ie 'boot=5s,action=2s,latency=100ms,seed=7,state=./demo.json' or 'reset' to start over
+ *  The state is kept in the user's cache dir unless state= says otherwise, state=memory keeps it for the run only
+ */
+func NewFake (spec string) (*Fake_t, error) {
+    f := &Fake_t{Boot: 20 * time.Second, Action: 5 * time.Second, Latency: 150 * time.Millisecond, next: http.DefaultTransport}
+    if dir, err := os.UserCacheDir(); err == nil { f.File = filepath.Join(dir, "harbormaster", fake_state_file) }
+    seed := time.Now().UnixNano()
+    reset := false
+
+    for _, part := range(strings.Split(spec, ",")) {
+        part = strings.TrimSpace(part)
+        if len(part) == 0 { continue }
+        if part == "reset" {
+            reset = true
+            continue
+        }
+        kv := strings.SplitN(part, "=", 2)
+        if len(kv) != 2 { return nil, fmt.Errorf("Fake provider setting '%s' should be name=value", part) }
+
+        var err error
+        switch kv[0] {
+        case "boot":    f.Boot, err = time.ParseDuration(kv[1])
+        case "action":  f.Action, err = time.ParseDuration(kv[1])
+        case "latency": f.Latency, err = time.ParseDuration(kv[1])
+        case "seed":    seed, err = strconv.ParseInt(kv[1], 10, 64)
+        case "state":
+            f.File = kv[1]
+            if f.File == "memory" { f.File = "" }
+        default:
+            return nil, fmt.Errorf("Unknown fake provider setting '%s', expecting boot, action, latency, seed, state or reset", kv[0])
+        }
+        if err != nil { return nil, fmt.Errorf("Fake provider setting '%s' :: %s", part, err.Error()) }
+    }
+
+    f.rand = rand.New(rand.NewSource(seed))
+    if reset && len(f.File) > 0 { os.Remove(f.File) }
+    if err := f.load(); err != nil { return nil, err }
+    return f, nil
+}
+
+/*! \brief Credentials that only the fake takes, so a run with it can never reach a real account
+ */
+func FakeCredentials (do *DO_config_t, cf *CF_config_t) {
+    do.APIKey, do.BaseURL, do.Headers = strings.Repeat("f", 64), "", nil
+    cf.APIKey, cf.Email, cf.Account, cf.BaseURL, cf.Headers, cf.Accounts = "fake", "demo@" + Fake_domain, Fake_account_id, "", nil, nil
+    cf.Zone, cf.Zones = Fake_zone_id, map[string]string{Fake_domain: Fake_zone_id}
+}
+
+/*! \brief Answers the request from the fake account
+ */
+func (f *Fake_t) RoundTrip (req *http.Request) (*http.Response, error) {
+    p := req.URL.Path
+    if !strings.Contains(p, "/v2/") && !strings.Contains(p, "/client/v4/") { return f.next.RoundTrip(req) }
+
+    var body []byte
+    if req.Body != nil {
+        body, _ = ioutil.ReadAll(req.Body)
+        req.Body.Close()
+    }
+
+    if f.Latency > 0 {
+        f.lock.Lock()
+        wait := time.Duration(f.rand.Int63n(int64(f.Latency)))
+        f.lock.Unlock()
+        timer := time.NewTimer(wait)
+        select {
+        case <-timer.C:
+        case <-req.Context().Done():
+            timer.Stop()
+            return nil, req.Context().Err()
+        }
+    }
+
+    f.lock.Lock()
+    defer f.lock.Unlock()
+    f.settle(time.Now())
+
+    var reply fake_reply_t
+    if i := strings.Index(p, "/v2/"); i >= 0 {
+        reply = f.digitalOcean(req, strings.Split(strings.Trim(p[i + 4:], "/"), "/"), body)
+    } else {
+        i = strings.Index(p, "/client/v4/")
+        reply = f.cloudFlare(req, strings.Split(strings.Trim(p[i + 11:], "/"), "/"), body)
+    }
+
+    if req.Method != "GET" && reply.code < 300 {
+        if err := f.save(); err != nil { return nil, fmt.Errorf("fake provider: unable to save its state :: %s", err.Error()) }
+    }
+
+    var data []byte
+    if reply.body != nil { data, _ = json.Marshal(reply.body) }
+    resp := &http.Response{StatusCode: reply.code, Status: fmt.Sprintf("%d %s", reply.code, http.StatusText(reply.code)), Header: http.Header{}, Request: req,
+        Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1, Body: ioutil.NopCloser(bytes.NewReader(data)), ContentLength: int64(len(data))}
+    resp.Header.Set("Content-Type", "application/json")
+    resp.Header.Set("Ratelimit-Remaining", "4999")
+    if strings.Contains(p, "/v2/") {
+        resp.Header.Set("X-Request-Id", fakeRequestID())
+    } else {
+        resp.Header.Set("Cf-Ray", fmt.Sprintf("%016x-FAKE", rand.Uint64()))
+    }
+    return resp, nil
+}
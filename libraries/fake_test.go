@@ -0,0 +1,146 @@
+package libraries
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    )
+
+/*! \brief The fake as the default transport for the test, with credentials only it takes
+ */
+func useFake (t *testing.T) (DO_c, CF_c) {
+    fake, err := NewFake("state=memory,boot=0,action=0,latency=0")
+    if err != nil { t.Fatal(err) }
+    was := http.DefaultTransport
+    http.DefaultTransport = fake
+    t.Cleanup(func () { http.DefaultTransport = was })
+
+    var do DO_c
+    var cf CF_c
+    FakeCredentials(&do.Config, &cf.Config)
+    return do, cf
+}
+
+func TestFakeFirewall (t *testing.T) {
+    do, _ := useFake(t)
+    anywhere := &DO_fw_target_t{Addresses: []string{"0.0.0.0/0", "::/0"}}
+    do.Config.FirewallRules = map[string]DO_rule_set_t{
+        "web": {Inbound: []DO_fw_rule_t{{Protocol: "tcp", Ports: "80", Sources: anywhere}, {Protocol: "tcp", Ports: "443", Sources: anywhere}}},
+        "ssh": {Inbound: []DO_fw_rule_t{{Protocol: "tcp", Ports: "22", Sources: &DO_fw_target_t{Addresses: []string{"203.0.113.0/24"}}}}},
+    }
+
+    tests := []struct {
+        name        string
+        sets        []string
+        diff        int     //rule changes ApplyFirewall reports
+        inbound     int     //inbound rules the firewall ends up with
+    }{
+        {"create", []string{"web"}, 5, 2},      //the outbound rules default to anywhere
+        {"same again", []string{"web"}, 0, 2},
+        {"add a set", []string{"web", "ssh"}, 1, 3},
+        {"take one away", []string{"ssh"}, 2, 1},
+    }
+
+    for _, tt := range(tests) {
+        diff, err := do.ApplyFirewall("demo", tt.sets, false)
+        if err != nil { t.Fatalf("%s: %s", tt.name, err) }
+        if len(diff) != tt.diff { t.Errorf("%s: %d changes, expecting %d :: %v", tt.name, len(diff), tt.diff, diff) }
+
+        firewalls, err := do.ListFirewalls()
+        if err != nil { t.Fatalf("%s: %s", tt.name, err) }
+        if len(firewalls) != 1 { t.Fatalf("%s: %d firewalls, expecting 1", tt.name, len(firewalls)) }
+        if len(firewalls[0].Inbound) != tt.inbound { t.Errorf("%s: %d inbound rules, expecting %d", tt.name, len(firewalls[0].Inbound), tt.inbound) }
+        if !hasString(firewalls[0].Tags, do_stack_tag + "demo") { t.Errorf("%s: firewall isn't on the stack's tag :: %v", tt.name, firewalls[0].Tags) }
+    }
+
+    firewalls, _ := do.ListFirewalls()
+    rule := DO_fw_rule_t{Protocol: "tcp", Ports: "8080", Sources: anywhere}
+    if err := do.AddFirewallRule(firewalls[0].ID, rule); err != nil { t.Fatal(err) }
+    if removed, err := do.RemoveFirewallRule(firewalls[0].ID, rule); err != nil || !removed { t.Errorf("Removing the added rule :: %v %v", removed, err) }
+    if removed, err := do.RemoveFirewallRule(firewalls[0].ID, rule); err != nil || removed { t.Errorf("Removing it again should find nothing :: %v %v", removed, err) }
+}
+
+func TestFakeLoadBalancer (t *testing.T) {
+    do, _ := useFake(t)
+    web := []DO_forwarding_rule_t{{EntryProtocol: "http", EntryPort: 80, TargetProtocol: "http", TargetPort: 8080}}
+    both := append([]DO_forwarding_rule_t{{EntryProtocol: "tcp", EntryPort: 443, TargetProtocol: "tcp", TargetPort: 8443}}, web...)
+
+    created, err := do.AssignLoadBalancer("demo", "nyc3", "demo", web, nil)
+    if err != nil { t.Fatal(err) }
+    if len(created.IP) == 0 { t.Fatalf("New load balancer doesn't have an ip :: %+v", created) }
+
+    tests := []struct {
+        name        string
+        region      string
+        rules       []DO_forwarding_rule_t
+        fails       bool
+    }{
+        {"unchanged", "nyc3", web, false},
+        {"new rule", "nyc3", both, false},
+        {"no rules", "nyc3", nil, true},
+        {"moved region", "ams3", web, true},
+    }
+
+    for _, tt := range(tests) {
+        lb, err := do.AssignLoadBalancer("demo", tt.region, "demo", tt.rules, nil)
+        if tt.fails {
+            if err == nil { t.Errorf("%s: expecting an error", tt.name) }
+            continue
+        }
+        if err != nil { t.Fatalf("%s: %s", tt.name, err) }
+        if lb.ID != created.ID || lb.IP != created.IP { t.Errorf("%s: balancer %s at %s, expecting %s at %s", tt.name, lb.ID, lb.IP, created.ID, created.IP) }
+        if len(lb.ForwardingRules) != len(tt.rules) { t.Errorf("%s: %d forwarding rules, expecting %d", tt.name, len(lb.ForwardingRules), len(tt.rules)) }
+    }
+
+    balancers, err := do.ListLoadBalancers()
+    if err != nil { t.Fatal(err) }
+    if len(balancers) != 1 { t.Errorf("%d load balancers, expecting 1", len(balancers)) }
+}
+
+func TestFakePools (t *testing.T) {
+    _, cf := useFake(t)
+    origins := []CF_pool_origin_t{{Name: "web-1", Address: "192.0.2.10", Enabled: true, Weight: 1}}
+
+    east, err := cf.AssignPool("web-nyc3", origins)
+    if err != nil { t.Fatal(err) }
+    west, err := cf.AssignPool("web-ams3", []CF_pool_origin_t{{Name: "web-2", Address: "192.0.2.20", Enabled: true, Weight: 1}})
+    if err != nil { t.Fatal(err) }
+    if len(east.ID) == 0 || east.ID == west.ID { t.Fatalf("Pools need ids of their own :: %s %s", east.ID, west.ID) }
+
+    again, err := cf.AssignPool("web-nyc3", origins)
+    if err != nil || again.ID != east.ID { t.Errorf("Assigning the same pool again :: %v %v", again, err) }
+
+    east.Origins = append(east.Origins, CF_pool_origin_t{Name: "web-3", Address: "192.0.2.30", Enabled: true, Weight: 0.25})
+    east.Origins[0].Weight = 0.75
+    if err = cf.SetPoolOrigins(*east); err != nil { t.Fatal(err) }
+    got, err := cf.GetPool(east.ID)
+    if err != nil { t.Fatal(err) }
+    if len(got.Origins) != 2 || got.Origins[0].Weight != 0.75 { t.Errorf("Origins weren't replaced :: %+v", got.Origins) }
+    if _, err = cf.GetPool("nowhere"); err == nil { t.Error("Expecting an error for a pool that doesn't exist") }
+
+    tests := []struct {
+        name        string
+        regions     map[string][]string
+        pools       []string
+        fails       bool
+    }{
+        {"create", map[string][]string{"ENAM": {east.ID}}, []string{east.ID}, false},
+        {"add a region", map[string][]string{"ENAM": {east.ID}, "WEU": {west.ID}}, []string{east.ID, west.ID}, false},
+        {"unknown pool", nil, []string{"0123456789abcdef0123456789abcdef"}, true},
+        {"no pools", nil, nil, true},
+    }
+
+    for _, tt := range(tests) {
+        err := cf.AssignGeoBalancer("www." + Fake_domain, tt.regions, tt.pools)
+        if tt.fails != (err != nil) { t.Errorf("%s: error %v", tt.name, err) }
+    }
+
+    resp, err := cf.request("load_balancers", nil, nil)
+    if err != nil { t.Fatal(err) }
+    var list struct {
+        Result  []cf_balancer_t     `json:"result"`
+    }
+    if err = json.Unmarshal(resp, &list); err != nil { t.Fatal(err) }
+    if len(list.Result) != 1 { t.Fatalf("%d load balancers, expecting 1", len(list.Result)) }
+    if len(list.Result[0].RegionPools) != 2 || len(list.Result[0].DefaultPools) != 2 { t.Errorf("Load balancer wasn't updated :: %+v", list.Result[0]) }
+}
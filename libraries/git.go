@@ -0,0 +1,48 @@
+/*! \file git.go
+    \brief Committing what we keep on disk to a git repo, so the state and the zone history get history, review and rollback from git
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Runs git in the directory and returns what it printed
+ */
+func runGit (dir string, args ...string) (string, error) {
+    out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+    if err != nil { return "", fmt.Errorf("git %s in '%s' failed :: %s %s", args[0], dir, err.Error(), strings.TrimSpace(string(out))) }
+    return strings.TrimSpace(string(out)), nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- GIT FUNCTIONS -----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Commits everything that changed under the directory with the message, making the directory a repo when it isn't in one
+ *  The commit is made as harbormaster when git doesn't know who the user is, ie on a build box.  Returns false when there was nothing to commit
+ */
+func GitCommit (dir, msg string) (bool, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil { return false, fmt.Errorf("Unable to make '%s' :: %s", dir, err.Error()) }
+    if _, err := runGit(dir, "rev-parse", "--git-dir"); err != nil {
+        if _, err = runGit(dir, "init", "-q"); err != nil { return false, err }
+    }
+
+    if _, err := runGit(dir, "add", "-A", "--", "."); err != nil { return false, err }
+    if _, err := runGit(dir, "diff", "--cached", "--quiet", "--", "."); err == nil { return false, nil }     //it exits 1 when there are changes
+
+    args := []string{"commit", "-q", "-m", msg, "--", "."}
+    if email, _ := runGit(dir, "config", "user.email"); len(email) == 0 {
+        args = append([]string{"-c", "user.name=harbormaster", "-c", "user.email=harbormaster@localhost"}, args...)
+    }
+    _, err := runGit(dir, args...)
+    return err == nil, err
+}
@@ -0,0 +1,50 @@
+/*! \file hosts.go
+    \brief Which requests are to the provider apis, the transports in front of them leave everything else alone
+ *  Health probes, output posts and allowlist fetches go through the same default transport, but they aren't api requests
+*/
+
+package libraries
+
+import (
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+var provider_hosts = map[string]bool{"api.digitalocean.com": true, "api.cloudflare.com": true}
+var provider_lock sync.RWMutex
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief True when the request is going to one of the provider apis, spaces included, or a base_url standing in for one
+ */
+func providerRequest (req *http.Request) bool {
+    host := strings.ToLower(req.URL.Hostname())
+    if host == do_spaces_domain || strings.HasSuffix(host, "." + do_spaces_domain) { return true }
+
+    provider_lock.RLock()
+    defer provider_lock.RUnlock()
+    return provider_hosts[host]
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- HOSTS FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Adds the hosts of the base_urls from the config, so a gateway or a mock counts as the api it replaces
+ */
+func ProviderHosts (baseURLs ...string) {
+    provider_lock.Lock()
+    defer provider_lock.Unlock()
+    for _, base := range(baseURLs) {
+        if len(base) == 0 { continue }
+        if u, err := url.Parse(base); err == nil && len(u.Hostname()) > 0 { provider_hosts[strings.ToLower(u.Hostname())] = true }
+    }
+}
@@ -0,0 +1,155 @@
+/*! \file pages.go
+    \brief Walking the pages of the list endpoints for both apis, so callers get one item at a time and can stop whenever they like
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "encoding/json"
+    "net/url"
+    "strings"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const do_per_page          = 100   //max page size for most of the digital ocean lists
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Adds the page to the url, whether or not it already has a query
+ */
+func pageUrl (path string, page, perPage int) string {
+    sep := "?"
+    if strings.Contains(path, "?") { sep = "&" }
+    return fmt.Sprintf("%s%spage=%d&per_page=%d", path, sep, page, perPage)
+}
+
+/*! \brief Turns the droplet into the node we hand back, with the harbormaster tags pulled out
+ */
+func dropletNode (d do_droplet_t) DO_node_t {
+    node := DO_node_t{ID: d.ID, Name: d.Name, Status: d.Status, Region: d.Region.Slug, Size: d.SizeSlug, GPU: d.GPUInfo.String(), Tags: d.Tags}
+    for _, n := range(d.Networks.V4) {
+        switch n.Type {
+        case "public":  node.IP = n.IP
+        case "private": node.PrivateIP = n.IP
+        }
+    }
+    for _, n := range(d.Networks.V6) {
+        if n.Type == "public" { node.IPv6 = n.IP }
+    }
+    for _, t := range(d.Tags) {
+        switch {
+        case t == do_managed_tag:                   node.Managed = true
+        case strings.HasPrefix(t, do_stack_tag):    node.Stack = strings.TrimPrefix(t, do_stack_tag)
+        case strings.HasPrefix(t, do_created_tag):  node.Created = strings.TrimPrefix(t, do_created_tag)
+        case strings.HasPrefix(t, do_template_tag): node.Template = strings.TrimPrefix(t, do_template_tag)
+        case strings.HasPrefix(t, do_owner_tag):    node.Owner = strings.TrimPrefix(t, do_owner_tag)
+        case strings.HasPrefix(t, do_expires_tag):
+            if at, ok := expiresAt([]string{t}); ok { node.Expires = at.Format("2006-01-02 15:04") }
+        case strings.HasPrefix(t, do_note_tag):     node.Note = strings.ReplaceAll(strings.TrimPrefix(t, do_note_tag), "_", " ")
+        }
+    }
+    return node
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- PAGE FUNCTIONS ----------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Calls fn with each item in the digital ocean list, field is where the list is in the response, ie 'droplets'
+ *  Pages are requested as they're needed, and returning false from fn stops before the next one is asked for
+ */
+func (do DO_c) EachPage (path, field string, fn func (item json.RawMessage) bool) error {
+    for page := 1; page > 0; page++ {
+        resp, err := do.send("GET", pageUrl(path, page, do_per_page), nil)
+        if err != nil { return err }
+
+        var list map[string]json.RawMessage
+        if err = json.Unmarshal(resp, &list); err != nil { return err }
+
+        var items []json.RawMessage
+        if len(list[field]) > 0 {
+            if err = json.Unmarshal(list[field], &items); err != nil { return err }
+        }
+        for _, item := range(items) {
+            if !fn(compatItem(compat_fields[field], item, nil)) { return nil }
+        }
+
+        var links struct {
+            Pages   struct {
+                Next    string  `json:"next"`
+            }   `json:"pages"`
+        }
+        if len(list["links"]) > 0 { json.Unmarshal(list["links"], &links) }
+        if len(links.Pages.Next) == 0 { break }
+    }
+    return nil
+}
+
+/*! \brief Calls fn with each node, only the ones matching the tag when it's set.  Returning false stops
+ *  The tag can be an expression from ParseSelector, ie 'tag=web AND region=nyc3'
+ */
+func (do DO_c) EachNode (tag string, fn func (node DO_node_t) bool) error {
+    sel, err := ParseSelector(tag)
+    if err != nil { return err }
+
+    path := "droplets"
+    if t := sel.apiTag(); len(t) > 0 { path += "?tag_name=" + url.QueryEscape(t) }
+
+    pageErr := do.EachPage(path, "droplets", func (item json.RawMessage) bool {
+        var d do_droplet_t
+        if err = json.Unmarshal(item, &d); err != nil { return false }
+        node := dropletNode(d)
+        if !sel.matches(node) { return true }
+        return fn(node)
+    })
+    if pageErr != nil { return pageErr }
+    return err
+}
+
+/*! \brief Calls fn with each item in the cloud flare list for the current zone, ie 'dns_records'
+ *  Pages are requested as they're needed, and returning false from fn stops before the next one is asked for
+ */
+func (cf CF_c) EachPage (path string, fn func (item json.RawMessage) bool) error {
+    for page := 1; page > 0; {
+        resp, err := cf.request(pageUrl(path, page, cf_per_page), nil, nil)
+        if err != nil { return err }
+
+        var list struct {
+            ResultInfo  struct {
+                TotalPages  int     `json:"total_pages"`
+            }   `json:"result_info"`
+            Result  []json.RawMessage   `json:"result"`
+        }
+        if err = json.Unmarshal(resp, &list); err != nil { return err }
+
+        for _, item := range(list.Result) {
+            if !fn(item) { return nil }
+        }
+        if list.ResultInfo.TotalPages > page {
+            page++
+        } else {
+            page = 0    //we're done
+        }
+    }
+    return nil
+}
+
+/*! \brief Calls fn with each domain record in the zone.  Returning false stops
+ */
+func (cf CF_c) EachDomainRecord (fn func (rec CF_record_t) bool) error {
+    var err error
+    hint := cf.recordHint()
+    pageErr := cf.EachPage("dns_records", func (item json.RawMessage) bool {
+        var rec CF_record_t
+        if err = json.Unmarshal(compatItem("cf_record", item, hint), &rec); err != nil { return false }
+        return fn(rec)
+    })
+    if pageErr != nil { return pageErr }
+    return err
+}
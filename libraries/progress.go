@@ -0,0 +1,48 @@
+/*! \file progress.go
+    \brief Keeps track of the steps in longer operations, how long each took and how it went, for the summary at the end
+*/
+
+package libraries
+
+import (
+    "sync"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type Step_t struct {
+    Name        string  `json:"name"`
+    Seconds     float64 `json:"seconds"`
+    Result      string  `json:"result"`    //ok, or the error
+}
+
+/*! \brief The steps for the run, a nil one doesn't keep track of anything
+ */
+type Progress_t struct {
+    Steps       []Step_t
+    lock        sync.Mutex  //bulk rows share this
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- PROGRESS FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Runs the step, keeping track of how long it took and how it went
+ */
+func (p *Progress_t) Step (name string, fn func() error) error {
+    if p == nil { return fn() }
+
+    start := time.Now()
+    err := fn()
+
+    step := Step_t{Name: name, Seconds: time.Since(start).Round(time.Millisecond).Seconds(), Result: "ok"}
+    if err != nil { step.Result = err.Error() }
+
+    p.lock.Lock()
+    p.Steps = append(p.Steps, step)
+    p.lock.Unlock()
+    return err
+}
@@ -0,0 +1,114 @@
+/*! \file read_cache.go
+    \brief Local cache of responses for read heavy things, ie node lists and domain records, so loops don't burn the rate limits
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "os"
+    "io/ioutil"
+    "path/filepath"
+    "encoding/hex"
+    "crypto/sha256"
+    "strings"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Responses are kept as files in the dir for the ttl, a nil one doesn't cache anything
+ *  Refresh skips what's cached, but still saves the new responses for next time.  Once one is stale its etag, when the api sent one,
+ *  lets us ask for it again with If-None-Match and keep using it on a 304
+ */
+type ReadCache_t struct {
+    Dir         string
+    TTL         time.Duration
+    Refresh     bool
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief File for the response, the api key is part of the name so accounts don't mix
+ */
+func (c *ReadCache_t) file (apiKey, url string) string {
+    sum := sha256.Sum256([]byte(apiKey + " " + url))
+    return filepath.Join(c.Dir, hex.EncodeToString(sum[:]) + ".cache")
+}
+
+/*! \brief The cached response for the url, nil when there isn't a fresh one
+ */
+func (c *ReadCache_t) get (apiKey, url string) []byte {
+    if c == nil || c.Refresh { return nil }
+
+    loc := c.file(apiKey, url)
+    info, err := os.Stat(loc)
+    if err != nil || time.Since(info.ModTime()) > c.TTL { return nil }
+
+    body, err := ioutil.ReadFile(loc)
+    if err != nil { return nil }
+    return body
+}
+
+/*! \brief The cached response and its etag even when it's past the ttl, empty etag when there isn't one to check it against
+ */
+func (c *ReadCache_t) stale (apiKey, url string) ([]byte, string) {
+    if c == nil { return nil, "" }
+
+    loc := c.file(apiKey, url)
+    etag, err := ioutil.ReadFile(strings.TrimSuffix(loc, ".cache") + ".etag")
+    if err != nil || len(etag) == 0 { return nil, "" }
+    body, err := ioutil.ReadFile(loc)
+    if err != nil { return nil, "" }
+    return body, string(etag)
+}
+
+/*! \brief The api said the stale response hasn't changed, so it's good for another ttl
+ */
+func (c *ReadCache_t) touch (apiKey, url string) {
+    if c == nil { return }
+    now := time.Now()
+    os.Chtimes(c.file(apiKey, url), now, now)
+}
+
+/*! \brief Saves the response along with its etag, failing to is fine, we just ask again next time
+ */
+func (c *ReadCache_t) put (apiKey, url string, body []byte, etag string) {
+    if c == nil { return }
+    if os.MkdirAll(c.Dir, 0700) != nil { return }
+
+    loc := c.file(apiKey, url)
+    if len(etag) > 0 {
+        ioutil.WriteFile(strings.TrimSuffix(loc, ".cache") + ".etag", []byte(etag), 0600)
+    } else {
+        os.Remove(strings.TrimSuffix(loc, ".cache") + ".etag")
+    }
+    ioutil.WriteFile(loc, body, 0600)
+}
+
+/*! \brief Throws out everything cached, anything we change could be in there
+ */
+func (c *ReadCache_t) clear () {
+    if c == nil { return }
+    files, _ := filepath.Glob(filepath.Join(c.Dir, "*.cache"))
+    etags, _ := filepath.Glob(filepath.Join(c.Dir, "*.etag"))
+    for _, f := range(append(files, etags...)) { os.Remove(f) }
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- CACHE FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Cache in the user's cache dir, nil when the ttl is 0 so nothing is cached
+ */
+func NewReadCache (ttl time.Duration, refresh bool) (*ReadCache_t, error) {
+    if ttl <= 0 { return nil, nil }
+
+    dir, err := os.UserCacheDir()
+    if err != nil { return nil, fmt.Errorf("Unable to find a cache directory :: %s", err.Error()) }
+    return &ReadCache_t{Dir: filepath.Join(dir, "harbormaster"), TTL: ttl, Refresh: refresh}, nil
+}
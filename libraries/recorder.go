@@ -0,0 +1,127 @@
+/*! \file recorder.go
+    \brief Records the api traffic to a cassette file and plays it back, so scripts can be run against real responses without touching anything live
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "strings"
+    "sync"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief One request and the response we got for it, headers aren't kept as that's where the credentials go
+ */
+type recorder_interaction_t struct {
+    Method      string  `json:"method"`
+    Url         string  `json:"url"`
+    Request     string  `json:"request,omitempty"`
+    Status      int     `json:"status"`
+    Response    string  `json:"response"`
+}
+
+/*! \brief Sits in front of the http transport, recording every api interaction or replaying them from the file
+ *  Everything saved goes through redactString, so the database connection strings and kubeconfigs don't keep their credentials
+ */
+type Recorder_t struct {
+    File        string
+    Replay      bool
+    Secrets     []string    //api keys and the like that get scrubbed from everything we save
+    interactions    []recorder_interaction_t
+    used        []bool
+    lock        sync.Mutex
+    next        http.RoundTripper
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Saves everything so far, it's written after each request so a failed run still has its cassette
+ */
+func (r *Recorder_t) save () error {
+    jStr, err := json.MarshalIndent(r.interactions, "", "  ")
+    if err == nil { err = ioutil.WriteFile(r.File, jStr, 0600) }
+    return err
+}
+
+/*! \brief Finds the recorded interaction for the request, the first one not used yet that matches
+ *  When they've all been used the last match is handed back again, so polling for something to finish still ends
+ */
+func (r *Recorder_t) find (method, url, body string) (*recorder_interaction_t, error) {
+    last := -1
+    for _, matchBody := range([]bool{true, false}) {
+        for i, inter := range(r.interactions) {
+            if inter.Method != method || inter.Url != url || (matchBody && inter.Request != body) { continue }
+            last = i
+            if !r.used[i] {
+                r.used[i] = true
+                return &r.interactions[i], nil
+            }
+        }
+        if last >= 0 { return &r.interactions[last], nil }
+    }
+    return nil, fmt.Errorf("No recorded response in %s for %s %s", r.File, method, url)
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- RECORDER FUNCTIONS ------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Recorder for the file, with replay the cassette is read in and nothing goes out to the network
+ */
+func NewRecorder (file string, replay bool, secrets []string) (*Recorder_t, error) {
+    r := &Recorder_t{File: file, Replay: replay, Secrets: secrets, interactions: make([]recorder_interaction_t, 0), next: http.DefaultTransport}
+    if replay {
+        data, err := ioutil.ReadFile(file)
+        if err != nil { return nil, fmt.Errorf("Unable to read the cassette :: %s", err.Error()) }
+        if err = json.Unmarshal(data, &r.interactions); err != nil { return nil, fmt.Errorf("Invalid cassette %s :: %s", file, err.Error()) }
+        r.used = make([]bool, len(r.interactions))
+    }
+    return r, nil
+}
+
+/*! \brief Handles the request, either passing it on and recording it, or answering it from the cassette
+ *  Only the provider api requests are recorded, health probes and output posts go straight through
+ */
+func (r *Recorder_t) RoundTrip (req *http.Request) (*http.Response, error) {
+    if !providerRequest(req) { return r.next.RoundTrip(req) }
+
+    var reqBody []byte
+    if req.Body != nil {
+        reqBody, _ = ioutil.ReadAll(req.Body)
+        req.Body.Close()
+        req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+    }
+    url, body := redactString(req.URL.String(), r.Secrets), redactString(string(reqBody), r.Secrets)
+
+    if r.Replay {
+        r.lock.Lock()
+        inter, err := r.find(req.Method, url, body)
+        r.lock.Unlock()
+        if err != nil { return nil, err }
+        return &http.Response{StatusCode: inter.Status, Status: fmt.Sprintf("%d %s", inter.Status, http.StatusText(inter.Status)), Header: http.Header{"Content-Type": {"application/json"}},
+            Body: ioutil.NopCloser(strings.NewReader(inter.Response)), Request: req}, nil
+    }
+
+    resp, err := r.next.RoundTrip(req)
+    if err != nil { return nil, err }
+    respBody, err := ioutil.ReadAll(resp.Body)
+    resp.Body.Close()
+    if err != nil { return nil, err }
+    resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+    r.lock.Lock()
+    defer r.lock.Unlock()
+    r.interactions = append(r.interactions, recorder_interaction_t{Method: req.Method, Url: url, Request: body, Status: resp.StatusCode, Response: redactString(string(respBody), r.Secrets)})
+    if err = r.save(); err != nil { return nil, fmt.Errorf("Unable to write the cassette :: %s", err.Error()) }
+    return resp, nil
+}
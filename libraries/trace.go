@@ -0,0 +1,170 @@
+/*! \file trace.go
+    \brief Traces of every api request and response written to a file, with the credentials taken out so the file can be shared
+*/
+
+package libraries
+
+import (
+    "fmt"
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+    )
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const redacted_value = "REDACTED"
+
+//json fields that hold credentials, ie database passwords, tunnel tokens, r2 secrets and user data that can carry app secrets
+var redact_secret_fields = regexp.MustCompile(`(?i)("[a-z_]*(password|secret|token|private_key|api_key|access_key|key_data|user_data)[a-z_]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+//the password in a connection string, ie the database uri and private_uri
+var redact_url_password = regexp.MustCompile(`(?i)([a-z][a-z0-9+.-]*://[^:/@\s"]+:)[^@\s"/]+@`)
+
+//yaml lines that hold credentials, ie the kubeconfig's token and client key
+var redact_yaml_fields = regexp.MustCompile(`(?im)^(\s*-?\s*[a-z_-]*(password|secret|token|key-data)[a-z_-]*\s*:[ \t]*)\S.*$`)
+
+//headers that carry credentials for either api or spaces
+var redact_headers = []string{"Authorization", "X-Auth-Key", "X-Auth-Email", "Cookie", "Set-Cookie", "X-Amz-Security-Token"}
+
+//headers the providers put their id for the request in, what their support asks for
+var request_id_headers = []string{"X-Request-Id", "Cf-Ray"}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief One line of the trace file
+ */
+type trace_entry_t struct {
+    Time        string  `json:"time"`
+    Method      string  `json:"method"`
+    Url         string  `json:"url"`
+    RequestHeaders  http.Header `json:"request_headers"`
+    Request     string  `json:"request,omitempty"`
+    Status      int     `json:"status,omitempty"`
+    ResponseHeaders http.Header `json:"response_headers,omitempty"`
+    Response    string  `json:"response,omitempty"`
+    Error       string  `json:"error,omitempty"`
+    Duration    int64   `json:"duration_ms"`
+}
+
+/*! \brief Sits in front of the http transport writing a json line to the file for each request
+ */
+type Tracer_t struct {
+    Secrets     []string    //api keys and the like that get scrubbed from everything we write
+    file        *os.File
+    lock        sync.Mutex
+    next        http.RoundTripper
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Takes the secrets and any credential looking json or yaml fields out of the string, along with passwords in connection strings
+ */
+func redactString (str string, secrets []string) string {
+    for _, secret := range(secrets) {
+        if len(secret) > 0 { str = strings.ReplaceAll(str, secret, redacted_value) }
+    }
+    str = redact_url_password.ReplaceAllString(str, "${1}" + redacted_value + "@")
+    str = redact_yaml_fields.ReplaceAllString(str, "${1}" + redacted_value)
+    return redact_secret_fields.ReplaceAllString(str, `$1"` + redacted_value + `"`)
+}
+
+/*! \brief Sets the headers from the config on the request, with their $VARS expanded
+ */
+func setHeaders (req *http.Request, headers map[string]string) {
+    for name, val := range(headers) { req.Header.Set(name, ExpandHeader(val)) }
+}
+
+/*! \brief Copy of the headers with the credentials taken out, safe to print
+ */
+func redactHeaders (headers http.Header, secrets []string) http.Header {
+    clean := make(http.Header)
+    for name, vals := range(headers) {
+        for _, val := range(vals) { clean.Add(name, redactString(val, secrets)) }
+    }
+    for _, name := range(redact_headers) {
+        if len(clean.Get(name)) > 0 { clean.Set(name, redacted_value) }
+    }
+    return clean
+}
+
+/*! \brief Expands the $VARS in a header value from the config, ie "$USER" or "$HARBORMASTER_RUN_ID".  Ones that aren't set are left alone
+ */
+func ExpandHeader (val string) string {
+    if !strings.Contains(val, "$") { return val }
+    return os.Expand(val, func (name string) string {
+        if v, ok := os.LookupEnv(name); ok { return v }
+        return "$" + name
+    })
+}
+
+/*! \brief The provider's id for the request from the response headers, empty when there isn't one
+ */
+func RequestID (headers http.Header) string {
+    for _, name := range(request_id_headers) {
+        if id := headers.Get(name); len(id) > 0 { return id }
+    }
+    return ""
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- TRACE FUNCTIONS ---------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Tracer appending to the file, it wraps whatever the default transport is right now
+ */
+func NewTracer (loc string, secrets []string) (*Tracer_t, error) {
+    file, err := os.OpenFile(loc, os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0600)
+    if err != nil { return nil, fmt.Errorf("Unable to open the trace file :: %s", err.Error()) }
+    return &Tracer_t{Secrets: secrets, file: file, next: http.DefaultTransport}, nil
+}
+
+func (t *Tracer_t) Close () error {
+    return t.file.Close()
+}
+
+/*! \brief Passes the request on, writing out what went and what came back
+ */
+func (t *Tracer_t) RoundTrip (req *http.Request) (*http.Response, error) {
+    var reqBody []byte
+    if req.Body != nil {
+        reqBody, _ = ioutil.ReadAll(req.Body)
+        req.Body.Close()
+        req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+    }
+    entry := trace_entry_t{Time: time.Now().UTC().Format(time.RFC3339Nano), Method: req.Method, Url: redactString(req.URL.String(), t.Secrets),
+        RequestHeaders: redactHeaders(req.Header, t.Secrets), Request: redactString(string(reqBody), t.Secrets)}
+
+    start := time.Now()
+    resp, err := t.next.RoundTrip(req)
+    entry.Duration = time.Since(start).Milliseconds()
+
+    if err == nil {
+        var respBody []byte
+        respBody, err = ioutil.ReadAll(resp.Body)
+        resp.Body.Close()
+        resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+        entry.Status, entry.ResponseHeaders, entry.Response = resp.StatusCode, redactHeaders(resp.Header, t.Secrets), redactString(string(respBody), t.Secrets)
+    }
+    if err != nil { entry.Error = redactString(err.Error(), t.Secrets) }
+
+    jStr, _ := json.Marshal(entry)
+    t.lock.Lock()
+    t.file.Write(append(jStr, '\n'))
+    t.lock.Unlock()
+
+    if err != nil { return nil, err }
+    return resp, nil
+}
@@ -0,0 +1,354 @@
+/*! \file output.go
+    \brief Handles printing lists of things to the console as a table, json or csv
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "bytes"
+    "net/http"
+    "io/ioutil"
+    "path/filepath"
+    "time"
+    "encoding/csv"
+    "encoding/json"
+    "text/tabwriter"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const output_file_name      = "harbormaster_output.json"    //where -o writes to on its own
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A domain record we set, for the output
+ */
+type dns_record_t struct {
+    ID          string  `json:"id"`
+    Domain      string  `json:"domain"`
+    Type        string  `json:"type"`
+    Name        string  `json:"name"`
+    Content     string  `json:"content"`
+}
+
+type floating_ip_t struct {
+    IP          string  `json:"ip"`
+    IPv6        string  `json:"ipv6,omitempty"`  //reserved ipv6 that moved with it
+    NodeID      int     `json:"node_id"`
+}
+
+/*! \brief What's written out with -merge, every run adds to it instead of replacing it
+ *  Resources are by their type and then name, so running the same thing again just updates it
+ */
+type output_doc_t struct {
+    Resources   map[string]map[string]interface{}   `json:"resources"`
+    Runs        []output_run_t  `json:"runs"`
+}
+
+type output_run_t struct {
+    Time        time.Time   `json:"time"`
+    Version     string      `json:"version"`
+    Args        []string    `json:"args"`
+    Success     bool        `json:"success"`
+    Resources   []string    `json:"resources,omitempty"` //type/name of what this run touched
+    Steps       []libraries.Step_t  `json:"steps,omitempty"`
+}
+
+/*! \brief The -o flag, on its own it's a bool for the local file, or -o=dest picks where the output goes
+ */
+type output_dest_t struct {
+    set     bool
+    dest    string
+}
+
+func (o *output_dest_t) String () string { return o.dest }
+
+func (o *output_dest_t) IsBoolFlag () bool { return true }
+
+func (o *output_dest_t) Set (val string) error {
+    switch strings.ToLower(val) {
+    case "true":    o.set, o.dest = true, ""
+    case "false":   o.set, o.dest = false, ""
+    default:        o.set, o.dest = true, val
+    }
+    return nil
+}
+
+/*! \brief A flag that can be given more than once, ie -tag web -tag staging, the values end up comma separated
+ */
+type multi_flag_t struct {
+    val     *string
+}
+
+func (m multi_flag_t) String () string {
+    if m.val == nil { return "" }
+    return *m.val
+}
+
+func (m multi_flag_t) Set (val string) error {
+    if len(*m.val) > 0 { *m.val += "," }
+    *m.val += val
+    return nil
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Prints out a list in the requested format
+ *  Table and csv use the headers and rows, json just dumps out the raw objects
+ */
+func printList (format string, headers []string, rows [][]string, raw interface{}) (err error) {
+    switch strings.ToLower(format) {
+    case "table", "github", "":
+        tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(tw, strings.ToUpper(strings.Join(headers, "\t")))
+        for _, row := range(rows) {
+            fmt.Fprintln(tw, strings.Join(row, "\t"))
+        }
+        err = tw.Flush()
+
+    case "json":
+        var data []byte
+        data, err = json.MarshalIndent(raw, "", "  ")
+        if err == nil { fmt.Println(string(data)) }
+
+    case "csv":
+        w := csv.NewWriter(os.Stdout)
+        w.Write(headers)
+        w.WriteAll(rows)    //this flushes for us
+        err = w.Error()
+
+    default:
+        err = fmt.Errorf("Unknown format '%s', expecting table, json or csv", format)
+    }
+    return
+}
+
+/*! \brief Prints the summary of the steps for the run, json and csv leave it out so their output stays parsable
+ */
+func printSteps (format string, steps []libraries.Step_t) {
+    if !strings.EqualFold(format, "table") && !strings.EqualFold(format, "github") { return }
+
+    total := 0.0
+    rows := make([][]string, 0, len(steps) + 1)
+    for _, s := range(steps) {
+        total += s.Seconds
+        rows = append(rows, []string{s.Name, fmt.Sprintf("%.1fs", s.Seconds), s.Result})
+    }
+    rows = append(rows, []string{"total", fmt.Sprintf("%.1fs", total), ""})
+
+    fmt.Println()
+    printList("table", []string{"step", "duration", "result"}, rows, steps)
+}
+
+/*! \brief Type and name of the thing in the output, empty for things we don't keep, ie lists
+ *  Also returns what's kept for it, the file output is split into its droplet or app
+ */
+func resourceKey (output interface{}) (string, string, interface{}) {
+    switch v := output.(type) {
+    case *libraries.FileOutput_t:
+        if v.App != nil { return "app", v.App.Name(), v.App }
+        if v.Droplet.ID > 0 { return "droplet", v.Droplet.Name, v.Droplet }
+    case *dns_record_t:                 return "dns_record", v.Type + " " + v.Name + "." + v.Domain, v
+    case *floating_ip_t:                return "floating_ip", v.IP, v
+    case *libraries.CF_hostname_t:      return "custom_hostname", v.Hostname, v
+    case *libraries.DO_cdn_t:           return "cdn", v.Origin, v
+    case *libraries.DO_cert_t:          return "certificate", v.Name, v
+    case *libraries.DO_namespace_t:     return "functions_namespace", v.Label, v
+    case *libraries.DO_uptime_check_t:  return "uptime_check", v.Name, v
+    case *libraries.DO_pool_t:          return "node_pool", v.Name, v
+    case *libraries.DO_replica_t:       return "database_replica", v.Name, v
+    case *libraries.DO_database_t:      return "database", v.Name, v
+    }
+    return "", "", nil
+}
+
+/*! \brief The things in the output, a bulk run has one for each row that made something
+ */
+func outputItems (output interface{}) []interface{} {
+    results, ok := output.([]bulk_result_t)
+    if !ok { return []interface{}{output} }
+
+    items := make([]interface{}, 0, len(results))
+    for _, r := range(results) {
+        if r.Output != nil { items = append(items, r.Output) }
+    }
+    return items
+}
+
+/*! \brief Reads in the document we're merging into, nil when there isn't one yet
+ */
+func readOutput (dest, cwd, region string, do libraries.DO_c) ([]byte, error) {
+    switch {
+    case len(dest) == 0:
+        dest = filepath.Join(cwd, output_file_name)
+    case strings.HasPrefix(dest, "s3://"):
+        parts := strings.SplitN(strings.TrimPrefix(dest, "s3://"), "/", 2)
+        if len(parts) < 2 { return nil, fmt.Errorf("Output destination '%s' needs to look like s3://bucket/key", dest) }
+        data, found, err := do.DownloadObject(parts[0], region, parts[1])
+        if !found { data = nil }
+        return data, err
+    case dest == "stdout" || dest == "-" || strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://"):
+        return nil, fmt.Errorf("Output can only be merged into a file or spaces, not '%s'", dest)
+    }
+
+    data, err := ioutil.ReadFile(dest)
+    if os.IsNotExist(err) { return nil, nil }
+    return data, err
+}
+
+/*! \brief Adds the output of this run to what's already at the destination
+ */
+func mergeOutput (dest, cwd, region, version string, success bool, output interface{}, steps []libraries.Step_t, do libraries.DO_c) (interface{}, error) {
+    existing, err := readOutput(dest, cwd, region, do)
+    if err != nil { return nil, err }
+
+    doc := output_doc_t{}
+    if len(existing) > 0 {
+        if err = json.Unmarshal(existing, &doc); err != nil { return nil, fmt.Errorf("Unable to merge output, it isn't from -merge :: %s", err.Error()) }
+    }
+    if doc.Resources == nil { doc.Resources = make(map[string]map[string]interface{}) }
+
+    run := output_run_t{Time: time.Now().UTC(), Version: version, Args: os.Args[1:], Success: success, Steps: steps}
+    for _, o := range(outputItems(output)) {
+        kind, name, val := resourceKey(o)
+        if len(kind) == 0 { continue }
+
+        if doc.Resources[kind] == nil { doc.Resources[kind] = make(map[string]interface{}) }
+        doc.Resources[kind][name] = val
+        run.Resources = append(run.Resources, kind + "/" + name)
+    }
+
+    doc.Runs = append(doc.Runs, run)
+    return doc, nil
+}
+
+/*! \brief Writes the json output to the destination, an empty one is the local output file
+ *  Destinations are a file path, stdout, s3://bucket/key for spaces in the region, or an http(s) url the json is posted to
+ */
+func writeOutput (dest, cwd, region string, output interface{}, do libraries.DO_c) (err error) {
+    data, err := json.Marshal(output)
+    if err != nil { return }
+
+    switch {
+    case len(dest) == 0:
+        err = ioutil.WriteFile(filepath.Join(cwd, output_file_name), data, 0644)
+
+    case dest == "stdout" || dest == "-":
+        fmt.Println(string(data))
+
+    case strings.HasPrefix(dest, "s3://"):
+        parts := strings.SplitN(strings.TrimPrefix(dest, "s3://"), "/", 2)
+        if len(parts) < 2 || len(parts[0]) == 0 || len(parts[1]) == 0 { return fmt.Errorf("Output destination '%s' needs to look like s3://bucket/key", dest) }
+        err = do.UploadObject(parts[0], region, parts[1], data, "application/json")
+
+    case strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://"):
+        var resp *http.Response
+        resp, err = http.Post(dest, "application/json", bytes.NewBuffer(data))
+        if err == nil {
+            resp.Body.Close()
+            if resp.StatusCode >= 300 { err = fmt.Errorf("status code: %d", resp.StatusCode) }
+        }
+
+    default:
+        err = ioutil.WriteFile(dest, data, 0644)
+    }
+
+    if err != nil {
+        if len(dest) == 0 { dest = output_file_name }
+        err = fmt.Errorf("Unable to write output to '%s' :: %s", dest, err.Error())
+    }
+    return
+}
+
+/*! \brief Commits the state repo from the config with a summary of the run, the command, how it went and what it touched
+ *  The output file and dns history are in it, so every run that changes something is a commit
+ */
+func commitState (repo string, runErr error, output interface{}) error {
+    msg := "harbormaster " + strings.Join(os.Args[1:], " ")
+    if len(msg) > 72 { msg = msg[:69] + "..." }
+    msg += "\n\n"
+    if runErr != nil {
+        msg += "Failed :: " + runErr.Error() + "\n"
+    } else {
+        msg += "Success\n"
+    }
+    for _, o := range(outputItems(output)) {
+        if kind, name, _ := resourceKey(o); len(kind) > 0 { msg += "\n" + kind + "/" + name }
+    }
+
+    if _, err := libraries.GitCommit(repo, msg); err != nil { return fmt.Errorf("Unable to commit the state repo :: %s", err.Error()) }
+    return nil
+}
+
+/*! \brief Escapes a message for a github workflow command
+ */
+func githubEscape (msg string) string {
+    return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(msg)
+}
+
+/*! \brief Appends the lines to the file github gives us through the env variable, if it's set
+ */
+func githubAppend (env string, lines []string) error {
+    loc := os.Getenv(env)
+    if len(loc) == 0 || len(lines) == 0 { return nil }
+
+    f, err := os.OpenFile(loc, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
+    if err != nil { return err }
+    defer f.Close()
+
+    _, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+    return err
+}
+
+/*! \brief Reports the run to github actions, an annotation for how it went, step outputs and a job summary of what changed
+ */
+func githubReport (output interface{}, runErr error) error {
+    if runErr != nil {
+        fmt.Println("::error title=harbormaster::" + githubEscape(runErr.Error()))
+    } else {
+        fmt.Println("::notice title=harbormaster::Success")
+    }
+
+    outputs := []interface{}{output}
+    if results, ok := output.([]bulk_result_t); ok {
+        outputs = outputs[:0]
+        for _, r := range(results) {
+            if r.Output != nil { outputs = append(outputs, r.Output) }
+        }
+    }
+
+    steps := make([]string, 0)
+    summary := []string{"| Type | Name |", "| --- | --- |"}
+    for _, o := range(outputs) {
+        switch v := o.(type) {
+        case *libraries.FileOutput_t:
+            if v.Droplet.ID > 0 && len(outputs) == 1 {  //only a single node makes sense as a step output
+                steps = append(steps, fmt.Sprintf("node_id=%d", v.Droplet.ID))
+                for _, n := range(v.Droplet.Networks.V4) {
+                    if n.Type == "public" { steps = append(steps, "node_ip=" + n.IP); break }
+                }
+            }
+        case *dns_record_t:
+            if len(v.ID) > 0 { steps = append(steps, "record_id=" + v.ID) }
+        }
+
+        if kind, name, _ := resourceKey(o); len(kind) > 0 { summary = append(summary, fmt.Sprintf("| %s | %s |", kind, name)) }
+    }
+
+    err := githubAppend("GITHUB_OUTPUT", steps)
+    if err == nil && len(summary) > 2 {
+        err = githubAppend("GITHUB_STEP_SUMMARY", append([]string{"### Harbormaster resources changed", ""}, summary...))
+    }
+    return err
+}
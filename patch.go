@@ -0,0 +1,63 @@
+/*! \file patch.go
+    \brief Patch night in one command, -patch updates the OS of a tag's nodes one at a time and each has to be healthy before the next goes
+*/
+
+package main
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const patch_health_wait     = 5 * time.Minute
+const patch_health_interval = 10 * time.Second
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Keeps probing the url until it's healthy, giving up after a few minutes
+ */
+func waitHealthy (do libraries.DO_c, url string) error {
+    var err error
+    for start := time.Now(); time.Since(start) < patch_health_wait; {
+        if err = probeHTTP(url); err == nil { return nil }
+        if do.Verbose { fmt.Printf("Waiting for %s to be healthy :: %s\n", url, err.Error()) }
+        if do.Ctx != nil && do.Ctx.Err() != nil { return do.Ctx.Err() }
+        time.Sleep(patch_health_interval)
+    }
+    return fmt.Errorf("%s wasn't healthy after %s :: %s", url, patch_health_wait, err.Error())
+}
+
+/*! \brief Patches the nodes with the tag or in the stack one at a time, stopping at the first one that fails or isn't healthy after
+ *  The health url is only checked when checkHealth is set, {ip} is swapped for the node's address
+ */
+func patchNodes (tag, stack, healthURL string, checkHealth, dryRun bool, do libraries.DO_c) ([]*libraries.DO_patch_t, error) {
+    if len(tag) == 0 && len(stack) == 0 { return nil, fmt.Errorf("Nodes to patch not set.  use the -tag or -stack option") }
+    nodes, err := do.ListNodes(tag, stack)
+    if err != nil { return nil, err }
+    if len(nodes) == 0 { return nil, fmt.Errorf("No nodes to patch") }
+
+    results := make([]*libraries.DO_patch_t, 0, len(nodes))
+    for _, n := range(nodes) { fmt.Println("~ patch node " + n.Name) }
+    if dryRun { return results, nil }
+
+    for i, n := range(nodes) {
+        result, err := do.PatchNode(n.Name)
+        if err == nil && checkHealth {
+            url := strings.ReplaceAll(healthURL, "{ip}", result.IP)
+            err = do.Progress.Step("health " + n.Name, func () error { return waitHealthy(do, url) })
+            if err != nil { result.Result = err.Error() }
+        }
+        results = append(results, result)
+        if err != nil { return results, fmt.Errorf("Patching stopped at %s, %d of %d nodes done :: %s", n.Name, i, len(nodes), err.Error()) }
+    }
+    return results, nil
+}
@@ -0,0 +1,43 @@
+/*! \file platform.go
+    \brief Where the config lives and how the console gets colors, the parts that are different on windows are in platform_windows.go and platform_other.go
+*/
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const config_file_name      = "harbormaster.json"
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The config in the current directory, or in the platform's config directory when there isn't one here
+ *  ie ~/.config/harbormaster on linux, %AppData%\harbormaster on windows and ~/Library/Application Support/harbormaster on macs
+ */
+func configPath (cwd string) string {
+    local := filepath.Join(cwd, config_file_name)
+    if _, err := os.Stat(local); err == nil { return local }
+
+    dir, err := os.UserConfigDir()
+    if err != nil { return local }
+    user := filepath.Join(dir, "harbormaster", config_file_name)
+    if _, err = os.Stat(user); err == nil { return user }
+    return local    //so the error is about the one they'd expect
+}
+
+/*! \brief Wraps the word in the color when stdout is a console that can show it, ie '32' for green
+ *  NO_COLOR turns them off, see no-color.org
+ */
+func colorize (word, color string) string {
+    if len(os.Getenv("NO_COLOR")) > 0 { return word }
+    if info, err := os.Stdout.Stat(); err != nil || info.Mode() & os.ModeCharDevice == 0 || !consoleColors() { return word }
+    return "\033[" + color + "m" + word + "\033[0m"
+}
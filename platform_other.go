@@ -0,0 +1,26 @@
+//go:build !windows
+
+/*! \file platform_other.go
+    \brief Everything but windows, the shell is sh and terminals understand the color codes
+*/
+
+package main
+
+import (
+    "context"
+    "os/exec"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func consoleColors () bool {
+    return true
+}
+
+/*! \brief Runs the command line through the shell
+ */
+func shellCommand (ctx context.Context, command string) *exec.Cmd {
+    return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+/*! \file platform_windows.go
+    \brief Windows, the shell is cmd and the console has to be asked to understand the color codes
+*/
+
+package main
+
+import (
+    "os"
+    "context"
+    "os/exec"
+    "sync"
+    "syscall"
+    "unsafe"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const windows_virtual_terminal  = 0x0004    //ENABLE_VIRTUAL_TERMINAL_PROCESSING, windows 10 and newer
+
+var windows_colors struct {
+    once    sync.Once
+    ok      bool
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Turns on the color codes for the console, false when it's too old for them
+ */
+func consoleColors () bool {
+    windows_colors.once.Do(func () {
+        kernel32 := syscall.NewLazyDLL("kernel32.dll")
+        getMode, setMode := kernel32.NewProc("GetConsoleMode"), kernel32.NewProc("SetConsoleMode")
+        if getMode.Find() != nil || setMode.Find() != nil { return }
+
+        var mode uint32
+        handle := os.Stdout.Fd()
+        if ok, _, _ := getMode.Call(handle, uintptr(unsafe.Pointer(&mode))); ok == 0 { return }
+        if mode & windows_virtual_terminal != 0 {
+            windows_colors.ok = true
+            return
+        }
+        ok, _, _ := setMode.Call(handle, uintptr(mode | windows_virtual_terminal))
+        windows_colors.ok = ok != 0
+    })
+    return windows_colors.ok
+}
+
+/*! \brief Runs the command line through cmd, hooks written for sh need to be written for it instead
+ */
+func shellCommand (ctx context.Context, command string) *exec.Cmd {
+    cmd := exec.CommandContext(ctx, "cmd")
+    cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: "cmd /C " + command}     //passed as is, cmd does its own quoting
+    return cmd
+}
@@ -0,0 +1,86 @@
+/*! \file protect.go
+    \brief Guard rails from the config, the nodes and domain records we refuse to delete or overwrite
+*/
+
+package main
+
+import (
+    "fmt"
+    "path"
+    "strings"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The protected section of the config, names can use shell style wildcards, ie 'db-*'
+ *  DNS names are the full name, so the root record of a domain is just 'example.com'
+ */
+type protected_t struct {
+    Nodes       []string    `json:"nodes"`
+    Tags        []string    `json:"tags"`    //nodes with any of these tags
+    DNS         []string    `json:"dns"`
+    Override    bool        `json:"-"`       //from -override-protection, lets everything through
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func matchesAny (patterns []string, val string) (string, bool) {
+    for _, p := range(patterns) {
+        if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(val)); ok { return p, true }
+    }
+    return "", false
+}
+
+/*! \brief Makes sure all the patterns are valid, so a bad one doesn't quietly protect nothing
+ */
+func (p protected_t) validate () error {
+    for _, list := range([][]string{p.Nodes, p.Tags, p.DNS}) {
+        for _, pattern := range(list) {
+            if _, err := path.Match(pattern, ""); err != nil { return fmt.Errorf("Invalid protected pattern '%s' in the config", pattern) }
+        }
+    }
+    return nil
+}
+
+/*! \brief Errors if the node is protected by its name or one of its tags
+ */
+func (p protected_t) checkNode (do libraries.DO_c, name string) error {
+    if p.Override { return nil }
+    if pattern, ok := matchesAny(p.Nodes, name); ok {
+        return fmt.Errorf("Node '%s' is protected by '%s' in the config.  use -override-protection if you really mean it", name, pattern)
+    }
+    if len(p.Tags) == 0 { return nil }
+
+    node := libraries.FileOutput_t{}
+    if _, err := do.GetNode(name, &node); err != nil {    //without its tags we can't tell, so it's treated as protected
+        return fmt.Errorf("Unable to check if node '%s' is protected by its tags :: %s", name, err.Error())
+    }
+    for _, tag := range(node.Droplet.Tags) {
+        if pattern, ok := matchesAny(p.Tags, tag); ok {
+            return fmt.Errorf("Node '%s' is protected by its tag '%s'.  use -override-protection if you really mean it", name, pattern)
+        }
+    }
+    return nil
+}
+
+/*! \brief Errors if the domain record is protected, cloud flare records get their domain from the zone
+ */
+func (p protected_t) checkDNS (cf libraries.CF_c, cloudflare bool, domain, subDomain string) (err error) {
+    if p.Override || len(p.DNS) == 0 { return nil }
+    if cloudflare && len(domain) == 0 {
+        if domain, err = cf.ZoneName(); err != nil { return }
+    }
+
+    name := subDomain + "." + domain
+    if subDomain == "@" || len(subDomain) == 0 { name = domain }
+    if pattern, ok := matchesAny(p.DNS, name); ok {
+        return fmt.Errorf("Domain record '%s' is protected by '%s' in the config.  use -override-protection if you really mean it", name, pattern)
+    }
+    return nil
+}
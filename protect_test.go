@@ -0,0 +1,34 @@
+package main
+
+import (
+    "testing"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+func TestProtectedNode (t *testing.T) {
+    api := stubAPI(t, map[string]string{
+        "GET /droplets": `{"droplets":[{"id":1,"name":"db-1","tags":["prod"]},{"id":2,"name":"web-1"},{"id":3,"name":"web-2"}]}`,
+        "GET /droplets/1": `{"droplet":{"id":1,"name":"db-1","tags":["prod"]}}`,
+        "GET /droplets/2": `{"droplet":{"id":2,"name":"web-1"}}`,
+    })
+    do := libraries.DO_c{Config: libraries.DO_config_t{APIKey: "key", BaseURL: api}}
+    p := protected_t{Nodes: []string{"bastion*"}, Tags: []string{"prod"}}
+
+    tests := []struct {
+        name        string
+        override    bool
+        protected   bool
+    }{
+        {"bastion-1", false, true},
+        {"db-1", false, true},
+        {"web-1", false, false},
+        {"web-2", false, true},     //its tags can't be looked up
+        {"db-1", true, false},
+    }
+
+    for _, tt := range(tests) {
+        p.Override = tt.override
+        if err := p.checkNode(do, tt.name); tt.protected != (err != nil) { t.Errorf("%s: error %v", tt.name, err) }
+    }
+}
@@ -0,0 +1,109 @@
+/*! \file purge.go
+    \brief Cleaning up the records pointing at an ip address with -purge-ip, across the digital ocean domains and cloud flare zones
+ *  A deleted node's address gets handed to someone else, and a record still pointing at it sends our traffic, and our cookies, to them
+*/
+
+package main
+
+import (
+    "fmt"
+    "bufio"
+    "net"
+    "os"
+    "sort"
+    "strings"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Asks on the terminal before going ahead, yes skips asking.  Without a terminal to ask on it has to be yes
+ */
+func confirm (question string, yes bool) error {
+    if yes { return nil }
+    if info, err := os.Stdin.Stat(); err != nil || info.Mode() & os.ModeCharDevice == 0 {
+        return fmt.Errorf("No terminal to confirm on, nothing was changed.  use -yes to go ahead without asking")
+    }
+    fmt.Printf("%s [y/N] ", question)
+    answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+    if !strings.HasSuffix(answer, "\n") { fmt.Println() }     //stdin closed on us
+    if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" { return nil }
+    return fmt.Errorf("Cancelled, nothing was changed")
+}
+
+/*! \brief The cloud flare zones to look in, the one picked with -zone or -cloudflare -d, otherwise all of them from the config
+ */
+func purgeZones (picked bool, config config_t, cf libraries.CF_c) []string {
+    if picked { return []string{cf.Config.Zone} }
+    seen := make(map[string]bool)
+    if len(config.CF.Zone) > 0 { seen[config.CF.Zone] = true }
+    for _, id := range(config.CF.Zones) { seen[id] = true }
+    zones := make([]string, 0, len(seen))
+    for id := range(seen) { zones = append(zones, id) }
+    sort.Strings(zones)
+    return zones
+}
+
+/*! \brief Finds the records pointing at ip, shows what's going to happen to them and once it's confirmed deletes them, or points them at retarget
+ *  Digital ocean is searched in domain, or every domain, unless it's cloudflare only.  Cloud flare is searched in the zones from purgeZones
+ */
+func purgeIP (ip, retarget, domain string, cloudflare, zonePicked, dryRun, yes bool, config config_t, do libraries.DO_c, cf libraries.CF_c) ([]libraries.DNS_ip_record_t, error) {
+    from := net.ParseIP(ip)
+    if from == nil { return nil, fmt.Errorf("-purge-ip '%s' isn't an ip address", ip) }
+    if len(retarget) > 0 {
+        to := net.ParseIP(retarget)
+        if to == nil { return nil, fmt.Errorf("-retarget '%s' isn't an ip address", retarget) }
+        if (to.To4() == nil) != (from.To4() == nil) { return nil, fmt.Errorf("-retarget %s isn't the same kind of address as %s, the records are A or AAAA for one of them", retarget, ip) }
+    }
+
+    records := make([]libraries.DNS_ip_record_t, 0)
+    if !cloudflare && len(config.DO.APIKey) > 0 {
+        found, err := do.RecordsPointingAt(ip, domain)
+        if err != nil { return nil, err }
+        records = append(records, found...)
+    }
+    if len(config.CF.APIKey) > 0 && (cloudflare || len(domain) == 0) {
+        for _, zone := range(purgeZones(zonePicked, config, cf)) {
+            cf.Config.Zone = zone
+            found, err := cf.RecordsPointingAt(ip)
+            if err != nil { return nil, err }
+            records = append(records, found...)
+        }
+    }
+
+    if len(records) == 0 {
+        fmt.Printf("No records point at %s\n", ip)
+        return records, nil
+    }
+    for _, r := range(records) {
+        provider := "digitalocean"
+        if r.CloudFlare { provider = "cloudflare" }
+        if len(retarget) > 0 {
+            fmt.Printf("~ %-12s %s  %s -> %s\n", provider, r, r.Content, retarget)
+        } else {
+            fmt.Printf("- %-12s %s  %s\n", provider, r, r.Content)
+        }
+        if err := config.Protected.checkDNS(cf, r.CloudFlare, r.Zone, r.Name); err != nil { return nil, err }
+    }
+    if dryRun { return records, nil }
+
+    verb, done := "Delete", "Deleted"
+    if len(retarget) > 0 { verb, done = "Retarget", "Retargeted" }
+    if err := confirm(fmt.Sprintf("%s these %d records?", verb, len(records)), yes); err != nil { return records, err }
+
+    for _, r := range(records) {
+        var err error
+        if r.CloudFlare {
+            err = cf.PurgeRecord(r, retarget)
+        } else {
+            err = do.PurgeRecord(r, retarget)
+        }
+        if err != nil { return records, fmt.Errorf("%s :: %s", r, err.Error()) }
+        if do.Verbose { fmt.Printf("%s %s\n", done, r) }
+    }
+    fmt.Printf("%s %d records pointing at %s\n", done, len(records), ip)
+    return records, nil
+}
@@ -0,0 +1,78 @@
+/*! \file push.go
+    \brief -push copies files to every node with the tag or in the stack over sftp, a few nodes at a time, and runs an optional -reload after
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "sync"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Splits the local:remote pairs, the last colon is the split so windows drive letters are fine
+ */
+func parsePushFiles (args []string) ([]libraries.DO_push_file_t, error) {
+    files := make([]libraries.DO_push_file_t, 0, len(args))
+    for _, a := range(args) {
+        i := strings.LastIndex(a, ":")
+        if i < 1 || i == len(a) - 1 { return nil, fmt.Errorf("'%s' isn't local:remote, ie ./nginx.conf:/etc/nginx/nginx.conf", a) }
+        f := libraries.DO_push_file_t{Local: a[:i], Remote: a[i + 1:]}
+        info, err := os.Stat(f.Local)
+        if err != nil { return nil, fmt.Errorf("Unable to push '%s' :: %s", f.Local, err.Error()) }
+        if info.IsDir() { return nil, fmt.Errorf("'%s' is a directory, only files can be pushed", f.Local) }
+        files = append(files, f)
+    }
+    return files, nil
+}
+
+/*! \brief Pushes the files to the nodes, at most concurrency at a time, and returns how it went on each in the listing's order
+ *  Any failures are summed up in the error, the results are still all there
+ */
+func pushNodes (tag, stack string, args []string, reload string, concurrency int, dryRun bool, do libraries.DO_c) ([]*libraries.DO_push_t, error) {
+    if len(args) == 0 { return nil, fmt.Errorf("Files to push not set.  put them after the options as local:remote, ie -push -tag web ./nginx.conf:/etc/nginx/nginx.conf") }
+    if len(tag) == 0 && len(stack) == 0 { return nil, fmt.Errorf("Nodes to push to not set.  use the -tag or -stack option") }
+    files, err := parsePushFiles(args)
+    if err != nil { return nil, err }
+    nodes, err := do.ListNodes(tag, stack)
+    if err != nil { return nil, err }
+    if len(nodes) == 0 { return nil, fmt.Errorf("No nodes to push to") }
+
+    results := make([]*libraries.DO_push_t, len(nodes))
+    if dryRun {
+        for i, n := range(nodes) {
+            for _, f := range(files) { fmt.Printf("~ %s: %s -> %s\n", n.Name, f.Local, f.Remote) }
+            if len(reload) > 0 { fmt.Printf("~ %s: %s\n", n.Name, reload) }
+            results[i] = &libraries.DO_push_t{Node: n.Name, IP: n.IP, Result: "dry run"}
+        }
+        return results, nil
+    }
+
+    if concurrency < 1 { concurrency = 1 }
+    slots := make(chan struct{}, concurrency)
+    wg := sync.WaitGroup{}
+    for i, n := range(nodes) {
+        wg.Add(1)
+        go func (i int, n libraries.DO_node_t) {
+            defer wg.Done()
+            slots <- struct{}{}
+            defer func() { <-slots }()
+            results[i] = do.PushFiles(n, files, reload)
+        }(i, n)
+    }
+    wg.Wait()
+
+    failed := make([]string, 0)
+    for _, r := range(results) {
+        if r.Result != "ok" { failed = append(failed, r.Node) }
+    }
+    if len(failed) > 0 { return results, fmt.Errorf("Push failed on %d of %d nodes :: %s", len(failed), len(nodes), strings.Join(failed, ", ")) }
+    return results, nil
+}
@@ -0,0 +1,160 @@
+/*! \file report.go
+    \brief Run reports for change management, what a run was given, what it changed and a digest of what the apis told it
+ *  Reports can be signed with an ssh key through ssh-keygen, and -verify-report checks the signature and the input files
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "bytes"
+    "flag"
+    "strings"
+    "time"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const report_namespace      = "harbormaster-report"   //ssh signatures are only good for the namespace they were made for
+const run_id_env            = "HARBORMASTER_RUN_ID"
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type report_api_t struct {
+    Responses   int     `json:"responses"`
+    Digest      string  `json:"digest"`    //sha256 over the hashes of every response
+}
+
+type run_report_t struct {
+    Time        time.Time   `json:"time"`
+    Version     string      `json:"version"`
+    By          string      `json:"by"`
+    RunID       string      `json:"run_id"`
+    Args        []string    `json:"args"`
+    Config      string      `json:"config"`    //sha256 of the config file, it has the credentials so it's not included
+    Inputs      map[string]string   `json:"inputs"`    //sha256 of each file the options point at, by the file name
+    Success     bool        `json:"success"`
+    Error       string      `json:"error,omitempty"`
+    Resources   []string    `json:"resources"`
+    Steps       []libraries.Step_t  `json:"steps,omitempty"`
+    API         report_api_t    `json:"api"`
+    Changes     []libraries.Digest_change_t `json:"changes"`  //with the providers' request ids, for their support
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The id for this run, from HARBORMASTER_RUN_ID when a pipeline hands us its own, otherwise a new one
+ *  It's put in the environment so the headers in the config and the hooks can use it too
+ */
+func runIdentifier () string {
+    id := os.Getenv(run_id_env)
+    if len(id) == 0 {
+        b := make([]byte, 8)
+        rand.Read(b)
+        id = hex.EncodeToString(b)
+        os.Setenv(run_id_env, id)
+    }
+    return id
+}
+
+/*! \brief sha256 of the file, empty when it can't be read
+ */
+func fileHash (loc string) string {
+    data, err := ioutil.ReadFile(loc)
+    if err != nil { return "" }
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+/*! \brief Hashes of the files the options that were passed point at, ie -bulk or -cluster-spec.  The report and its key are left out
+ */
+func reportInputs () map[string]string {
+    inputs := make(map[string]string)
+    flag.Visit(func (f *flag.Flag) {
+        loc := f.Value.String()
+        if f.Name == "report" || f.Name == "report-key" { return }
+        if info, err := os.Stat(loc); err == nil && info.Mode().IsRegular() { inputs[loc] = fileHash(loc) }
+    })
+    return inputs
+}
+
+/*! \brief Runs ssh-keygen with the data on stdin
+ */
+func sshKeygen (data []byte, args ...string) (string, error) {
+    cmd := exec.Command("ssh-keygen", args...)
+    cmd.Stdin = bytes.NewReader(data)
+    out, err := cmd.CombinedOutput()
+    if err != nil { return "", fmt.Errorf("ssh-keygen %s failed :: %s %s", args[1], err.Error(), strings.TrimSpace(string(out))) }
+    return strings.TrimSpace(string(out)), nil
+}
+
+/*! \brief Writes the report for the run, and signs it to <loc>.sig when there's a key
+ */
+func writeReport (loc, key, configLoc, version, runID string, runErr error, output interface{}, steps []libraries.Step_t, digest *libraries.Digest_t) error {
+    report := run_report_t{Time: time.Now().UTC(), Version: version, By: historyBy(), RunID: runID, Args: os.Args[1:], Config: fileHash(configLoc),
+        Inputs: reportInputs(), Success: runErr == nil, Resources: make([]string, 0), Steps: steps, Changes: digest.Changes()}
+    if runErr != nil { report.Error = runErr.Error() }
+    for _, o := range(outputItems(output)) {
+        if kind, name, _ := resourceKey(o); len(kind) > 0 { report.Resources = append(report.Resources, kind + "/" + name) }
+    }
+    report.API.Responses, report.API.Digest = digest.Sum()
+
+    jStr, _ := json.MarshalIndent(report, "", "  ")
+    if err := ioutil.WriteFile(loc, jStr, 0644); err != nil { return fmt.Errorf("Unable to write report to '%s' :: %s", loc, err.Error()) }
+    if len(key) == 0 { return nil }
+
+    os.Remove(loc + ".sig")     //ssh-keygen won't replace it
+    if _, err := sshKeygen(nil, "-Y", "sign", "-f", key, "-n", report_namespace, loc); err != nil { return err }
+    fmt.Println("Signed the report to " + loc + ".sig")
+    return nil
+}
+
+/*! \brief Checks the report's signature, against the allowed signers file when there is one, and that its input files haven't changed since
+ */
+func verifyReport (loc, allowedSigners string) error {
+    data, err := ioutil.ReadFile(loc)
+    if err != nil { return fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+    report := run_report_t{}
+    if err = json.Unmarshal(data, &report); err != nil { return fmt.Errorf("Invalid report '%s' :: %s", loc, err.Error()) }
+
+    sig := loc + ".sig"
+    if len(allowedSigners) == 0 {
+        out, err := sshKeygen(data, "-Y", "check-novalidate", "-n", report_namespace, "-s", sig)
+        if err != nil { return err }
+        fmt.Println(out)
+        fmt.Println("The signature wasn't checked against who's allowed to sign, use -allowed-signers for that")
+    } else {
+        principal, err := sshKeygen(nil, "-Y", "find-principals", "-f", allowedSigners, "-s", sig)
+        if err != nil { return fmt.Errorf("The report wasn't signed by anyone in '%s' :: %s", allowedSigners, err.Error()) }
+        principal = strings.SplitN(principal, "\n", 2)[0]
+        out, err := sshKeygen(data, "-Y", "verify", "-f", allowedSigners, "-I", principal, "-n", report_namespace, "-s", sig)
+        if err != nil { return err }
+        fmt.Println(out)
+    }
+
+    fmt.Printf("Run by %s at %s, harbormaster %s\n", report.By, report.Time.Format("2006-01-02 15:04:05"), strings.Join(report.Args, " "))
+    changed := 0
+    for in, hash := range(report.Inputs) {
+        if now := fileHash(in); now != hash {
+            changed++
+            fmt.Printf("Input %s has changed since the run\n", in)
+        }
+    }
+    if changed > 0 { return fmt.Errorf("%d of the %d input files are different now", changed, len(report.Inputs)) }
+    return nil
+}
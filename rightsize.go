@@ -0,0 +1,56 @@
+/*! \file rightsize.go
+    \brief -rightsize recommends a size for each node from a week of its monitoring, and can write the changes out as a -bulk file to apply them
+*/
+
+package main
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const rightsize_window = 7 * 24 * time.Hour
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Prints the recommendations for the nodes with the tag or in the stack, or all of them, and writes the bulk file when out is set
+ */
+func rightsize (tag, stack, out, format string, do libraries.DO_c) ([]*libraries.DO_rightsize_t, error) {
+    nodes, err := do.ListNodes(tag, stack)
+    if err != nil { return nil, err }
+    if len(nodes) == 0 { return nil, fmt.Errorf("No nodes to rightsize") }
+
+    report, err := do.Rightsize(nodes, rightsize_window)
+    if err != nil { return report, err }
+
+    rows := make([][]string, 0, len(report))
+    changes := make([]map[string]string, 0)    //only the columns a resize row needs
+    delta := 0.0
+    for _, r := range(report) {
+        rows = append(rows, []string{r.Node, r.Size, fmt.Sprint(r.CPUAvg), fmt.Sprint(r.CPUP95), fmt.Sprint(r.MemoryAvg), fmt.Sprint(r.MemoryP95), r.Change, r.Suggest, fmt.Sprintf("%+.2f", r.MonthlyDelta), r.Reason})
+        if len(r.Suggest) > 0 {
+            changes = append(changes, map[string]string{"action": "resize", "name": r.Node, "slug": r.Suggest})
+            delta += r.MonthlyDelta
+        }
+    }
+    if err = printList(format, []string{"node", "size", "cpu avg", "cpu p95", "mem avg", "mem p95", "change", "suggest", "monthly", "reason"}, rows, report); err != nil { return report, err }
+    if strings.EqualFold(format, "table") || strings.EqualFold(format, "github") { fmt.Printf("%d of %d nodes should change size, $%+.2f a month\n", len(changes), len(report), delta) }
+
+    if len(out) > 0 {
+        jStr, _ := json.MarshalIndent(changes, "", "  ")
+        if err = ioutil.WriteFile(out, jStr, 0644); err != nil { return report, fmt.Errorf("Unable to write '%s' :: %s", out, err.Error()) }
+        fmt.Printf("Wrote %d resizes to %s, run them with -bulk %s\n", len(changes), out, out)
+    }
+    return report, nil
+}
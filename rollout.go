@@ -0,0 +1,66 @@
+/*! \file rollout.go
+    \brief Building an image with -build-image and rolling it out with -rollout, so the packer pipeline and our nodes meet
+ *  Nodes are rebuilt one at a time and each has to be ready before the next goes, so the group never loses more than one
+*/
+
+package main
+
+import (
+    "fmt"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type rollout_result_t struct {
+    Build       *libraries.DO_image_build_t     `json:"build,omitempty"`
+    Image       string      `json:"image,omitempty"`
+    Rebuilt     []string    `json:"rebuilt"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Builds the image when build is set, then rebuilds the nodes picked by the tag or stack from it, or from the image when there's no build
+ *  Protected nodes stop it before any are touched
+ */
+func rolloutImage (build, rollout bool, image, tag, stack string, latest, dryRun bool, config config_t, do libraries.DO_c) (*rollout_result_t, error) {
+    result := &rollout_result_t{Image: image, Rebuilt: make([]string, 0)}
+
+    var nodes []libraries.DO_node_t
+    if rollout {
+        if len(tag) == 0 && len(stack) == 0 { return nil, fmt.Errorf("Nodes to roll out to not set.  use the -tag or -stack option") }
+        if !build && len(image) == 0 { return nil, fmt.Errorf("Image to roll out not set.  use the -image option, or -build-image to build one") }
+
+        var err error
+        if nodes, err = do.ListNodes(tag, stack); err != nil { return nil, err }
+        if len(nodes) == 0 { return nil, fmt.Errorf("No nodes to roll out to") }
+        for _, n := range(nodes) {
+            if err = config.Protected.checkNode(do, n.Name); err != nil { return nil, err }
+        }
+    }
+
+    if build {
+        fmt.Println("+ snapshot from " + do.Config.Packer.Template)
+    }
+    for _, n := range(nodes) { fmt.Println("~ node " + n.Name) }
+    if dryRun { return result, nil }
+
+    if build {
+        var err error
+        if result.Build, err = do.BuildImage(); err != nil { return result, err }
+        result.Image = fmt.Sprint(result.Build.ID)
+    }
+
+    for _, n := range(nodes) {
+        img, err := do.ResolveImage(result.Image, n.Region, latest)    //snapshot: patterns go by the node's region
+        if err == nil { err = do.RebuildNode(n.Name, img) }
+        if err != nil { return result, fmt.Errorf("Rollout stopped at %s, %d of %d nodes done :: %s", n.Name, len(result.Rebuilt), len(nodes), err.Error()) }
+        result.Rebuilt = append(result.Rebuilt, n.Name)
+    }
+    return result, nil
+}
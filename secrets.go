@@ -0,0 +1,110 @@
+/*! \file secrets.go
+    \brief -secrets delivers an app's secrets to a node it creates, from references to vault, ssm, the environment or files so the values aren't kept next to the config
+ *  They go in the user data, or over ssh once the node is up with deliver set to ssh, and are never printed or written to the output
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "sort"
+    "strings"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The secrets file, values are references.  ie 'vault:secret/app#db_password', 'ssm:/app/api_key', 'env:STRIPE_KEY' or 'file:./token'
+ */
+type secrets_spec_t struct {
+    Path        string  `json:"path"`      //where the env file goes on the node
+    Mode        string  `json:"mode"`      //0600 when it's not set
+    Owner       string  `json:"owner"`     //root when it's not set
+    Deliver     string  `json:"deliver"`   //userdata or ssh
+    Values      map[string]string   `json:"values"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func readSecretsSpec (loc string) (spec secrets_spec_t, err error) {
+    data, err := ioutil.ReadFile(loc)
+    if err != nil { return spec, fmt.Errorf("Unable to open '%s' file :: %s", loc, err.Error()) }
+    if err = json.Unmarshal(data, &spec); err != nil { return spec, fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+
+    spec.Deliver = strings.ToLower(spec.Deliver)
+    switch {
+    case len(spec.Path) == 0:
+        err = fmt.Errorf("Secrets path not set in '%s'", loc)
+    case len(spec.Values) == 0:
+        err = fmt.Errorf("No secrets in '%s'", loc)
+    case spec.Deliver == "":
+        spec.Deliver = "userdata"
+    case spec.Deliver != "userdata" && spec.Deliver != "ssh":
+        err = fmt.Errorf("Secrets deliver '%s' isn't userdata or ssh", spec.Deliver)
+    }
+    return
+}
+
+/*! \brief Runs the secret manager's cli, so its own login and environment are what's used
+ */
+func secretCLI (name string, args ...string) (string, error) {
+    var stderr strings.Builder
+    cmd := exec.Command(name, args...)
+    cmd.Stderr = &stderr
+    out, err := cmd.Output()
+    if err != nil { return "", fmt.Errorf("%s failed :: %s %s", name, err.Error(), strings.TrimSpace(stderr.String())) }
+    return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+/*! \brief Looks up the value a reference points at
+ */
+func resolveSecret (ref string) (string, error) {
+    kind, loc := ref, ""
+    if i := strings.Index(ref, ":"); i > 0 { kind, loc = ref[:i], ref[i + 1:] }
+
+    switch kind {
+    case "vault":
+        parts := strings.SplitN(loc, "#", 2)
+        if len(parts) != 2 { return "", fmt.Errorf("Vault reference '%s' needs the field, ie vault:secret/app#db_password", ref) }
+        return secretCLI("vault", "kv", "get", "-field=" + parts[1], parts[0])
+    case "ssm":
+        return secretCLI("aws", "ssm", "get-parameter", "--with-decryption", "--name", loc, "--query", "Parameter.Value", "--output", "text")
+    case "env":
+        val, ok := os.LookupEnv(loc)
+        if !ok { return "", fmt.Errorf("Environment variable %s isn't set", loc) }
+        return val, nil
+    case "file":
+        data, err := ioutil.ReadFile(loc)
+        if err != nil { return "", fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+        return strings.TrimRight(string(data), "\r\n"), nil
+    }
+    return "", fmt.Errorf("Unknown secret reference '%s', expecting vault:, ssm:, env: or file:", ref)
+}
+
+/*! \brief Looks up all the values and renders the env file, one NAME=value a line
+ */
+func renderSecrets (spec secrets_spec_t) (libraries.DO_secret_file_t, error) {
+    file := libraries.DO_secret_file_t{Path: spec.Path, Mode: spec.Mode, Owner: spec.Owner}
+    names := make([]string, 0, len(spec.Values))
+    for name := range(spec.Values) { names = append(names, name) }
+    sort.Strings(names)
+
+    var env strings.Builder
+    for _, name := range(names) {
+        val, err := resolveSecret(spec.Values[name])
+        if err != nil { return file, fmt.Errorf("Secret %s :: %s", name, err.Error()) }
+        if strings.ContainsAny(val, "\r\n") { return file, fmt.Errorf("Secret %s has a newline in it, which an env file can't hold", name) }
+        fmt.Fprintf(&env, "%s=%s\n", name, val)
+    }
+    file.Content = []byte(env.String())
+    return file, nil
+}
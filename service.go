@@ -0,0 +1,269 @@
+/*! \file service.go
+    \brief -service-install, running a command under systemd, or launchd on a mac, so it outlives the terminal it was started from
+ *  Commands that finish on their own are run every -service-every on a timer, ie -self -sd keeping a record pointed at the node it's on.
+ *  The unit runs this binary with the rest of the command line, next to the config.  The api keys can go in its env file instead of the config
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "bytes"
+    "regexp"
+    "runtime"
+    "strings"
+    "time"
+    "os/exec"
+    "path/filepath"
+    "encoding/xml"
+    "io/ioutil"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const service_env_do_key    = "HARBORMASTER_DO_API_KEY"     //these win over the config's keys
+const service_env_cf_key    = "HARBORMASTER_CF_API_KEY"
+const service_env_cf_email  = "HARBORMASTER_CF_EMAIL"
+
+const service_launchd_label = "com.github.nathanrthomas.harbormaster."
+
+var service_name_check      = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief What goes in the unit, and where it and its env file are written
+ */
+type service_t struct {
+    Name        string
+    Exe         string
+    Args        []string
+    Every       time.Duration   //run on a timer this often, otherwise it's kept running
+    WorkDir     string      //where the config is, -o writes here too
+    EnvFile     string
+    Unit        string
+    System      bool        //a systemd system unit, otherwise it's the user's own
+    User        string      //who a system unit runs as, the one behind sudo
+    Log         string      //launchd only, systemd sends it to the journal
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The api keys from the environment, ie the env file of a -service-install unit.  True when any of them were set
+ */
+func envCredentials (config *config_t) bool {
+    set := false
+    for env, field := range(map[string]*string{service_env_do_key: &config.DO.APIKey, service_env_cf_key: &config.CF.APIKey, service_env_cf_email: &config.CF.Email}) {
+        if val := strings.TrimSpace(os.Getenv(env)); len(val) > 0 { *field, set = val, true }
+    }
+    return set
+}
+
+/*! \brief The command line without -service-install, -service-every and -dry-run, it's what the unit runs
+ */
+func serviceArgs (args []string) []string {
+    kept := make([]string, 0, len(args))
+    for i := 0; i < len(args); i++ {
+        name := strings.TrimLeft(args[i], "-")
+        if !strings.HasPrefix(args[i], "-") || args[i] == "-" || args[i] == "--" {
+            kept = append(kept, args[i])
+            continue
+        }
+        switch {
+        case name == "service-install", name == "service-every":  i++    //its value is the next one
+        case strings.HasPrefix(name, "service-install="), strings.HasPrefix(name, "service-every="), name == "dry-run", strings.HasPrefix(name, "dry-run="):
+        default:
+            kept = append(kept, args[i])
+        }
+    }
+    return kept
+}
+
+/*! \brief Quotes the argument for a systemd command line, % and $ would otherwise be expanded
+ */
+func systemdQuote (arg string) string {
+    arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(arg)
+    return `"` + arg + `"`
+}
+
+/*! \brief A systemd unit, a system one is locked down to what harbormaster needs.  Its output goes to the journal
+ *  On a timer it's a oneshot the timer starts, without an install section of its own
+ */
+func (s service_t) systemdUnit () string {
+    var b bytes.Buffer
+    command := []string{systemdQuote(s.Exe)}
+    for _, arg := range(s.Args) { command = append(command, systemdQuote(arg)) }
+
+    fmt.Fprintf(&b, "[Unit]\nDescription=harbormaster %s\nWants=network-online.target\nAfter=network-online.target\n\n", s.Name)
+    kind := "simple"
+    if s.Every > 0 { kind = "oneshot" }
+    fmt.Fprintf(&b, "[Service]\nType=%s\nExecStart=%s\nWorkingDirectory=%s\n", kind, strings.Join(command, " "), strings.ReplaceAll(s.WorkDir, "%", "%%"))
+    fmt.Fprintf(&b, "EnvironmentFile=-%s\nEnvironment=HARBORMASTER_NO_UPDATE_CHECK=1\n", s.EnvFile)
+    if s.Every == 0 { b.WriteString("Restart=on-failure\nRestartSec=10\n") }
+    fmt.Fprintf(&b, "StandardOutput=journal\nStandardError=journal\nSyslogIdentifier=harbormaster-%s\n", s.Name)
+    b.WriteString("NoNewPrivileges=yes\n")
+    if s.System {
+        if len(s.User) > 0 { fmt.Fprintf(&b, "User=%s\n", s.User) }
+        fmt.Fprintf(&b, "CacheDirectory=harbormaster-%s\nEnvironment=XDG_CACHE_HOME=/var/cache/harbormaster-%s\n", s.Name, s.Name)  //the undo journal and the read cache
+        fmt.Fprintf(&b, "ProtectSystem=strict\nProtectHome=read-only\nReadWritePaths=%s\n", systemdQuote(s.WorkDir))
+        b.WriteString("PrivateTmp=yes\nPrivateDevices=yes\nProtectKernelTunables=yes\nProtectKernelModules=yes\nProtectControlGroups=yes\n")
+        b.WriteString("RestrictAddressFamilies=AF_INET AF_INET6 AF_UNIX\nRestrictNamespaces=yes\nLockPersonality=yes\nMemoryDenyWriteExecute=yes\nCapabilityBoundingSet=\n")
+    }
+    if s.Every == 0 { fmt.Fprintf(&b, "\n[Install]\nWantedBy=%s\n", s.wantedBy("multi-user.target", "default.target")) }
+    return b.String()
+}
+
+/*! \brief The timer that runs the oneshot unit every so often, starting right away
+ */
+func (s service_t) systemdTimer () string {
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "[Unit]\nDescription=harbormaster %s every %s\n\n", s.Name, s.Every)
+    fmt.Fprintf(&b, "[Timer]\nOnActiveSec=0\nOnUnitActiveSec=%ds\nAccuracySec=1s\nUnit=harbormaster-%s.service\n", int(s.Every.Seconds()), s.Name)
+    fmt.Fprintf(&b, "\n[Install]\nWantedBy=%s\n", s.wantedBy("timers.target", "timers.target"))
+    return b.String()
+}
+
+/*! \brief Target the unit is enabled under, for a system or a user unit
+ */
+func (s service_t) wantedBy (system, user string) string {
+    if s.System { return system }
+    return user
+}
+
+/*! \brief A launchd agent, launchd doesn't read env files so sh loads it before running us
+ */
+func (s service_t) launchdPlist () string {
+    esc := func (str string) string {
+        var b bytes.Buffer
+        xml.EscapeText(&b, []byte(str))
+        return b.String()
+    }
+    var b bytes.Buffer
+    b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE plist PUBLIC \"-//Apple//DTD PLIST 1.0//EN\" \"http://www.apple.com/DTDs/PropertyList-1.0.dtd\">\n<plist version=\"1.0\">\n<dict>\n")
+    fmt.Fprintf(&b, "  <key>Label</key>\n  <string>%s</string>\n", esc(service_launchd_label + s.Name))
+    b.WriteString("  <key>ProgramArguments</key>\n  <array>\n")
+    for _, arg := range(append([]string{"/bin/sh", "-c", `set -a; [ -f "$0" ] && . "$0"; set +a; exec "$@"`, s.EnvFile, s.Exe}, s.Args...)) {
+        fmt.Fprintf(&b, "    <string>%s</string>\n", esc(arg))
+    }
+    b.WriteString("  </array>\n")
+    fmt.Fprintf(&b, "  <key>WorkingDirectory</key>\n  <string>%s</string>\n", esc(s.WorkDir))
+    b.WriteString("  <key>EnvironmentVariables</key>\n  <dict>\n    <key>HARBORMASTER_NO_UPDATE_CHECK</key>\n    <string>1</string>\n  </dict>\n")
+    b.WriteString("  <key>RunAtLoad</key>\n  <true/>\n")
+    if s.Every > 0 {
+        fmt.Fprintf(&b, "  <key>StartInterval</key>\n  <integer>%d</integer>\n", int(s.Every.Seconds()))
+    } else {
+        b.WriteString("  <key>KeepAlive</key>\n  <dict>\n    <key>SuccessfulExit</key>\n    <false/>\n  </dict>\n  <key>ThrottleInterval</key>\n  <integer>10</integer>\n")
+    }
+    fmt.Fprintf(&b, "  <key>StandardOutPath</key>\n  <string>%s</string>\n  <key>StandardErrorPath</key>\n  <string>%s</string>\n", esc(s.Log), esc(s.Log))
+    b.WriteString("</dict>\n</plist>\n")
+    return b.String()
+}
+
+/*! \brief Where the unit and env file go on this platform.  Root gets a system unit, anyone else a user one
+ */
+func newService (name, configLoc string, args []string, every time.Duration) (*service_t, error) {
+    if !service_name_check.MatchString(name) { return nil, fmt.Errorf("-service-install '%s' has to be letters, numbers, - and _", name) }
+    if every < 0 || (every > 0 && every < time.Minute) { return nil, fmt.Errorf("-service-every has to be at least a minute") }
+    exe, err := os.Executable()
+    if err == nil { exe, err = filepath.EvalSymlinks(exe) }
+    if err != nil { return nil, fmt.Errorf("Unable to find this binary for the unit :: %s", err.Error()) }
+    configDir, err := os.UserConfigDir()
+    if err != nil { return nil, fmt.Errorf("Unable to find a place for the unit :: %s", err.Error()) }
+
+    s := &service_t{Name: name, Exe: exe, Args: serviceArgs(args), Every: every, WorkDir: filepath.Dir(configLoc), EnvFile: filepath.Join(configDir, "harbormaster", name + ".env")}
+    switch runtime.GOOS {
+    case "linux":
+        s.Unit = filepath.Join(configDir, "systemd", "user", "harbormaster-" + name + ".service")
+        if os.Geteuid() == 0 {
+            s.System, s.User = true, os.Getenv("SUDO_USER")
+            s.Unit, s.EnvFile = filepath.Join("/etc/systemd/system", "harbormaster-" + name + ".service"), filepath.Join("/etc/harbormaster", name + ".env")
+        }
+    case "darwin":
+        home, err := os.UserHomeDir()
+        if err != nil { return nil, fmt.Errorf("Unable to find a place for the unit :: %s", err.Error()) }
+        s.Unit = filepath.Join(home, "Library", "LaunchAgents", service_launchd_label + name + ".plist")
+        s.Log = filepath.Join(home, "Library", "Logs", "harbormaster-" + name + ".log")
+    default:
+        return nil, fmt.Errorf("-service-install writes systemd units and launchd agents, there's neither on %s", runtime.GOOS)
+    }
+    return s, nil
+}
+
+/*! \brief Runs the service manager's command, showing it first
+ */
+func serviceCommand (name string, args ...string) error {
+    fmt.Println(name + " " + strings.Join(args, " "))
+    if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+        return fmt.Errorf("%s %s :: %s %s", name, strings.Join(args, " "), err.Error(), strings.TrimSpace(string(out)))
+    }
+    return nil
+}
+
+  //-------------------------------------------------------------------------------------------------------------------------//
+ //----- SERVICE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Writes the unit for the command line and starts it, along with an env file for the api keys when there isn't one yet
+ *  With every it's run on a timer instead of kept running.  With dryRun the unit is only shown
+ */
+func installService (name, configLoc string, args []string, every time.Duration, dryRun bool) error {
+    s, err := newService(name, configLoc, args, every)
+    if err != nil { return err }
+
+    unit, timer, start := s.systemdUnit(), "", "harbormaster-" + name + ".service"    //what gets enabled and started
+    if runtime.GOOS == "darwin" {
+        unit = s.launchdPlist()
+    } else if every > 0 {
+        timer, start = s.systemdTimer(), "harbormaster-" + name + ".timer"
+    }
+    timerLoc := strings.TrimSuffix(s.Unit, ".service") + ".timer"
+    if dryRun {
+        fmt.Printf("# %s\n%s", s.Unit, unit)
+        if len(timer) > 0 { fmt.Printf("\n# %s\n%s", timerLoc, timer) }
+        fmt.Println("Dry run, nothing was changed")
+        return nil
+    }
+
+    if _, err = os.Stat(s.EnvFile); os.IsNotExist(err) {    //never replaced, it's where the keys are
+        env := fmt.Sprintf("# api keys for harbormaster-%s, they win over the ones in %s\n#%s=\n#%s=\n#%s=\n", name, configLoc, service_env_do_key, service_env_cf_key, service_env_cf_email)
+        if err = os.MkdirAll(filepath.Dir(s.EnvFile), 0700); err == nil { err = ioutil.WriteFile(s.EnvFile, []byte(env), 0600) }
+        if err != nil { return fmt.Errorf("Unable to write the env file '%s' :: %s", s.EnvFile, err.Error()) }
+    }
+    if err = os.MkdirAll(filepath.Dir(s.Unit), 0755); err == nil { err = ioutil.WriteFile(s.Unit, []byte(unit), 0644) }
+    if err != nil { return fmt.Errorf("Unable to write the unit '%s' :: %s", s.Unit, err.Error()) }
+    fmt.Println("Wrote " + s.Unit)
+    if len(timer) > 0 {
+        if err = ioutil.WriteFile(timerLoc, []byte(timer), 0644); err != nil { return fmt.Errorf("Unable to write the timer '%s' :: %s", timerLoc, err.Error()) }
+        fmt.Println("Wrote " + timerLoc)
+    }
+
+    logs := "journalctl -u harbormaster-" + name + " -f"
+    switch {
+    case runtime.GOOS == "darwin":
+        exec.Command("launchctl", "unload", s.Unit).Run()    //when it's being replaced, there's nothing to unload the first time
+        err = serviceCommand("launchctl", "load", "-w", s.Unit)
+        logs = "tail -f " + s.Log
+    case s.System:
+        err = serviceCommand("systemctl", "daemon-reload")
+        if err == nil { err = serviceCommand("systemctl", "enable", "--now", start) }
+        if err == nil { err = serviceCommand("systemctl", "restart", start) }  //so a replaced unit's command line takes
+    default:
+        err = serviceCommand("systemctl", "--user", "daemon-reload")
+        if err == nil { err = serviceCommand("systemctl", "--user", "enable", "--now", start) }
+        if err == nil { err = serviceCommand("systemctl", "--user", "restart", start) }
+        logs = "journalctl --user-unit harbormaster-" + name + " -f"
+    }
+    if err != nil { return err }
+
+    state := "is running"
+    if every > 0 { state = "runs every " + every.String() }
+    fmt.Printf("harbormaster-%s %s.  The api keys can go in %s, the logs are at '%s'\n", name, state, s.EnvFile, logs)
+    if !s.System && runtime.GOOS == "linux" { fmt.Println("User units stop when you log out, unless 'loginctl enable-linger' is run for you") }
+    return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestServiceArgs (t *testing.T) {
+    tests := []struct {
+        args        []string
+        kept        []string
+    }{
+        {[]string{"-service-install", "home", "-service-every", "5m", "-self", "-sd", "home"}, []string{"-self", "-sd", "home"}},
+        {[]string{"-self", "--service-install=home", "-dry-run", "-service-every=1h", "-tag", "worker"}, []string{"-self", "-tag", "worker"}},
+        {[]string{"-dnssync", "-d", "example.com", "-dry-run=true", "-service-install", "sync"}, []string{"-dnssync", "-d", "example.com"}},
+        {[]string{"-self", "-V", "-", "--"}, []string{"-self", "-V", "-", "--"}},
+    }
+
+    for _, tt := range(tests) {
+        if kept := serviceArgs(tt.args); !reflect.DeepEqual(kept, tt.kept) { t.Errorf("serviceArgs(%v) = %v, expecting %v", tt.args, kept, tt.kept) }
+    }
+}
+
+func TestSystemdUnit (t *testing.T) {
+    s := service_t{Name: "home", Exe: "/usr/local/bin/harbormaster", Args: []string{"-self", "-sd", `{hostname}`, "-tag", `a "b" at 50% for $5`}, WorkDir: "/srv/hm", EnvFile: "/etc/harbormaster/home.env", System: true, User: "deploy"}
+    unit := s.systemdUnit()
+    for _, want := range([]string{
+        `ExecStart="/usr/local/bin/harbormaster" "-self" "-sd" "{hostname}" "-tag" "a \"b\" at 50%% for $$5"`,
+        "Type=simple\n", "Restart=on-failure\n", "WorkingDirectory=/srv/hm\n", "EnvironmentFile=-/etc/harbormaster/home.env\n", "User=deploy\n", "ProtectSystem=strict\n", "StandardOutput=journal\n", "WantedBy=multi-user.target\n",
+    }) {
+        if !strings.Contains(unit, want) { t.Errorf("System unit is missing %s\n%s", want, unit) }
+    }
+
+    s.System, s.User = false, ""
+    unit = s.systemdUnit()
+    for _, gone := range([]string{"User=", "ProtectSystem=", "multi-user.target"}) {
+        if strings.Contains(unit, gone) { t.Errorf("User unit has %s\n%s", gone, unit) }
+    }
+
+    s.Every = 5 * time.Minute   //on a timer, the timer is what's installed
+    unit, timer := s.systemdUnit(), s.systemdTimer()
+    for _, want := range([]string{"Type=oneshot\n"}) {
+        if !strings.Contains(unit, want) { t.Errorf("Timer's unit is missing %s\n%s", want, unit) }
+    }
+    for _, gone := range([]string{"Restart=", "[Install]"}) {
+        if strings.Contains(unit, gone) { t.Errorf("Timer's unit has %s\n%s", gone, unit) }
+    }
+    for _, want := range([]string{"OnUnitActiveSec=300s\n", "Unit=harbormaster-home.service\n", "WantedBy=timers.target\n"}) {
+        if !strings.Contains(timer, want) { t.Errorf("Timer is missing %s\n%s", want, timer) }
+    }
+}
+
+func TestLaunchdPlist (t *testing.T) {
+    s := service_t{Name: "home", Exe: "/usr/local/bin/harbormaster", Args: []string{"-self", "-tag", "a<b"}, WorkDir: "/srv/hm", EnvFile: "/Users/me/home.env", Log: "/Users/me/home.log"}
+    tests := []struct {
+        every       time.Duration
+        want        []string
+        gone        []string
+    }{
+        {0, []string{"<string>a&lt;b</string>", "<key>KeepAlive</key>", "<string>/Users/me/home.env</string>"}, []string{"StartInterval"}},
+        {time.Hour, []string{"<key>StartInterval</key>\n  <integer>3600</integer>"}, []string{"KeepAlive"}},
+    }
+
+    for _, tt := range(tests) {
+        s.Every = tt.every
+        plist := s.launchdPlist()
+        for _, want := range(tt.want) {
+            if !strings.Contains(plist, want) { t.Errorf("%s: plist is missing %s\n%s", tt.every, want, plist) }
+        }
+        for _, gone := range(tt.gone) {
+            if strings.Contains(plist, gone) { t.Errorf("%s: plist has %s\n%s", tt.every, gone, plist) }
+        }
+    }
+}
+
+func TestEnvCredentials (t *testing.T) {
+    key := strings.Repeat("a", 64)
+    t.Setenv(service_env_do_key, key)
+    t.Setenv(service_env_cf_key, "")
+    t.Setenv(service_env_cf_email, "")
+
+    config, err := readConfig(filepath.Join(t.TempDir(), config_file_name), false)
+    if err != nil { t.Fatalf("The key from the environment should be enough :: %s", err) }
+    if config.DO.APIKey != key { t.Errorf("Digital ocean key is '%s', expecting the one from the environment", config.DO.APIKey) }
+
+    t.Setenv(service_env_do_key, "")
+    if _, err = readConfig(filepath.Join(t.TempDir(), config_file_name), false); err == nil { t.Error("Expecting an error without a config or keys") }
+}
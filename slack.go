@@ -0,0 +1,333 @@
+/*! \file slack.go
+    \brief Slack slash commands with -slack, so on-call can list nodes and swap a record to its standby from the incident channel
+ *  Requests have to carry slack's signature, each channel only gets the commands the config gives it, and progress is posted as a thread
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os/signal"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "text/tabwriter"
+    "time"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const slack_path        = "/slack/commands"
+const slack_post_url    = "https://slack.com/api/chat.postMessage"
+const slack_max_skew    = 5 * time.Minute   //older requests are refused, so a captured one can't be replayed
+const slack_max_body    = 64 * 1024
+const slack_timeout     = 10 * time.Second
+
+var slack_commands = []string{"node list", "swap"}  //what the channels in the config can be given, help is always allowed
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A record the swap command moves between its primary and standby addresses
+ */
+type slack_swap_t struct {
+    CloudFlare  bool    `json:"cloudflare,omitempty"`
+    Domain      string  `json:"domain,omitempty"`    //the digital ocean domain, or for picking the cloud flare zone
+    SubDomain   string  `json:"sub_domain"`
+    Type        string  `json:"type,omitempty"`  //A when it's not set
+    Primary     string  `json:"primary"`
+    Standby     string  `json:"standby"`
+}
+
+type slack_config_t struct {
+    SigningSecret   string  `json:"signing_secret"`
+    BotToken    string      `json:"bot_token,omitempty"`    //for the threaded progress, without it the updates go to the command's response_url
+    Channels    map[string][]string     `json:"channels"`  //channel id or name to the commands it's allowed, ie "node list", "swap" or "*".  "*" as the channel is every channel
+    Swaps       map[string]slack_swap_t `json:"swaps"`     //by the name used in the command, ie /harbormaster swap api
+}
+
+/*! \brief Where a command's progress is posted, the thread under the first message when there's a bot token
+ */
+type slack_reply_t struct {
+    token       string
+    channel     string
+    ts          string
+    responseURL string
+}
+
+/*! \brief What's needed to run the commands
+ */
+type slack_server_t struct {
+    config      slack_config_t
+    protected   protected_t
+    events      *event_hub_t
+    do          libraries.DO_c
+    cf          libraries.CF_c
+    lock        sync.Mutex  //one command at a time, two people swapping the same record shouldn't race
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func (config slack_config_t) validate () error {
+    if len(config.SigningSecret) == 0 { return fmt.Errorf("No signing_secret in the slack section of the config") }
+    for channel, commands := range(config.Channels) {
+        for _, c := range(commands) {
+            if c != "*" && !hasString(slack_commands, c) { return fmt.Errorf("Unknown command '%s' for channel '%s' in the slack config, expecting %s or *", c, channel, strings.Join(slack_commands, ", ")) }
+        }
+    }
+    for name, s := range(config.Swaps) {
+        if len(s.SubDomain) == 0 || len(s.Primary) == 0 || len(s.Standby) == 0 { return fmt.Errorf("Swap '%s' in the slack config needs a sub_domain, primary and standby", name) }
+        if !s.CloudFlare && len(s.Domain) == 0 { return fmt.Errorf("Swap '%s' in the slack config needs a domain", name) }
+    }
+    return nil
+}
+
+/*! \brief Whether the channel, by id or name, is allowed the command
+ */
+func (config slack_config_t) allowed (channelID, channelName, command string) bool {
+    if command == "help" { return true }
+    for _, key := range([]string{channelID, channelName, "#" + channelName, "*"}) {
+        for _, c := range(config.Channels[key]) {
+            if c == "*" || c == command { return true }
+        }
+    }
+    return false
+}
+
+/*! \brief Checks slack's signature on the request, v0= then the hmac of v0:timestamp:body with the signing secret
+ */
+func slackVerify (secret string, header http.Header, body []byte, now time.Time) error {
+    stamp := header.Get("X-Slack-Request-Timestamp")
+    secs, err := strconv.ParseInt(stamp, 10, 64)
+    if err != nil { return fmt.Errorf("Missing the request timestamp") }
+    if skew := now.Sub(time.Unix(secs, 0)); skew > slack_max_skew || skew < -slack_max_skew { return fmt.Errorf("Request timestamp is %s off", skew.Round(time.Second)) }
+
+    mac := hmac.New(sha256.New, []byte(secret))
+    fmt.Fprintf(mac, "v0:%s:", stamp)
+    mac.Write(body)
+    want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+    if !hmac.Equal([]byte(want), []byte(header.Get("X-Slack-Signature"))) { return fmt.Errorf("Bad signature") }
+    return nil
+}
+
+func slackSend (req *http.Request) ([]byte, error) {
+    client := &http.Client{Timeout: slack_timeout}
+    resp, err := client.Do(req)
+    if err != nil { return nil, err }
+    defer resp.Body.Close()
+    data, err := ioutil.ReadAll(resp.Body)
+    if err == nil && resp.StatusCode != http.StatusOK { err = fmt.Errorf("status code %d from slack :: %s", resp.StatusCode, strings.TrimSpace(string(data))) }
+    return data, err
+}
+
+/*! \brief Posts the text, the first post with a bot token starts the thread the rest go in.  Failing to post is only printed, the command carries on
+ */
+func (reply *slack_reply_t) post (text string) {
+    var req *http.Request
+    var err error
+    if len(reply.token) > 0 {
+        body := map[string]string{"channel": reply.channel, "text": text}
+        if len(reply.ts) > 0 { body["thread_ts"] = reply.ts }
+        jStr, _ := json.Marshal(body)
+        if req, err = http.NewRequest("POST", slack_post_url, bytes.NewReader(jStr)); err == nil { req.Header.Set("Authorization", "Bearer " + reply.token) }
+    } else {
+        jStr, _ := json.Marshal(map[string]string{"response_type": "in_channel", "text": text})
+        req, err = http.NewRequest("POST", reply.responseURL, bytes.NewReader(jStr))
+    }
+    if err == nil {
+        req.Header.Set("Content-Type", "application/json; charset=utf-8")
+        var data []byte
+        if data, err = slackSend(req); err == nil && len(reply.token) > 0 {
+            var resp struct {
+                OK      bool    `json:"ok"`
+                Error   string  `json:"error"`
+                TS      string  `json:"ts"`
+            }
+            if err = json.Unmarshal(data, &resp); err == nil && !resp.OK { err = fmt.Errorf("slack said %s", resp.Error) }
+            if err == nil && len(reply.ts) == 0 { reply.ts = resp.TS }
+        }
+    }
+    if err != nil { fmt.Printf("Unable to post to slack :: %s\n", err.Error()) }
+}
+
+func slackHelp (config slack_config_t, channelID, channelName string) string {
+    lines := []string{"`help` what you can run here"}
+    if config.allowed(channelID, channelName, "node list") { lines = append(lines, "`node list [tag]` the nodes, only the ones with the tag when it's given") }
+    if config.allowed(channelID, channelName, "swap") {
+        names := make([]string, 0, len(config.Swaps))
+        for name := range(config.Swaps) { names = append(names, name) }
+        sort.Strings(names)
+        lines = append(lines, fmt.Sprintf("`swap %s [primary|standby]` points the record at the other address, or the one given", strings.Join(names, "|")))
+    }
+    return strings.Join(lines, "\n")
+}
+
+func (s *slack_server_t) nodeList (tag string) (string, error) {
+    nodes, err := s.do.ListNodes(tag, "")
+    if err != nil { return "", err }
+    if len(nodes) == 0 { return "No nodes found", nil }
+
+    var b bytes.Buffer
+    tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(tw, "NAME\tIP\tSIZE\tREGION\tSTATUS")
+    for _, n := range(nodes) { fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", n.Name, n.IP, n.Size, n.Region, n.Status) }
+    tw.Flush()
+    return "```\n" + b.String() + "```", nil
+}
+
+/*! \brief Points the swap's record at the other address, or the primary or standby when that's given
+ */
+func (s *slack_server_t) swap (name, to string, reply *slack_reply_t) error {
+    sw, ok := s.config.Swaps[name]
+    if !ok { return fmt.Errorf("There's no swap named '%s'", name) }
+    if len(sw.Type) == 0 { sw.Type = "A" }
+    opts := failover_t{CloudFlare: sw.CloudFlare, Domain: sw.Domain, SubDomain: sw.SubDomain, Type: sw.Type, Primary: sw.Primary, Standby: sw.Standby}
+
+    cf := s.cf
+    if sw.CloudFlare {
+        if err := cf.SelectZone("", sw.Domain); err != nil { return err }
+    }
+    if err := s.protected.checkDNS(cf, sw.CloudFlare, sw.Domain, sw.SubDomain); err != nil { return err }
+
+    current, ttl, proxied, err := opts.record(s.do, cf)
+    if err != nil { return err }
+    if proxied { ttl = 0 }  //keeps what cloud flare has
+
+    target := sw.Standby
+    switch to {
+    case "primary":     target = sw.Primary
+    case "standby":     target = sw.Standby
+    case "":            if current == sw.Standby { target = sw.Primary }
+    default:            return fmt.Errorf("Swap to '%s'? expecting primary or standby", to)
+    }
+    if current == target {
+        reply.post(fmt.Sprintf("%s already points at %s, nothing to do", sw.SubDomain, current))
+        return nil
+    }
+
+    reply.post(fmt.Sprintf("%s points at %s, switching it to %s", sw.SubDomain, current, target))
+    if err = opts.update(s.do, cf, target, ttl); err != nil { return err }
+    fmt.Printf("%s %s -> %s, from slack\n", time.Now().Format("2006-01-02 15:04:05"), sw.SubDomain, target)
+    s.events.publish("failover.triggered", sw.SubDomain, fmt.Sprintf("%s -> %s, from slack", current, target))
+    s.events.publish("dns.updated", sw.SubDomain, fmt.Sprintf("%s %s -> %s", sw.Type, current, target))
+    reply.post(fmt.Sprintf("Done, %s points at %s", sw.SubDomain, target))
+    return nil
+}
+
+/*! \brief Runs the command after the request has been answered, slack only waits 3 seconds for that
+ */
+func (s *slack_server_t) run (user string, args []string, reply *slack_reply_t) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    reply.post(fmt.Sprintf("<@%s> ran `%s`", user, strings.Join(args, " ")))
+    var err error
+    switch {
+    case len(args) >= 2 && args[0] == "node" && args[1] == "list":
+        tag := ""
+        if len(args) > 2 { tag = args[2] }
+        var list string
+        if list, err = s.nodeList(tag); err == nil { reply.post(list) }
+
+    case args[0] == "swap" && len(args) >= 2:
+        to := ""
+        if len(args) > 2 { to = strings.ToLower(args[2]) }
+        err = s.swap(args[1], to, reply)
+    }
+    if err != nil { reply.post("FAILED :: " + err.Error()) }
+}
+
+func (s *slack_server_t) ServeHTTP (w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+        http.Error(w, "slash commands are posted", http.StatusMethodNotAllowed)
+        return
+    }
+    body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, slack_max_body))
+    if err == nil { err = slackVerify(s.config.SigningSecret, r.Header, body, time.Now()) }
+    if err != nil {
+        fmt.Printf("Refused a slack request from %s :: %s\n", r.RemoteAddr, err.Error())
+        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        return
+    }
+    form, err := url.ParseQuery(string(body))
+    if err != nil {
+        http.Error(w, "bad request", http.StatusBadRequest)
+        return
+    }
+
+    respond := func (text string) {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": text})
+    }
+
+    args := strings.Fields(form.Get("text"))
+    for i := 0; i < len(args) && i < 2; i++ { args[i] = strings.ToLower(args[i]) }   //the command, tags and swap names are left as they are
+    channelID, channelName := form.Get("channel_id"), form.Get("channel_name")
+    command := "help"
+    if len(args) >= 2 && args[0] == "node" && args[1] == "list" {
+        command = "node list"
+    } else if len(args) > 0 && args[0] == "swap" {
+        command = "swap"
+    }
+
+    switch {
+    case command == "help":
+        respond(slackHelp(s.config, channelID, channelName))
+    case !s.config.allowed(channelID, channelName, command):
+        respond(fmt.Sprintf("`%s` isn't allowed in this channel", command))
+    case command == "swap" && len(args) < 2:
+        respond(slackHelp(s.config, channelID, channelName))
+    default:
+        fmt.Printf("%s slack %s in %s :: %s\n", time.Now().Format("2006-01-02 15:04:05"), form.Get("user_name"), channelName, strings.Join(args, " "))
+        reply := &slack_reply_t{token: s.config.BotToken, channel: channelID, responseURL: form.Get("response_url")}
+        go s.run(form.Get("user_id"), args, reply)
+        respond("On it")
+    }
+}
+
+/*! \brief Answers slash commands on the address until ctrl-c or the -timeout
+ */
+func serveSlack (addr string, config config_t, events *event_hub_t, do libraries.DO_c, cf libraries.CF_c) error {
+    if err := config.Slack.validate(); err != nil { return err }
+
+    parent := do.Ctx
+    if parent == nil { parent = context.Background() }
+    ctx, stop := signal.NotifyContext(parent, os.Interrupt)
+    defer stop()
+    do.Ctx, cf.Ctx = ctx, ctx
+
+    mux := http.NewServeMux()
+    mux.Handle(slack_path, &slack_server_t{config: config.Slack, protected: config.Protected, events: events, do: do, cf: cf})
+    server := &http.Server{Addr: addr, Handler: mux}
+
+    errs := make(chan error, 1)
+    go func () { errs <- server.ListenAndServe() }()
+    fmt.Printf("Answering slack commands on %s%s\n", addr, slack_path)
+
+    select {
+    case err := <-errs:
+        return fmt.Errorf("Unable to answer slack commands on '%s' :: %s", addr, err.Error())
+    case <-ctx.Done():
+    }
+    shutdown, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+    defer cancel()
+    return server.Shutdown(shutdown)
+}
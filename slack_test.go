@@ -0,0 +1,43 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+func TestSlackSwap (t *testing.T) {
+    swap := slack_swap_t{Domain: "example.com", SubDomain: "api", Primary: "192.0.2.10", Standby: "192.0.2.20"}
+    do, records := stubRecords(t, libraries.DO_record_t{ID: 1, Type: "A", Name: "api", Data: swap.Primary, TTL: 60})
+    var posts int32
+    slack := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) { atomic.AddInt32(&posts, 1) }))
+    defer slack.Close()
+
+    var config config_t
+    s := &slack_server_t{config: slack_config_t{Swaps: map[string]slack_swap_t{"api": swap}}, protected: config.Protected, do: do}
+
+    tests := []struct {
+        name        string
+        swap        string
+        to          string
+        points      string      //where the record ends up
+        fails       bool
+    }{
+        {"to the standby", "api", "", swap.Standby, false},
+        {"already there", "api", "standby", swap.Standby, false},
+        {"back again", "api", "", swap.Primary, false},
+        {"named", "api", "standby", swap.Standby, false},
+        {"sideways", "api", "sideways", swap.Standby, true},
+        {"unknown swap", "web", "", swap.Standby, true},
+    }
+
+    for _, tt := range(tests) {
+        err := s.swap(tt.swap, tt.to, &slack_reply_t{responseURL: slack.URL})
+        if tt.fails != (err != nil) { t.Errorf("%s: error %v", tt.name, err) }
+        if rec := records.get(t, "api"); rec.Data != tt.points { t.Errorf("%s: points at %s, expecting %s", tt.name, rec.Data, tt.points) }
+    }
+    if atomic.LoadInt32(&posts) == 0 { t.Error("Nothing was posted back to slack") }
+}
@@ -0,0 +1,166 @@
+/*! \file status.go
+    \brief A static status page for a stack with -status-page, the health checks boiled down to json and html and uploaded to spaces or r2
+ *  With -watch it's republished every -interval, so stakeholders get a status page without anything new to run
+*/
+
+package main
+
+import (
+    "fmt"
+    "bytes"
+    "context"
+    "strings"
+    "time"
+    "html/template"
+    "encoding/json"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const status_json   = "status.json"
+const status_html   = "index.html"
+
+var status_page = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<title>{{.Name}} status</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; color: #222; }
+.ok { color: #1a7f37; } .down { color: #cf222e; }
+table { border-collapse: collapse; width: 100%; } td, th { text-align: left; padding: 0.3em 0.5em; border-bottom: 1px solid #ddd; }
+</style>
+</head>
+<body>
+<h1>{{.Name}} is <span class="{{if .Healthy}}ok">up{{else}}down">degraded{{end}}</span></h1>
+<table>
+<tr><th>Nodes up</th><td>{{.Nodes.Up}} of {{.Nodes.Total}}</td></tr>
+<tr><th>Load balancers healthy</th><td>{{.Balancers.Up}} of {{.Balancers.Total}}</td></tr>
+<tr><th>DNS resolving</th><td>{{.DNS.Up}} of {{.DNS.Total}}</td></tr>
+</table>
+<h2>Checks</h2>
+<table>
+{{range .Checks}}<tr><td>{{.Check}}</td><td>{{.Target}}</td><td class="{{if .OK}}ok">ok{{else}}down">down{{end}}</td></tr>
+{{end}}</table>
+<p>Updated {{.Updated.Format "2006-01-02 15:04:05 MST"}}</p>
+</body>
+</html>
+`))
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+type status_count_t struct {
+    Up          int     `json:"up"`
+    Total       int     `json:"total"`
+}
+
+/*! \brief One check on the page, no addresses or errors as it's public
+ */
+type status_check_t struct {
+    Check       string  `json:"check"`
+    Target      string  `json:"target"`
+    OK          bool    `json:"ok"`
+}
+
+type status_t struct {
+    Name        string      `json:"name"`
+    Updated     time.Time   `json:"updated"`
+    Healthy     bool        `json:"healthy"`
+    Nodes       status_count_t  `json:"nodes"`     //node and floating-ip checks
+    Balancers   status_count_t  `json:"balancers"`
+    DNS         status_count_t  `json:"dns"`
+    Checks      []status_check_t    `json:"checks"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+func buildStatus (name string, results []health_result_t) status_t {
+    status := status_t{Name: name, Updated: time.Now().UTC(), Healthy: true, Checks: make([]status_check_t, 0, len(results))}
+    for _, r := range(results) {
+        var count *status_count_t
+        switch r.Check {
+        case "balancer":    count = &status.Balancers
+        case "dns":         count = &status.DNS
+        default:            count = &status.Nodes
+        }
+        count.Total++
+        if r.OK {
+            count.Up++
+        } else {
+            status.Healthy = false
+        }
+        status.Checks = append(status.Checks, status_check_t{Check: r.Check, Target: r.Target, OK: r.OK})
+    }
+    return status
+}
+
+/*! \brief Splits 'spaces:bucket/prefix' or 'r2:bucket/prefix' up
+ */
+func parseStatusDest (dest string) (kind, bucket, prefix string, err error) {
+    parts := strings.SplitN(dest, ":", 2)
+    if len(parts) != 2 || (parts[0] != "spaces" && parts[0] != "r2") { return "", "", "", fmt.Errorf("-status-page '%s' should be spaces:<bucket>/<prefix> or r2:<bucket>/<prefix>", dest) }
+    kind = parts[0]
+    bucket, prefix = parts[1], ""
+    if i := strings.Index(bucket, "/"); i >= 0 { bucket, prefix = bucket[:i], strings.Trim(bucket[i+1:], "/") }
+    if len(bucket) == 0 { return "", "", "", fmt.Errorf("-status-page '%s' doesn't have a bucket", dest) }
+    if len(prefix) > 0 { prefix += "/" }
+    return
+}
+
+/*! \brief Runs the health checks and uploads the page and its json, a check failing is what the page is for so only the run itself failing is an error
+ */
+func publishStatus (dest, region string, cloudflare bool, domain, tag, stack, healthURL string, concurrency int, dryRun bool, do libraries.DO_c, cf libraries.CF_c) (*status_t, error) {
+    kind, bucket, prefix, err := parseStatusDest(dest)
+    if err != nil { return nil, err }
+    if kind == "spaces" && len(region) == 0 { return nil, fmt.Errorf("Region not set for the space.  use the -region option") }
+
+    results, err := runHealthChecks(do, cf, cloudflare, domain, tag, stack, healthURL, concurrency)
+    if err != nil { return nil, err }
+    name := stack
+    if len(name) == 0 { name = tag }
+    status := buildStatus(name, results)
+
+    jStr, _ := json.MarshalIndent(status, "", "  ")
+    var page bytes.Buffer
+    if err = status_page.Execute(&page, status); err != nil { return nil, err }
+
+    fmt.Printf("%s %s, %d/%d nodes, %d/%d balancers, %d/%d dns\n", status.Updated.Local().Format("2006-01-02 15:04:05"), healthStatus(status.Healthy),
+        status.Nodes.Up, status.Nodes.Total, status.Balancers.Up, status.Balancers.Total, status.DNS.Up, status.DNS.Total)
+    if dryRun { return &status, nil }
+
+    upload := func (key string, data []byte, contentType string) error {
+        if kind == "r2" { return cf.UploadObject(bucket, prefix + key, data, contentType) }
+        return do.UploadObject(bucket, region, prefix + key, data, contentType)
+    }
+    if err = upload(status_json, jStr, "application/json"); err != nil { return nil, err }
+    if err = upload(status_html, page.Bytes(), "text/html; charset=utf-8"); err != nil { return nil, err }
+    return &status, nil
+}
+
+/*! \brief Republishes the page every interval until ctrl-c or the -timeout, the stack going up or down is sent as health.changed
+ */
+func watchStatus (dest, region string, cloudflare bool, domain, tag, stack, healthURL string, concurrency int, interval time.Duration, dryRun bool, events *event_hub_t, do libraries.DO_c, cf libraries.CF_c) error {
+    var last *status_t
+    return watchEvery(interval, do.Ctx, func (ctx context.Context) error {
+        do.Ctx, cf.Ctx = ctx, ctx
+        status, err := publishStatus(dest, region, cloudflare, domain, tag, stack, healthURL, concurrency, dryRun, do, cf)
+        if err != nil { return err }
+        if last != nil && last.Healthy != status.Healthy {
+            detail := "degraded"
+            if status.Healthy { detail = "up" }
+            events.publish("health.changed", status.Name, fmt.Sprintf("%s, %d/%d nodes, %d/%d balancers, %d/%d dns", detail,
+                status.Nodes.Up, status.Nodes.Total, status.Balancers.Up, status.Balancers.Total, status.DNS.Up, status.DNS.Total))
+        }
+        last = status
+        return nil
+    })
+}
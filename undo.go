@@ -0,0 +1,97 @@
+/*! \file undo.go
+    \brief Undoing the last dns change, the records are noted before every change a run makes and -undo puts them back
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "time"
+    "path/filepath"
+    "encoding/json"
+    "io/ioutil"
+
+    "github.com/NathanRThomas/harbormaster/libraries"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const undo_keep     = 20    //runs we can go back through
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief A run that changed records, with what they were before it did
+ */
+type undo_entry_t struct {
+    Time        time.Time   `json:"time"`
+    By          string      `json:"by"`
+    Args        []string    `json:"args"`
+    Records     []libraries.DNS_snapshot_t  `json:"records"`  //in the order they were changed
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Where the undo entries are kept, next to the update check
+ */
+func undoFile () (string, error) {
+    dir, err := os.UserCacheDir()
+    if err != nil { return "", fmt.Errorf("Unable to find a place for the undo file :: %s", err.Error()) }
+    return filepath.Join(dir, "harbormaster", "undo.json"), nil
+}
+
+func readUndo (loc string) ([]undo_entry_t, error) {
+    entries := make([]undo_entry_t, 0)
+    data, err := ioutil.ReadFile(loc)
+    if os.IsNotExist(err) { return entries, nil }
+    if err != nil { return nil, fmt.Errorf("Unable to read '%s' :: %s", loc, err.Error()) }
+    if err = json.Unmarshal(data, &entries); err != nil { return nil, fmt.Errorf("Invalid undo file '%s' :: %s", loc, err.Error()) }
+    return entries, nil
+}
+
+func writeUndo (loc string, entries []undo_entry_t) error {
+    if len(entries) > undo_keep { entries = entries[len(entries) - undo_keep:] }
+    jStr, _ := json.MarshalIndent(entries, "", "  ")
+    os.MkdirAll(filepath.Dir(loc), 0755)
+    if err := ioutil.WriteFile(loc, jStr, 0600); err != nil { return fmt.Errorf("Unable to write '%s' :: %s", loc, err.Error()) }
+    return nil
+}
+
+/*! \brief Adds the records the run changed as the newest entry, so -undo can put them back
+ */
+func saveUndo (journal *libraries.DNS_journal_t) error {
+    records := journal.Records()
+    if len(records) == 0 { return nil }
+
+    loc, err := undoFile()
+    if err != nil { return err }
+    entries, err := readUndo(loc)
+    if err != nil { return err }
+    entries = append(entries, undo_entry_t{Time: time.Now().UTC(), By: historyBy(), Args: os.Args[1:], Records: records})
+    return writeUndo(loc, entries)
+}
+
+/*! \brief Puts the records from the most recent run that changed dns back the way they were before it
+ *  They're restored newest first, so a record the run changed twice ends up how it started.  The entry is only dropped once everything is back
+ */
+func undoLast (do libraries.DO_c, cf libraries.CF_c, dryRun bool) error {
+    loc, err := undoFile()
+    if err != nil { return err }
+    entries, err := readUndo(loc)
+    if err != nil { return err }
+    if len(entries) == 0 { return fmt.Errorf("There are no dns changes to undo") }
+
+    last := entries[len(entries) - 1]
+    fmt.Printf("Undoing harbormaster %v by %s at %s\n", last.Args, last.By, last.Time.Local().Format("2006-01-02 15:04:05"))
+    snaps := make([]libraries.DNS_snapshot_t, 0, len(last.Records))
+    for i := len(last.Records) - 1; i >= 0; i-- { snaps = append(snaps, last.Records[i]) }
+
+    if err = restoreSnapshots(snaps, do, cf, dryRun); err != nil || dryRun { return err }
+    return writeUndo(loc, entries[:len(entries) - 1])
+}
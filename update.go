@@ -0,0 +1,212 @@
+/*! \file update.go
+    \brief Keeping harbormaster current from the github releases, -self-update replaces the binary and runs let you know when there's a newer one
+ *  The release's checksums.txt has to be signed by someone in the allowed signers file, and the download has to match it
+*/
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "runtime"
+    "strconv"
+    "strings"
+    "time"
+    "net/http"
+    "path/filepath"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io/ioutil"
+)
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- CONSTS ------------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+const update_latest_url     = "https://api.github.com/repos/NathanRThomas/harbormaster/releases/latest"
+const update_checksums      = "checksums.txt"
+const update_namespace      = "harbormaster-release"
+const update_check_every    = 24 * time.Hour
+const update_check_timeout  = 3 * time.Second   //the notice isn't worth holding up a run for
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- STRUCTS -----------------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief The update section of the config
+ */
+type update_config_t struct {
+    AllowedSigners  string  `json:"allowed_signers"`  //ssh allowed signers file the release checksums are checked against, -allowed-signers wins
+    NoCheck         bool    `json:"no_check"`    //no new version notices, HARBORMASTER_NO_UPDATE_CHECK does the same
+}
+
+type update_release_t struct {
+    Tag         string  `json:"tag_name"`
+    Assets      []struct {
+        Name    string  `json:"name"`
+        URL     string  `json:"browser_download_url"`
+    }   `json:"assets"`
+}
+
+//-------------------------------------------------------------------------------------------------------------------------//
+//----- PRIVATE FUNCTIONS -------------------------------------------------------------------------------------------------//
+//-------------------------------------------------------------------------------------------------------------------------//
+
+/*! \brief Client that goes around the budget, recorder and the rest, none of this is part of the run
+ */
+func updateClient (timeout time.Duration) *http.Client {
+    return &http.Client{Timeout: timeout, Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+}
+
+func updateGet (client *http.Client, url string) ([]byte, error) {
+    resp, err := client.Get(url)
+    if err != nil { return nil, err }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK { return nil, fmt.Errorf("status code %d from %s", resp.StatusCode, url) }
+    return ioutil.ReadAll(resp.Body)
+}
+
+func latestRelease (client *http.Client) (*update_release_t, error) {
+    data, err := updateGet(client, update_latest_url)
+    if err != nil { return nil, fmt.Errorf("Unable to get the latest release :: %s", err.Error()) }
+    release := &update_release_t{}
+    return release, json.Unmarshal(data, release)
+}
+
+/*! \brief True when version a is older than b, ie 0.4.1700000000 and v0.4.1710000000.  Missing parts are 0
+ */
+func olderVersion (a, b string) bool {
+    pa, pb := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+    for i := 0; i < len(pa) || i < len(pb); i++ {
+        var na, nb int
+        if i < len(pa) { na, _ = strconv.Atoi(pa[i]) }
+        if i < len(pb) { nb, _ = strconv.Atoi(pb[i]) }
+        if na != nb { return na < nb }
+    }
+    return false
+}
+
+/*! \brief Name of the release asset for this platform, like the Makefile's release target makes
+ */
+func updateAssetName () string {
+    name := "harbormaster-" + runtime.GOOS + "-" + runtime.GOARCH
+    if runtime.GOOS == "windows" { name += ".exe" }
+    return name
+}
+
+/*! \brief Where we note the last time we looked for a new version
+ */
+func updateStampFile () string {
+    dir, err := os.UserCacheDir()
+    if err != nil { return "" }
+    return filepath.Join(dir, "harbormaster", "update_check")
+}
+
+/*! \brief Starts looking for a newer release in the background, at most once a day.  Dev builds without a version don't look
+ *  The run isn't held up by it, nil when there's nothing to look for
+ */
+func startUpdateCheck (config update_config_t, version string) <-chan string {
+    if config.NoCheck || len(os.Getenv("HARBORMASTER_NO_UPDATE_CHECK")) > 0 || len(minversion) == 0 { return nil }
+    stamp := updateStampFile()
+    if len(stamp) == 0 { return nil }
+    if info, err := os.Stat(stamp); err == nil && time.Since(info.ModTime()) < update_check_every { return nil }
+
+    notice := make(chan string, 1)
+    go func () {
+        release, err := latestRelease(updateClient(update_check_timeout))
+        if err == nil && olderVersion(version, release.Tag) {
+            notice <- fmt.Sprintf("harbormaster %s is available, you have %s.  use -self-update to get it", release.Tag, version)
+        } else {
+            notice <- ""
+        }
+    }()
+    return notice
+}
+
+/*! \brief Lets them know there's a newer release on stderr, if the check has finished by now.  Otherwise the next run looks again
+ */
+func updateNotice (notice <-chan string) {
+    if notice == nil { return }
+    select {
+    case msg := <-notice:
+        if stamp := updateStampFile(); len(stamp) > 0 {    //even when it failed, so we don't keep trying on every run
+            os.MkdirAll(filepath.Dir(stamp), 0755)
+            ioutil.WriteFile(stamp, []byte(time.Now().UTC().Format(time.RFC3339)), 0644)
+        }
+        if len(msg) > 0 { fmt.Fprintln(os.Stderr, msg) }
+    default:
+    }
+}
+
+/*! \brief Downloads the latest release for this platform, checks it and replaces the running binary with it
+ */
+func selfUpdate (config update_config_t, allowedSigners, version string, dryRun bool) error {
+    if len(allowedSigners) == 0 { allowedSigners = config.AllowedSigners }
+    if len(allowedSigners) == 0 { return fmt.Errorf("Updates have to be checked against who signs releases.  use the -allowed-signers option or set allowed_signers in the update section of the config") }
+
+    client := updateClient(5 * time.Minute)
+    release, err := latestRelease(client)
+    if err != nil { return err }
+    if !olderVersion(version, release.Tag) {
+        fmt.Printf("Already on the latest, %s\n", version)
+        return nil
+    }
+
+    urls := make(map[string]string)
+    for _, a := range(release.Assets) { urls[a.Name] = a.URL }
+    asset := updateAssetName()
+    for _, name := range([]string{asset, update_checksums, update_checksums + ".sig"}) {
+        if len(urls[name]) == 0 { return fmt.Errorf("Release %s doesn't have %s", release.Tag, name) }
+    }
+    fmt.Printf("Updating from %s to %s\n", version, release.Tag)
+    if dryRun { return nil }
+
+    sums, err := updateGet(client, urls[update_checksums])
+    if err != nil { return err }
+    sig, err := updateGet(client, urls[update_checksums + ".sig"])
+    if err != nil { return err }
+
+    sigFile, err := ioutil.TempFile("", "harbormaster-sig")
+    if err != nil { return err }
+    defer os.Remove(sigFile.Name())
+    sigFile.Write(sig)
+    sigFile.Close()
+
+    principal, err := sshKeygen(nil, "-Y", "find-principals", "-f", allowedSigners, "-s", sigFile.Name())
+    if err != nil { return fmt.Errorf("The release wasn't signed by anyone in '%s' :: %s", allowedSigners, err.Error()) }
+    out, err := sshKeygen(sums, "-Y", "verify", "-f", allowedSigners, "-I", strings.SplitN(principal, "\n", 2)[0], "-n", update_namespace, "-s", sigFile.Name())
+    if err != nil { return err }
+    fmt.Println(out)
+
+    want := ""
+    for _, line := range(strings.Split(string(sums), "\n")) {     //sha256sum's format, '<hash>  <name>'
+        if f := strings.Fields(line); len(f) == 2 && strings.TrimPrefix(f[1], "*") == asset { want = f[0] }
+    }
+    if len(want) == 0 { return fmt.Errorf("%s isn't in the release's %s", asset, update_checksums) }
+
+    binary, err := updateGet(client, urls[asset])
+    if err != nil { return err }
+    sum := sha256.Sum256(binary)
+    if hex.EncodeToString(sum[:]) != want { return fmt.Errorf("The download of %s doesn't match its checksum, not installing it", asset) }
+
+    exe, err := os.Executable()
+    if err == nil { exe, err = filepath.EvalSymlinks(exe) }
+    if err != nil { return fmt.Errorf("Unable to find the running binary :: %s", err.Error()) }
+
+    tmp := exe + ".new"
+    if err = ioutil.WriteFile(tmp, binary, 0755); err != nil { return fmt.Errorf("Unable to write '%s' :: %s", tmp, err.Error()) }
+    old := exe + ".old"
+    os.Remove(old)
+    if err = os.Rename(exe, old); err != nil {     //windows won't replace a running binary, but it will move it
+        os.Remove(tmp)
+        return fmt.Errorf("Unable to replace '%s' :: %s", exe, err.Error())
+    }
+    if err = os.Rename(tmp, exe); err != nil {
+        os.Rename(old, exe)
+        return fmt.Errorf("Unable to replace '%s' :: %s", exe, err.Error())
+    }
+    os.Remove(old)  //fails on windows while we're running, the next update clears it out
+    fmt.Println("Updated " + exe)
+    return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestOlderVersion (t *testing.T) {
+    tests := []struct {
+        a, b        string
+        older       bool
+    }{
+        {"0.4.1700000000", "v0.4.1710000000", true},
+        {"v0.4.1710000000", "0.4.1700000000", false},
+        {"0.4.1700000000", "0.4.1700000000", false},
+        {"0.4", "0.4.1", true},         //missing parts are 0
+        {"0.4.0", "0.4", false},
+        {"0.9.9", "0.10.0", true},      //by number, not as strings
+        {"1.0.0", "0.99.99", false},
+        {"dev", "0.0.1", true},
+        {"", "", false},
+    }
+
+    for _, tt := range(tests) {
+        if got := olderVersion(tt.a, tt.b); got != tt.older { t.Errorf("olderVersion(%s, %s) = %v, expecting %v", tt.a, tt.b, got, tt.older) }
+    }
+}